@@ -4,6 +4,15 @@ go 1.16
 
 require (
 	github.com/aws/aws-sdk-go v1.34.8
+	github.com/aws/aws-sdk-go-v2 v1.16.16
+	github.com/aws/aws-sdk-go-v2/service/dynamodb v1.17.1
+	github.com/aws/aws-sdk-go-v2/service/kinesis v1.15.19
+	github.com/awslabs/kinesis-aggregation/go v0.0.0-20201211133042-142dfe1d7a6d
+	github.com/golang/protobuf v1.3.1
+	github.com/lib/pq v1.10.9
+	github.com/mattn/go-sqlite3 v1.14.16
 	github.com/stretchr/testify v1.7.0
 	github.com/vmware/vmware-go-kcl v1.3.0
+	go.etcd.io/bbolt v1.3.6
+	gopkg.in/yaml.v3 v3.0.0-20200313102051-9f266ea9e77c
 )
@@ -0,0 +1,164 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	dynamodbv2 "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	kinesisv2 "github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/defaults"
+)
+
+// NewConfig creates a configuration for aws-sdk-go-v2 clients. They use the same endpoints,
+// credentials, http client and retries as the clients of the sessions created by NewSession,
+// so both sdk generations can be used side by side.
+func NewConfig(configuration Configuration) (aws.Config, error) {
+	configCredentials, err := NewCredentials(configuration)
+	if err != nil {
+		return aws.Config{}, errors.New("could not create aws config")
+	}
+	return newConfig(configuration, configCredentials)
+}
+
+// NewKinesisConfig creates a configuration for aws-sdk-go-v2 kinesis clients, which assumes
+// the kinesis role when it is set.
+func NewKinesisConfig(configuration Configuration) (aws.Config, error) {
+	kinesisCredentials, err := NewKinesisCredentials(configuration)
+	if err != nil {
+		return aws.Config{}, errors.New("could not create aws config")
+	}
+	return newConfig(configuration, kinesisCredentials)
+}
+
+// NewDynamoDBConfig creates a configuration for aws-sdk-go-v2 dynamodb clients, which assumes
+// the dynamodb role when it is set.
+func NewDynamoDBConfig(configuration Configuration) (aws.Config, error) {
+	dynamoDBCredentials, err := NewDynamoDBCredentials(configuration)
+	if err != nil {
+		return aws.Config{}, errors.New("could not create aws config")
+	}
+	return newConfig(configuration, dynamoDBCredentials)
+}
+
+// NewKinesisClientV2 creates a new aws-sdk-go-v2 kinesis client.
+func NewKinesisClientV2(config aws.Config) *kinesisv2.Client {
+	return kinesisv2.NewFromConfig(config)
+}
+
+// NewDynamoDBClientV2 creates a new aws-sdk-go-v2 dynamodb client.
+func NewDynamoDBClientV2(config aws.Config) *dynamodbv2.Client {
+	return dynamodbv2.NewFromConfig(config)
+}
+
+// newConfig creates an aws-sdk-go-v2 configuration with the given credentials. When there are
+// none it uses the sdk default credentials chain, like the sessions do.
+func newConfig(configuration Configuration, configCredentials *credentials.Credentials) (aws.Config, error) {
+	if configCredentials == nil {
+		configCredentials = defaults.CredChain(defaults.Config(), defaults.Handlers())
+	}
+	httpClient, err := configuration.HTTP.newHTTPClient()
+	if err != nil {
+		log.Println("msg", "invalid aws config", "error", err)
+		return aws.Config{}, errors.New("could not create aws config")
+	}
+	config := aws.Config{
+		Region:                      configuration.Region,
+		Credentials:                 &credentialsProvider{credentials: configCredentials},
+		HTTPClient:                  httpClient,
+		EndpointResolverWithOptions: configuration.endpointResolverV2(),
+	}
+	if configuration.Retry.isSet() {
+		retryer, err := configuration.Retry.newRetryer()
+		if err != nil {
+			log.Println("msg", "invalid aws config", "error", err)
+			return aws.Config{}, errors.New("could not create aws config")
+		}
+		config.Retryer = func() aws.Retryer {
+			return retry.NewStandard(func(options *retry.StandardOptions) {
+				// v2 counts the first attempt, v1 only the retries.
+				options.MaxAttempts = retryer.NumMaxRetries + 1
+				options.MaxBackoff = retryer.MaxRetryDelay
+				options.Backoff = backoff{retryer: retryer, throttles: retry.IsErrorThrottles(retry.DefaultThrottles)}
+			})
+		}
+	}
+	return config, nil
+}
+
+// endpointResolverV2 resolves the overridden endpoints of the configuration for aws-sdk-go-v2
+// clients, the default endpoints of aws are used for the rest.
+func (c Configuration) endpointResolverV2() aws.EndpointResolverWithOptions {
+	return aws.EndpointResolverWithOptionsFunc(func(service, region string, options ...interface{}) (aws.Endpoint, error) {
+		endpoint := c.Endpoint
+		switch service {
+		case kinesisv2.ServiceID:
+			endpoint = c.KinesisEndpointURL()
+		case dynamodbv2.ServiceID:
+			endpoint = c.DynamoDBEndpointURL()
+		}
+		if endpoint == "" {
+			return aws.Endpoint{}, &aws.EndpointNotFoundError{}
+		}
+		return aws.Endpoint{
+			URL:           endpoint,
+			SigningRegion: region,
+		}, nil
+	})
+}
+
+// credentialsProvider provides the credentials of the configuration to aws-sdk-go-v2 clients,
+// so both sdk generations share the credential sources and assumed roles.
+type credentialsProvider struct {
+	credentials *credentials.Credentials
+}
+
+// Retrieve returns the credentials, which are cached and refreshed by the aws-sdk-go credentials.
+func (c *credentialsProvider) Retrieve(ctx context.Context) (aws.Credentials, error) {
+	value, err := c.credentials.GetWithContext(ctx)
+	if err != nil {
+		return aws.Credentials{}, err
+	}
+	retrieved := aws.Credentials{
+		AccessKeyID:     value.AccessKeyID,
+		SecretAccessKey: value.SecretAccessKey,
+		SessionToken:    value.SessionToken,
+		Source:          value.ProviderName,
+	}
+	if expiresAt, err := c.credentials.ExpiresAt(); err == nil {
+		retrieved.CanExpire = true
+		retrieved.Expires = expiresAt
+	}
+	return retrieved, nil
+}
+
+// backoff computes the delay between retries of aws-sdk-go-v2 clients the same way the
+// aws-sdk-go retryer does, with separate bounds for throttled requests.
+type backoff struct {
+	retryer   client.DefaultRetryer
+	throttles retry.IsErrorThrottles
+}
+
+// BackoffDelay returns the delay before the given attempt.
+func (b backoff) BackoffDelay(attempt int, err error) (time.Duration, error) {
+	minDelay, maxDelay := b.retryer.MinRetryDelay, b.retryer.MaxRetryDelay
+	if b.throttles.IsErrorThrottle(err) == aws.TrueTernary {
+		minDelay, maxDelay = b.retryer.MinThrottleDelay, b.retryer.MaxThrottleDelay
+	}
+	if attempt > 13 {
+		attempt = 13
+	}
+	delay := time.Duration(math.Exp2(float64(attempt-1))) * minDelay
+	delay += time.Duration(rand.Int63n(int64(minDelay) + 1))
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+	return delay, nil
+}
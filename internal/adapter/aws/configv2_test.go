@@ -0,0 +1,247 @@
+package aws_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	awsv2 "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go/aws"
+	awsadapter "github.com/fernandoocampo/pubsub-kinesis/internal/adapter/aws"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigResolvesEndpoints(t *testing.T) {
+	configuration := awsadapter.Configuration{
+		Region:           "us-east-1",
+		Endpoint:         "http://localhost:4566",
+		DynamoDBEndpoint: "http://localhost:8000",
+		CredentialsProvider: awsadapter.CredentialsConfiguration{
+			AccessKeyID:     "AKIASTATIC",
+			SecretAccessKey: "static-secret",
+		},
+	}
+	cases := map[string]string{
+		"Kinesis":  "http://localhost:4566",
+		"DynamoDB": "http://localhost:8000",
+		"STS":      "http://localhost:4566",
+	}
+
+	config, err := awsadapter.NewConfig(configuration)
+	assert.NoError(t, err)
+
+	for service, want := range cases {
+		t.Run(service, func(st *testing.T) {
+			endpoint, err := config.EndpointResolverWithOptions.ResolveEndpoint(service, "eu-west-1")
+
+			assert.NoError(st, err)
+			assert.Equal(st, want, endpoint.URL)
+			assert.Equal(st, "eu-west-1", endpoint.SigningRegion)
+		})
+	}
+}
+
+func TestConfigUsesDefaultEndpointsWithoutOverrides(t *testing.T) {
+	config, err := awsadapter.NewConfig(awsadapter.Configuration{Region: "us-east-1"})
+	assert.NoError(t, err)
+
+	_, err = config.EndpointResolverWithOptions.ResolveEndpoint("Kinesis", "us-east-1")
+
+	var notFound *awsv2.EndpointNotFoundError
+	assert.True(t, errors.As(err, &notFound))
+}
+
+func TestConfigCredentials(t *testing.T) {
+	sts := newSTSMock()
+	server := httptest.NewServer(sts)
+	defer server.Close()
+	configuration := awsadapter.Configuration{
+		Region:   "us-east-1",
+		Endpoint: server.URL,
+		CredentialsProvider: awsadapter.CredentialsConfiguration{
+			AccessKeyID:     "AKIABASE",
+			SecretAccessKey: "base-secret",
+			SessionToken:    "base-token",
+		},
+		KinesisRole: awsadapter.AssumeRoleConfiguration{
+			RoleARN: "arn:aws:iam::111111111111:role/orders-stream-reader",
+		},
+	}
+
+	config, err := awsadapter.NewConfig(configuration)
+	assert.NoError(t, err)
+	value, err := config.Credentials.Retrieve(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, awsv2.Credentials{
+		AccessKeyID:     "AKIABASE",
+		SecretAccessKey: "base-secret",
+		SessionToken:    "base-token",
+		Source:          "StaticProvider",
+	}, value)
+
+	kinesisConfig, err := awsadapter.NewKinesisConfig(configuration)
+	assert.NoError(t, err)
+	kinesisValue, err := kinesisConfig.Credentials.Retrieve(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "ASIA111111111111", kinesisValue.AccessKeyID)
+	assert.Equal(t, "role-token", kinesisValue.SessionToken)
+	assert.True(t, kinesisValue.CanExpire)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), kinesisValue.Expires, time.Minute)
+}
+
+func TestConfigWithoutCredentialsUsesDefaultChain(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIAENVIRONMENT")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "environment-secret")
+	t.Setenv("AWS_SESSION_TOKEN", "")
+
+	config, err := awsadapter.NewConfig(awsadapter.Configuration{Region: "us-east-1"})
+	assert.NoError(t, err)
+	value, err := config.Credentials.Retrieve(context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, "AKIAENVIRONMENT", value.AccessKeyID)
+	assert.Equal(t, "environment-secret", value.SecretAccessKey)
+}
+
+func TestConfigRetryAttempts(t *testing.T) {
+	cases := map[string]struct {
+		retry        awsadapter.RetryConfiguration
+		wantAttempts int
+	}{
+		"no_retries": {
+			retry:        awsadapter.RetryConfiguration{MaxRetries: aws.Int(0)},
+			wantAttempts: 1,
+		},
+		"retries": {
+			retry:        awsadapter.RetryConfiguration{MaxRetries: aws.Int(7)},
+			wantAttempts: 8,
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(st *testing.T) {
+			config, err := awsadapter.NewConfig(awsadapter.Configuration{Region: "us-east-1", Retry: c.retry})
+
+			assert.NoError(st, err)
+			assert.Equal(st, c.wantAttempts, config.Retryer().MaxAttempts())
+		})
+	}
+}
+
+func TestConfigWithoutRetrySettingsUsesSDKRetryer(t *testing.T) {
+	config, err := awsadapter.NewConfig(awsadapter.Configuration{Region: "us-east-1"})
+
+	assert.NoError(t, err)
+	assert.Nil(t, config.Retryer)
+}
+
+func TestConfigRetryDelay(t *testing.T) {
+	config, err := awsadapter.NewConfig(awsadapter.Configuration{
+		Region: "us-east-1",
+		Retry: awsadapter.RetryConfiguration{
+			MaxRetries:       aws.Int(20),
+			MinRetryDelay:    100 * time.Millisecond,
+			MaxRetryDelay:    time.Second,
+			MinThrottleDelay: 500 * time.Millisecond,
+			MaxThrottleDelay: 2 * time.Second,
+		},
+	})
+	assert.NoError(t, err)
+	cases := map[string]struct {
+		attempt int
+		err     error
+		wantMin time.Duration
+		wantMax time.Duration
+	}{
+		"first_attempt": {
+			attempt: 1,
+			err:     errors.New("connection reset"),
+			wantMin: 100 * time.Millisecond,
+			wantMax: 200 * time.Millisecond,
+		},
+		"third_attempt": {
+			attempt: 3,
+			err:     errors.New("connection reset"),
+			wantMin: 400 * time.Millisecond,
+			wantMax: 500 * time.Millisecond,
+		},
+		"bounded_by_maximum": {
+			attempt: 5,
+			err:     errors.New("connection reset"),
+			wantMin: time.Second,
+			wantMax: time.Second,
+		},
+		"many_attempts": {
+			attempt: 20,
+			err:     errors.New("connection reset"),
+			wantMin: time.Second,
+			wantMax: time.Second,
+		},
+		"throttled": {
+			attempt: 1,
+			err:     throttleError{},
+			wantMin: 500 * time.Millisecond,
+			wantMax: time.Second,
+		},
+		"throttled_bounded_by_maximum": {
+			attempt: 4,
+			err:     throttleError{},
+			wantMin: 2 * time.Second,
+			wantMax: 2 * time.Second,
+		},
+	}
+	retryer := config.Retryer()
+
+	for name, c := range cases {
+		t.Run(name, func(st *testing.T) {
+			delay, err := retryer.RetryDelay(c.attempt, c.err)
+
+			assert.NoError(st, err)
+			assert.GreaterOrEqual(st, int64(delay), int64(c.wantMin))
+			assert.LessOrEqual(st, int64(delay), int64(c.wantMax))
+		})
+	}
+}
+
+func TestDynamoDBClientV2UsesConfig(t *testing.T) {
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		fmt.Fprint(w, `{"Table": {"TableName": "orders-consumer", "TableStatus": "ACTIVE"}}`)
+	}))
+	defer server.Close()
+	config, err := awsadapter.NewDynamoDBConfig(awsadapter.Configuration{
+		Region:           "us-east-1",
+		DynamoDBEndpoint: server.URL,
+		CredentialsProvider: awsadapter.CredentialsConfiguration{
+			AccessKeyID:     "AKIASTATIC",
+			SecretAccessKey: "static-secret",
+		},
+	})
+	assert.NoError(t, err)
+
+	output, err := awsadapter.NewDynamoDBClientV2(config).DescribeTable(context.Background(), &dynamodb.DescribeTableInput{
+		TableName: aws.String("orders-consumer"),
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "ACTIVE", string(output.Table.TableStatus))
+	assert.Contains(t, authorization, "Credential=AKIASTATIC/")
+}
+
+// throttleError is an error with the code aws returns when requests are throttled.
+type throttleError struct{}
+
+func (t throttleError) Error() string {
+	return "rate exceeded"
+}
+
+func (t throttleError) ErrorCode() string {
+	return "ThrottlingException"
+}
@@ -0,0 +1,226 @@
+package aws
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+// MinRoleDuration is the shortest session sts allows when assuming a role.
+const MinRoleDuration = 15 * time.Minute
+
+// CredentialsSource is a place credentials are read from.
+type CredentialsSource string
+
+// Supported credentials sources.
+const (
+	// CredentialsStatic uses the access key of the configuration.
+	CredentialsStatic CredentialsSource = "static"
+	// CredentialsEnvironment reads AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN.
+	CredentialsEnvironment CredentialsSource = "environment"
+	// CredentialsSharedProfile reads a profile of the shared credentials file.
+	CredentialsSharedProfile CredentialsSource = "shared_profile"
+	// CredentialsWebIdentity exchanges a web identity token file for the credentials of a role,
+	// e.g. the service account token of a kubernetes pod.
+	CredentialsWebIdentity CredentialsSource = "web_identity"
+)
+
+// CredentialsConfiguration declares where credentials come from. The sources are tried in order
+// until one of them provides credentials, so several sources make a chain. An access key without
+// sources means the static source. When a role is set,
+// it is assumed with the credentials of the sources, or with the default credentials of the sdk
+// when there are no sources.
+type CredentialsConfiguration struct {
+	Sources []CredentialsSource
+	// AccessKeyID, SecretAccessKey and SessionToken are used by the static source.
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	// Profile and SharedCredentialsFile are used by the shared profile source, empty values
+	// mean the sdk defaults, the AWS_PROFILE profile and ~/.aws/credentials.
+	Profile               string
+	SharedCredentialsFile string
+	// WebIdentityTokenFile, WebIdentityRoleARN and WebIdentitySessionName are used by the web identity source.
+	WebIdentityTokenFile   string
+	WebIdentityRoleARN     string
+	WebIdentitySessionName string
+	// AssumeRole is the role assumed with the credentials of the sources.
+	AssumeRole AssumeRoleConfiguration
+}
+
+// AssumeRoleConfiguration contains the parameters to assume a role with sts.
+type AssumeRoleConfiguration struct {
+	RoleARN     string
+	ExternalID  string
+	SessionName string
+	// Duration of the role session, the sts default is used when it is zero.
+	Duration time.Duration
+}
+
+// NewCredentials creates the credentials of the configuration. It returns nil when no
+// credentials are configured, so the sdk default credentials chain is used.
+func NewCredentials(configuration Configuration) (*credentials.Credentials, error) {
+	if configuration.Credentials != nil {
+		return configuration.Credentials, nil
+	}
+	baseCredentials, err := configuration.CredentialsProvider.newCredentials(configuration)
+	if err != nil {
+		log.Println("level", "ERROR", "msg", "could not create aws credentials", "error", err)
+		return nil, err
+	}
+	return baseCredentials, nil
+}
+
+// NewKinesisCredentials creates the credentials used with kinesis, which assume the kinesis
+// role on top of the configuration credentials when it is set.
+func NewKinesisCredentials(configuration Configuration) (*credentials.Credentials, error) {
+	return newServiceCredentials(configuration, configuration.KinesisRole)
+}
+
+// NewDynamoDBCredentials creates the credentials used with dynamodb, which assume the dynamodb
+// role on top of the configuration credentials when it is set.
+func NewDynamoDBCredentials(configuration Configuration) (*credentials.Credentials, error) {
+	return newServiceCredentials(configuration, configuration.DynamoDBRole)
+}
+
+// newServiceCredentials creates the credentials of a service that may use its own role.
+func newServiceCredentials(configuration Configuration, role AssumeRoleConfiguration) (*credentials.Credentials, error) {
+	baseCredentials, err := NewCredentials(configuration)
+	if err != nil {
+		return nil, err
+	}
+	if role.RoleARN == "" {
+		return baseCredentials, nil
+	}
+	serviceCredentials, err := role.assume(configuration, baseCredentials)
+	if err != nil {
+		log.Println("level", "ERROR", "msg", "could not assume service role", "role", role.RoleARN, "error", err)
+		return nil, err
+	}
+	return serviceCredentials, nil
+}
+
+// newCredentials creates the credentials of the sources, assuming the role if it is set.
+func (c CredentialsConfiguration) newCredentials(configuration Configuration) (*credentials.Credentials, error) {
+	sources, err := c.sources()
+	if err != nil {
+		return nil, err
+	}
+	var sourceCredentials *credentials.Credentials
+	if len(sources) > 0 {
+		providers := make([]credentials.Provider, 0, len(sources))
+		for _, source := range sources {
+			provider, err := c.provider(source, configuration)
+			if err != nil {
+				return nil, err
+			}
+			providers = append(providers, provider)
+		}
+		if len(providers) == 1 {
+			sourceCredentials = credentials.NewCredentials(providers[0])
+		} else {
+			sourceCredentials = credentials.NewCredentials(&credentials.ChainProvider{
+				Providers:     providers,
+				VerboseErrors: true,
+			})
+		}
+	}
+	if c.AssumeRole.RoleARN == "" {
+		return sourceCredentials, nil
+	}
+	return c.AssumeRole.assume(configuration, sourceCredentials)
+}
+
+// sources returns the sources of the credentials, the static one when there are none but an
+// access key is set. It fails when an access key is set but no source uses it.
+func (c CredentialsConfiguration) sources() ([]CredentialsSource, error) {
+	if c.AccessKeyID == "" && c.SecretAccessKey == "" {
+		return c.Sources, nil
+	}
+	if len(c.Sources) == 0 {
+		return []CredentialsSource{CredentialsStatic}, nil
+	}
+	for _, source := range c.Sources {
+		if source == CredentialsStatic {
+			return c.Sources, nil
+		}
+	}
+	return nil, fmt.Errorf("access key is only used by the %s credentials source, add it to the sources", CredentialsStatic)
+}
+
+// provider creates the credentials provider of a source.
+func (c CredentialsConfiguration) provider(source CredentialsSource, configuration Configuration) (credentials.Provider, error) {
+	switch source {
+	case CredentialsStatic:
+		if c.AccessKeyID == "" || c.SecretAccessKey == "" {
+			return nil, errors.New("static credentials require an access key id and a secret access key")
+		}
+		return &credentials.StaticProvider{Value: credentials.Value{
+			AccessKeyID:     c.AccessKeyID,
+			SecretAccessKey: c.SecretAccessKey,
+			SessionToken:    c.SessionToken,
+		}}, nil
+	case CredentialsEnvironment:
+		return &credentials.EnvProvider{}, nil
+	case CredentialsSharedProfile:
+		return &credentials.SharedCredentialsProvider{
+			Filename: c.SharedCredentialsFile,
+			Profile:  c.Profile,
+		}, nil
+	case CredentialsWebIdentity:
+		if c.WebIdentityTokenFile == "" || c.WebIdentityRoleARN == "" {
+			return nil, errors.New("web identity credentials require a token file and a role arn")
+		}
+		// the token is exchanged without signing the request, so sts needs no credentials.
+		stsSession, err := newSTSSession(configuration, credentials.AnonymousCredentials)
+		if err != nil {
+			return nil, err
+		}
+		return stscreds.NewWebIdentityRoleProvider(sts.New(stsSession), c.WebIdentityRoleARN, c.WebIdentitySessionName, c.WebIdentityTokenFile), nil
+	default:
+		return nil, fmt.Errorf("unknown credentials source %q", source)
+	}
+}
+
+// assume returns credentials of the role assumed with the given credentials.
+func (a AssumeRoleConfiguration) assume(configuration Configuration, sourceCredentials *credentials.Credentials) (*credentials.Credentials, error) {
+	if a.Duration != 0 && a.Duration < MinRoleDuration {
+		return nil, fmt.Errorf("role duration must be at least %s, got %s", MinRoleDuration, a.Duration)
+	}
+	stsSession, err := newSTSSession(configuration, sourceCredentials)
+	if err != nil {
+		return nil, err
+	}
+	return stscreds.NewCredentials(stsSession, a.RoleARN, func(provider *stscreds.AssumeRoleProvider) {
+		if a.ExternalID != "" {
+			provider.ExternalID = aws.String(a.ExternalID)
+		}
+		if a.SessionName != "" {
+			provider.RoleSessionName = a.SessionName
+		}
+		if a.Duration != 0 {
+			provider.Duration = a.Duration
+		}
+	}), nil
+}
+
+// newSTSSession creates the session used to get credentials from sts. Nil credentials mean
+// the sdk default credentials chain.
+func newSTSSession(configuration Configuration, stsCredentials *credentials.Credentials) (*session.Session, error) {
+	awsConfig, err := configuration.awsConfig(stsCredentials)
+	if err != nil {
+		return nil, err
+	}
+	stsSession, err := configuration.newAWSSession(awsConfig)
+	if err != nil {
+		return nil, errors.New("could not create sts session")
+	}
+	return stsSession, nil
+}
@@ -0,0 +1,326 @@
+package aws_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	awsadapter "github.com/fernandoocampo/pubsub-kinesis/internal/adapter/aws"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewCredentialsWithoutConfiguration(t *testing.T) {
+	awsCredentials, err := awsadapter.NewCredentials(awsadapter.Configuration{Region: "us-east-1"})
+
+	assert.NoError(t, err)
+	assert.Nil(t, awsCredentials)
+}
+
+func TestNewCredentialsKeepsReadyMadeCredentials(t *testing.T) {
+	readyMade := credentials.NewStaticCredentials("AKIAREADYMADE", "secret", "")
+	configuration := awsadapter.Configuration{
+		Region:      "us-east-1",
+		Credentials: readyMade,
+		CredentialsProvider: awsadapter.CredentialsConfiguration{
+			Sources: []awsadapter.CredentialsSource{awsadapter.CredentialsEnvironment},
+		},
+	}
+
+	awsCredentials, err := awsadapter.NewCredentials(configuration)
+
+	assert.NoError(t, err)
+	assert.Same(t, readyMade, awsCredentials)
+}
+
+func TestNewCredentialsChain(t *testing.T) {
+	cases := map[string]struct {
+		env          map[string]string
+		wantKeyID    string
+		wantProvider string
+	}{
+		"first_source": {
+			env: map[string]string{
+				"AWS_ACCESS_KEY_ID":     "AKIAENVIRONMENT",
+				"AWS_SECRET_ACCESS_KEY": "environment-secret",
+			},
+			wantKeyID:    "AKIAENVIRONMENT",
+			wantProvider: credentials.EnvProviderName,
+		},
+		"next_source": {
+			env: map[string]string{
+				"AWS_ACCESS_KEY_ID":     "",
+				"AWS_SECRET_ACCESS_KEY": "",
+			},
+			wantKeyID:    "AKIASTATIC",
+			wantProvider: credentials.StaticProviderName,
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(st *testing.T) {
+			for key, value := range c.env {
+				st.Setenv(key, value)
+			}
+			configuration := awsadapter.Configuration{
+				Region: "us-east-1",
+				CredentialsProvider: awsadapter.CredentialsConfiguration{
+					Sources:         []awsadapter.CredentialsSource{awsadapter.CredentialsEnvironment, awsadapter.CredentialsStatic},
+					AccessKeyID:     "AKIASTATIC",
+					SecretAccessKey: "static-secret",
+				},
+			}
+
+			awsCredentials, err := awsadapter.NewCredentials(configuration)
+			assert.NoError(st, err)
+			value, err := awsCredentials.Get()
+
+			assert.NoError(st, err)
+			assert.Equal(st, c.wantKeyID, value.AccessKeyID)
+			assert.Equal(st, c.wantProvider, value.ProviderName)
+		})
+	}
+}
+
+func TestNewCredentialsInfersStaticSource(t *testing.T) {
+	configuration := awsadapter.Configuration{
+		Region: "us-east-1",
+		CredentialsProvider: awsadapter.CredentialsConfiguration{
+			AccessKeyID:     "AKIASTATIC",
+			SecretAccessKey: "static-secret",
+			SessionToken:    "static-token",
+		},
+	}
+
+	awsCredentials, err := awsadapter.NewCredentials(configuration)
+	assert.NoError(t, err)
+	value, err := awsCredentials.Get()
+
+	assert.NoError(t, err)
+	assert.Equal(t, credentials.Value{
+		AccessKeyID:     "AKIASTATIC",
+		SecretAccessKey: "static-secret",
+		SessionToken:    "static-token",
+		ProviderName:    credentials.StaticProviderName,
+	}, value)
+}
+
+func TestNewCredentialsRejectsInvalidConfiguration(t *testing.T) {
+	cases := map[string]struct {
+		configuration awsadapter.CredentialsConfiguration
+		want          string
+	}{
+		"unknown_source": {
+			configuration: awsadapter.CredentialsConfiguration{
+				Sources: []awsadapter.CredentialsSource{"vault"},
+			},
+			want: `unknown credentials source "vault"`,
+		},
+		"access_key_without_static_source": {
+			configuration: awsadapter.CredentialsConfiguration{
+				Sources:         []awsadapter.CredentialsSource{awsadapter.CredentialsEnvironment},
+				AccessKeyID:     "AKIASTATIC",
+				SecretAccessKey: "static-secret",
+			},
+			want: "access key is only used by the static credentials source, add it to the sources",
+		},
+		"static_without_secret": {
+			configuration: awsadapter.CredentialsConfiguration{
+				AccessKeyID: "AKIASTATIC",
+			},
+			want: "static credentials require an access key id and a secret access key",
+		},
+		"web_identity_without_token": {
+			configuration: awsadapter.CredentialsConfiguration{
+				Sources:            []awsadapter.CredentialsSource{awsadapter.CredentialsWebIdentity},
+				WebIdentityRoleARN: "arn:aws:iam::111111111111:role/orders",
+			},
+			want: "web identity credentials require a token file and a role arn",
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(st *testing.T) {
+			awsCredentials, err := awsadapter.NewCredentials(awsadapter.Configuration{
+				Region:              "us-east-1",
+				CredentialsProvider: c.configuration,
+			})
+
+			assert.Nil(st, awsCredentials)
+			assert.EqualError(st, err, c.want)
+		})
+	}
+}
+
+func TestRoleDurationIsChecked(t *testing.T) {
+	role := awsadapter.AssumeRoleConfiguration{RoleARN: "arn:aws:iam::111111111111:role/orders"}
+	cases := map[string]struct {
+		duration time.Duration
+		wantErr  bool
+	}{
+		"sts_default": {},
+		"minimum": {
+			duration: awsadapter.MinRoleDuration,
+		},
+		"too_short": {
+			duration: 5 * time.Minute,
+			wantErr:  true,
+		},
+	}
+	newCredentials := map[string]func(role awsadapter.AssumeRoleConfiguration) (*credentials.Credentials, error){
+		"credentials": func(role awsadapter.AssumeRoleConfiguration) (*credentials.Credentials, error) {
+			configuration := awsadapter.Configuration{Region: "us-east-1"}
+			configuration.CredentialsProvider.AssumeRole = role
+			return awsadapter.NewCredentials(configuration)
+		},
+		"kinesis": func(role awsadapter.AssumeRoleConfiguration) (*credentials.Credentials, error) {
+			return awsadapter.NewKinesisCredentials(awsadapter.Configuration{Region: "us-east-1", KinesisRole: role})
+		},
+		"dynamodb": func(role awsadapter.AssumeRoleConfiguration) (*credentials.Credentials, error) {
+			return awsadapter.NewDynamoDBCredentials(awsadapter.Configuration{Region: "us-east-1", DynamoDBRole: role})
+		},
+	}
+
+	for name, c := range cases {
+		for service, newServiceCredentials := range newCredentials {
+			t.Run(name+"_"+service, func(st *testing.T) {
+				role.Duration = c.duration
+
+				awsCredentials, err := newServiceCredentials(role)
+
+				if c.wantErr {
+					assert.EqualError(st, err, "role duration must be at least 15m0s, got 5m0s")
+					assert.Nil(st, awsCredentials)
+					return
+				}
+				assert.NoError(st, err)
+				assert.NotNil(st, awsCredentials)
+			})
+		}
+	}
+}
+
+func TestServiceCredentialsAssumeTheirRole(t *testing.T) {
+	sts := newSTSMock()
+	server := httptest.NewServer(sts)
+	defer server.Close()
+	configuration := awsadapter.Configuration{
+		Region:   "us-east-1",
+		Endpoint: server.URL,
+		CredentialsProvider: awsadapter.CredentialsConfiguration{
+			AccessKeyID:     "AKIABASE",
+			SecretAccessKey: "base-secret",
+		},
+		KinesisRole: awsadapter.AssumeRoleConfiguration{
+			RoleARN:     "arn:aws:iam::111111111111:role/orders-stream-reader",
+			ExternalID:  "orders",
+			SessionName: "orders-consumer",
+			Duration:    time.Hour,
+		},
+		DynamoDBRole: awsadapter.AssumeRoleConfiguration{
+			RoleARN: "arn:aws:iam::222222222222:role/orders-lease-writer",
+		},
+	}
+
+	baseCredentials, err := awsadapter.NewCredentials(configuration)
+	assert.NoError(t, err)
+	kinesisCredentials, err := awsadapter.NewKinesisCredentials(configuration)
+	assert.NoError(t, err)
+	dynamoDBCredentials, err := awsadapter.NewDynamoDBCredentials(configuration)
+	assert.NoError(t, err)
+
+	baseValue, err := baseCredentials.Get()
+	assert.NoError(t, err)
+	assert.Equal(t, "AKIABASE", baseValue.AccessKeyID)
+	kinesisValue, err := kinesisCredentials.Get()
+	assert.NoError(t, err)
+	assert.Equal(t, "ASIA111111111111", kinesisValue.AccessKeyID)
+	dynamoDBValue, err := dynamoDBCredentials.Get()
+	assert.NoError(t, err)
+	assert.Equal(t, "ASIA222222222222", dynamoDBValue.AccessKeyID)
+
+	assert.Len(t, sts.requests, 2)
+	kinesisRequest := sts.request(configuration.KinesisRole.RoleARN)
+	assert.Equal(t, "orders", kinesisRequest.externalID)
+	assert.Equal(t, "orders-consumer", kinesisRequest.sessionName)
+	assert.Equal(t, "3600", kinesisRequest.duration)
+	assert.Contains(t, kinesisRequest.authorization, "Credential=AKIABASE/")
+	dynamoDBRequest := sts.request(configuration.DynamoDBRole.RoleARN)
+	assert.Contains(t, dynamoDBRequest.authorization, "Credential=AKIABASE/")
+}
+
+func TestServiceCredentialsWithoutRole(t *testing.T) {
+	readyMade := credentials.NewStaticCredentials("AKIAREADYMADE", "secret", "")
+	configuration := awsadapter.Configuration{Region: "us-east-1", Credentials: readyMade}
+
+	kinesisCredentials, err := awsadapter.NewKinesisCredentials(configuration)
+	assert.NoError(t, err)
+	dynamoDBCredentials, err := awsadapter.NewDynamoDBCredentials(configuration)
+	assert.NoError(t, err)
+
+	assert.Same(t, readyMade, kinesisCredentials)
+	assert.Same(t, readyMade, dynamoDBCredentials)
+}
+
+// stsRequest is an AssumeRole request received by stsMock.
+type stsRequest struct {
+	roleARN       string
+	externalID    string
+	sessionName   string
+	duration      string
+	authorization string
+}
+
+// stsMock answers AssumeRole requests with credentials whose access key id has the account of the role.
+type stsMock struct {
+	mutex    sync.Mutex
+	requests []stsRequest
+}
+
+func newSTSMock() *stsMock {
+	return &stsMock{}
+}
+
+func (s *stsMock) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.Form.Get("Action") != "AssumeRole" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	request := stsRequest{
+		roleARN:       r.Form.Get("RoleArn"),
+		externalID:    r.Form.Get("ExternalId"),
+		sessionName:   r.Form.Get("RoleSessionName"),
+		duration:      r.Form.Get("DurationSeconds"),
+		authorization: r.Header.Get("Authorization"),
+	}
+	s.mutex.Lock()
+	s.requests = append(s.requests, request)
+	s.mutex.Unlock()
+
+	account := strings.Split(request.roleARN, ":")[4]
+	fmt.Fprintf(w, `<AssumeRoleResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <AssumeRoleResult>
+    <Credentials>
+      <AccessKeyId>ASIA%s</AccessKeyId>
+      <SecretAccessKey>role-secret</SecretAccessKey>
+      <SessionToken>role-token</SessionToken>
+      <Expiration>%s</Expiration>
+    </Credentials>
+  </AssumeRoleResult>
+</AssumeRoleResponse>`, account, time.Now().Add(time.Hour).UTC().Format(time.RFC3339))
+}
+
+func (s *stsMock) request(roleARN string) stsRequest {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, request := range s.requests {
+		if request.roleARN == roleARN {
+			return request
+		}
+	}
+	return stsRequest{}
+}
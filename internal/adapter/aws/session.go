@@ -4,31 +4,100 @@ import (
 	"errors"
 	"log"
 
-	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
 	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/kinesis"
 )
 
 // Configuration contains parameters required to connect to kinesis
 type Configuration struct {
-	Region      string
-	Endpoint    string
+	Region string
+	// Endpoint overrides the endpoint of every aws service.
+	Endpoint string
+	// KinesisEndpoint overrides the kinesis endpoint, e.g. to use a local emulator. It takes
+	// precedence over Endpoint.
+	KinesisEndpoint string
+	// DynamoDBEndpoint overrides the dynamodb endpoint, e.g. to use a local dynamodb. It takes
+	// precedence over Endpoint.
+	DynamoDBEndpoint string
+	// Credentials are ready-made credentials, they take precedence over CredentialsProvider.
 	Credentials *credentials.Credentials
+	// CredentialsProvider declares where the credentials come from. The sdk default
+	// credentials chain is used when neither it nor Credentials are set.
+	CredentialsProvider CredentialsConfiguration
+	// KinesisRole is a role assumed to access kinesis, e.g. a stream of another account.
+	KinesisRole AssumeRoleConfiguration
+	// DynamoDBRole is a role assumed to access dynamodb, e.g. a lease table of another account.
+	DynamoDBRole AssumeRoleConfiguration
+	// HTTP tunes the http client shared by the clients of the sessions.
+	HTTP HTTPConfiguration
+	// Retry tunes the retries of the requests of the clients of the sessions.
+	Retry RetryConfiguration
 }
 
-// NewSession creates a new aws session
+// KinesisEndpointURL returns the endpoint that overrides the kinesis one, if any.
+func (c Configuration) KinesisEndpointURL() string {
+	if c.KinesisEndpoint != "" {
+		return c.KinesisEndpoint
+	}
+	return c.Endpoint
+}
+
+// DynamoDBEndpointURL returns the endpoint that overrides the dynamodb one, if any.
+func (c Configuration) DynamoDBEndpointURL() string {
+	if c.DynamoDBEndpoint != "" {
+		return c.DynamoDBEndpoint
+	}
+	return c.Endpoint
+}
+
+// NewSession creates a new aws session. The clients created with it use the endpoints and
+// the credentials of the configuration.
 func NewSession(configuration Configuration) (*session.Session, error) {
-	awssession, err := session.NewSession(&aws.Config{
-		Region:      &configuration.Region,
-		Endpoint:    &configuration.Endpoint,
-		Credentials: configuration.Credentials,
-	})
+	sessionCredentials, err := NewCredentials(configuration)
+	if err != nil {
+		return nil, errors.New("could not create aws session")
+	}
+	return newSession(configuration, sessionCredentials)
+}
+
+// NewKinesisSession creates a new aws session for kinesis clients, which assumes the kinesis
+// role when it is set.
+func NewKinesisSession(configuration Configuration) (*session.Session, error) {
+	kinesisCredentials, err := NewKinesisCredentials(configuration)
+	if err != nil {
+		return nil, errors.New("could not create aws session")
+	}
+	return newSession(configuration, kinesisCredentials)
+}
+
+// NewDynamoDBSession creates a new aws session for dynamodb clients, which assumes the dynamodb
+// role when it is set.
+func NewDynamoDBSession(configuration Configuration) (*session.Session, error) {
+	dynamoDBCredentials, err := NewDynamoDBCredentials(configuration)
+	if err != nil {
+		return nil, errors.New("could not create aws session")
+	}
+	return newSession(configuration, dynamoDBCredentials)
+}
+
+// newSession creates a new aws session with the given credentials.
+func newSession(configuration Configuration, sessionCredentials *credentials.Credentials) (*session.Session, error) {
+	awsConfig, err := configuration.awsConfig(sessionCredentials)
+	if err != nil {
+		log.Println("msg", "invalid aws session configuration", "error", err)
+		return nil, errors.New("could not create aws session")
+	}
+	awssession, err := configuration.newAWSSession(awsConfig)
 	if err != nil {
 		log.Println(
 			"msg", "could not create aws session",
 			"region", configuration.Region,
 			"endpoint", configuration.Endpoint,
+			"kinesis_endpoint", configuration.KinesisEndpoint,
+			"dynamodb_endpoint", configuration.DynamoDBEndpoint,
 			"error", err,
 		)
 		return nil, errors.New("could not create aws session")
@@ -37,7 +106,33 @@ func NewSession(configuration Configuration) (*session.Session, error) {
 	return awssession, nil
 }
 
+// endpointResolver resolves the overridden endpoints of the configuration and the default
+// endpoints of aws for the rest.
+func (c Configuration) endpointResolver() endpoints.Resolver {
+	return endpoints.ResolverFunc(func(service, region string, opts ...func(*endpoints.Options)) (endpoints.ResolvedEndpoint, error) {
+		endpoint := c.Endpoint
+		switch service {
+		case kinesis.EndpointsID:
+			endpoint = c.KinesisEndpointURL()
+		case dynamodb.EndpointsID:
+			endpoint = c.DynamoDBEndpointURL()
+		}
+		if endpoint == "" {
+			return endpoints.DefaultResolver().EndpointFor(service, region, opts...)
+		}
+		return endpoints.ResolvedEndpoint{
+			URL:           endpoint,
+			SigningRegion: region,
+		}, nil
+	})
+}
+
 // NewKinesisClient creates a new aws kinesis client.
 func NewKinesisClient(awssession *session.Session) *kinesis.Kinesis {
 	return kinesis.New(awssession)
 }
+
+// NewDynamoDBClient creates a new aws dynamodb client.
+func NewDynamoDBClient(awssession *session.Session) *dynamodb.DynamoDB {
+	return dynamodb.New(awssession)
+}
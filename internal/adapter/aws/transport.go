@@ -0,0 +1,288 @@
+package aws
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// Default dial settings of the http transport, the same ones of the go default transport.
+const (
+	DefaultDialTimeout = 30 * time.Second
+	DefaultKeepAlive   = 30 * time.Second
+)
+
+// HTTPConfiguration tunes the http client of the sessions. Zero values keep the
+// settings of the go default transport.
+type HTTPConfiguration struct {
+	// MaxIdleConns is the size of the pool of idle connections across all hosts.
+	MaxIdleConns int
+	// MaxIdleConnsPerHost is the size of the pool of idle connections per host.
+	MaxIdleConnsPerHost int
+	// MaxConnsPerHost limits the connections per host, including the ones in use.
+	MaxConnsPerHost int
+	// DialTimeout is the maximum time to establish a connection.
+	DialTimeout time.Duration
+	// KeepAlive is the interval of the tcp keep-alive probes, a negative value disables them.
+	KeepAlive time.Duration
+	// DisableKeepAlives makes every request use a new connection.
+	DisableKeepAlives bool
+	// IdleConnTimeout is how long an idle connection stays in the pool.
+	IdleConnTimeout time.Duration
+	// TLSHandshakeTimeout is the maximum time of the tls handshake.
+	TLSHandshakeTimeout time.Duration
+	// ResponseHeaderTimeout is the maximum time to wait for the response headers of a request.
+	ResponseHeaderTimeout time.Duration
+	// Timeout limits the whole request. Keep it unset, or longer than five minutes,
+	// with enhanced fan-out, whose subscriptions are long running requests.
+	Timeout time.Duration
+	// ProxyURL is the proxy of every request, by default the one of the HTTPS_PROXY and NO_PROXY variables.
+	ProxyURL string
+	// CABundleFile is a PEM file with certificate authorities trusted besides the system ones,
+	// e.g. the one of a tls intercepting proxy or a local emulator.
+	CABundleFile string
+}
+
+// RetryConfiguration tunes the retries of the sdk. Zero values keep the sdk defaults.
+type RetryConfiguration struct {
+	// MaxRetries is the maximum number of retries of a request, zero disables them.
+	MaxRetries *int
+	// MinRetryDelay and MaxRetryDelay bound the backoff between retries.
+	MinRetryDelay time.Duration
+	MaxRetryDelay time.Duration
+	// MinThrottleDelay and MaxThrottleDelay bound the backoff between retries of throttled requests.
+	MinThrottleDelay time.Duration
+	MaxThrottleDelay time.Duration
+}
+
+// awsConfig returns the sdk configuration of sessions with the given credentials.
+func (c Configuration) awsConfig(sessionCredentials *credentials.Credentials) (*aws.Config, error) {
+	httpClient, err := c.HTTP.newHTTPClient()
+	if err != nil {
+		return nil, err
+	}
+	awsConfig := aws.Config{
+		Region:           aws.String(c.Region),
+		EndpointResolver: c.endpointResolver(),
+		Credentials:      sessionCredentials,
+		HTTPClient:       httpClient,
+	}
+	if c.Retry.isSet() {
+		retryer, err := c.Retry.newRetryer()
+		if err != nil {
+			return nil, err
+		}
+		request.WithRetryer(&awsConfig, retryer)
+	}
+	return &awsConfig, nil
+}
+
+// newAWSSession creates a session with the sdk configuration. The sdk replaces the certificate authorities
+// of the http client with the ones of AWS_CA_BUNDLE, so the ones of CABundleFile are restored.
+func (c Configuration) newAWSSession(awsConfig *aws.Config) (*session.Session, error) {
+	var tlsConfig *tls.Config
+	if transport, ok := awsConfig.HTTPClient.Transport.(*http.Transport); ok && c.HTTP.CABundleFile != "" {
+		tlsConfig = transport.TLSClientConfig.Clone()
+	}
+	awsSession, err := session.NewSession(awsConfig)
+	if err != nil {
+		return nil, err
+	}
+	if transport, ok := awsSession.Config.HTTPClient.Transport.(*http.Transport); ok && tlsConfig != nil {
+		transport.TLSClientConfig = tlsConfig
+	}
+	return awsSession, nil
+}
+
+// Validate checks the http settings, none of them can be negative but KeepAlive.
+func (h HTTPConfiguration) Validate() error {
+	for _, setting := range []struct {
+		name  string
+		value int
+	}{
+		{"MaxIdleConns", h.MaxIdleConns},
+		{"MaxIdleConnsPerHost", h.MaxIdleConnsPerHost},
+		{"MaxConnsPerHost", h.MaxConnsPerHost},
+	} {
+		if setting.value < 0 {
+			return fmt.Errorf("%s must not be negative, got %d", setting.name, setting.value)
+		}
+	}
+	for _, setting := range []struct {
+		name  string
+		value time.Duration
+	}{
+		{"DialTimeout", h.DialTimeout},
+		{"IdleConnTimeout", h.IdleConnTimeout},
+		{"TLSHandshakeTimeout", h.TLSHandshakeTimeout},
+		{"ResponseHeaderTimeout", h.ResponseHeaderTimeout},
+		{"Timeout", h.Timeout},
+	} {
+		if setting.value < 0 {
+			return fmt.Errorf("%s must not be negative, got %s", setting.name, setting.value)
+		}
+	}
+	if h.ProxyURL != "" {
+		if _, err := h.proxyURL(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// proxyURL parses the proxy url.
+func (h HTTPConfiguration) proxyURL() (*url.URL, error) {
+	proxyURL, err := url.Parse(h.ProxyURL)
+	if err != nil || proxyURL.Host == "" {
+		return nil, fmt.Errorf("invalid proxy url %q", h.ProxyURL)
+	}
+	return proxyURL, nil
+}
+
+// newHTTPClient creates the http client of the configuration.
+func (h HTTPConfiguration) newHTTPClient() (*http.Client, error) {
+	if err := h.Validate(); err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if h.DialTimeout != 0 || h.KeepAlive != 0 {
+		dialer := net.Dialer{
+			Timeout:   DefaultDialTimeout,
+			KeepAlive: DefaultKeepAlive,
+		}
+		if h.DialTimeout != 0 {
+			dialer.Timeout = h.DialTimeout
+		}
+		if h.KeepAlive != 0 {
+			dialer.KeepAlive = h.KeepAlive
+		}
+		transport.DialContext = dialer.DialContext
+	}
+	if h.MaxIdleConns != 0 {
+		transport.MaxIdleConns = h.MaxIdleConns
+	}
+	if h.MaxIdleConnsPerHost != 0 {
+		transport.MaxIdleConnsPerHost = h.MaxIdleConnsPerHost
+	}
+	if h.MaxConnsPerHost != 0 {
+		transport.MaxConnsPerHost = h.MaxConnsPerHost
+	}
+	transport.DisableKeepAlives = h.DisableKeepAlives
+	if h.IdleConnTimeout != 0 {
+		transport.IdleConnTimeout = h.IdleConnTimeout
+	}
+	if h.TLSHandshakeTimeout != 0 {
+		transport.TLSHandshakeTimeout = h.TLSHandshakeTimeout
+	}
+	if h.ResponseHeaderTimeout != 0 {
+		transport.ResponseHeaderTimeout = h.ResponseHeaderTimeout
+	}
+	if h.ProxyURL != "" {
+		proxyURL, err := h.proxyURL()
+		if err != nil {
+			return nil, err
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	if h.CABundleFile != "" {
+		rootCAs, err := loadCABundle(h.CABundleFile)
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = &tls.Config{
+			MinVersion: tls.VersionTLS12,
+			RootCAs:    rootCAs,
+		}
+	}
+
+	httpClient := http.Client{
+		Transport: transport,
+		Timeout:   h.Timeout,
+	}
+	return &httpClient, nil
+}
+
+// loadCABundle returns the system certificate authorities along with the ones of the file.
+func loadCABundle(caBundleFile string) (*x509.CertPool, error) {
+	pem, err := ioutil.ReadFile(caBundleFile)
+	if err != nil {
+		return nil, fmt.Errorf("ca bundle could not be read: %w", err)
+	}
+	rootCAs, err := x509.SystemCertPool()
+	if err != nil || rootCAs == nil {
+		rootCAs = x509.NewCertPool()
+	}
+	if !rootCAs.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("ca bundle %s has no pem certificates", caBundleFile)
+	}
+	return rootCAs, nil
+}
+
+// isSet tells if any retry setting is set.
+func (r RetryConfiguration) isSet() bool {
+	return r.MaxRetries != nil || r.MinRetryDelay != 0 || r.MaxRetryDelay != 0 || r.MinThrottleDelay != 0 || r.MaxThrottleDelay != 0
+}
+
+// Validate checks the retry settings, none of them can be negative and the minimum delays
+// can't be greater than the maximum ones.
+func (r RetryConfiguration) Validate() error {
+	_, err := r.newRetryer()
+	return err
+}
+
+// newRetryer creates the sdk retryer of the configuration.
+func (r RetryConfiguration) newRetryer() (client.DefaultRetryer, error) {
+	if r.MaxRetries != nil && *r.MaxRetries < 0 {
+		return client.DefaultRetryer{}, fmt.Errorf("MaxRetries must not be negative, got %d", *r.MaxRetries)
+	}
+	for _, setting := range []struct {
+		name  string
+		value time.Duration
+	}{
+		{"MinRetryDelay", r.MinRetryDelay},
+		{"MaxRetryDelay", r.MaxRetryDelay},
+		{"MinThrottleDelay", r.MinThrottleDelay},
+		{"MaxThrottleDelay", r.MaxThrottleDelay},
+	} {
+		if setting.value < 0 {
+			return client.DefaultRetryer{}, fmt.Errorf("%s must not be negative, got %s", setting.name, setting.value)
+		}
+	}
+	retryer := client.DefaultRetryer{
+		NumMaxRetries:    client.DefaultRetryerMaxNumRetries,
+		MinRetryDelay:    durationOrDefault(r.MinRetryDelay, client.DefaultRetryerMinRetryDelay),
+		MaxRetryDelay:    durationOrDefault(r.MaxRetryDelay, client.DefaultRetryerMaxRetryDelay),
+		MinThrottleDelay: durationOrDefault(r.MinThrottleDelay, client.DefaultRetryerMinThrottleDelay),
+		MaxThrottleDelay: durationOrDefault(r.MaxThrottleDelay, client.DefaultRetryerMaxThrottleDelay),
+	}
+	if r.MaxRetries != nil {
+		retryer.NumMaxRetries = *r.MaxRetries
+	}
+	if retryer.MinRetryDelay > retryer.MaxRetryDelay {
+		return client.DefaultRetryer{}, errors.New("MinRetryDelay must not be greater than MaxRetryDelay")
+	}
+	if retryer.MinThrottleDelay > retryer.MaxThrottleDelay {
+		return client.DefaultRetryer{}, errors.New("MinThrottleDelay must not be greater than MaxThrottleDelay")
+	}
+	return retryer, nil
+}
+
+func durationOrDefault(value, defaultValue time.Duration) time.Duration {
+	if value > 0 {
+		return value
+	}
+	return defaultValue
+}
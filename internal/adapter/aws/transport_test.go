@@ -0,0 +1,242 @@
+package aws_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	awsadapter "github.com/fernandoocampo/pubsub-kinesis/internal/adapter/aws"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPClientUsesProxy(t *testing.T) {
+	var proxiedURLs []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxiedURLs = append(proxiedURLs, r.URL.String())
+	}))
+	defer proxy.Close()
+	configuration := awsadapter.Configuration{
+		Region: "us-east-1",
+		HTTP:   awsadapter.HTTPConfiguration{ProxyURL: proxy.URL},
+	}
+
+	httpClient := newHTTPClient(t, configuration)
+	response, err := httpClient.Get("http://kinesis.us-east-1.amazonaws.com/")
+
+	assert.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, []string{"http://kinesis.us-east-1.amazonaws.com/"}, proxiedURLs)
+}
+
+func TestHTTPClientTrustsCABundle(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	caBundleFile := writeCABundle(t, server.Certificate())
+	// the sdk trusts AWS_CA_BUNDLE unless the configuration sets its own bundle.
+	t.Setenv("AWS_CA_BUNDLE", writeCABundle(t, newCertificate(t)))
+
+	_, err := newHTTPClient(t, awsadapter.Configuration{Region: "us-east-1"}).Get(server.URL)
+	assert.Error(t, err)
+
+	configuration := awsadapter.Configuration{
+		Region: "us-east-1",
+		HTTP:   awsadapter.HTTPConfiguration{CABundleFile: caBundleFile},
+	}
+	response, err := newHTTPClient(t, configuration).Get(server.URL)
+	if assert.NoError(t, err) {
+		response.Body.Close()
+	}
+}
+
+func TestHTTPClientRejectsInvalidCABundle(t *testing.T) {
+	caBundleFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := ioutil.WriteFile(caBundleFile, []byte("not a certificate"), 0600); err != nil {
+		t.Fatal("unexpected error writing ca bundle", err)
+	}
+	cases := map[string]string{
+		"missing_file":    filepath.Join(t.TempDir(), "missing.pem"),
+		"no_certificates": caBundleFile,
+	}
+
+	for name, file := range cases {
+		t.Run(name, func(st *testing.T) {
+			configuration := awsadapter.Configuration{
+				Region: "us-east-1",
+				HTTP:   awsadapter.HTTPConfiguration{CABundleFile: file},
+			}
+
+			awsSession, err := awsadapter.NewSession(configuration)
+
+			assert.Error(st, err)
+			assert.Nil(st, awsSession)
+		})
+	}
+}
+
+func TestHTTPConfigurationValidate(t *testing.T) {
+	cases := map[string]struct {
+		configuration awsadapter.HTTPConfiguration
+		want          string
+	}{
+		"valid": {
+			configuration: awsadapter.HTTPConfiguration{MaxIdleConns: 100, KeepAlive: -1, Timeout: time.Minute},
+		},
+		"negative_connections": {
+			configuration: awsadapter.HTTPConfiguration{MaxConnsPerHost: -1},
+			want:          "MaxConnsPerHost must not be negative, got -1",
+		},
+		"negative_timeout": {
+			configuration: awsadapter.HTTPConfiguration{TLSHandshakeTimeout: -time.Second},
+			want:          "TLSHandshakeTimeout must not be negative, got -1s",
+		},
+		"first_negative_value": {
+			configuration: awsadapter.HTTPConfiguration{
+				MaxIdleConns:        -1,
+				MaxIdleConnsPerHost: -1,
+				MaxConnsPerHost:     -1,
+				DialTimeout:         -time.Second,
+			},
+			want: "MaxIdleConns must not be negative, got -1",
+		},
+		"invalid_proxy": {
+			configuration: awsadapter.HTTPConfiguration{ProxyURL: "proxy.local:3128"},
+			want:          `invalid proxy url "proxy.local:3128"`,
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(st *testing.T) {
+			err := c.configuration.Validate()
+
+			if c.want == "" {
+				assert.NoError(st, err)
+				return
+			}
+			assert.EqualError(st, err, c.want)
+		})
+	}
+}
+
+func TestRetryConfigurationValidate(t *testing.T) {
+	cases := map[string]struct {
+		configuration awsadapter.RetryConfiguration
+		want          string
+	}{
+		"defaults": {},
+		"no_retries": {
+			configuration: awsadapter.RetryConfiguration{MaxRetries: aws.Int(0)},
+		},
+		"minimum_below_default_maximum": {
+			configuration: awsadapter.RetryConfiguration{MinRetryDelay: 100 * time.Millisecond},
+		},
+		"negative_retries": {
+			configuration: awsadapter.RetryConfiguration{MaxRetries: aws.Int(-1)},
+			want:          "MaxRetries must not be negative, got -1",
+		},
+		"negative_delay": {
+			configuration: awsadapter.RetryConfiguration{MaxThrottleDelay: -time.Second},
+			want:          "MaxThrottleDelay must not be negative, got -1s",
+		},
+		"minimum_above_maximum": {
+			configuration: awsadapter.RetryConfiguration{MinRetryDelay: time.Second, MaxRetryDelay: time.Millisecond},
+			want:          "MinRetryDelay must not be greater than MaxRetryDelay",
+		},
+		"minimum_above_default_maximum": {
+			configuration: awsadapter.RetryConfiguration{MinThrottleDelay: time.Hour},
+			want:          "MinThrottleDelay must not be greater than MaxThrottleDelay",
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(st *testing.T) {
+			err := c.configuration.Validate()
+
+			if c.want == "" {
+				assert.NoError(st, err)
+				return
+			}
+			assert.EqualError(st, err, c.want)
+		})
+	}
+}
+
+func TestSessionUsesRetrySettings(t *testing.T) {
+	configuration := awsadapter.Configuration{
+		Region: "us-east-1",
+		Retry: awsadapter.RetryConfiguration{
+			MaxRetries:    aws.Int(7),
+			MinRetryDelay: 50 * time.Millisecond,
+		},
+	}
+
+	awsSession, err := awsadapter.NewSession(configuration)
+
+	assert.NoError(t, err)
+	retryer, ok := awsSession.Config.Retryer.(client.DefaultRetryer)
+	if assert.True(t, ok) {
+		assert.Equal(t, 7, retryer.NumMaxRetries)
+		assert.Equal(t, 50*time.Millisecond, retryer.MinRetryDelay)
+		assert.Equal(t, client.DefaultRetryerMaxRetryDelay, retryer.MaxRetryDelay)
+		assert.Equal(t, client.DefaultRetryerMinThrottleDelay, retryer.MinThrottleDelay)
+	}
+}
+
+// newHTTPClient returns the http client of a session of the configuration.
+func newHTTPClient(t *testing.T, configuration awsadapter.Configuration) *http.Client {
+	t.Helper()
+	awsSession, err := awsadapter.NewSession(configuration)
+	if err != nil {
+		t.Fatal("unexpected error creating session", err)
+	}
+	return awsSession.Config.HTTPClient
+}
+
+// writeCABundle writes the certificate to a pem file and returns its path.
+func writeCABundle(t *testing.T, certificate *x509.Certificate) string {
+	t.Helper()
+	caBundleFile := filepath.Join(t.TempDir(), "ca.pem")
+	certificatePEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate.Raw})
+	if err := ioutil.WriteFile(caBundleFile, certificatePEM, 0600); err != nil {
+		t.Fatal("unexpected error writing ca bundle", err)
+	}
+	return caBundleFile
+}
+
+// newCertificate creates a self-signed certificate authority.
+func newCertificate(t *testing.T) *x509.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal("unexpected error generating key", err)
+	}
+	template := x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "other authority"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal("unexpected error creating certificate", err)
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal("unexpected error parsing certificate", err)
+	}
+	return certificate
+}
@@ -0,0 +1,224 @@
+package checkpointstore
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/vmware/vmware-go-kcl/clientlibrary/checkpoint"
+	"github.com/vmware/vmware-go-kcl/clientlibrary/config"
+	partition "github.com/vmware/vmware-go-kcl/clientlibrary/partition"
+)
+
+// errLeaseNotOwned is returned when a worker releases a lease it doesn't hold.
+var errLeaseNotOwned = errors.New("lease is not owned by the worker")
+
+// errShardNotLeased is returned when a worker claims a shard without lease.
+var errShardNotLeased = errors.New("shard has no lease")
+
+// Checkpointer is a kcl checkpointer on a store, it behaves like the dynamodb checkpointer of kcl:
+// the leases are acquired, renewed and claimed only if they didn't change since they were read.
+type Checkpointer struct {
+	store         Store
+	kclConfig     *config.KinesisClientLibConfiguration
+	lastLeaseSync time.Time
+}
+
+// NewCheckpointer creates a checkpointer that keeps the leases of the kcl lease table in the store.
+func NewCheckpointer(store Store, kclConfig *config.KinesisClientLibConfiguration) *Checkpointer {
+	newCheckpointer := Checkpointer{
+		store:     store,
+		kclConfig: kclConfig,
+	}
+	return &newCheckpointer
+}
+
+// CheckpointerFactory returns a function that creates the checkpointers of kcl workers on the store,
+// e.g. for kinesis.StandardKCLWorkerFactory.WithCheckpointerFactory.
+func CheckpointerFactory(store Store) func(kclConfig *config.KinesisClientLibConfiguration) checkpoint.Checkpointer {
+	return func(kclConfig *config.KinesisClientLibConfiguration) checkpoint.Checkpointer {
+		return NewCheckpointer(store, kclConfig)
+	}
+}
+
+// Init creates the lease table if it doesn't exist.
+func (c *Checkpointer) Init() error {
+	err := c.store.Init(c.kclConfig.TableName)
+	if err != nil {
+		log.Println("level", "ERROR", "msg", "cannot initialize lease table", "table", c.kclConfig.TableName, "error", err)
+	}
+	return err
+}
+
+// GetLease acquires or renews the lease of the shard for the worker.
+func (c *Checkpointer) GetLease(shard *partition.ShardStatus, newAssignTo string) error {
+	newLeaseTimeout := time.Now().Add(time.Duration(c.kclConfig.FailoverTimeMillis) * time.Millisecond).UTC()
+	current, err := c.store.GetLease(c.kclConfig.TableName, shard.ID)
+	if err != nil && !errors.Is(err, ErrLeaseNotFound) {
+		return err
+	}
+
+	isClaimRequestExpired := shard.IsClaimRequestExpired(c.kclConfig)
+	if c.kclConfig.EnableLeaseStealing && current.ClaimRequest != "" && current.ClaimRequest != newAssignTo && !isClaimRequestExpired {
+		return errors.New(checkpoint.ErrShardClaimed)
+	}
+	if current.AssignedTo != "" && current.AssignedTo != newAssignTo && time.Now().Before(current.LeaseTimeout) {
+		if !c.kclConfig.EnableLeaseStealing || !isClaimRequestExpired {
+			return checkpoint.ErrLeaseNotAcquired{}
+		}
+	}
+
+	lease := Lease{
+		ShardID:       shard.ID,
+		AssignedTo:    newAssignTo,
+		LeaseTimeout:  newLeaseTimeout,
+		Checkpoint:    shard.GetCheckpoint(),
+		ParentShardID: shard.ParentShardId,
+	}
+	err = c.store.SwapLease(c.kclConfig.TableName, lease, current.Version)
+	if errors.Is(err, ErrLeaseChanged) {
+		return checkpoint.ErrLeaseNotAcquired{}
+	}
+	if err != nil {
+		return err
+	}
+
+	shard.Mux.Lock()
+	shard.AssignedTo = newAssignTo
+	shard.LeaseTimeout = newLeaseTimeout
+	shard.Mux.Unlock()
+	return nil
+}
+
+// CheckpointSequence writes the checkpoint of the shard.
+func (c *Checkpointer) CheckpointSequence(shard *partition.ShardStatus) error {
+	lease := Lease{
+		ShardID:       shard.ID,
+		AssignedTo:    shard.GetLeaseOwner(),
+		LeaseTimeout:  shard.GetLeaseTimeout(),
+		Checkpoint:    shard.GetCheckpoint(),
+		ParentShardID: shard.ParentShardId,
+	}
+	return c.store.PutLease(c.kclConfig.TableName, lease)
+}
+
+// FetchCheckpoint reads the checkpoint, owner and lease timeout of the shard.
+// It returns checkpoint.ErrSequenceIDNotFound when the shard has no checkpoint.
+func (c *Checkpointer) FetchCheckpoint(shard *partition.ShardStatus) error {
+	lease, err := c.store.GetLease(c.kclConfig.TableName, shard.ID)
+	if errors.Is(err, ErrLeaseNotFound) {
+		return checkpoint.ErrSequenceIDNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return applyLease(shard, lease)
+}
+
+// RemoveLeaseInfo removes the lease of a shard that no longer exists.
+func (c *Checkpointer) RemoveLeaseInfo(shardID string) error {
+	err := c.store.DeleteLease(c.kclConfig.TableName, shardID)
+	if err != nil {
+		log.Println("level", "ERROR", "msg", "cannot remove lease", "shard", shardID, "error", err)
+		return err
+	}
+	log.Println("level", "INFO", "msg", "lease removed", "shard", shardID)
+	return nil
+}
+
+// RemoveLeaseOwner releases the lease of the shard held by the worker, so others can take it.
+func (c *Checkpointer) RemoveLeaseOwner(shardID string) error {
+	lease, err := c.store.GetLease(c.kclConfig.TableName, shardID)
+	if err != nil {
+		return err
+	}
+	if lease.AssignedTo != c.kclConfig.WorkerID {
+		return errLeaseNotOwned
+	}
+	version := lease.Version
+	lease.AssignedTo = ""
+	return c.store.SwapLease(c.kclConfig.TableName, lease, version)
+}
+
+// ListActiveWorkers returns the shards of each worker, it fails if a shard has no owner.
+func (c *Checkpointer) ListActiveWorkers(shardStatus map[string]*partition.ShardStatus) (map[string][]*partition.ShardStatus, error) {
+	err := c.syncLeases(shardStatus)
+	if err != nil {
+		return nil, err
+	}
+
+	workers := make(map[string][]*partition.ShardStatus)
+	for _, shard := range shardStatus {
+		if shard.GetCheckpoint() == checkpoint.ShardEnd {
+			continue
+		}
+		leaseOwner := shard.GetLeaseOwner()
+		if leaseOwner == "" {
+			return nil, checkpoint.ErrShardNotAssigned
+		}
+		workers[leaseOwner] = append(workers[leaseOwner], shard)
+	}
+	return workers, nil
+}
+
+// ClaimShard places a claim request on the shard to steal its lease, it fails if the lease changed
+// since the shard was read or it is already claimed.
+func (c *Checkpointer) ClaimShard(shard *partition.ShardStatus, claimID string) error {
+	lease, err := c.store.GetLease(c.kclConfig.TableName, shard.ID)
+	if errors.Is(err, ErrLeaseNotFound) {
+		return errShardNotLeased
+	}
+	if err != nil {
+		return err
+	}
+	if err := applyLease(shard, lease); err != nil && !errors.Is(err, checkpoint.ErrSequenceIDNotFound) {
+		return err
+	}
+	if lease.ClaimRequest != "" {
+		return errors.New(checkpoint.ErrShardClaimed)
+	}
+
+	version := lease.Version
+	lease.ClaimRequest = claimID
+	return c.store.SwapLease(c.kclConfig.TableName, lease, version)
+}
+
+// syncLeases updates the owners and checkpoints of the shards, at most once per lease syncing interval.
+func (c *Checkpointer) syncLeases(shardStatus map[string]*partition.ShardStatus) error {
+	syncInterval := time.Duration(c.kclConfig.LeaseSyncingTimeIntervalMillis) * time.Millisecond
+	if c.lastLeaseSync.Add(syncInterval).After(time.Now()) {
+		return nil
+	}
+	c.lastLeaseSync = time.Now()
+
+	leases, err := c.store.ListLeases(c.kclConfig.TableName)
+	if err != nil {
+		log.Println("level", "ERROR", "msg", "cannot sync leases", "table", c.kclConfig.TableName, "error", err)
+		return err
+	}
+	for _, lease := range leases {
+		if lease.AssignedTo == "" || lease.Checkpoint == "" {
+			continue
+		}
+		if shard, ok := shardStatus[lease.ShardID]; ok {
+			shard.SetLeaseOwner(lease.AssignedTo)
+			shard.SetCheckpoint(lease.Checkpoint)
+		}
+	}
+	return nil
+}
+
+// applyLease copies the checkpoint, owner and lease timeout of the lease into the shard.
+func applyLease(shard *partition.ShardStatus, lease Lease) error {
+	if lease.Checkpoint == "" {
+		return checkpoint.ErrSequenceIDNotFound
+	}
+	shard.SetCheckpoint(lease.Checkpoint)
+	if lease.AssignedTo != "" {
+		shard.SetLeaseOwner(lease.AssignedTo)
+	}
+	if !lease.LeaseTimeout.IsZero() {
+		shard.SetLeaseTimeout(lease.LeaseTimeout)
+	}
+	return nil
+}
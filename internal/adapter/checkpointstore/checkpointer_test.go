@@ -0,0 +1,252 @@
+package checkpointstore_test
+
+import (
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fernandoocampo/pubsub-kinesis/internal/adapter/checkpointstore"
+	_ "github.com/fernandoocampo/pubsub-kinesis/internal/adapter/checkpointstore/sqldriver"
+	"github.com/stretchr/testify/assert"
+	"github.com/vmware/vmware-go-kcl/clientlibrary/checkpoint"
+	"github.com/vmware/vmware-go-kcl/clientlibrary/config"
+	partition "github.com/vmware/vmware-go-kcl/clientlibrary/partition"
+)
+
+func TestGetLease(t *testing.T) {
+	for name, newStore := range stores() {
+		t.Run(name, func(st *testing.T) {
+			store := newStore(st)
+			first := newCheckpointer(st, store, "worker-1")
+			second := newCheckpointer(st, store, "worker-2")
+
+			err := first.GetLease(newShard(), "worker-1")
+			assert.NoError(st, err)
+
+			shard := newShard()
+			err = second.GetLease(shard, "worker-2")
+			assert.Equal(st, checkpoint.ErrLeaseNotAcquired{}, err)
+			assert.Empty(st, shard.GetLeaseOwner())
+
+			shard = newShard()
+			err = first.GetLease(shard, "worker-1")
+			assert.NoError(st, err)
+			assert.Equal(st, "worker-1", shard.GetLeaseOwner())
+			assert.True(st, shard.GetLeaseTimeout().After(time.Now()))
+		})
+	}
+}
+
+func TestGetExpiredLease(t *testing.T) {
+	for name, newStore := range stores() {
+		t.Run(name, func(st *testing.T) {
+			store := newStore(st)
+			assert.NoError(st, store.Init("orders-consumer"))
+			err := store.PutLease("orders-consumer", checkpointstore.Lease{
+				ShardID:      "shardId-000000000000",
+				AssignedTo:   "worker-1",
+				LeaseTimeout: time.Now().Add(-time.Minute),
+				Checkpoint:   "1001",
+			})
+			assert.NoError(st, err)
+			shard := newShard()
+			checkpointer := newCheckpointer(st, store, "worker-2")
+
+			assert.NoError(st, checkpointer.FetchCheckpoint(shard))
+			err = checkpointer.GetLease(shard, "worker-2")
+
+			assert.NoError(st, err)
+			lease, err := store.GetLease("orders-consumer", "shardId-000000000000")
+			assert.NoError(st, err)
+			assert.Equal(st, "worker-2", lease.AssignedTo)
+			assert.Equal(st, "1001", lease.Checkpoint)
+			assert.Equal(st, int64(2), lease.Version)
+		})
+	}
+}
+
+func TestCheckpointSequence(t *testing.T) {
+	for name, newStore := range stores() {
+		t.Run(name, func(st *testing.T) {
+			checkpointer := newCheckpointer(st, newStore(st), "worker-1")
+			shard := newShard()
+
+			err := checkpointer.FetchCheckpoint(shard)
+			assert.Equal(st, checkpoint.ErrSequenceIDNotFound, err)
+
+			assert.NoError(st, checkpointer.GetLease(shard, "worker-1"))
+			shard.SetCheckpoint("1003")
+			assert.NoError(st, checkpointer.CheckpointSequence(shard))
+
+			fetched := newShard()
+			err = checkpointer.FetchCheckpoint(fetched)
+
+			assert.NoError(st, err)
+			assert.Equal(st, "1003", fetched.GetCheckpoint())
+			assert.Equal(st, "worker-1", fetched.GetLeaseOwner())
+			assert.WithinDuration(st, shard.GetLeaseTimeout(), fetched.GetLeaseTimeout(), time.Millisecond)
+		})
+	}
+}
+
+func TestRemoveLease(t *testing.T) {
+	for name, newStore := range stores() {
+		t.Run(name, func(st *testing.T) {
+			store := newStore(st)
+			owner := newCheckpointer(st, store, "worker-1")
+			other := newCheckpointer(st, store, "worker-2")
+			assert.NoError(st, owner.GetLease(newShard(), "worker-1"))
+
+			assert.Error(st, other.RemoveLeaseOwner("shardId-000000000000"))
+			assert.NoError(st, owner.RemoveLeaseOwner("shardId-000000000000"))
+			assert.NoError(st, other.GetLease(newShard(), "worker-2"))
+
+			assert.NoError(st, other.RemoveLeaseInfo("shardId-000000000000"))
+			_, err := store.GetLease("orders-consumer", "shardId-000000000000")
+			assert.True(st, errors.Is(err, checkpointstore.ErrLeaseNotFound))
+		})
+	}
+}
+
+func TestClaimShard(t *testing.T) {
+	for name, newStore := range stores() {
+		t.Run(name, func(st *testing.T) {
+			store := newStore(st)
+			owner := newCheckpointer(st, store, "worker-1")
+			thief := newCheckpointer(st, store, "worker-2")
+			shard := newShard()
+			assert.NoError(st, owner.GetLease(shard, "worker-1"))
+			shard.SetCheckpoint("1001")
+			assert.NoError(st, owner.CheckpointSequence(shard))
+
+			workers, err := thief.ListActiveWorkers(map[string]*partition.ShardStatus{shard.ID: newShard()})
+			assert.NoError(st, err)
+			assert.Len(st, workers["worker-1"], 1)
+
+			claimed := workers["worker-1"][0]
+			assert.NoError(st, thief.ClaimShard(claimed, "worker-2"))
+			assert.EqualError(st, thief.ClaimShard(claimed, "worker-3"), checkpoint.ErrShardClaimed)
+			assert.EqualError(st, owner.GetLease(shard, "worker-1"), checkpoint.ErrShardClaimed)
+
+			lease, err := store.GetLease("orders-consumer", shard.ID)
+			assert.NoError(st, err)
+			assert.Equal(st, "worker-2", lease.ClaimRequest)
+			assert.Equal(st, "1001", lease.Checkpoint)
+		})
+	}
+}
+
+func TestSwapLease(t *testing.T) {
+	for name, newStore := range stores() {
+		t.Run(name, func(st *testing.T) {
+			store := newStore(st)
+			assert.NoError(st, store.Init("orders-consumer"))
+			lease := checkpointstore.Lease{ShardID: "shardId-000000000000", AssignedTo: "worker-1"}
+
+			assert.NoError(st, store.SwapLease("orders-consumer", lease, 0))
+			assert.Equal(st, checkpointstore.ErrLeaseChanged, store.SwapLease("orders-consumer", lease, 0))
+			assert.NoError(st, store.SwapLease("orders-consumer", lease, 1))
+			assert.Equal(st, checkpointstore.ErrLeaseChanged, store.SwapLease("orders-consumer", lease, 1))
+			assert.NoError(st, store.PutLease("orders-consumer", lease))
+
+			leases, err := store.ListLeases("orders-consumer")
+			assert.NoError(st, err)
+			assert.Equal(st, []checkpointstore.Lease{{ShardID: "shardId-000000000000", AssignedTo: "worker-1", Version: 3}}, leases)
+			leases, err = store.ListLeases("other-consumer")
+			assert.NoError(st, err)
+			assert.Empty(st, leases)
+		})
+	}
+}
+
+func TestOpen(t *testing.T) {
+	cases := map[string]struct {
+		configuration checkpointstore.Configuration
+		wantStore     bool
+		wantErr       string
+	}{
+		"dynamodb": {
+			configuration: checkpointstore.Configuration{Kind: checkpointstore.KindDynamoDB},
+		},
+		"memory": {
+			configuration: checkpointstore.Configuration{Kind: checkpointstore.KindMemory},
+			wantStore:     true,
+		},
+		"file": {
+			configuration: checkpointstore.Configuration{Kind: checkpointstore.KindFile, FilePath: filepath.Join(t.TempDir(), "leases.db")},
+			wantStore:     true,
+		},
+		"file without path": {
+			configuration: checkpointstore.Configuration{Kind: checkpointstore.KindFile},
+			wantErr:       "file store requires a file path",
+		},
+		"unsupported driver": {
+			configuration: checkpointstore.Configuration{Kind: checkpointstore.KindSQL, SQLDriver: "mysql", SQLDataSource: "db"},
+			wantErr:       `unsupported sql driver "mysql", use postgres or sqlite3`,
+		},
+		"unsupported kind": {
+			configuration: checkpointstore.Configuration{Kind: "redis"},
+			wantErr:       `unsupported checkpoint store "redis"`,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(st *testing.T) {
+			store, err := checkpointstore.Open(c.configuration)
+
+			if c.wantErr != "" {
+				assert.EqualError(st, err, c.wantErr)
+				return
+			}
+			assert.NoError(st, err)
+			assert.Equal(st, c.wantStore, store != nil)
+			if store != nil {
+				assert.NoError(st, store.Close())
+			}
+		})
+	}
+}
+
+// stores returns the stores to test, each one creates an empty store closed at the end of the test.
+func stores() map[string]func(t *testing.T) checkpointstore.Store {
+	return map[string]func(t *testing.T) checkpointstore.Store{
+		"memory": func(t *testing.T) checkpointstore.Store {
+			return checkpointstore.NewMemoryStore()
+		},
+		"file": func(t *testing.T) checkpointstore.Store {
+			store, err := checkpointstore.OpenFileStore(filepath.Join(t.TempDir(), "leases.db"))
+			if err != nil {
+				t.Fatal("unexpected error opening file store", err)
+			}
+			t.Cleanup(func() { store.Close() })
+			return store
+		},
+		"sqlite": func(t *testing.T) checkpointstore.Store {
+			store, err := checkpointstore.OpenSQLStore("sqlite3", filepath.Join(t.TempDir(), "leases.db"))
+			if err != nil {
+				t.Fatal("unexpected error opening sql store", err)
+			}
+			t.Cleanup(func() { store.Close() })
+			return store
+		},
+	}
+}
+
+func newCheckpointer(t *testing.T, store checkpointstore.Store, workerID string) *checkpointstore.Checkpointer {
+	t.Helper()
+	kclConfig := config.NewKinesisClientLibConfig("orders-consumer", "orders", "us-east-1", workerID).
+		WithLeaseStealing(true)
+	checkpointer := checkpointstore.NewCheckpointer(store, kclConfig)
+	if err := checkpointer.Init(); err != nil {
+		t.Fatal("unexpected error initializing checkpointer", err)
+	}
+	return checkpointer
+}
+
+func newShard() *partition.ShardStatus {
+	return &partition.ShardStatus{
+		ID:  "shardId-000000000000",
+		Mux: &sync.RWMutex{},
+	}
+}
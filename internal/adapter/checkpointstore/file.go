@@ -0,0 +1,141 @@
+package checkpointstore
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// fileLockTimeout is how long OpenFileStore waits for another process to release the file.
+const fileLockTimeout = 5 * time.Second
+
+// FileStore keeps the leases in an embedded bbolt database file, a bucket per lease table.
+// The file is locked while the store is open, so the workers using it must share the process.
+type FileStore struct {
+	db *bolt.DB
+}
+
+// OpenFileStore opens the database file, it is created if it doesn't exist.
+func OpenFileStore(filePath string) (*FileStore, error) {
+	db, err := bolt.Open(filePath, 0600, &bolt.Options{Timeout: fileLockTimeout})
+	if err != nil {
+		log.Println("level", "ERROR", "msg", "cannot open checkpoint file", "file", filePath, "error", err)
+		return nil, err
+	}
+	newStore := FileStore{
+		db: db,
+	}
+	return &newStore, nil
+}
+
+// Init creates the lease table if it doesn't exist.
+func (f *FileStore) Init(table string) error {
+	return f.db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(table))
+		return err
+	})
+}
+
+// GetLease returns the lease of the shard or ErrLeaseNotFound.
+func (f *FileStore) GetLease(table, shardID string) (Lease, error) {
+	var lease Lease
+	err := f.db.View(func(tx *bolt.Tx) error {
+		var err error
+		lease, err = readLease(tx, table, shardID)
+		return err
+	})
+	return lease, err
+}
+
+// PutLease writes the lease whatever its version is.
+func (f *FileStore) PutLease(table string, lease Lease) error {
+	return f.db.Update(func(tx *bolt.Tx) error {
+		current, err := readLease(tx, table, lease.ShardID)
+		if err != nil && !errors.Is(err, ErrLeaseNotFound) {
+			return err
+		}
+		return writeLease(tx, table, lease, current.Version)
+	})
+}
+
+// SwapLease writes the lease only if the stored one has the given version.
+func (f *FileStore) SwapLease(table string, lease Lease, version int64) error {
+	return f.db.Update(func(tx *bolt.Tx) error {
+		current, err := readLease(tx, table, lease.ShardID)
+		if err != nil && !errors.Is(err, ErrLeaseNotFound) {
+			return err
+		}
+		if current.Version != version {
+			return ErrLeaseChanged
+		}
+		return writeLease(tx, table, lease, version)
+	})
+}
+
+// DeleteLease removes the lease of the shard.
+func (f *FileStore) DeleteLease(table, shardID string) error {
+	return f.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(table))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.Delete([]byte(shardID))
+	})
+}
+
+// ListLeases returns the leases of the table sorted by shard.
+func (f *FileStore) ListLeases(table string) ([]Lease, error) {
+	var leases []Lease
+	err := f.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(table))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(key, value []byte) error {
+			var lease Lease
+			if err := json.Unmarshal(value, &lease); err != nil {
+				return err
+			}
+			leases = append(leases, lease)
+			return nil
+		})
+	})
+	return leases, err
+}
+
+// Close closes the database file.
+func (f *FileStore) Close() error {
+	return f.db.Close()
+}
+
+// readLease reads the lease of the shard in the transaction.
+func readLease(tx *bolt.Tx, table, shardID string) (Lease, error) {
+	bucket := tx.Bucket([]byte(table))
+	if bucket == nil {
+		return Lease{}, ErrLeaseNotFound
+	}
+	value := bucket.Get([]byte(shardID))
+	if value == nil {
+		return Lease{}, ErrLeaseNotFound
+	}
+	var lease Lease
+	err := json.Unmarshal(value, &lease)
+	return lease, err
+}
+
+// writeLease writes the lease in the transaction with the version following the given one.
+func writeLease(tx *bolt.Tx, table string, lease Lease, version int64) error {
+	bucket, err := tx.CreateBucketIfNotExists([]byte(table))
+	if err != nil {
+		return err
+	}
+	lease.Version = version + 1
+	value, err := json.Marshal(lease)
+	if err != nil {
+		return err
+	}
+	return bucket.Put([]byte(lease.ShardID), value)
+}
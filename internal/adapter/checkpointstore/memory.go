@@ -0,0 +1,99 @@
+package checkpointstore
+
+import (
+	"sort"
+	"sync"
+)
+
+// MemoryStore keeps the leases in memory, they are lost when the process ends.
+// It is meant for tests and for single process development.
+type MemoryStore struct {
+	mutex  sync.Mutex
+	tables map[string]map[string]Lease
+}
+
+// NewMemoryStore creates an empty memory store.
+func NewMemoryStore() *MemoryStore {
+	newStore := MemoryStore{
+		tables: make(map[string]map[string]Lease),
+	}
+	return &newStore
+}
+
+// Init creates the lease table if it doesn't exist.
+func (m *MemoryStore) Init(table string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if _, ok := m.tables[table]; !ok {
+		m.tables[table] = make(map[string]Lease)
+	}
+	return nil
+}
+
+// GetLease returns the lease of the shard or ErrLeaseNotFound.
+func (m *MemoryStore) GetLease(table, shardID string) (Lease, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	lease, ok := m.tables[table][shardID]
+	if !ok {
+		return Lease{}, ErrLeaseNotFound
+	}
+	return lease, nil
+}
+
+// PutLease writes the lease whatever its version is.
+func (m *MemoryStore) PutLease(table string, lease Lease) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.write(table, lease)
+	return nil
+}
+
+// SwapLease writes the lease only if the stored one has the given version.
+func (m *MemoryStore) SwapLease(table string, lease Lease, version int64) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.tables[table][lease.ShardID].Version != version {
+		return ErrLeaseChanged
+	}
+	m.write(table, lease)
+	return nil
+}
+
+// DeleteLease removes the lease of the shard.
+func (m *MemoryStore) DeleteLease(table, shardID string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	delete(m.tables[table], shardID)
+	return nil
+}
+
+// ListLeases returns the leases of the table sorted by shard.
+func (m *MemoryStore) ListLeases(table string) ([]Lease, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	leases := make([]Lease, 0, len(m.tables[table]))
+	for _, lease := range m.tables[table] {
+		leases = append(leases, lease)
+	}
+	sort.Slice(leases, func(i, j int) bool {
+		return leases[i].ShardID < leases[j].ShardID
+	})
+	return leases, nil
+}
+
+// Close does nothing, the leases are kept until the store is garbage collected.
+func (m *MemoryStore) Close() error {
+	return nil
+}
+
+// write stores the lease with the next version, the mutex must be held.
+func (m *MemoryStore) write(table string, lease Lease) {
+	leases, ok := m.tables[table]
+	if !ok {
+		leases = make(map[string]Lease)
+		m.tables[table] = leases
+	}
+	lease.Version = leases[lease.ShardID].Version + 1
+	leases[lease.ShardID] = lease
+}
@@ -0,0 +1,227 @@
+package checkpointstore
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// leasesTable is the sql table with the leases of every lease table.
+const leasesTable = "kcl_leases"
+
+// dialect contains what changes between sql databases.
+type dialect struct {
+	// numberedPlaceholders tells if placeholders are $1, $2... instead of ?.
+	numberedPlaceholders bool
+}
+
+// dialects are the supported dialects by database/sql driver name.
+var dialects = map[string]dialect{
+	"postgres": {numberedPlaceholders: true},
+	"sqlite3":  {},
+}
+
+// SQLStore keeps the leases in a table of a sql database, postgres or sqlite.
+// The drivers are registered by the sqldriver package, the sqlite one requires cgo.
+type SQLStore struct {
+	db      *sql.DB
+	dialect dialect
+}
+
+// OpenSQLStore opens the database of the data source with the given driver: postgres or sqlite3.
+// The driver must be registered, e.g. importing the sqldriver package.
+func OpenSQLStore(driver, dataSource string) (*SQLStore, error) {
+	if _, ok := dialects[driver]; !ok {
+		return nil, errors.New("unsupported sql driver")
+	}
+	if !registered(driver) {
+		return nil, fmt.Errorf("sql driver %q is not registered, import the checkpointstore/sqldriver package", driver)
+	}
+	db, err := sql.Open(driver, dataSource)
+	if err != nil {
+		log.Println("level", "ERROR", "msg", "cannot open checkpoint database", "driver", driver, "error", err)
+		return nil, err
+	}
+	return NewSQLStore(db, driver)
+}
+
+// registered tells if the database/sql driver is registered.
+func registered(driver string) bool {
+	for _, v := range sql.Drivers() {
+		if v == driver {
+			return true
+		}
+	}
+	return false
+}
+
+// NewSQLStore creates a store on an open database of the given driver: postgres or sqlite3.
+func NewSQLStore(db *sql.DB, driver string) (*SQLStore, error) {
+	dialect, ok := dialects[driver]
+	if !ok {
+		return nil, errors.New("unsupported sql driver")
+	}
+	newStore := SQLStore{
+		db:      db,
+		dialect: dialect,
+	}
+	return &newStore, nil
+}
+
+// Init creates the leases table if it doesn't exist, it is shared by every lease table.
+func (s *SQLStore) Init(table string) error {
+	_, err := s.db.Exec(`CREATE TABLE IF NOT EXISTS ` + leasesTable + ` (
+		lease_table TEXT NOT NULL,
+		shard_id TEXT NOT NULL,
+		assigned_to TEXT NOT NULL,
+		lease_timeout TEXT NOT NULL,
+		checkpoint TEXT NOT NULL,
+		parent_shard_id TEXT NOT NULL,
+		claim_request TEXT NOT NULL,
+		version BIGINT NOT NULL,
+		PRIMARY KEY (lease_table, shard_id)
+	)`)
+	if err != nil {
+		log.Println("level", "ERROR", "msg", "cannot create checkpoint table", "table", leasesTable, "error", err)
+	}
+	return err
+}
+
+// GetLease returns the lease of the shard or ErrLeaseNotFound.
+func (s *SQLStore) GetLease(table, shardID string) (Lease, error) {
+	row := s.db.QueryRow(s.query(`SELECT shard_id, assigned_to, lease_timeout, checkpoint, parent_shard_id, claim_request, version
+		FROM `+leasesTable+` WHERE lease_table = ? AND shard_id = ?`), table, shardID)
+	lease, err := scanLease(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Lease{}, ErrLeaseNotFound
+	}
+	return lease, err
+}
+
+// PutLease writes the lease whatever its version is.
+func (s *SQLStore) PutLease(table string, lease Lease) error {
+	_, err := s.db.Exec(s.query(`INSERT INTO `+leasesTable+`
+		(lease_table, shard_id, assigned_to, lease_timeout, checkpoint, parent_shard_id, claim_request, version)
+		VALUES (?, ?, ?, ?, ?, ?, ?, 1)
+		ON CONFLICT (lease_table, shard_id) DO UPDATE SET
+		assigned_to = excluded.assigned_to, lease_timeout = excluded.lease_timeout, checkpoint = excluded.checkpoint,
+		parent_shard_id = excluded.parent_shard_id, claim_request = excluded.claim_request,
+		version = `+leasesTable+`.version + 1`), leaseValues(table, lease)...)
+	return err
+}
+
+// SwapLease writes the lease only if the stored one has the given version.
+func (s *SQLStore) SwapLease(table string, lease Lease, version int64) error {
+	var result sql.Result
+	var err error
+	if version == 0 {
+		result, err = s.db.Exec(s.query(`INSERT INTO `+leasesTable+`
+			(lease_table, shard_id, assigned_to, lease_timeout, checkpoint, parent_shard_id, claim_request, version)
+			VALUES (?, ?, ?, ?, ?, ?, ?, 1)
+			ON CONFLICT (lease_table, shard_id) DO NOTHING`), leaseValues(table, lease)...)
+	} else {
+		result, err = s.db.Exec(s.query(`UPDATE `+leasesTable+` SET
+			assigned_to = ?, lease_timeout = ?, checkpoint = ?, parent_shard_id = ?, claim_request = ?, version = version + 1
+			WHERE lease_table = ? AND shard_id = ? AND version = ?`),
+			lease.AssignedTo, formatTimeout(lease.LeaseTimeout), lease.Checkpoint, lease.ParentShardID, lease.ClaimRequest,
+			table, lease.ShardID, version)
+	}
+	if err != nil {
+		return err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return ErrLeaseChanged
+	}
+	return nil
+}
+
+// DeleteLease removes the lease of the shard.
+func (s *SQLStore) DeleteLease(table, shardID string) error {
+	_, err := s.db.Exec(s.query(`DELETE FROM `+leasesTable+` WHERE lease_table = ? AND shard_id = ?`), table, shardID)
+	return err
+}
+
+// ListLeases returns the leases of the table sorted by shard.
+func (s *SQLStore) ListLeases(table string) ([]Lease, error) {
+	rows, err := s.db.Query(s.query(`SELECT shard_id, assigned_to, lease_timeout, checkpoint, parent_shard_id, claim_request, version
+		FROM `+leasesTable+` WHERE lease_table = ? ORDER BY shard_id`), table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var leases []Lease
+	for rows.Next() {
+		lease, err := scanLease(rows)
+		if err != nil {
+			return nil, err
+		}
+		leases = append(leases, lease)
+	}
+	return leases, rows.Err()
+}
+
+// Close closes the database.
+func (s *SQLStore) Close() error {
+	return s.db.Close()
+}
+
+// query replaces the ? placeholders of the query with the ones of the dialect.
+func (s *SQLStore) query(query string) string {
+	if !s.dialect.numberedPlaceholders {
+		return query
+	}
+	var numbered strings.Builder
+	placeholder := 0
+	for _, char := range query {
+		if char != '?' {
+			numbered.WriteRune(char)
+			continue
+		}
+		placeholder++
+		numbered.WriteString("$" + strconv.Itoa(placeholder))
+	}
+	return numbered.String()
+}
+
+// leaseValues returns the values of the lease for an insert.
+func leaseValues(table string, lease Lease) []interface{} {
+	return []interface{}{
+		table, lease.ShardID, lease.AssignedTo, formatTimeout(lease.LeaseTimeout),
+		lease.Checkpoint, lease.ParentShardID, lease.ClaimRequest,
+	}
+}
+
+// rowScanner is a row of a query, sql.Row or sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanLease reads a lease from a row.
+func scanLease(row rowScanner) (Lease, error) {
+	var lease Lease
+	var leaseTimeout string
+	err := row.Scan(&lease.ShardID, &lease.AssignedTo, &leaseTimeout, &lease.Checkpoint, &lease.ParentShardID, &lease.ClaimRequest, &lease.Version)
+	if err != nil {
+		return Lease{}, err
+	}
+	if leaseTimeout != "" {
+		lease.LeaseTimeout, err = time.Parse(time.RFC3339Nano, leaseTimeout)
+	}
+	return lease, err
+}
+
+// formatTimeout formats the lease timeout, empty when there is none.
+func formatTimeout(leaseTimeout time.Time) string {
+	if leaseTimeout.IsZero() {
+		return ""
+	}
+	return leaseTimeout.UTC().Format(time.RFC3339Nano)
+}
@@ -0,0 +1,14 @@
+// Package sqldriver registers the database/sql drivers of the sql checkpoint store, postgres and
+// sqlite3. The main package of a service that keeps its leases in a sql database imports it for
+// its side effects, so the rest don't link them:
+//
+//	import _ "github.com/fernandoocampo/pubsub-kinesis/internal/adapter/checkpointstore/sqldriver"
+//
+// The sqlite3 driver requires cgo, without it the sqlite store fails when it is opened.
+package sqldriver
+
+import (
+	// drivers of the supported dialects.
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+)
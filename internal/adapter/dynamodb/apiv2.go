@@ -0,0 +1,372 @@
+package dynamodb
+
+import (
+	"errors"
+
+	dynamodbv2 "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// apiV2 adapts an aws-sdk-go-v2 client to the api of the client, converting the inputs and
+// outputs of its operations between both sdk generations.
+type apiV2 struct {
+	client APIV2
+}
+
+// DescribeTableWithContext describes a table.
+func (a *apiV2) DescribeTableWithContext(ctx aws.Context, input *dynamodb.DescribeTableInput, opts ...request.Option) (*dynamodb.DescribeTableOutput, error) {
+	output, err := a.client.DescribeTable(ctx, &dynamodbv2.DescribeTableInput{
+		TableName: input.TableName,
+	})
+	if err != nil {
+		return nil, errorFromV2(err)
+	}
+	table := dynamodb.TableDescription{}
+	if output.Table != nil {
+		table.TableName = output.Table.TableName
+		table.TableArn = output.Table.TableArn
+		table.TableStatus = aws.String(string(output.Table.TableStatus))
+		table.ItemCount = aws.Int64(output.Table.ItemCount)
+		if output.Table.BillingModeSummary != nil {
+			table.BillingModeSummary = &dynamodb.BillingModeSummary{
+				BillingMode: aws.String(string(output.Table.BillingModeSummary.BillingMode)),
+			}
+		}
+		if output.Table.ProvisionedThroughput != nil {
+			table.ProvisionedThroughput = &dynamodb.ProvisionedThroughputDescription{
+				ReadCapacityUnits:  output.Table.ProvisionedThroughput.ReadCapacityUnits,
+				WriteCapacityUnits: output.Table.ProvisionedThroughput.WriteCapacityUnits,
+			}
+		}
+		if output.Table.SSEDescription != nil {
+			table.SSEDescription = &dynamodb.SSEDescription{
+				Status:          aws.String(string(output.Table.SSEDescription.Status)),
+				SSEType:         aws.String(string(output.Table.SSEDescription.SSEType)),
+				KMSMasterKeyArn: output.Table.SSEDescription.KMSMasterKeyArn,
+			}
+		}
+	}
+	return &dynamodb.DescribeTableOutput{Table: &table}, nil
+}
+
+// ScanWithContext reads a page of the items of a table.
+func (a *apiV2) ScanWithContext(ctx aws.Context, input *dynamodb.ScanInput, opts ...request.Option) (*dynamodb.ScanOutput, error) {
+	output, err := a.client.Scan(ctx, &dynamodbv2.ScanInput{
+		TableName:         input.TableName,
+		ConsistentRead:    input.ConsistentRead,
+		ExclusiveStartKey: itemToV2(input.ExclusiveStartKey),
+		Limit:             int32Pointer(input.Limit),
+	})
+	if err != nil {
+		return nil, errorFromV2(err)
+	}
+	items := make([]map[string]*dynamodb.AttributeValue, 0, len(output.Items))
+	for _, item := range output.Items {
+		items = append(items, itemFromV2(item))
+	}
+	return &dynamodb.ScanOutput{
+		Items:            items,
+		LastEvaluatedKey: itemFromV2(output.LastEvaluatedKey),
+	}, nil
+}
+
+// GetItemWithContext reads an item of a table.
+func (a *apiV2) GetItemWithContext(ctx aws.Context, input *dynamodb.GetItemInput, opts ...request.Option) (*dynamodb.GetItemOutput, error) {
+	output, err := a.client.GetItem(ctx, &dynamodbv2.GetItemInput{
+		TableName:      input.TableName,
+		ConsistentRead: input.ConsistentRead,
+		Key:            itemToV2(input.Key),
+	})
+	if err != nil {
+		return nil, errorFromV2(err)
+	}
+	return &dynamodb.GetItemOutput{
+		Item: itemFromV2(output.Item),
+	}, nil
+}
+
+// UpdateItemWithContext updates an item of a table.
+func (a *apiV2) UpdateItemWithContext(ctx aws.Context, input *dynamodb.UpdateItemInput, opts ...request.Option) (*dynamodb.UpdateItemOutput, error) {
+	_, err := a.client.UpdateItem(ctx, &dynamodbv2.UpdateItemInput{
+		TableName:                 input.TableName,
+		Key:                       itemToV2(input.Key),
+		UpdateExpression:          input.UpdateExpression,
+		ConditionExpression:       input.ConditionExpression,
+		ExpressionAttributeNames:  aws.StringValueMap(input.ExpressionAttributeNames),
+		ExpressionAttributeValues: itemToV2(input.ExpressionAttributeValues),
+	})
+	if err != nil {
+		return nil, errorFromV2(err)
+	}
+	return &dynamodb.UpdateItemOutput{}, nil
+}
+
+// CreateTableWithContext creates a table.
+func (a *apiV2) CreateTableWithContext(ctx aws.Context, input *dynamodb.CreateTableInput, opts ...request.Option) (*dynamodb.CreateTableOutput, error) {
+	converted := dynamodbv2.CreateTableInput{
+		TableName:             input.TableName,
+		BillingMode:           types.BillingMode(aws.StringValue(input.BillingMode)),
+		ProvisionedThroughput: provisionedThroughputToV2(input.ProvisionedThroughput),
+		SSESpecification:      sseSpecificationToV2(input.SSESpecification),
+		Tags:                  tagsToV2(input.Tags),
+	}
+	for _, definition := range input.AttributeDefinitions {
+		converted.AttributeDefinitions = append(converted.AttributeDefinitions, types.AttributeDefinition{
+			AttributeName: definition.AttributeName,
+			AttributeType: types.ScalarAttributeType(aws.StringValue(definition.AttributeType)),
+		})
+	}
+	for _, element := range input.KeySchema {
+		converted.KeySchema = append(converted.KeySchema, types.KeySchemaElement{
+			AttributeName: element.AttributeName,
+			KeyType:       types.KeyType(aws.StringValue(element.KeyType)),
+		})
+	}
+	_, err := a.client.CreateTable(ctx, &converted)
+	if err != nil {
+		return nil, errorFromV2(err)
+	}
+	return &dynamodb.CreateTableOutput{}, nil
+}
+
+// UpdateTableWithContext updates the billing mode, capacity or encryption of a table.
+func (a *apiV2) UpdateTableWithContext(ctx aws.Context, input *dynamodb.UpdateTableInput, opts ...request.Option) (*dynamodb.UpdateTableOutput, error) {
+	_, err := a.client.UpdateTable(ctx, &dynamodbv2.UpdateTableInput{
+		TableName:             input.TableName,
+		BillingMode:           types.BillingMode(aws.StringValue(input.BillingMode)),
+		ProvisionedThroughput: provisionedThroughputToV2(input.ProvisionedThroughput),
+		SSESpecification:      sseSpecificationToV2(input.SSESpecification),
+	})
+	if err != nil {
+		return nil, errorFromV2(err)
+	}
+	return &dynamodb.UpdateTableOutput{}, nil
+}
+
+// DeleteTableWithContext deletes a table.
+func (a *apiV2) DeleteTableWithContext(ctx aws.Context, input *dynamodb.DeleteTableInput, opts ...request.Option) (*dynamodb.DeleteTableOutput, error) {
+	_, err := a.client.DeleteTable(ctx, &dynamodbv2.DeleteTableInput{
+		TableName: input.TableName,
+	})
+	if err != nil {
+		return nil, errorFromV2(err)
+	}
+	return &dynamodb.DeleteTableOutput{}, nil
+}
+
+// DescribeContinuousBackupsWithContext describes the backups of a table.
+func (a *apiV2) DescribeContinuousBackupsWithContext(ctx aws.Context, input *dynamodb.DescribeContinuousBackupsInput, opts ...request.Option) (*dynamodb.DescribeContinuousBackupsOutput, error) {
+	output, err := a.client.DescribeContinuousBackups(ctx, &dynamodbv2.DescribeContinuousBackupsInput{
+		TableName: input.TableName,
+	})
+	if err != nil {
+		return nil, errorFromV2(err)
+	}
+	description := dynamodb.ContinuousBackupsDescription{}
+	if output.ContinuousBackupsDescription != nil {
+		description.ContinuousBackupsStatus = aws.String(string(output.ContinuousBackupsDescription.ContinuousBackupsStatus))
+		if output.ContinuousBackupsDescription.PointInTimeRecoveryDescription != nil {
+			description.PointInTimeRecoveryDescription = &dynamodb.PointInTimeRecoveryDescription{
+				PointInTimeRecoveryStatus: aws.String(string(output.ContinuousBackupsDescription.PointInTimeRecoveryDescription.PointInTimeRecoveryStatus)),
+			}
+		}
+	}
+	return &dynamodb.DescribeContinuousBackupsOutput{ContinuousBackupsDescription: &description}, nil
+}
+
+// UpdateContinuousBackupsWithContext enables or disables the point in time recovery of a table.
+func (a *apiV2) UpdateContinuousBackupsWithContext(ctx aws.Context, input *dynamodb.UpdateContinuousBackupsInput, opts ...request.Option) (*dynamodb.UpdateContinuousBackupsOutput, error) {
+	converted := dynamodbv2.UpdateContinuousBackupsInput{
+		TableName: input.TableName,
+	}
+	if input.PointInTimeRecoverySpecification != nil {
+		converted.PointInTimeRecoverySpecification = &types.PointInTimeRecoverySpecification{
+			PointInTimeRecoveryEnabled: input.PointInTimeRecoverySpecification.PointInTimeRecoveryEnabled,
+		}
+	}
+	_, err := a.client.UpdateContinuousBackups(ctx, &converted)
+	if err != nil {
+		return nil, errorFromV2(err)
+	}
+	return &dynamodb.UpdateContinuousBackupsOutput{}, nil
+}
+
+// ListTagsOfResourceWithContext reads a page of the tags of a resource.
+func (a *apiV2) ListTagsOfResourceWithContext(ctx aws.Context, input *dynamodb.ListTagsOfResourceInput, opts ...request.Option) (*dynamodb.ListTagsOfResourceOutput, error) {
+	output, err := a.client.ListTagsOfResource(ctx, &dynamodbv2.ListTagsOfResourceInput{
+		ResourceArn: input.ResourceArn,
+		NextToken:   input.NextToken,
+	})
+	if err != nil {
+		return nil, errorFromV2(err)
+	}
+	tags := make([]*dynamodb.Tag, 0, len(output.Tags))
+	for _, tag := range output.Tags {
+		tags = append(tags, &dynamodb.Tag{Key: tag.Key, Value: tag.Value})
+	}
+	return &dynamodb.ListTagsOfResourceOutput{Tags: tags, NextToken: output.NextToken}, nil
+}
+
+// TagResourceWithContext adds tags to a resource.
+func (a *apiV2) TagResourceWithContext(ctx aws.Context, input *dynamodb.TagResourceInput, opts ...request.Option) (*dynamodb.TagResourceOutput, error) {
+	_, err := a.client.TagResource(ctx, &dynamodbv2.TagResourceInput{
+		ResourceArn: input.ResourceArn,
+		Tags:        tagsToV2(input.Tags),
+	})
+	if err != nil {
+		return nil, errorFromV2(err)
+	}
+	return &dynamodb.TagResourceOutput{}, nil
+}
+
+// errorFromV2 returns the errors callers check by code as the aws-sdk-go errors of the same code,
+// so they are checked like with aws-sdk-go clients.
+func errorFromV2(err error) error {
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, conditionFailed.ErrorMessage(), err)
+	}
+	var notFound *types.ResourceNotFoundException
+	if errors.As(err, &notFound) {
+		return awserr.New(dynamodb.ErrCodeResourceNotFoundException, notFound.ErrorMessage(), err)
+	}
+	var inUse *types.ResourceInUseException
+	if errors.As(err, &inUse) {
+		return awserr.New(dynamodb.ErrCodeResourceInUseException, inUse.ErrorMessage(), err)
+	}
+	return err
+}
+
+// provisionedThroughputToV2 converts an optional provisioned throughput to the types of aws-sdk-go-v2.
+func provisionedThroughputToV2(throughput *dynamodb.ProvisionedThroughput) *types.ProvisionedThroughput {
+	if throughput == nil {
+		return nil
+	}
+	return &types.ProvisionedThroughput{
+		ReadCapacityUnits:  throughput.ReadCapacityUnits,
+		WriteCapacityUnits: throughput.WriteCapacityUnits,
+	}
+}
+
+// sseSpecificationToV2 converts an optional encryption specification to the types of aws-sdk-go-v2.
+func sseSpecificationToV2(specification *dynamodb.SSESpecification) *types.SSESpecification {
+	if specification == nil {
+		return nil
+	}
+	return &types.SSESpecification{
+		Enabled:        specification.Enabled,
+		SSEType:        types.SSEType(aws.StringValue(specification.SSEType)),
+		KMSMasterKeyId: specification.KMSMasterKeyId,
+	}
+}
+
+// tagsToV2 converts tags to the types of aws-sdk-go-v2.
+func tagsToV2(tags []*dynamodb.Tag) []types.Tag {
+	if tags == nil {
+		return nil
+	}
+	converted := make([]types.Tag, 0, len(tags))
+	for _, tag := range tags {
+		converted = append(converted, types.Tag{Key: tag.Key, Value: tag.Value})
+	}
+	return converted
+}
+
+// itemToV2 converts an item to the types of aws-sdk-go-v2.
+func itemToV2(item map[string]*dynamodb.AttributeValue) map[string]types.AttributeValue {
+	if item == nil {
+		return nil
+	}
+	converted := make(map[string]types.AttributeValue, len(item))
+	for name, value := range item {
+		converted[name] = attributeValueToV2(value)
+	}
+	return converted
+}
+
+// itemFromV2 converts an item from the types of aws-sdk-go-v2.
+func itemFromV2(item map[string]types.AttributeValue) map[string]*dynamodb.AttributeValue {
+	if item == nil {
+		return nil
+	}
+	converted := make(map[string]*dynamodb.AttributeValue, len(item))
+	for name, value := range item {
+		converted[name] = attributeValueFromV2(value)
+	}
+	return converted
+}
+
+// attributeValueToV2 converts an attribute value to the types of aws-sdk-go-v2.
+func attributeValueToV2(value *dynamodb.AttributeValue) types.AttributeValue {
+	switch {
+	case value == nil:
+		return &types.AttributeValueMemberNULL{Value: true}
+	case value.S != nil:
+		return &types.AttributeValueMemberS{Value: aws.StringValue(value.S)}
+	case value.N != nil:
+		return &types.AttributeValueMemberN{Value: aws.StringValue(value.N)}
+	case value.B != nil:
+		return &types.AttributeValueMemberB{Value: value.B}
+	case value.BOOL != nil:
+		return &types.AttributeValueMemberBOOL{Value: aws.BoolValue(value.BOOL)}
+	case value.SS != nil:
+		return &types.AttributeValueMemberSS{Value: aws.StringValueSlice(value.SS)}
+	case value.NS != nil:
+		return &types.AttributeValueMemberNS{Value: aws.StringValueSlice(value.NS)}
+	case value.BS != nil:
+		return &types.AttributeValueMemberBS{Value: value.BS}
+	case value.L != nil:
+		list := make([]types.AttributeValue, 0, len(value.L))
+		for _, item := range value.L {
+			list = append(list, attributeValueToV2(item))
+		}
+		return &types.AttributeValueMemberL{Value: list}
+	case value.M != nil:
+		return &types.AttributeValueMemberM{Value: itemToV2(value.M)}
+	}
+	return &types.AttributeValueMemberNULL{Value: aws.BoolValue(value.NULL)}
+}
+
+// attributeValueFromV2 converts an attribute value from the types of aws-sdk-go-v2.
+func attributeValueFromV2(value types.AttributeValue) *dynamodb.AttributeValue {
+	switch member := value.(type) {
+	case *types.AttributeValueMemberS:
+		return &dynamodb.AttributeValue{S: aws.String(member.Value)}
+	case *types.AttributeValueMemberN:
+		return &dynamodb.AttributeValue{N: aws.String(member.Value)}
+	case *types.AttributeValueMemberB:
+		return &dynamodb.AttributeValue{B: member.Value}
+	case *types.AttributeValueMemberBOOL:
+		return &dynamodb.AttributeValue{BOOL: aws.Bool(member.Value)}
+	case *types.AttributeValueMemberSS:
+		return &dynamodb.AttributeValue{SS: aws.StringSlice(member.Value)}
+	case *types.AttributeValueMemberNS:
+		return &dynamodb.AttributeValue{NS: aws.StringSlice(member.Value)}
+	case *types.AttributeValueMemberBS:
+		return &dynamodb.AttributeValue{BS: member.Value}
+	case *types.AttributeValueMemberL:
+		list := make([]*dynamodb.AttributeValue, 0, len(member.Value))
+		for _, item := range member.Value {
+			list = append(list, attributeValueFromV2(item))
+		}
+		return &dynamodb.AttributeValue{L: list}
+	case *types.AttributeValueMemberM:
+		return &dynamodb.AttributeValue{M: itemFromV2(member.Value)}
+	case *types.AttributeValueMemberNULL:
+		return &dynamodb.AttributeValue{NULL: aws.Bool(member.Value)}
+	}
+	return &dynamodb.AttributeValue{NULL: aws.Bool(true)}
+}
+
+// int32Pointer converts an optional int64 to an optional int32.
+func int32Pointer(value *int64) *int32 {
+	if value == nil {
+		return nil
+	}
+	converted := int32(*value)
+	return &converted
+}
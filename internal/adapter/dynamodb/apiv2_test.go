@@ -0,0 +1,53 @@
+package dynamodb_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	dynamodbv2 "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	awsdynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/fernandoocampo/pubsub-kinesis/internal/adapter/dynamodb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPIV2ConvertsLeaseReadErrors(t *testing.T) {
+	api := dynamodb.NewAPIV2(&missingTableV2Mock{})
+	cases := map[string]func() error{
+		"scan": func() error {
+			_, err := api.ScanWithContext(context.Background(), &awsdynamodb.ScanInput{TableName: aws.String("orders-consumer")})
+			return err
+		},
+		"get_item": func() error {
+			_, err := api.GetItemWithContext(context.Background(), &awsdynamodb.GetItemInput{TableName: aws.String("orders-consumer")})
+			return err
+		},
+	}
+
+	for name, call := range cases {
+		t.Run(name, func(st *testing.T) {
+			err := call()
+
+			var awsErr awserr.Error
+			if assert.True(st, errors.As(err, &awsErr)) {
+				assert.Equal(st, awsdynamodb.ErrCodeResourceNotFoundException, awsErr.Code())
+			}
+		})
+	}
+}
+
+// missingTableV2Mock reads a lease table that doesn't exist with aws-sdk-go-v2.
+type missingTableV2Mock struct {
+	dynamodb.APIV2
+}
+
+func (m *missingTableV2Mock) Scan(ctx context.Context, input *dynamodbv2.ScanInput, optFns ...func(*dynamodbv2.Options)) (*dynamodbv2.ScanOutput, error) {
+	return nil, &types.ResourceNotFoundException{Message: aws.String("table not found")}
+}
+
+func (m *missingTableV2Mock) GetItem(ctx context.Context, input *dynamodbv2.GetItemInput, optFns ...func(*dynamodbv2.Options)) (*dynamodbv2.GetItemOutput, error) {
+	return nil, &types.ResourceNotFoundException{Message: aws.String("table not found")}
+}
@@ -1,20 +1,76 @@
 package dynamodb
 
 import (
+	"context"
+
+	dynamodbv2 "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 )
 
+// API defines the dynamodb operations used by the client, with the types of aws-sdk-go.
+// aws-sdk-go clients implement it, aws-sdk-go-v2 clients are adapted by NewClientV2.
+type API interface {
+	DescribeTableWithContext(ctx aws.Context, input *dynamodb.DescribeTableInput, opts ...request.Option) (*dynamodb.DescribeTableOutput, error)
+	ScanWithContext(ctx aws.Context, input *dynamodb.ScanInput, opts ...request.Option) (*dynamodb.ScanOutput, error)
+	GetItemWithContext(ctx aws.Context, input *dynamodb.GetItemInput, opts ...request.Option) (*dynamodb.GetItemOutput, error)
+	UpdateItemWithContext(ctx aws.Context, input *dynamodb.UpdateItemInput, opts ...request.Option) (*dynamodb.UpdateItemOutput, error)
+	CreateTableWithContext(ctx aws.Context, input *dynamodb.CreateTableInput, opts ...request.Option) (*dynamodb.CreateTableOutput, error)
+	UpdateTableWithContext(ctx aws.Context, input *dynamodb.UpdateTableInput, opts ...request.Option) (*dynamodb.UpdateTableOutput, error)
+	DeleteTableWithContext(ctx aws.Context, input *dynamodb.DeleteTableInput, opts ...request.Option) (*dynamodb.DeleteTableOutput, error)
+	DescribeContinuousBackupsWithContext(ctx aws.Context, input *dynamodb.DescribeContinuousBackupsInput, opts ...request.Option) (*dynamodb.DescribeContinuousBackupsOutput, error)
+	UpdateContinuousBackupsWithContext(ctx aws.Context, input *dynamodb.UpdateContinuousBackupsInput, opts ...request.Option) (*dynamodb.UpdateContinuousBackupsOutput, error)
+	ListTagsOfResourceWithContext(ctx aws.Context, input *dynamodb.ListTagsOfResourceInput, opts ...request.Option) (*dynamodb.ListTagsOfResourceOutput, error)
+	TagResourceWithContext(ctx aws.Context, input *dynamodb.TagResourceInput, opts ...request.Option) (*dynamodb.TagResourceOutput, error)
+}
+
+// APIV2 defines the dynamodb operations used by the client, with the types of aws-sdk-go-v2.
+type APIV2 interface {
+	DescribeTable(ctx context.Context, input *dynamodbv2.DescribeTableInput, optFns ...func(*dynamodbv2.Options)) (*dynamodbv2.DescribeTableOutput, error)
+	Scan(ctx context.Context, input *dynamodbv2.ScanInput, optFns ...func(*dynamodbv2.Options)) (*dynamodbv2.ScanOutput, error)
+	GetItem(ctx context.Context, input *dynamodbv2.GetItemInput, optFns ...func(*dynamodbv2.Options)) (*dynamodbv2.GetItemOutput, error)
+	UpdateItem(ctx context.Context, input *dynamodbv2.UpdateItemInput, optFns ...func(*dynamodbv2.Options)) (*dynamodbv2.UpdateItemOutput, error)
+	CreateTable(ctx context.Context, input *dynamodbv2.CreateTableInput, optFns ...func(*dynamodbv2.Options)) (*dynamodbv2.CreateTableOutput, error)
+	UpdateTable(ctx context.Context, input *dynamodbv2.UpdateTableInput, optFns ...func(*dynamodbv2.Options)) (*dynamodbv2.UpdateTableOutput, error)
+	DeleteTable(ctx context.Context, input *dynamodbv2.DeleteTableInput, optFns ...func(*dynamodbv2.Options)) (*dynamodbv2.DeleteTableOutput, error)
+	DescribeContinuousBackups(ctx context.Context, input *dynamodbv2.DescribeContinuousBackupsInput, optFns ...func(*dynamodbv2.Options)) (*dynamodbv2.DescribeContinuousBackupsOutput, error)
+	UpdateContinuousBackups(ctx context.Context, input *dynamodbv2.UpdateContinuousBackupsInput, optFns ...func(*dynamodbv2.Options)) (*dynamodbv2.UpdateContinuousBackupsOutput, error)
+	ListTagsOfResource(ctx context.Context, input *dynamodbv2.ListTagsOfResourceInput, optFns ...func(*dynamodbv2.Options)) (*dynamodbv2.ListTagsOfResourceOutput, error)
+	TagResource(ctx context.Context, input *dynamodbv2.TagResourceInput, optFns ...func(*dynamodbv2.Options)) (*dynamodbv2.TagResourceOutput, error)
+}
+
 // Client contains data to connect to dynamo service
 type Client struct {
-	dynamoDBClient *dynamodb.DynamoDB
+	dynamoDBClient API
 }
 
 // NewClient creates a new dynamodb client.
 func NewClient(awssession *session.Session) *Client {
 	newDynamoDB := dynamodb.New(awssession)
+	return NewClientWithAPI(newDynamoDB)
+}
+
+// NewClientWithAPI creates a new dynamodb client on the given dynamodb api.
+func NewClientWithAPI(dynamoDBClient API) *Client {
 	newClient := Client{
-		dynamoDBClient: newDynamoDB,
+		dynamoDBClient: dynamoDBClient,
 	}
 	return &newClient
 }
+
+// NewClientV2 creates a new dynamodb client on an aws-sdk-go-v2 dynamodb client, e.g. the one
+// of aws.NewDynamoDBClientV2. It behaves like the clients created with NewClient.
+func NewClientV2(dynamoDBClient APIV2) *Client {
+	return NewClientWithAPI(&apiV2{client: dynamoDBClient})
+}
+
+// TableStatus returns the status of the given table, e.g. ACTIVE.
+func (c *Client) TableStatus(ctx context.Context, tableName string) (string, error) {
+	table, err := c.describeTable(ctx, tableName)
+	if err != nil {
+		return "", err
+	}
+	return aws.StringValue(table.TableStatus), nil
+}
@@ -0,0 +1,6 @@
+package dynamodb
+
+// NewAPIV2 exposes the adapter of aws-sdk-go-v2 clients to the tests.
+func NewAPIV2(client APIV2) API {
+	return &apiV2{client: client}
+}
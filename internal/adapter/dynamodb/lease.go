@@ -0,0 +1,231 @@
+package dynamodb
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/vmware/vmware-go-kcl/clientlibrary/checkpoint"
+)
+
+// LeaseCounterAttribute is the lease counter written by the java kcl. vmware-go-kcl doesn't
+// keep one, so leases written by it have a zero counter.
+const LeaseCounterAttribute = "leaseCounter"
+
+// Lease is an item of a kcl lease table, the state of a shard.
+type Lease struct {
+	ShardID string
+	// Owner is the worker that holds the lease, empty when nobody does.
+	Owner string
+	// Checkpoint is the sequence number the shard was processed up to, checkpoint.ShardEnd once it was completed.
+	Checkpoint string
+	// LeaseTimeout is when the lease expires unless its owner renews it.
+	LeaseTimeout time.Time
+	// LeaseCounter is increased on every renewal by the kcl implementations that keep it.
+	LeaseCounter int64
+	// ParentShardIDs are the shards this one was split or merged from.
+	ParentShardIDs []string
+	// ClaimRequest is the worker that claimed the lease to steal it.
+	ClaimRequest string
+}
+
+// Owned tells if a worker holds the lease.
+func (l Lease) Owned() bool {
+	return l.Owner != ""
+}
+
+// Finished tells if the shard was completely processed.
+func (l Lease) Finished() bool {
+	return l.Checkpoint == checkpoint.ShardEnd
+}
+
+// Expired tells if the lease was not renewed in time at the given time.
+func (l Lease) Expired(now time.Time) bool {
+	return !l.LeaseTimeout.IsZero() && l.LeaseTimeout.Before(now)
+}
+
+// Leases are the leases of a lease table, sorted by shard id.
+type Leases []Lease
+
+// ByWorker returns the owned leases keyed by worker.
+func (l Leases) ByWorker() map[string]Leases {
+	byWorker := make(map[string]Leases)
+	for _, lease := range l {
+		if lease.Owned() {
+			byWorker[lease.Owner] = append(byWorker[lease.Owner], lease)
+		}
+	}
+	return byWorker
+}
+
+// Unowned returns the leases of shards still to process that no worker holds.
+func (l Leases) Unowned() Leases {
+	return l.filter(func(lease Lease) bool {
+		return !lease.Owned() && !lease.Finished()
+	})
+}
+
+// Stale returns the owned leases that expired more than the given grace ago, their
+// owners stopped renewing them, e.g. because they died.
+func (l Leases) Stale(now time.Time, grace time.Duration) Leases {
+	return l.filter(func(lease Lease) bool {
+		return lease.Owned() && !lease.Finished() && lease.Expired(now.Add(-grace))
+	})
+}
+
+// Claimed returns the leases that a worker claimed to steal them.
+func (l Leases) Claimed() Leases {
+	return l.filter(func(lease Lease) bool {
+		return lease.ClaimRequest != ""
+	})
+}
+
+// Finished returns the leases of shards that were completely processed.
+func (l Leases) Finished() Leases {
+	return l.filter(Lease.Finished)
+}
+
+func (l Leases) filter(match func(lease Lease) bool) Leases {
+	filtered := make(Leases, 0, len(l))
+	for _, lease := range l {
+		if match(lease) {
+			filtered = append(filtered, lease)
+		}
+	}
+	return filtered
+}
+
+// LeaseSummary counts the leases of a lease table, e.g. for dashboards.
+type LeaseSummary struct {
+	Total     int
+	Owned     int
+	Unowned   int
+	Finished  int
+	Stale     int
+	Claimed   int
+	PerWorker map[string]int
+}
+
+// Summary counts the leases at the given time, see Stale for the grace.
+func (l Leases) Summary(now time.Time, grace time.Duration) LeaseSummary {
+	summary := LeaseSummary{
+		Total:     len(l),
+		Unowned:   len(l.Unowned()),
+		Finished:  len(l.Finished()),
+		Stale:     len(l.Stale(now, grace)),
+		Claimed:   len(l.Claimed()),
+		PerWorker: make(map[string]int),
+	}
+	for worker, leases := range l.ByWorker() {
+		summary.PerWorker[worker] = len(leases)
+		summary.Owned += len(leases)
+	}
+	return summary
+}
+
+// Leases reads all the leases of the given kcl lease table.
+func (c *Client) Leases(ctx context.Context, tableName string) (Leases, error) {
+	var leases Leases
+	input := dynamodb.ScanInput{
+		TableName:      aws.String(tableName),
+		ConsistentRead: aws.Bool(true),
+	}
+	for {
+		output, err := c.dynamoDBClient.ScanWithContext(ctx, &input)
+		if err != nil {
+			log.Println("level", "ERROR", "msg", "lease table could not be read", "table", tableName, "error", err)
+			return nil, errors.New("lease table could not be read")
+		}
+		for _, item := range output.Items {
+			lease, err := unmarshalLease(item)
+			if err != nil {
+				log.Println("level", "ERROR", "msg", "invalid lease", "table", tableName, "error", err)
+				return nil, errors.New("lease table has invalid leases")
+			}
+			leases = append(leases, lease)
+		}
+		if len(output.LastEvaluatedKey) == 0 {
+			break
+		}
+		input.ExclusiveStartKey = output.LastEvaluatedKey
+	}
+	sort.Slice(leases, func(i, j int) bool {
+		return leases[i].ShardID < leases[j].ShardID
+	})
+	return leases, nil
+}
+
+// Lease reads the lease of a shard, false if the table has none.
+func (c *Client) Lease(ctx context.Context, tableName, shardID string) (Lease, bool, error) {
+	output, err := c.dynamoDBClient.GetItemWithContext(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(tableName),
+		ConsistentRead: aws.Bool(true),
+		Key: map[string]*dynamodb.AttributeValue{
+			checkpoint.LeaseKeyKey: {S: aws.String(shardID)},
+		},
+	})
+	if err != nil {
+		log.Println("level", "ERROR", "msg", "lease could not be read", "table", tableName, "shard", shardID, "error", err)
+		return Lease{}, false, errors.New("lease could not be read")
+	}
+	if len(output.Item) == 0 {
+		return Lease{}, false, nil
+	}
+	lease, err := unmarshalLease(output.Item)
+	if err != nil {
+		log.Println("level", "ERROR", "msg", "invalid lease", "table", tableName, "shard", shardID, "error", err)
+		return Lease{}, false, errors.New("lease is invalid")
+	}
+	return lease, true, nil
+}
+
+// unmarshalLease reads a lease from an item of the lease table.
+func unmarshalLease(item map[string]*dynamodb.AttributeValue) (Lease, error) {
+	lease := Lease{
+		ShardID:      stringAttribute(item, checkpoint.LeaseKeyKey),
+		Owner:        stringAttribute(item, checkpoint.LeaseOwnerKey),
+		Checkpoint:   stringAttribute(item, checkpoint.SequenceNumberKey),
+		ClaimRequest: stringAttribute(item, checkpoint.ClaimRequestKey),
+	}
+	if lease.ShardID == "" {
+		return Lease{}, errors.New("lease without shard id")
+	}
+	if leaseTimeout := stringAttribute(item, checkpoint.LeaseTimeoutKey); leaseTimeout != "" {
+		parsed, err := time.Parse(time.RFC3339, leaseTimeout)
+		if err != nil {
+			return Lease{}, errors.New("lease timeout of shard " + lease.ShardID + " is not a RFC 3339 time")
+		}
+		lease.LeaseTimeout = parsed
+	}
+	if counter, ok := item[LeaseCounterAttribute]; ok && counter.N != nil {
+		parsed, err := strconv.ParseInt(aws.StringValue(counter.N), 10, 64)
+		if err != nil {
+			return Lease{}, errors.New("lease counter of shard " + lease.ShardID + " is not a number")
+		}
+		lease.LeaseCounter = parsed
+	}
+	if parent, ok := item[checkpoint.ParentShardIdKey]; ok {
+		switch {
+		case parent.S != nil:
+			lease.ParentShardIDs = []string{aws.StringValue(parent.S)}
+		case len(parent.SS) > 0:
+			lease.ParentShardIDs = aws.StringValueSlice(parent.SS)
+			sort.Strings(lease.ParentShardIDs)
+		}
+	}
+	return lease, nil
+}
+
+// stringAttribute returns the string attribute of the item, empty if it is not set.
+func stringAttribute(item map[string]*dynamodb.AttributeValue, name string) string {
+	value, ok := item[name]
+	if !ok {
+		return ""
+	}
+	return aws.StringValue(value.S)
+}
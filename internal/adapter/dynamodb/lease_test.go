@@ -0,0 +1,286 @@
+package dynamodb_test
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	dynamodbv2 "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	awsdynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/fernandoocampo/pubsub-kinesis/internal/adapter/dynamodb"
+	"github.com/stretchr/testify/assert"
+)
+
+var now = time.Date(2021, 5, 1, 12, 0, 0, 0, time.UTC)
+
+// leaseTable is the content of a lease table, used by the mocked clients of both sdk generations.
+var leaseTable = []leaseItem{
+	{shardID: "shardId-000000000003", owner: "worker-1", checkpoint: "300", timeout: now.Add(time.Minute)},
+	{shardID: "shardId-000000000000", checkpoint: "SHARD_END"},
+	{shardID: "shardId-000000000001", owner: "worker-1", checkpoint: "100", timeout: now.Add(time.Minute), parents: []string{"shardId-000000000000"}, counter: 7},
+	{shardID: "shardId-000000000002", owner: "worker-2", checkpoint: "200", timeout: now.Add(-time.Hour), claim: "worker-1"},
+	{shardID: "shardId-000000000004", parents: []string{"shardId-000000000002", "shardId-000000000001"}},
+}
+
+// leaseSDK creates clients on a mocked lease table of a sdk generation, so every test runs against both of them.
+type leaseSDK struct {
+	name      string
+	newClient func(items []leaseItem) *dynamodb.Client
+}
+
+func leaseSDKs() []leaseSDK {
+	return []leaseSDK{
+		{
+			name: "aws-sdk-go",
+			newClient: func(items []leaseItem) *dynamodb.Client {
+				return dynamodb.NewClientWithAPI(&leaseTableMock{items: items})
+			},
+		},
+		{
+			name: "aws-sdk-go-v2",
+			newClient: func(items []leaseItem) *dynamodb.Client {
+				return dynamodb.NewClientV2(&leaseTableV2Mock{items: items})
+			},
+		},
+	}
+}
+
+func TestLeases(t *testing.T) {
+	for _, sdk := range leaseSDKs() {
+		t.Run(sdk.name, func(st *testing.T) {
+			client := sdk.newClient(leaseTable)
+
+			leases, err := client.Leases(context.Background(), "orders-consumer")
+
+			assert.NoError(st, err)
+			assert.Len(st, leases, 5)
+			assert.Equal(st, dynamodb.Lease{
+				ShardID:        "shardId-000000000001",
+				Owner:          "worker-1",
+				Checkpoint:     "100",
+				LeaseTimeout:   now.Add(time.Minute),
+				LeaseCounter:   7,
+				ParentShardIDs: []string{"shardId-000000000000"},
+			}, leases[1])
+			assert.Equal(st, "worker-1", leases[2].ClaimRequest)
+			assert.Equal(st, []string{"shardId-000000000001", "shardId-000000000002"}, leases[4].ParentShardIDs)
+		})
+	}
+}
+
+func TestLease(t *testing.T) {
+	for _, sdk := range leaseSDKs() {
+		t.Run(sdk.name, func(st *testing.T) {
+			client := sdk.newClient(leaseTable)
+
+			lease, ok, err := client.Lease(context.Background(), "orders-consumer", "shardId-000000000002")
+			assert.NoError(st, err)
+			assert.True(st, ok)
+			assert.Equal(st, "worker-2", lease.Owner)
+
+			_, ok, err = client.Lease(context.Background(), "orders-consumer", "shardId-000000000009")
+			assert.NoError(st, err)
+			assert.False(st, ok)
+		})
+	}
+}
+
+func TestLeasesRejectsInvalidLeases(t *testing.T) {
+	for _, sdk := range leaseSDKs() {
+		t.Run(sdk.name, func(st *testing.T) {
+			client := sdk.newClient([]leaseItem{{shardID: "shardId-000000000000", rawTimeout: "yesterday"}})
+
+			_, err := client.Leases(context.Background(), "orders-consumer")
+
+			assert.Error(st, err)
+		})
+	}
+}
+
+func TestLeaseViews(t *testing.T) {
+	client := dynamodb.NewClientWithAPI(&leaseTableMock{items: leaseTable})
+	leases, err := client.Leases(context.Background(), "orders-consumer")
+	assert.NoError(t, err)
+
+	byWorker := leases.ByWorker()
+	assert.Len(t, byWorker, 2)
+	assert.Equal(t, []string{"shardId-000000000001", "shardId-000000000003"}, shardIDs(byWorker["worker-1"]))
+	assert.Equal(t, []string{"shardId-000000000002"}, shardIDs(byWorker["worker-2"]))
+	assert.Equal(t, []string{"shardId-000000000004"}, shardIDs(leases.Unowned()))
+	assert.Equal(t, []string{"shardId-000000000002"}, shardIDs(leases.Stale(now, time.Minute)))
+	assert.Empty(t, leases.Stale(now, 2*time.Hour))
+	assert.Equal(t, []string{"shardId-000000000002"}, shardIDs(leases.Claimed()))
+	assert.Equal(t, []string{"shardId-000000000000"}, shardIDs(leases.Finished()))
+	assert.Equal(t, dynamodb.LeaseSummary{
+		Total:     5,
+		Owned:     3,
+		Unowned:   1,
+		Finished:  1,
+		Stale:     1,
+		Claimed:   1,
+		PerWorker: map[string]int{"worker-1": 2, "worker-2": 1},
+	}, leases.Summary(now, time.Minute))
+}
+
+func shardIDs(leases dynamodb.Leases) []string {
+	result := make([]string, 0, len(leases))
+	for _, v := range leases {
+		result = append(result, v.ShardID)
+	}
+	return result
+}
+
+// leaseItem is a lease table item that can be written with the types of both sdk generations.
+type leaseItem struct {
+	shardID    string
+	owner      string
+	checkpoint string
+	timeout    time.Time
+	rawTimeout string
+	counter    int64
+	parents    []string
+	claim      string
+}
+
+func (l leaseItem) attributes() map[string]string {
+	attributes := map[string]string{"ShardID": l.shardID}
+	if l.owner != "" {
+		attributes["AssignedTo"] = l.owner
+	}
+	if l.checkpoint != "" {
+		attributes["Checkpoint"] = l.checkpoint
+	}
+	if !l.timeout.IsZero() {
+		attributes["LeaseTimeout"] = l.timeout.Format(time.RFC3339)
+	}
+	if l.rawTimeout != "" {
+		attributes["LeaseTimeout"] = l.rawTimeout
+	}
+	if l.claim != "" {
+		attributes["ClaimRequest"] = l.claim
+	}
+	return attributes
+}
+
+func (l leaseItem) v1() map[string]*awsdynamodb.AttributeValue {
+	item := make(map[string]*awsdynamodb.AttributeValue)
+	for name, value := range l.attributes() {
+		item[name] = &awsdynamodb.AttributeValue{S: aws.String(value)}
+	}
+	if l.counter > 0 {
+		item["leaseCounter"] = &awsdynamodb.AttributeValue{N: aws.String(strconv.FormatInt(l.counter, 10))}
+	}
+	switch len(l.parents) {
+	case 0:
+	case 1:
+		item["ParentShardId"] = &awsdynamodb.AttributeValue{S: aws.String(l.parents[0])}
+	default:
+		item["ParentShardId"] = &awsdynamodb.AttributeValue{SS: aws.StringSlice(l.parents)}
+	}
+	return item
+}
+
+func (l leaseItem) v2() map[string]types.AttributeValue {
+	item := make(map[string]types.AttributeValue)
+	for name, value := range l.attributes() {
+		item[name] = &types.AttributeValueMemberS{Value: value}
+	}
+	if l.counter > 0 {
+		item["leaseCounter"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(l.counter, 10)}
+	}
+	switch len(l.parents) {
+	case 0:
+	case 1:
+		item["ParentShardId"] = &types.AttributeValueMemberS{Value: l.parents[0]}
+	default:
+		item["ParentShardId"] = &types.AttributeValueMemberSS{Value: l.parents}
+	}
+	return item
+}
+
+// pageSize makes the mocks return several pages, like dynamodb does for big tables.
+const pageSize = 2
+
+// page returns the items of the page that starts after the given shard and the last shard of the page.
+func page(items []leaseItem, startAfter string) ([]leaseItem, string) {
+	start := 0
+	if startAfter != "" {
+		for i, item := range items {
+			if item.shardID == startAfter {
+				start = i + 1
+			}
+		}
+	}
+	end := start + pageSize
+	if end >= len(items) {
+		return items[start:], ""
+	}
+	return items[start:end], items[end-1].shardID
+}
+
+// leaseTableMock is a lease table with the given items, read with aws-sdk-go.
+type leaseTableMock struct {
+	dynamodb.API
+	items []leaseItem
+}
+
+func (d *leaseTableMock) ScanWithContext(ctx aws.Context, input *awsdynamodb.ScanInput, opts ...request.Option) (*awsdynamodb.ScanOutput, error) {
+	var startAfter string
+	if input.ExclusiveStartKey != nil {
+		startAfter = aws.StringValue(input.ExclusiveStartKey["ShardID"].S)
+	}
+	items, last := page(d.items, startAfter)
+	output := awsdynamodb.ScanOutput{}
+	for _, item := range items {
+		output.Items = append(output.Items, item.v1())
+	}
+	if last != "" {
+		output.LastEvaluatedKey = map[string]*awsdynamodb.AttributeValue{"ShardID": {S: aws.String(last)}}
+	}
+	return &output, nil
+}
+
+func (d *leaseTableMock) GetItemWithContext(ctx aws.Context, input *awsdynamodb.GetItemInput, opts ...request.Option) (*awsdynamodb.GetItemOutput, error) {
+	for _, item := range d.items {
+		if item.shardID == aws.StringValue(input.Key["ShardID"].S) {
+			return &awsdynamodb.GetItemOutput{Item: item.v1()}, nil
+		}
+	}
+	return &awsdynamodb.GetItemOutput{}, nil
+}
+
+// leaseTableV2Mock is a lease table with the given items, read with aws-sdk-go-v2.
+type leaseTableV2Mock struct {
+	dynamodb.APIV2
+	items []leaseItem
+}
+
+func (d *leaseTableV2Mock) Scan(ctx context.Context, input *dynamodbv2.ScanInput, optFns ...func(*dynamodbv2.Options)) (*dynamodbv2.ScanOutput, error) {
+	var startAfter string
+	if key, ok := input.ExclusiveStartKey["ShardID"].(*types.AttributeValueMemberS); ok {
+		startAfter = key.Value
+	}
+	items, last := page(d.items, startAfter)
+	output := dynamodbv2.ScanOutput{}
+	for _, item := range items {
+		output.Items = append(output.Items, item.v2())
+	}
+	if last != "" {
+		output.LastEvaluatedKey = map[string]types.AttributeValue{"ShardID": &types.AttributeValueMemberS{Value: last}}
+	}
+	return &output, nil
+}
+
+func (d *leaseTableV2Mock) GetItem(ctx context.Context, input *dynamodbv2.GetItemInput, optFns ...func(*dynamodbv2.Options)) (*dynamodbv2.GetItemOutput, error) {
+	key, _ := input.Key["ShardID"].(*types.AttributeValueMemberS)
+	for _, item := range d.items {
+		if key != nil && item.shardID == key.Value {
+			return &dynamodbv2.GetItemOutput{Item: item.v2()}, nil
+		}
+	}
+	return &dynamodbv2.GetItemOutput{}, nil
+}
@@ -0,0 +1,473 @@
+package dynamodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/kinesis"
+	"github.com/vmware/vmware-go-kcl/clientlibrary/checkpoint"
+)
+
+// PositionType is the kind of position a checkpoint is reset to.
+type PositionType string
+
+// Supported position types.
+const (
+	// PositionTrimHorizon reprocesses the shard from its oldest record.
+	PositionTrimHorizon PositionType = "TRIM_HORIZON"
+	// PositionLatest skips every record the shard has, processing resumes with the next one.
+	PositionLatest PositionType = "LATEST"
+	// PositionSequenceNumber resumes after the given sequence number, like any kcl checkpoint.
+	PositionSequenceNumber PositionType = "AFTER_SEQUENCE_NUMBER"
+	// PositionTimestamp reprocesses the records that arrived at or after the given time.
+	PositionTimestamp PositionType = "AT_TIMESTAMP"
+)
+
+// Position is where a checkpoint is reset to.
+type Position struct {
+	Type PositionType
+	// SequenceNumber is the sequence number of PositionSequenceNumber.
+	SequenceNumber string
+	// Timestamp is the arrival time of PositionTimestamp.
+	Timestamp time.Time
+}
+
+// Validate checks that the position is complete.
+func (p Position) Validate() error {
+	switch p.Type {
+	case PositionTrimHorizon, PositionLatest:
+	case PositionSequenceNumber:
+		if p.SequenceNumber == "" {
+			return errors.New("sequence number position requires a sequence number")
+		}
+	case PositionTimestamp:
+		if p.Timestamp.IsZero() {
+			return errors.New("timestamp position requires a timestamp")
+		}
+	default:
+		return fmt.Errorf("unsupported position type %q", p.Type)
+	}
+	return nil
+}
+
+// lookbacks are the windows before a time searched for the last record that arrived before it.
+// They grow, so quiet shards are not read from their oldest record unless they have to.
+var lookbacks = []time.Duration{
+	time.Minute,
+	10 * time.Minute,
+	time.Hour,
+	6 * time.Hour,
+	24 * time.Hour,
+	7 * 24 * time.Hour,
+}
+
+// maxRecordsPerRead is the maximum number of records returned by a kinesis GetRecords call.
+const maxRecordsPerRead = 10000
+
+// DefaultReadInterval is the default time between GetRecords calls, kinesis allows five reads
+// per second on each shard.
+const DefaultReadInterval = 200 * time.Millisecond
+
+// maxThrottledReads is how many times a read throttled by kinesis is retried.
+const maxThrottledReads = 5
+
+// ShardReader defines the kinesis operations used to resolve positions to sequence numbers.
+// aws-sdk-go kinesis clients implement it.
+type ShardReader interface {
+	ListShardsWithContext(ctx aws.Context, input *kinesis.ListShardsInput, opts ...request.Option) (*kinesis.ListShardsOutput, error)
+	GetShardIteratorWithContext(ctx aws.Context, input *kinesis.GetShardIteratorInput, opts ...request.Option) (*kinesis.GetShardIteratorOutput, error)
+	GetRecordsWithContext(ctx aws.Context, input *kinesis.GetRecordsInput, opts ...request.Option) (*kinesis.GetRecordsOutput, error)
+}
+
+// ResetRequest contains data to reset checkpoints of a lease table.
+type ResetRequest struct {
+	TableName  string
+	StreamName string
+	Position   Position
+	// Force resets leases held by workers. Their owners are removed, but a running owner keeps
+	// the shard in memory and writes its own checkpoint back the next time it renews the lease,
+	// so force is meant for workers that are known to be stopped or dead.
+	Force bool
+	// ReadInterval is the time between GetRecords calls while resolving the position,
+	// DefaultReadInterval when it is zero. Reads throttled by kinesis are retried.
+	ReadInterval time.Duration
+}
+
+// CheckpointReset is a checkpoint changed by a reset.
+type CheckpointReset struct {
+	ShardID  string
+	Previous string
+	// Checkpoint is the new checkpoint, processing resumes after it.
+	Checkpoint string
+	// Skipped tells that the lease was left as it was because its shard is finished and the
+	// stream no longer has it, e.g. a parent shard past the retention period.
+	Skipped bool
+}
+
+// LiveLeasesError is returned when checkpoints are not reset because workers hold live leases.
+type LiveLeasesError struct {
+	Leases Leases
+}
+
+// Error describes the live leases.
+func (e *LiveLeasesError) Error() string {
+	leases := make([]string, 0, len(e.Leases))
+	for _, lease := range e.Leases {
+		leases = append(leases, lease.ShardID+" ("+lease.Owner+")")
+	}
+	return "workers hold live leases: " + strings.Join(leases, ", ")
+}
+
+// ResetCheckpoint resets the checkpoint of a shard to the requested position.
+func (c *Client) ResetCheckpoint(ctx context.Context, reader ShardReader, request ResetRequest, shardID string) (CheckpointReset, error) {
+	if err := request.Position.Validate(); err != nil {
+		return CheckpointReset{}, err
+	}
+	lease, ok, err := c.Lease(ctx, request.TableName, shardID)
+	if err != nil {
+		return CheckpointReset{}, err
+	}
+	if !ok {
+		return CheckpointReset{}, fmt.Errorf("lease table %s has no lease for shard %s", request.TableName, shardID)
+	}
+	resets, err := c.resetCheckpoints(ctx, reader, request, Leases{lease})
+	if err != nil {
+		return CheckpointReset{}, err
+	}
+	return resets[0], nil
+}
+
+// ResetCheckpoints resets the checkpoints of every shard of the lease table to the requested
+// position. Sequence numbers belong to a single shard, so they can only be used with ResetCheckpoint.
+func (c *Client) ResetCheckpoints(ctx context.Context, reader ShardReader, request ResetRequest) ([]CheckpointReset, error) {
+	if err := request.Position.Validate(); err != nil {
+		return nil, err
+	}
+	if request.Position.Type == PositionSequenceNumber {
+		return nil, errors.New("sequence number position can only reset a single shard")
+	}
+	leases, err := c.Leases(ctx, request.TableName)
+	if err != nil {
+		return nil, err
+	}
+	return c.resetCheckpoints(ctx, reader, request, leases)
+}
+
+// resetCheckpoints resolves the position of every lease and writes them. Nothing is written
+// if a lease is live and the request is not forced, or if a position can't be resolved.
+// Finished shards the stream no longer has are skipped.
+func (c *Client) resetCheckpoints(ctx context.Context, reader ShardReader, request ResetRequest, leases Leases) ([]CheckpointReset, error) {
+	now := time.Now()
+	live := leases.filter(func(lease Lease) bool {
+		return lease.Owned() && !lease.Expired(now)
+	})
+	if len(live) > 0 && !request.Force {
+		return nil, &LiveLeasesError{Leases: live}
+	}
+	resolver := newPositionResolver(reader, request.StreamName, request.ReadInterval)
+	resets := make([]CheckpointReset, 0, len(leases))
+	for _, lease := range leases {
+		if lease.Finished() {
+			exists, err := resolver.hasShard(ctx, lease.ShardID)
+			if err != nil {
+				return nil, err
+			}
+			if !exists {
+				resets = append(resets, CheckpointReset{
+					ShardID:    lease.ShardID,
+					Previous:   lease.Checkpoint,
+					Checkpoint: lease.Checkpoint,
+					Skipped:    true,
+				})
+				continue
+			}
+		}
+		sequenceNumber, err := resolver.resolve(ctx, lease.ShardID, request.Position, now)
+		if err != nil {
+			return nil, err
+		}
+		resets = append(resets, CheckpointReset{
+			ShardID:    lease.ShardID,
+			Previous:   lease.Checkpoint,
+			Checkpoint: sequenceNumber,
+		})
+	}
+	for i, reset := range resets {
+		if reset.Skipped {
+			log.Println("level", "INFO", "msg", "checkpoint of finished shard kept, the stream no longer has it", "table", request.TableName, "shard", reset.ShardID)
+			continue
+		}
+		err := c.writeCheckpoint(ctx, request, leases[i], reset.Checkpoint)
+		if err != nil {
+			return resets[:i], err
+		}
+		log.Println("level", "INFO", "msg", "checkpoint reset", "table", request.TableName, "shard", reset.ShardID, "previous", reset.Previous, "checkpoint", reset.Checkpoint)
+	}
+	return resets, nil
+}
+
+// writeCheckpoint sets the checkpoint of the lease and releases it, so the next worker that
+// takes it reads the new checkpoint. The write fails if the lease changed since it was read,
+// unless the request is forced.
+func (c *Client) writeCheckpoint(ctx context.Context, request ResetRequest, lease Lease, sequenceNumber string) error {
+	input := dynamodb.UpdateItemInput{
+		TableName: aws.String(request.TableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			checkpoint.LeaseKeyKey: {S: aws.String(lease.ShardID)},
+		},
+		UpdateExpression: aws.String("SET #checkpoint = :checkpoint REMOVE #owner, #timeout, #claim"),
+		ExpressionAttributeNames: map[string]*string{
+			"#shard":      aws.String(checkpoint.LeaseKeyKey),
+			"#checkpoint": aws.String(checkpoint.SequenceNumberKey),
+			"#owner":      aws.String(checkpoint.LeaseOwnerKey),
+			"#timeout":    aws.String(checkpoint.LeaseTimeoutKey),
+			"#claim":      aws.String(checkpoint.ClaimRequestKey),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":checkpoint": {S: aws.String(sequenceNumber)},
+		},
+	}
+	conditions := []string{"attribute_exists(#shard)"}
+	if !request.Force {
+		conditions = append(conditions, unchangedCondition(lease, input.ExpressionAttributeValues)...)
+	}
+	input.ConditionExpression = aws.String(strings.Join(conditions, " AND "))
+	_, err := c.dynamoDBClient.UpdateItemWithContext(ctx, &input)
+	if err != nil {
+		var awsErr awserr.Error
+		if errors.As(err, &awsErr) && awsErr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			return fmt.Errorf("lease of shard %s changed while resetting its checkpoint", lease.ShardID)
+		}
+		log.Println("level", "ERROR", "msg", "checkpoint could not be reset", "table", request.TableName, "shard", lease.ShardID, "error", err)
+		return errors.New("checkpoint could not be reset")
+	}
+	return nil
+}
+
+// unchangedCondition returns the conditions that hold while the lease is as it was read,
+// adding the values they use.
+func unchangedCondition(lease Lease, values map[string]*dynamodb.AttributeValue) []string {
+	var conditions []string
+	if lease.Owned() {
+		conditions = append(conditions, "#owner = :owner")
+		values[":owner"] = &dynamodb.AttributeValue{S: aws.String(lease.Owner)}
+	} else {
+		conditions = append(conditions, "attribute_not_exists(#owner)")
+	}
+	if !lease.LeaseTimeout.IsZero() {
+		conditions = append(conditions, "#timeout = :timeout")
+		values[":timeout"] = &dynamodb.AttributeValue{S: aws.String(lease.LeaseTimeout.Format(time.RFC3339))}
+	}
+	if lease.Checkpoint != "" {
+		conditions = append(conditions, "#checkpoint = :previous")
+		values[":previous"] = &dynamodb.AttributeValue{S: aws.String(lease.Checkpoint)}
+	} else {
+		conditions = append(conditions, "attribute_not_exists(#checkpoint)")
+	}
+	return conditions
+}
+
+// positionResolver resolves positions of the shards of a stream to the sequence numbers kcl
+// resumes after. vmware-go-kcl always resumes after the checkpoint, so a position is resolved
+// to the record that precedes it, or to the starting sequence number of the shard when no
+// record does.
+type positionResolver struct {
+	reader     ShardReader
+	streamName string
+	// readInterval is the time between GetRecords calls.
+	readInterval time.Duration
+	// lastRead is when GetRecords was last called.
+	lastRead time.Time
+	// startingSequenceNumbers of the shards of the stream, read on first use.
+	startingSequenceNumbers map[string]string
+}
+
+func newPositionResolver(reader ShardReader, streamName string, readInterval time.Duration) *positionResolver {
+	if readInterval <= 0 {
+		readInterval = DefaultReadInterval
+	}
+	newPositionResolver := positionResolver{
+		reader:       reader,
+		streamName:   streamName,
+		readInterval: readInterval,
+	}
+	return &newPositionResolver
+}
+
+// resolve returns the checkpoint of the shard for the position, now is the time of LATEST.
+func (p *positionResolver) resolve(ctx context.Context, shardID string, position Position, now time.Time) (string, error) {
+	switch position.Type {
+	case PositionSequenceNumber:
+		return position.SequenceNumber, nil
+	case PositionTrimHorizon:
+		return p.startingSequenceNumber(ctx, shardID)
+	case PositionLatest:
+		return p.lastRecordBefore(ctx, shardID, now)
+	}
+	return p.lastRecordBefore(ctx, shardID, position.Timestamp)
+}
+
+// lastRecordBefore returns the sequence number of the last record that arrived before the given
+// time, searching in growing windows before it.
+func (p *positionResolver) lastRecordBefore(ctx context.Context, shardID string, before time.Time) (string, error) {
+	for _, lookback := range lookbacks {
+		sequenceNumber, err := p.readUntil(ctx, &kinesis.GetShardIteratorInput{
+			StreamName:        aws.String(p.streamName),
+			ShardId:           aws.String(shardID),
+			ShardIteratorType: aws.String(kinesis.ShardIteratorTypeAtTimestamp),
+			Timestamp:         aws.Time(before.Add(-lookback)),
+		}, before)
+		if err != nil {
+			return "", err
+		}
+		if sequenceNumber != "" {
+			return sequenceNumber, nil
+		}
+	}
+	sequenceNumber, err := p.readUntil(ctx, &kinesis.GetShardIteratorInput{
+		StreamName:        aws.String(p.streamName),
+		ShardId:           aws.String(shardID),
+		ShardIteratorType: aws.String(kinesis.ShardIteratorTypeTrimHorizon),
+	}, before)
+	if err != nil {
+		return "", err
+	}
+	if sequenceNumber != "" {
+		return sequenceNumber, nil
+	}
+	return p.startingSequenceNumber(ctx, shardID)
+}
+
+// readUntil reads the shard from the given iterator and returns the sequence number of the last
+// record that arrived before the given time, empty if none did.
+func (p *positionResolver) readUntil(ctx context.Context, input *kinesis.GetShardIteratorInput, before time.Time) (string, error) {
+	iterator, err := p.reader.GetShardIteratorWithContext(ctx, input)
+	if err != nil {
+		log.Println("level", "ERROR", "msg", "shard iterator could not be obtained", "stream", p.streamName, "shard", aws.StringValue(input.ShardId), "error", err)
+		return "", errors.New("shard iterator could not be obtained")
+	}
+	var last string
+	shardIterator := iterator.ShardIterator
+	for shardIterator != nil {
+		output, err := p.getRecords(ctx, aws.StringValue(input.ShardId), shardIterator)
+		if err != nil {
+			return "", err
+		}
+		for _, record := range output.Records {
+			if !aws.TimeValue(record.ApproximateArrivalTimestamp).Before(before) {
+				return last, nil
+			}
+			last = aws.StringValue(record.SequenceNumber)
+		}
+		if len(output.Records) == 0 && aws.Int64Value(output.MillisBehindLatest) == 0 {
+			break
+		}
+		shardIterator = output.NextShardIterator
+	}
+	return last, nil
+}
+
+// getRecords reads a page of records, waiting the read interval since the previous read.
+// Reads throttled by kinesis are retried, waiting twice as long every time.
+func (p *positionResolver) getRecords(ctx context.Context, shardID string, shardIterator *string) (*kinesis.GetRecordsOutput, error) {
+	delay := p.readInterval
+	for attempt := 0; ; attempt++ {
+		err := wait(ctx, time.Until(p.lastRead.Add(delay)))
+		if err != nil {
+			return nil, err
+		}
+		output, err := p.reader.GetRecordsWithContext(ctx, &kinesis.GetRecordsInput{
+			ShardIterator: shardIterator,
+			Limit:         aws.Int64(maxRecordsPerRead),
+		})
+		p.lastRead = time.Now()
+		if err == nil {
+			return output, nil
+		}
+		var awsErr awserr.Error
+		if errors.As(err, &awsErr) && awsErr.Code() == kinesis.ErrCodeProvisionedThroughputExceededException && attempt < maxThrottledReads {
+			log.Println("level", "WARN", "msg", "shard read throttled, retrying", "stream", p.streamName, "shard", shardID, "attempt", attempt+1)
+			delay *= 2
+			continue
+		}
+		log.Println("level", "ERROR", "msg", "shard records could not be read", "stream", p.streamName, "shard", shardID, "error", err)
+		return nil, errors.New("shard records could not be read")
+	}
+}
+
+// wait waits the given time or until the context is done.
+func wait(ctx context.Context, delay time.Duration) error {
+	if delay <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// hasShard tells if the stream has the shard.
+func (p *positionResolver) hasShard(ctx context.Context, shardID string) (bool, error) {
+	if p.startingSequenceNumbers == nil {
+		err := p.listShards(ctx)
+		if err != nil {
+			return false, err
+		}
+	}
+	_, ok := p.startingSequenceNumbers[shardID]
+	return ok, nil
+}
+
+// startingSequenceNumber returns the sequence number the shard starts with, it precedes all its records.
+func (p *positionResolver) startingSequenceNumber(ctx context.Context, shardID string) (string, error) {
+	ok, err := p.hasShard(ctx, shardID)
+	if err != nil {
+		return "", err
+	}
+	sequenceNumber := p.startingSequenceNumbers[shardID]
+	if !ok {
+		return "", fmt.Errorf("stream %s has no shard %s", p.streamName, shardID)
+	}
+	return sequenceNumber, nil
+}
+
+// listShards reads the starting sequence numbers of the shards of the stream.
+func (p *positionResolver) listShards(ctx context.Context) error {
+	startingSequenceNumbers := make(map[string]string)
+	input := kinesis.ListShardsInput{
+		StreamName: aws.String(p.streamName),
+	}
+	for {
+		output, err := p.reader.ListShardsWithContext(ctx, &input)
+		if err != nil {
+			log.Println("level", "ERROR", "msg", "shards could not be listed", "stream", p.streamName, "error", err)
+			return errors.New("shards could not be listed")
+		}
+		for _, shard := range output.Shards {
+			if shard.SequenceNumberRange == nil {
+				continue
+			}
+			startingSequenceNumbers[aws.StringValue(shard.ShardId)] = aws.StringValue(shard.SequenceNumberRange.StartingSequenceNumber)
+		}
+		if output.NextToken == nil {
+			break
+		}
+		input = kinesis.ListShardsInput{
+			NextToken: output.NextToken,
+		}
+	}
+	p.startingSequenceNumbers = startingSequenceNumbers
+	return nil
+}
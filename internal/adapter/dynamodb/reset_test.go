@@ -0,0 +1,372 @@
+package dynamodb_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	dynamodbv2 "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	awsdynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/kinesis"
+	"github.com/fernandoocampo/pubsub-kinesis/internal/adapter/dynamodb"
+	"github.com/stretchr/testify/assert"
+)
+
+// resetSDK creates clients on a mocked lease table of a sdk generation, so every test runs against both of them.
+// The clients also return the updates they receive, failing their conditions if asked to.
+type resetSDK struct {
+	name      string
+	newClient func(items []leaseItem, conditionFailed bool) (*dynamodb.Client, func() []update)
+}
+
+func resetSDKs() []resetSDK {
+	return []resetSDK{
+		{
+			name: "aws-sdk-go",
+			newClient: func(items []leaseItem, conditionFailed bool) (*dynamodb.Client, func() []update) {
+				mock := updatingLeaseTableMock{leaseTableMock: leaseTableMock{items: items}, conditionFailed: conditionFailed}
+				return dynamodb.NewClientWithAPI(&mock), func() []update { return mock.updates }
+			},
+		},
+		{
+			name: "aws-sdk-go-v2",
+			newClient: func(items []leaseItem, conditionFailed bool) (*dynamodb.Client, func() []update) {
+				mock := updatingLeaseTableV2Mock{leaseTableV2Mock: leaseTableV2Mock{items: items}, conditionFailed: conditionFailed}
+				return dynamodb.NewClientV2(&mock), func() []update { return mock.updates }
+			},
+		},
+	}
+}
+
+// arrival is the arrival time of the records of the mocked shards.
+var arrival = time.Now().Add(-time.Hour).Truncate(time.Second)
+
+// shardRecords are the records of the mocked stream, they arrived a minute apart from each other.
+var shardRecords = map[string][]string{
+	"shardId-000000000000": {"1001", "1002", "1003", "1004", "1005"},
+	"shardId-000000000001": {"2001", "2002", "2003"},
+	"shardId-000000000002": {},
+}
+
+// readInterval is the time between reads of the mocked shards, which have no read limit.
+const readInterval = time.Millisecond
+
+// expiredLeases are leases of workers that stopped renewing them.
+var expiredLeases = []leaseItem{
+	{shardID: "shardId-000000000000", owner: "worker-1", checkpoint: "1005", timeout: time.Now().Add(-time.Minute)},
+	{shardID: "shardId-000000000001", checkpoint: "2003"},
+	{shardID: "shardId-000000000002"},
+}
+
+func TestResetCheckpointToTimestamp(t *testing.T) {
+	for _, sdk := range resetSDKs() {
+		t.Run(sdk.name, func(st *testing.T) {
+			client, updates := sdk.newClient(expiredLeases, false)
+			request := dynamodb.ResetRequest{
+				TableName:    "orders-consumer",
+				StreamName:   "orders",
+				ReadInterval: readInterval,
+				Position:     dynamodb.Position{Type: dynamodb.PositionTimestamp, Timestamp: arrival.Add(2 * time.Minute)},
+			}
+
+			reset, err := client.ResetCheckpoint(context.Background(), &shardReaderMock{}, request, "shardId-000000000000")
+
+			assert.NoError(st, err)
+			assert.Equal(st, dynamodb.CheckpointReset{ShardID: "shardId-000000000000", Previous: "1005", Checkpoint: "1002"}, reset)
+			assert.Len(st, updates(), 1)
+			assert.Equal(st, "1002", updates()[0].checkpoint)
+			assert.Equal(st, "attribute_exists(#shard) AND #owner = :owner AND #timeout = :timeout AND #checkpoint = :previous", updates()[0].condition)
+		})
+	}
+}
+
+func TestResetCheckpoints(t *testing.T) {
+	cases := map[string]struct {
+		position dynamodb.Position
+		want     []string
+	}{
+		"trim horizon": {
+			position: dynamodb.Position{Type: dynamodb.PositionTrimHorizon},
+			want:     []string{"1000", "2000", "3000"},
+		},
+		"latest": {
+			position: dynamodb.Position{Type: dynamodb.PositionLatest},
+			want:     []string{"1005", "2003", "3000"},
+		},
+		"timestamp before every record": {
+			position: dynamodb.Position{Type: dynamodb.PositionTimestamp, Timestamp: arrival.Add(-time.Hour)},
+			want:     []string{"1000", "2000", "3000"},
+		},
+		"timestamp between records": {
+			position: dynamodb.Position{Type: dynamodb.PositionTimestamp, Timestamp: arrival.Add(90 * time.Second)},
+			want:     []string{"1002", "2002", "3000"},
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(st *testing.T) {
+			client, updates := resetSDKs()[0].newClient(expiredLeases, false)
+			request := dynamodb.ResetRequest{
+				TableName:    "orders-consumer",
+				StreamName:   "orders",
+				ReadInterval: readInterval,
+				Position:     c.position,
+			}
+
+			resets, err := client.ResetCheckpoints(context.Background(), &shardReaderMock{}, request)
+
+			assert.NoError(st, err)
+			checkpoints := make([]string, 0, len(resets))
+			for _, v := range resets {
+				checkpoints = append(checkpoints, v.Checkpoint)
+			}
+			assert.Equal(st, c.want, checkpoints)
+			assert.Len(st, updates(), 3)
+		})
+	}
+}
+
+func TestResetCheckpointsRefusesLiveLeases(t *testing.T) {
+	leases := append([]leaseItem{
+		{shardID: "shardId-000000000003", owner: "worker-2", checkpoint: "4001", timeout: time.Now().Add(time.Minute)},
+	}, expiredLeases...)
+	request := dynamodb.ResetRequest{
+		TableName:    "orders-consumer",
+		StreamName:   "orders",
+		ReadInterval: readInterval,
+		Position:     dynamodb.Position{Type: dynamodb.PositionLatest},
+	}
+	client, updates := resetSDKs()[0].newClient(leases, false)
+
+	_, err := client.ResetCheckpoints(context.Background(), &shardReaderMock{}, request)
+
+	var liveLeasesErr *dynamodb.LiveLeasesError
+	assert.True(t, errors.As(err, &liveLeasesErr))
+	assert.Equal(t, []string{"shardId-000000000003"}, shardIDs(liveLeasesErr.Leases))
+	assert.Empty(t, updates())
+
+	request.Force = true
+	request.Position = dynamodb.Position{Type: dynamodb.PositionSequenceNumber, SequenceNumber: "4000"}
+	reset, err := client.ResetCheckpoint(context.Background(), &shardReaderMock{}, request, "shardId-000000000003")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "4000", reset.Checkpoint)
+	assert.Equal(t, "attribute_exists(#shard)", updates()[0].condition)
+}
+
+func TestResetCheckpointFailures(t *testing.T) {
+	for _, sdk := range resetSDKs() {
+		t.Run(sdk.name, func(st *testing.T) {
+			client, _ := sdk.newClient(expiredLeases, true)
+			request := dynamodb.ResetRequest{
+				TableName:    "orders-consumer",
+				StreamName:   "orders",
+				ReadInterval: readInterval,
+				Position:     dynamodb.Position{Type: dynamodb.PositionSequenceNumber, SequenceNumber: "1003"},
+			}
+
+			_, err := client.ResetCheckpoint(context.Background(), &shardReaderMock{}, request, "shardId-000000000000")
+			assert.EqualError(st, err, "lease of shard shardId-000000000000 changed while resetting its checkpoint")
+
+			_, err = client.ResetCheckpoints(context.Background(), &shardReaderMock{}, request)
+			assert.Error(st, err)
+
+			_, err = client.ResetCheckpoint(context.Background(), &shardReaderMock{}, request, "shardId-000000000009")
+			assert.Error(st, err)
+
+			request.Position = dynamodb.Position{Type: dynamodb.PositionTimestamp}
+			_, err = client.ResetCheckpoint(context.Background(), &shardReaderMock{}, request, "shardId-000000000000")
+			assert.Error(st, err)
+		})
+	}
+}
+
+func TestResetCheckpointsSkipsFinishedShardsTheStreamNoLongerHas(t *testing.T) {
+	leases := []leaseItem{
+		{shardID: "shardId-000000000000", checkpoint: "1005"},
+		{shardID: "shardId-000000000002", checkpoint: "SHARD_END"},
+		{shardID: "shardId-000000000009", checkpoint: "SHARD_END"},
+	}
+	client, updates := resetSDKs()[0].newClient(leases, false)
+	request := dynamodb.ResetRequest{
+		TableName:    "orders-consumer",
+		StreamName:   "orders",
+		Position:     dynamodb.Position{Type: dynamodb.PositionTimestamp, Timestamp: arrival.Add(90 * time.Second)},
+		ReadInterval: readInterval,
+	}
+
+	resets, err := client.ResetCheckpoints(context.Background(), &shardReaderMock{}, request)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []dynamodb.CheckpointReset{
+		{ShardID: "shardId-000000000000", Previous: "1005", Checkpoint: "1002"},
+		{ShardID: "shardId-000000000002", Previous: "SHARD_END", Checkpoint: "3000"},
+		{ShardID: "shardId-000000000009", Previous: "SHARD_END", Checkpoint: "SHARD_END", Skipped: true},
+	}, resets)
+	assert.Len(t, updates(), 2)
+}
+
+func TestResetCheckpointPacesReads(t *testing.T) {
+	reader := throttlingReaderMock{throttled: 2}
+	client, _ := resetSDKs()[0].newClient(expiredLeases, false)
+	request := dynamodb.ResetRequest{
+		TableName:    "orders-consumer",
+		StreamName:   "orders",
+		Position:     dynamodb.Position{Type: dynamodb.PositionLatest},
+		ReadInterval: 20 * time.Millisecond,
+	}
+
+	reset, err := client.ResetCheckpoint(context.Background(), &reader, request, "shardId-000000000000")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "1005", reset.Checkpoint)
+	assert.Greater(t, len(reader.reads), 3)
+	for i := 1; i < len(reader.reads); i++ {
+		assert.GreaterOrEqual(t, int64(reader.reads[i].Sub(reader.reads[i-1])), int64(20*time.Millisecond))
+	}
+	// throttled reads are retried waiting twice as long every time.
+	assert.GreaterOrEqual(t, int64(reader.reads[1].Sub(reader.reads[0])), int64(40*time.Millisecond))
+	assert.GreaterOrEqual(t, int64(reader.reads[2].Sub(reader.reads[1])), int64(80*time.Millisecond))
+}
+
+func TestResetCheckpointStopsRetryingThrottledReads(t *testing.T) {
+	reader := throttlingReaderMock{throttled: 100}
+	client, updates := resetSDKs()[0].newClient(expiredLeases, false)
+	request := dynamodb.ResetRequest{
+		TableName:    "orders-consumer",
+		StreamName:   "orders",
+		Position:     dynamodb.Position{Type: dynamodb.PositionLatest},
+		ReadInterval: readInterval,
+	}
+
+	_, err := client.ResetCheckpoint(context.Background(), &reader, request, "shardId-000000000000")
+
+	assert.EqualError(t, err, "shard records could not be read")
+	assert.Len(t, reader.reads, 6)
+	assert.Empty(t, updates())
+}
+
+// update is an update received by the mocked lease table of any sdk generation.
+type update struct {
+	shardID    string
+	checkpoint string
+	condition  string
+}
+
+// updatingLeaseTableMock is a lease table that keeps the updates it receives with aws-sdk-go.
+type updatingLeaseTableMock struct {
+	leaseTableMock
+	conditionFailed bool
+	updates         []update
+}
+
+func (u *updatingLeaseTableMock) UpdateItemWithContext(ctx aws.Context, input *awsdynamodb.UpdateItemInput, opts ...request.Option) (*awsdynamodb.UpdateItemOutput, error) {
+	if u.conditionFailed {
+		return nil, awserr.New(awsdynamodb.ErrCodeConditionalCheckFailedException, "the conditional request failed", nil)
+	}
+	u.updates = append(u.updates, update{
+		shardID:    aws.StringValue(input.Key["ShardID"].S),
+		checkpoint: aws.StringValue(input.ExpressionAttributeValues[":checkpoint"].S),
+		condition:  aws.StringValue(input.ConditionExpression),
+	})
+	return &awsdynamodb.UpdateItemOutput{}, nil
+}
+
+// updatingLeaseTableV2Mock is a lease table that keeps the updates it receives with aws-sdk-go-v2.
+type updatingLeaseTableV2Mock struct {
+	leaseTableV2Mock
+	conditionFailed bool
+	updates         []update
+}
+
+func (u *updatingLeaseTableV2Mock) UpdateItem(ctx context.Context, input *dynamodbv2.UpdateItemInput, optFns ...func(*dynamodbv2.Options)) (*dynamodbv2.UpdateItemOutput, error) {
+	if u.conditionFailed {
+		return nil, &types.ConditionalCheckFailedException{Message: aws.String("the conditional request failed")}
+	}
+	key, _ := input.Key["ShardID"].(*types.AttributeValueMemberS)
+	checkpoint, _ := input.ExpressionAttributeValues[":checkpoint"].(*types.AttributeValueMemberS)
+	u.updates = append(u.updates, update{
+		shardID:    key.Value,
+		checkpoint: checkpoint.Value,
+		condition:  aws.StringValue(input.ConditionExpression),
+	})
+	return &dynamodbv2.UpdateItemOutput{}, nil
+}
+
+// shardReaderMock reads shardRecords, a page at most pageSize records long.
+type shardReaderMock struct{}
+
+func (s *shardReaderMock) ListShardsWithContext(ctx aws.Context, input *kinesis.ListShardsInput, opts ...request.Option) (*kinesis.ListShardsOutput, error) {
+	output := kinesis.ListShardsOutput{}
+	for i, shardID := range []string{"shardId-000000000000", "shardId-000000000001", "shardId-000000000002"} {
+		output.Shards = append(output.Shards, &kinesis.Shard{
+			ShardId: aws.String(shardID),
+			SequenceNumberRange: &kinesis.SequenceNumberRange{
+				StartingSequenceNumber: aws.String(strconv.Itoa((i + 1) * 1000)),
+			},
+		})
+	}
+	return &output, nil
+}
+
+func (s *shardReaderMock) GetShardIteratorWithContext(ctx aws.Context, input *kinesis.GetShardIteratorInput, opts ...request.Option) (*kinesis.GetShardIteratorOutput, error) {
+	records := shardRecords[aws.StringValue(input.ShardId)]
+	position := 0
+	if aws.StringValue(input.ShardIteratorType) == kinesis.ShardIteratorTypeAtTimestamp {
+		for position < len(records) && recordArrival(position).Before(aws.TimeValue(input.Timestamp)) {
+			position++
+		}
+	}
+	return &kinesis.GetShardIteratorOutput{ShardIterator: iterator(aws.StringValue(input.ShardId), position)}, nil
+}
+
+func (s *shardReaderMock) GetRecordsWithContext(ctx aws.Context, input *kinesis.GetRecordsInput, opts ...request.Option) (*kinesis.GetRecordsOutput, error) {
+	parts := strings.Split(aws.StringValue(input.ShardIterator), "/")
+	records := shardRecords[parts[0]]
+	start, _ := strconv.Atoi(parts[1])
+	end := start + pageSize
+	if end > len(records) {
+		end = len(records)
+	}
+	output := kinesis.GetRecordsOutput{
+		NextShardIterator:  iterator(parts[0], end),
+		MillisBehindLatest: aws.Int64(int64(len(records)-end) * 1000),
+	}
+	for i := start; i < end; i++ {
+		output.Records = append(output.Records, &kinesis.Record{
+			SequenceNumber:              aws.String(records[i]),
+			ApproximateArrivalTimestamp: aws.Time(recordArrival(i)),
+		})
+	}
+	return &output, nil
+}
+
+// throttlingReaderMock reads shardRecords after failing the first reads as throttled by kinesis,
+// it keeps the time of every read.
+type throttlingReaderMock struct {
+	shardReaderMock
+	throttled int
+	reads     []time.Time
+}
+
+func (t *throttlingReaderMock) GetRecordsWithContext(ctx aws.Context, input *kinesis.GetRecordsInput, opts ...request.Option) (*kinesis.GetRecordsOutput, error) {
+	t.reads = append(t.reads, time.Now())
+	if len(t.reads) <= t.throttled {
+		return nil, awserr.New(kinesis.ErrCodeProvisionedThroughputExceededException, "rate exceeded for shard", nil)
+	}
+	return t.shardReaderMock.GetRecordsWithContext(ctx, input, opts...)
+}
+
+func iterator(shardID string, position int) *string {
+	return aws.String(shardID + "/" + strconv.Itoa(position))
+}
+
+func recordArrival(position int) time.Time {
+	return arrival.Add(time.Duration(position) * time.Minute)
+}
@@ -0,0 +1,429 @@
+package dynamodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/vmware/vmware-go-kcl/clientlibrary/checkpoint"
+)
+
+// Table encryption types.
+const (
+	// EncryptionDefault encrypts the table with a key owned by dynamodb, like tables created by kcl.
+	EncryptionDefault = "DEFAULT"
+	// EncryptionKMS encrypts the table with a kms key, the aws managed one unless a key is given.
+	EncryptionKMS = "KMS"
+)
+
+// ErrTableNotFound is returned when the drift of a table that doesn't exist is checked.
+var ErrTableNotFound = errors.New("table was not found")
+
+// tablePollInterval is the time between checks of a table that is being created or updated.
+var tablePollInterval = 2 * time.Second
+
+// TableSettings contains the settings of a kcl lease table.
+type TableSettings struct {
+	TableName string
+	// BillingMode is PROVISIONED or PAY_PER_REQUEST, PROVISIONED by default.
+	BillingMode string
+	// ReadCapacity and WriteCapacity are the capacity units of provisioned tables, usually the
+	// initial lease table capacities of the kcl configuration. Existing tables are only given
+	// them when they switch to provisioned billing, later changes e.g. by auto scaling are
+	// reported as drift but kept.
+	ReadCapacity  int64
+	WriteCapacity int64
+	// Tags are added to the table, other tags of the table are kept.
+	Tags                map[string]string
+	PointInTimeRecovery bool
+	// Encryption is EncryptionDefault or EncryptionKMS, EncryptionDefault by default.
+	Encryption string
+	// KMSKeyID is the arn of the kms key of EncryptionKMS, the aws managed key when it is empty.
+	KMSKeyID string
+}
+
+// Validate checks the settings.
+func (t TableSettings) Validate() error {
+	if t.TableName == "" {
+		return errors.New("table name is required")
+	}
+	switch t.billingMode() {
+	case dynamodb.BillingModeProvisioned:
+		if t.ReadCapacity <= 0 || t.WriteCapacity <= 0 {
+			return errors.New("provisioned billing requires read and write capacities")
+		}
+	case dynamodb.BillingModePayPerRequest:
+	default:
+		return fmt.Errorf("unsupported billing mode %q", t.BillingMode)
+	}
+	switch t.encryption() {
+	case EncryptionDefault:
+		if t.KMSKeyID != "" {
+			return errors.New("kms key requires kms encryption")
+		}
+	case EncryptionKMS:
+	default:
+		return fmt.Errorf("unsupported encryption %q", t.Encryption)
+	}
+	return nil
+}
+
+func (t TableSettings) billingMode() string {
+	if t.BillingMode == "" {
+		return dynamodb.BillingModeProvisioned
+	}
+	return t.BillingMode
+}
+
+func (t TableSettings) encryption() string {
+	if t.Encryption == "" {
+		return EncryptionDefault
+	}
+	return t.Encryption
+}
+
+// Drift is a setting of a table that differs from the expected one.
+type Drift struct {
+	// Setting is the name of the setting, e.g. billing_mode or tags.team.
+	Setting  string
+	Expected string
+	Actual   string
+	// Reconciled is true when the setting was changed to the expected value.
+	Reconciled bool
+}
+
+// TableReport tells what the provisioning of a table did.
+type TableReport struct {
+	// Created is true when the table didn't exist and this call created it.
+	Created bool
+	Drifts  []Drift
+}
+
+// LeaseTableProvisioner returns a function that provisions lease tables with the given settings,
+// using the table name it is called with, e.g. for kinesis.StandardKCLWorkerFactory.WithLeaseTableProvisioner.
+func (c *Client) LeaseTableProvisioner(settings TableSettings) func(ctx context.Context, tableName string) error {
+	return func(ctx context.Context, tableName string) error {
+		settings.TableName = tableName
+		_, err := c.ProvisionLeaseTable(ctx, settings)
+		return err
+	}
+}
+
+// ProvisionLeaseTable creates the lease table with the given settings, or reconciles the settings
+// of the table if it exists. It waits until the table is active.
+func (c *Client) ProvisionLeaseTable(ctx context.Context, settings TableSettings) (TableReport, error) {
+	if err := settings.Validate(); err != nil {
+		return TableReport{}, err
+	}
+	table, err := c.describeTable(ctx, settings.TableName)
+	if errors.Is(err, ErrTableNotFound) {
+		created, err := c.createTable(ctx, settings)
+		if err != nil {
+			return TableReport{}, err
+		}
+		return TableReport{Created: created}, nil
+	}
+	if err != nil {
+		return TableReport{}, err
+	}
+	drifts, err := c.drift(ctx, settings, table)
+	if err != nil {
+		return TableReport{}, err
+	}
+	for i, drift := range drifts {
+		reconciled, err := c.reconcile(ctx, settings, table, drift)
+		if err != nil {
+			return TableReport{Drifts: drifts}, err
+		}
+		drifts[i].Reconciled = reconciled
+		log.Println("level", "WARN", "msg", "lease table drift", "table", settings.TableName, "setting", drift.Setting, "expected", drift.Expected, "actual", drift.Actual, "reconciled", reconciled)
+	}
+	return TableReport{Drifts: drifts}, nil
+}
+
+// LeaseTableDrift returns the settings of the lease table that differ from the given ones, without changing them.
+func (c *Client) LeaseTableDrift(ctx context.Context, settings TableSettings) ([]Drift, error) {
+	if err := settings.Validate(); err != nil {
+		return nil, err
+	}
+	table, err := c.describeTable(ctx, settings.TableName)
+	if err != nil {
+		return nil, err
+	}
+	return c.drift(ctx, settings, table)
+}
+
+// DeleteLeaseTable deletes the given lease table, e.g. the temporary one of a replay once its
+// workers are shut down. A table that doesn't exist is already deleted, so it is not an error.
+func (c *Client) DeleteLeaseTable(ctx context.Context, tableName string) error {
+	_, err := c.dynamoDBClient.DeleteTableWithContext(ctx, &dynamodb.DeleteTableInput{
+		TableName: aws.String(tableName),
+	})
+	if err != nil {
+		var awsErr awserr.Error
+		if errors.As(err, &awsErr) && awsErr.Code() == dynamodb.ErrCodeResourceNotFoundException {
+			return nil
+		}
+		log.Println("level", "ERROR", "msg", "lease table could not be deleted", "table", tableName, "error", err)
+		return errors.New("lease table could not be deleted")
+	}
+	log.Println("level", "INFO", "msg", "lease table deleted", "table", tableName)
+	return nil
+}
+
+// createTable creates the table with the kcl key schema and the given settings, point in time
+// recovery is enabled once it is active. It tells if the table was created by this call, workers
+// that start at the same time also try to create it, and they wait until it is active instead.
+func (c *Client) createTable(ctx context.Context, settings TableSettings) (bool, error) {
+	input := dynamodb.CreateTableInput{
+		TableName: aws.String(settings.TableName),
+		AttributeDefinitions: []*dynamodb.AttributeDefinition{
+			{AttributeName: aws.String(checkpoint.LeaseKeyKey), AttributeType: aws.String(dynamodb.ScalarAttributeTypeS)},
+		},
+		KeySchema: []*dynamodb.KeySchemaElement{
+			{AttributeName: aws.String(checkpoint.LeaseKeyKey), KeyType: aws.String(dynamodb.KeyTypeHash)},
+		},
+		BillingMode:      aws.String(settings.billingMode()),
+		SSESpecification: sseSpecification(settings),
+	}
+	if settings.billingMode() == dynamodb.BillingModeProvisioned {
+		input.ProvisionedThroughput = provisionedThroughput(settings)
+	}
+	for _, key := range sortedKeys(settings.Tags) {
+		input.Tags = append(input.Tags, &dynamodb.Tag{Key: aws.String(key), Value: aws.String(settings.Tags[key])})
+	}
+	created := true
+	_, err := c.dynamoDBClient.CreateTableWithContext(ctx, &input)
+	var awsErr awserr.Error
+	switch {
+	case errors.As(err, &awsErr) && awsErr.Code() == dynamodb.ErrCodeResourceInUseException:
+		log.Println("level", "INFO", "msg", "lease table is being created by another worker", "table", settings.TableName)
+		created = false
+	case err != nil:
+		log.Println("level", "ERROR", "msg", "lease table could not be created", "table", settings.TableName, "error", err)
+		return false, errors.New("lease table could not be created")
+	default:
+		log.Println("level", "INFO", "msg", "lease table created", "table", settings.TableName, "billing_mode", settings.billingMode())
+	}
+	if err := c.waitActive(ctx, settings.TableName); err != nil {
+		return false, err
+	}
+	if settings.PointInTimeRecovery {
+		return created, c.updatePointInTimeRecovery(ctx, settings)
+	}
+	return created, nil
+}
+
+// drift compares the table with the settings.
+func (c *Client) drift(ctx context.Context, settings TableSettings, table *dynamodb.TableDescription) ([]Drift, error) {
+	var drifts []Drift
+	billingMode := dynamodb.BillingModeProvisioned
+	if table.BillingModeSummary != nil && table.BillingModeSummary.BillingMode != nil {
+		billingMode = aws.StringValue(table.BillingModeSummary.BillingMode)
+	}
+	if billingMode != settings.billingMode() {
+		drifts = append(drifts, Drift{Setting: "billing_mode", Expected: settings.billingMode(), Actual: billingMode})
+	} else if billingMode == dynamodb.BillingModeProvisioned && table.ProvisionedThroughput != nil {
+		read := aws.Int64Value(table.ProvisionedThroughput.ReadCapacityUnits)
+		if read != settings.ReadCapacity {
+			drifts = append(drifts, Drift{Setting: "read_capacity", Expected: strconv.FormatInt(settings.ReadCapacity, 10), Actual: strconv.FormatInt(read, 10)})
+		}
+		write := aws.Int64Value(table.ProvisionedThroughput.WriteCapacityUnits)
+		if write != settings.WriteCapacity {
+			drifts = append(drifts, Drift{Setting: "write_capacity", Expected: strconv.FormatInt(settings.WriteCapacity, 10), Actual: strconv.FormatInt(write, 10)})
+		}
+	}
+
+	encryption, keyArn := EncryptionDefault, ""
+	if table.SSEDescription != nil && aws.StringValue(table.SSEDescription.Status) != dynamodb.SSEStatusDisabled {
+		encryption, keyArn = EncryptionKMS, aws.StringValue(table.SSEDescription.KMSMasterKeyArn)
+	}
+	if encryption != settings.encryption() {
+		drifts = append(drifts, Drift{Setting: "encryption", Expected: settings.encryption(), Actual: encryption})
+	} else if settings.KMSKeyID != "" && !strings.HasSuffix(keyArn, settings.KMSKeyID) {
+		drifts = append(drifts, Drift{Setting: "kms_key_id", Expected: settings.KMSKeyID, Actual: keyArn})
+	}
+
+	backups, err := c.dynamoDBClient.DescribeContinuousBackupsWithContext(ctx, &dynamodb.DescribeContinuousBackupsInput{
+		TableName: aws.String(settings.TableName),
+	})
+	if err != nil {
+		log.Println("level", "ERROR", "msg", "continuous backups could not be described", "table", settings.TableName, "error", err)
+		return nil, errors.New("continuous backups could not be described")
+	}
+	pointInTimeRecovery := backups.ContinuousBackupsDescription != nil &&
+		backups.ContinuousBackupsDescription.PointInTimeRecoveryDescription != nil &&
+		aws.StringValue(backups.ContinuousBackupsDescription.PointInTimeRecoveryDescription.PointInTimeRecoveryStatus) == dynamodb.PointInTimeRecoveryStatusEnabled
+	if pointInTimeRecovery != settings.PointInTimeRecovery {
+		drifts = append(drifts, Drift{Setting: "point_in_time_recovery", Expected: strconv.FormatBool(settings.PointInTimeRecovery), Actual: strconv.FormatBool(pointInTimeRecovery)})
+	}
+
+	if len(settings.Tags) == 0 {
+		return drifts, nil
+	}
+	tags, err := c.tags(ctx, table)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range sortedKeys(settings.Tags) {
+		if value, ok := tags[key]; !ok || value != settings.Tags[key] {
+			drifts = append(drifts, Drift{Setting: "tags." + key, Expected: settings.Tags[key], Actual: value})
+		}
+	}
+	return drifts, nil
+}
+
+// reconcile changes the setting of the drift to the expected value, it returns false for the
+// drifts that are only reported.
+func (c *Client) reconcile(ctx context.Context, settings TableSettings, table *dynamodb.TableDescription, drift Drift) (bool, error) {
+	switch {
+	case drift.Setting == "billing_mode":
+		input := dynamodb.UpdateTableInput{
+			TableName:   aws.String(settings.TableName),
+			BillingMode: aws.String(settings.billingMode()),
+		}
+		if settings.billingMode() == dynamodb.BillingModeProvisioned {
+			input.ProvisionedThroughput = provisionedThroughput(settings)
+		}
+		return true, c.updateTable(ctx, &input)
+	case drift.Setting == "encryption" || drift.Setting == "kms_key_id":
+		return true, c.updateTable(ctx, &dynamodb.UpdateTableInput{
+			TableName:        aws.String(settings.TableName),
+			SSESpecification: sseSpecification(settings),
+		})
+	case drift.Setting == "point_in_time_recovery":
+		return true, c.updatePointInTimeRecovery(ctx, settings)
+	case strings.HasPrefix(drift.Setting, "tags."):
+		key := strings.TrimPrefix(drift.Setting, "tags.")
+		_, err := c.dynamoDBClient.TagResourceWithContext(ctx, &dynamodb.TagResourceInput{
+			ResourceArn: table.TableArn,
+			Tags:        []*dynamodb.Tag{{Key: aws.String(key), Value: aws.String(settings.Tags[key])}},
+		})
+		if err != nil {
+			log.Println("level", "ERROR", "msg", "table could not be tagged", "table", settings.TableName, "error", err)
+			return false, errors.New("table could not be tagged")
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// updateTable updates the table and waits until it is active again, dynamodb rejects updates
+// of tables that are being updated.
+func (c *Client) updateTable(ctx context.Context, input *dynamodb.UpdateTableInput) error {
+	_, err := c.dynamoDBClient.UpdateTableWithContext(ctx, input)
+	if err != nil {
+		log.Println("level", "ERROR", "msg", "table could not be updated", "table", aws.StringValue(input.TableName), "error", err)
+		return errors.New("table could not be updated")
+	}
+	return c.waitActive(ctx, aws.StringValue(input.TableName))
+}
+
+// updatePointInTimeRecovery enables or disables the point in time recovery of the table.
+func (c *Client) updatePointInTimeRecovery(ctx context.Context, settings TableSettings) error {
+	_, err := c.dynamoDBClient.UpdateContinuousBackupsWithContext(ctx, &dynamodb.UpdateContinuousBackupsInput{
+		TableName: aws.String(settings.TableName),
+		PointInTimeRecoverySpecification: &dynamodb.PointInTimeRecoverySpecification{
+			PointInTimeRecoveryEnabled: aws.Bool(settings.PointInTimeRecovery),
+		},
+	})
+	if err != nil {
+		log.Println("level", "ERROR", "msg", "point in time recovery could not be updated", "table", settings.TableName, "error", err)
+		return errors.New("point in time recovery could not be updated")
+	}
+	return nil
+}
+
+// tags reads the tags of the table.
+func (c *Client) tags(ctx context.Context, table *dynamodb.TableDescription) (map[string]string, error) {
+	tags := make(map[string]string)
+	input := dynamodb.ListTagsOfResourceInput{
+		ResourceArn: table.TableArn,
+	}
+	for {
+		output, err := c.dynamoDBClient.ListTagsOfResourceWithContext(ctx, &input)
+		if err != nil {
+			log.Println("level", "ERROR", "msg", "table tags could not be listed", "table", aws.StringValue(table.TableName), "error", err)
+			return nil, errors.New("table tags could not be listed")
+		}
+		for _, tag := range output.Tags {
+			tags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+		}
+		if output.NextToken == nil {
+			return tags, nil
+		}
+		input.NextToken = output.NextToken
+	}
+}
+
+// describeTable describes the table, it returns ErrTableNotFound if it doesn't exist.
+func (c *Client) describeTable(ctx context.Context, tableName string) (*dynamodb.TableDescription, error) {
+	output, err := c.dynamoDBClient.DescribeTableWithContext(ctx, &dynamodb.DescribeTableInput{
+		TableName: aws.String(tableName),
+	})
+	if err != nil {
+		var awsErr awserr.Error
+		if errors.As(err, &awsErr) && awsErr.Code() == dynamodb.ErrCodeResourceNotFoundException {
+			return nil, ErrTableNotFound
+		}
+		log.Println("level", "ERROR", "msg", "table could not be described", "table", tableName, "error", err)
+		return nil, errors.New("table could not be described")
+	}
+	return output.Table, nil
+}
+
+// waitActive waits until the table is active.
+func (c *Client) waitActive(ctx context.Context, tableName string) error {
+	for {
+		table, err := c.describeTable(ctx, tableName)
+		if err != nil {
+			return err
+		}
+		if aws.StringValue(table.TableStatus) == dynamodb.TableStatusActive {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(tablePollInterval):
+		}
+	}
+}
+
+func provisionedThroughput(settings TableSettings) *dynamodb.ProvisionedThroughput {
+	return &dynamodb.ProvisionedThroughput{
+		ReadCapacityUnits:  aws.Int64(settings.ReadCapacity),
+		WriteCapacityUnits: aws.Int64(settings.WriteCapacity),
+	}
+}
+
+func sseSpecification(settings TableSettings) *dynamodb.SSESpecification {
+	if settings.encryption() == EncryptionDefault {
+		return &dynamodb.SSESpecification{Enabled: aws.Bool(false)}
+	}
+	specification := dynamodb.SSESpecification{
+		Enabled: aws.Bool(true),
+		SSEType: aws.String(dynamodb.SSETypeKms),
+	}
+	if settings.KMSKeyID != "" {
+		specification.KMSMasterKeyId = aws.String(settings.KMSKeyID)
+	}
+	return &specification
+}
+
+func sortedKeys(values map[string]string) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,491 @@
+package dynamodb_test
+
+import (
+	"context"
+	"testing"
+
+	dynamodbv2 "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	awsdynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/fernandoocampo/pubsub-kinesis/internal/adapter/dynamodb"
+	"github.com/stretchr/testify/assert"
+)
+
+const tableArn = "arn:aws:dynamodb:us-east-1:123456789012:table/orders-consumer"
+
+const kmsKeyArn = "arn:aws:kms:us-east-1:123456789012:key/1234abcd-12ab-34cd-56ef-1234567890ab"
+
+func TestProvisionLeaseTableCreatesTable(t *testing.T) {
+	for _, sdk := range tableSDKs() {
+		t.Run(sdk.name, func(st *testing.T) {
+			table := tableState{}
+			client := sdk.newClient(&table)
+
+			report, err := client.ProvisionLeaseTable(context.Background(), dynamodb.TableSettings{
+				TableName:           "orders-consumer",
+				BillingMode:         "PAY_PER_REQUEST",
+				Tags:                map[string]string{"team": "orders", "env": "prod"},
+				PointInTimeRecovery: true,
+				Encryption:          dynamodb.EncryptionKMS,
+				KMSKeyID:            kmsKeyArn,
+			})
+
+			assert.NoError(st, err)
+			assert.Equal(st, dynamodb.TableReport{Created: true}, report)
+			assert.Equal(st, tableState{
+				exists:      true,
+				key:         "ShardID",
+				billingMode: "PAY_PER_REQUEST",
+				sseEnabled:  true,
+				kmsKeyArn:   kmsKeyArn,
+				pitr:        true,
+				tags:        map[string]string{"team": "orders", "env": "prod"},
+				changes:     []string{"CreateTable", "UpdateContinuousBackups"},
+			}, table)
+		})
+	}
+}
+
+func TestProvisionLeaseTableCreatedByAnotherWorker(t *testing.T) {
+	for _, sdk := range tableSDKs() {
+		t.Run(sdk.name, func(st *testing.T) {
+			table := tableState{createdByOther: true, billingMode: "PAY_PER_REQUEST"}
+			client := sdk.newClient(&table)
+
+			report, err := client.ProvisionLeaseTable(context.Background(), dynamodb.TableSettings{
+				TableName:           "orders-consumer",
+				BillingMode:         "PAY_PER_REQUEST",
+				PointInTimeRecovery: true,
+			})
+
+			assert.NoError(st, err)
+			assert.Equal(st, dynamodb.TableReport{}, report)
+			assert.True(st, table.pitr)
+			assert.Equal(st, []string{"UpdateContinuousBackups"}, table.changes)
+		})
+	}
+}
+
+func TestProvisionLeaseTableReconcilesDrift(t *testing.T) {
+	for _, sdk := range tableSDKs() {
+		t.Run(sdk.name, func(st *testing.T) {
+			table := tableState{
+				exists:      true,
+				billingMode: "PROVISIONED",
+				read:        10,
+				write:       10,
+				tags:        map[string]string{"team": "payments", "owner": "ops"},
+			}
+			client := sdk.newClient(&table)
+
+			report, err := client.ProvisionLeaseTable(context.Background(), dynamodb.TableSettings{
+				TableName:           "orders-consumer",
+				ReadCapacity:        20,
+				WriteCapacity:       10,
+				Tags:                map[string]string{"team": "orders"},
+				PointInTimeRecovery: true,
+				Encryption:          dynamodb.EncryptionKMS,
+			})
+
+			assert.NoError(st, err)
+			assert.Equal(st, []dynamodb.Drift{
+				{Setting: "read_capacity", Expected: "20", Actual: "10"},
+				{Setting: "encryption", Expected: "KMS", Actual: "DEFAULT", Reconciled: true},
+				{Setting: "point_in_time_recovery", Expected: "true", Actual: "false", Reconciled: true},
+				{Setting: "tags.team", Expected: "orders", Actual: "payments", Reconciled: true},
+			}, report.Drifts)
+			assert.Equal(st, int64(10), table.read)
+			assert.True(st, table.sseEnabled)
+			assert.True(st, table.pitr)
+			assert.Equal(st, map[string]string{"team": "orders", "owner": "ops"}, table.tags)
+		})
+	}
+}
+
+func TestProvisionLeaseTableSwitchesBillingMode(t *testing.T) {
+	for _, sdk := range tableSDKs() {
+		t.Run(sdk.name, func(st *testing.T) {
+			table := tableState{exists: true, billingMode: "PAY_PER_REQUEST"}
+			client := sdk.newClient(&table)
+
+			report, err := client.ProvisionLeaseTable(context.Background(), dynamodb.TableSettings{
+				TableName:     "orders-consumer",
+				ReadCapacity:  20,
+				WriteCapacity: 30,
+			})
+
+			assert.NoError(st, err)
+			assert.Equal(st, []dynamodb.Drift{
+				{Setting: "billing_mode", Expected: "PROVISIONED", Actual: "PAY_PER_REQUEST", Reconciled: true},
+			}, report.Drifts)
+			assert.Equal(st, "PROVISIONED", table.billingMode)
+			assert.Equal(st, int64(20), table.read)
+			assert.Equal(st, int64(30), table.write)
+		})
+	}
+}
+
+func TestLeaseTableDrift(t *testing.T) {
+	for _, sdk := range tableSDKs() {
+		t.Run(sdk.name, func(st *testing.T) {
+			table := tableState{exists: true, billingMode: "PAY_PER_REQUEST", sseEnabled: true, kmsKeyArn: kmsKeyArn}
+			client := sdk.newClient(&table)
+			settings := dynamodb.TableSettings{
+				TableName:   "orders-consumer",
+				BillingMode: "PAY_PER_REQUEST",
+				Encryption:  dynamodb.EncryptionKMS,
+				KMSKeyID:    "1234abcd-12ab-34cd-56ef-1234567890ab",
+				Tags:        map[string]string{"team": "orders"},
+			}
+
+			drifts, err := client.LeaseTableDrift(context.Background(), settings)
+
+			assert.NoError(st, err)
+			assert.Equal(st, []dynamodb.Drift{{Setting: "tags.team", Expected: "orders"}}, drifts)
+			assert.Empty(st, table.changes)
+
+			_, err = sdk.newClient(&tableState{}).LeaseTableDrift(context.Background(), settings)
+			assert.Equal(st, dynamodb.ErrTableNotFound, err)
+		})
+	}
+}
+
+func TestTableSettingsValidate(t *testing.T) {
+	cases := map[string]dynamodb.TableSettings{
+		"no table name":         {ReadCapacity: 10, WriteCapacity: 10},
+		"no capacity":           {TableName: "orders-consumer"},
+		"unknown billing mode":  {TableName: "orders-consumer", BillingMode: "FREE"},
+		"unknown encryption":    {TableName: "orders-consumer", BillingMode: "PAY_PER_REQUEST", Encryption: "AES"},
+		"kms key without kms":   {TableName: "orders-consumer", BillingMode: "PAY_PER_REQUEST", KMSKeyID: kmsKeyArn},
+		"only write capacities": {TableName: "orders-consumer", WriteCapacity: 10},
+	}
+	for name, settings := range cases {
+		t.Run(name, func(st *testing.T) {
+			assert.Error(st, settings.Validate())
+		})
+	}
+	assert.NoError(t, dynamodb.TableSettings{TableName: "orders-consumer", ReadCapacity: 10, WriteCapacity: 10}.Validate())
+}
+
+func TestTableStatus(t *testing.T) {
+	for _, sdk := range tableSDKs() {
+		t.Run(sdk.name, func(st *testing.T) {
+			status, err := sdk.newClient(&tableState{exists: true}).TableStatus(context.Background(), "orders-consumer")
+			assert.NoError(st, err)
+			assert.Equal(st, "ACTIVE", status)
+
+			status, err = sdk.newClient(&tableState{}).TableStatus(context.Background(), "orders-consumer")
+			assert.Error(st, err)
+			assert.Empty(st, status)
+		})
+	}
+}
+
+func TestDeleteLeaseTable(t *testing.T) {
+	for _, sdk := range tableSDKs() {
+		t.Run(sdk.name, func(st *testing.T) {
+			table := tableState{exists: true}
+			client := sdk.newClient(&table)
+
+			err := client.DeleteLeaseTable(context.Background(), "orders-consumer-replay-20240301T000000Z")
+			assert.NoError(st, err)
+			assert.False(st, table.exists)
+			assert.Equal(st, []string{"DeleteTable"}, table.changes)
+
+			err = client.DeleteLeaseTable(context.Background(), "orders-consumer-replay-20240301T000000Z")
+			assert.NoError(st, err)
+			assert.Equal(st, []string{"DeleteTable"}, table.changes)
+		})
+	}
+}
+
+// tableSDK creates clients on a mocked table of a sdk generation, so every test runs against both of them.
+type tableSDK struct {
+	name string
+	// newClient creates a client on the given table, nil when it doesn't exist.
+	newClient func(table *tableState) *dynamodb.Client
+}
+
+func tableSDKs() []tableSDK {
+	return []tableSDK{
+		{
+			name: "aws-sdk-go",
+			newClient: func(table *tableState) *dynamodb.Client {
+				return dynamodb.NewClientWithAPI(&tableMock{table: table})
+			},
+		},
+		{
+			name: "aws-sdk-go-v2",
+			newClient: func(table *tableState) *dynamodb.Client {
+				return dynamodb.NewClientV2(&tableV2Mock{table: table})
+			},
+		},
+	}
+}
+
+// tableState is the table of the mocked clients of both sdk generations.
+type tableState struct {
+	exists bool
+	// createdByOther makes CreateTable fail as if another worker created the table first.
+	createdByOther bool
+	key            string
+	billingMode    string
+	read           int64
+	write          int64
+	sseEnabled     bool
+	kmsKeyArn      string
+	pitr           bool
+	tags           map[string]string
+	// changes are the operations that changed the table.
+	changes []string
+}
+
+func (t *tableState) create(key, billingMode string, throughput *awsdynamodb.ProvisionedThroughput, sse *awsdynamodb.SSESpecification, tags map[string]string) {
+	t.exists = true
+	t.key = key
+	t.billingMode = billingMode
+	t.tags = tags
+	t.update(billingMode, throughput, sse)
+	t.changes = append(t.changes[:len(t.changes)-1], "CreateTable")
+}
+
+func (t *tableState) update(billingMode string, throughput *awsdynamodb.ProvisionedThroughput, sse *awsdynamodb.SSESpecification) {
+	if billingMode != "" {
+		t.billingMode = billingMode
+	}
+	if throughput != nil {
+		t.read = aws.Int64Value(throughput.ReadCapacityUnits)
+		t.write = aws.Int64Value(throughput.WriteCapacityUnits)
+	}
+	if sse != nil {
+		t.sseEnabled = aws.BoolValue(sse.Enabled)
+		t.kmsKeyArn = ""
+		if t.sseEnabled {
+			t.kmsKeyArn = aws.StringValue(sse.KMSMasterKeyId)
+		}
+	}
+	t.changes = append(t.changes, "UpdateTable")
+}
+
+func (t *tableState) tag(tags map[string]string) {
+	if t.tags == nil {
+		t.tags = make(map[string]string)
+	}
+	for key, value := range tags {
+		t.tags[key] = value
+	}
+	t.changes = append(t.changes, "TagResource")
+}
+
+func (t *tableState) updatePointInTimeRecovery(enabled bool) {
+	t.pitr = enabled
+	t.changes = append(t.changes, "UpdateContinuousBackups")
+}
+
+func (t *tableState) delete() bool {
+	if !t.exists {
+		return false
+	}
+	t.exists = false
+	t.changes = append(t.changes, "DeleteTable")
+	return true
+}
+
+func (t *tableState) sseStatus() string {
+	if t.sseEnabled {
+		return "ENABLED"
+	}
+	return "DISABLED"
+}
+
+func (t *tableState) pitrStatus() string {
+	if t.pitr {
+		return "ENABLED"
+	}
+	return "DISABLED"
+}
+
+// tableMock is a dynamodb table managed with aws-sdk-go.
+type tableMock struct {
+	dynamodb.API
+	table *tableState
+}
+
+func (d *tableMock) DescribeTableWithContext(ctx aws.Context, input *awsdynamodb.DescribeTableInput, opts ...request.Option) (*awsdynamodb.DescribeTableOutput, error) {
+	if d.table == nil || !d.table.exists {
+		return nil, awserr.New(awsdynamodb.ErrCodeResourceNotFoundException, "table not found", nil)
+	}
+	return &awsdynamodb.DescribeTableOutput{Table: &awsdynamodb.TableDescription{
+		TableName:          input.TableName,
+		TableArn:           aws.String(tableArn),
+		TableStatus:        aws.String(awsdynamodb.TableStatusActive),
+		BillingModeSummary: &awsdynamodb.BillingModeSummary{BillingMode: aws.String(d.table.billingMode)},
+		ProvisionedThroughput: &awsdynamodb.ProvisionedThroughputDescription{
+			ReadCapacityUnits:  aws.Int64(d.table.read),
+			WriteCapacityUnits: aws.Int64(d.table.write),
+		},
+		SSEDescription: &awsdynamodb.SSEDescription{
+			Status:          aws.String(d.table.sseStatus()),
+			KMSMasterKeyArn: aws.String(d.table.kmsKeyArn),
+		},
+	}}, nil
+}
+
+func (d *tableMock) CreateTableWithContext(ctx aws.Context, input *awsdynamodb.CreateTableInput, opts ...request.Option) (*awsdynamodb.CreateTableOutput, error) {
+	if d.table.createdByOther {
+		d.table.exists = true
+		return nil, awserr.New(awsdynamodb.ErrCodeResourceInUseException, "table already exists", nil)
+	}
+	tags := make(map[string]string)
+	for _, tag := range input.Tags {
+		tags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+	}
+	d.table.create(aws.StringValue(input.KeySchema[0].AttributeName), aws.StringValue(input.BillingMode), input.ProvisionedThroughput, input.SSESpecification, tags)
+	return &awsdynamodb.CreateTableOutput{}, nil
+}
+
+func (d *tableMock) UpdateTableWithContext(ctx aws.Context, input *awsdynamodb.UpdateTableInput, opts ...request.Option) (*awsdynamodb.UpdateTableOutput, error) {
+	d.table.update(aws.StringValue(input.BillingMode), input.ProvisionedThroughput, input.SSESpecification)
+	return &awsdynamodb.UpdateTableOutput{}, nil
+}
+
+func (d *tableMock) DeleteTableWithContext(ctx aws.Context, input *awsdynamodb.DeleteTableInput, opts ...request.Option) (*awsdynamodb.DeleteTableOutput, error) {
+	if !d.table.delete() {
+		return nil, awserr.New(awsdynamodb.ErrCodeResourceNotFoundException, "table not found", nil)
+	}
+	return &awsdynamodb.DeleteTableOutput{}, nil
+}
+
+func (d *tableMock) DescribeContinuousBackupsWithContext(ctx aws.Context, input *awsdynamodb.DescribeContinuousBackupsInput, opts ...request.Option) (*awsdynamodb.DescribeContinuousBackupsOutput, error) {
+	return &awsdynamodb.DescribeContinuousBackupsOutput{ContinuousBackupsDescription: &awsdynamodb.ContinuousBackupsDescription{
+		PointInTimeRecoveryDescription: &awsdynamodb.PointInTimeRecoveryDescription{
+			PointInTimeRecoveryStatus: aws.String(d.table.pitrStatus()),
+		},
+	}}, nil
+}
+
+func (d *tableMock) UpdateContinuousBackupsWithContext(ctx aws.Context, input *awsdynamodb.UpdateContinuousBackupsInput, opts ...request.Option) (*awsdynamodb.UpdateContinuousBackupsOutput, error) {
+	d.table.updatePointInTimeRecovery(aws.BoolValue(input.PointInTimeRecoverySpecification.PointInTimeRecoveryEnabled))
+	return &awsdynamodb.UpdateContinuousBackupsOutput{}, nil
+}
+
+func (d *tableMock) ListTagsOfResourceWithContext(ctx aws.Context, input *awsdynamodb.ListTagsOfResourceInput, opts ...request.Option) (*awsdynamodb.ListTagsOfResourceOutput, error) {
+	output := awsdynamodb.ListTagsOfResourceOutput{}
+	for key, value := range d.table.tags {
+		output.Tags = append(output.Tags, &awsdynamodb.Tag{Key: aws.String(key), Value: aws.String(value)})
+	}
+	return &output, nil
+}
+
+func (d *tableMock) TagResourceWithContext(ctx aws.Context, input *awsdynamodb.TagResourceInput, opts ...request.Option) (*awsdynamodb.TagResourceOutput, error) {
+	tags := make(map[string]string)
+	for _, tag := range input.Tags {
+		tags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+	}
+	d.table.tag(tags)
+	return &awsdynamodb.TagResourceOutput{}, nil
+}
+
+// tableV2Mock is a dynamodb table managed with aws-sdk-go-v2.
+type tableV2Mock struct {
+	dynamodb.APIV2
+	table *tableState
+}
+
+func (d *tableV2Mock) DescribeTable(ctx context.Context, input *dynamodbv2.DescribeTableInput, optFns ...func(*dynamodbv2.Options)) (*dynamodbv2.DescribeTableOutput, error) {
+	if d.table == nil || !d.table.exists {
+		return nil, &types.ResourceNotFoundException{Message: aws.String("table not found")}
+	}
+	return &dynamodbv2.DescribeTableOutput{Table: &types.TableDescription{
+		TableName:          input.TableName,
+		TableArn:           aws.String(tableArn),
+		TableStatus:        types.TableStatusActive,
+		BillingModeSummary: &types.BillingModeSummary{BillingMode: types.BillingMode(d.table.billingMode)},
+		ProvisionedThroughput: &types.ProvisionedThroughputDescription{
+			ReadCapacityUnits:  aws.Int64(d.table.read),
+			WriteCapacityUnits: aws.Int64(d.table.write),
+		},
+		SSEDescription: &types.SSEDescription{
+			Status:          types.SSEStatus(d.table.sseStatus()),
+			KMSMasterKeyArn: aws.String(d.table.kmsKeyArn),
+		},
+	}}, nil
+}
+
+func (d *tableV2Mock) CreateTable(ctx context.Context, input *dynamodbv2.CreateTableInput, optFns ...func(*dynamodbv2.Options)) (*dynamodbv2.CreateTableOutput, error) {
+	if d.table.createdByOther {
+		d.table.exists = true
+		return nil, &types.ResourceInUseException{Message: aws.String("table already exists")}
+	}
+	tags := make(map[string]string)
+	for _, tag := range input.Tags {
+		tags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+	}
+	d.table.create(aws.StringValue(input.KeySchema[0].AttributeName), string(input.BillingMode), throughputFromV2(input.ProvisionedThroughput), sseFromV2(input.SSESpecification), tags)
+	return &dynamodbv2.CreateTableOutput{}, nil
+}
+
+func (d *tableV2Mock) UpdateTable(ctx context.Context, input *dynamodbv2.UpdateTableInput, optFns ...func(*dynamodbv2.Options)) (*dynamodbv2.UpdateTableOutput, error) {
+	d.table.update(string(input.BillingMode), throughputFromV2(input.ProvisionedThroughput), sseFromV2(input.SSESpecification))
+	return &dynamodbv2.UpdateTableOutput{}, nil
+}
+
+func (d *tableV2Mock) DeleteTable(ctx context.Context, input *dynamodbv2.DeleteTableInput, optFns ...func(*dynamodbv2.Options)) (*dynamodbv2.DeleteTableOutput, error) {
+	if !d.table.delete() {
+		return nil, &types.ResourceNotFoundException{Message: aws.String("table not found")}
+	}
+	return &dynamodbv2.DeleteTableOutput{}, nil
+}
+
+func (d *tableV2Mock) DescribeContinuousBackups(ctx context.Context, input *dynamodbv2.DescribeContinuousBackupsInput, optFns ...func(*dynamodbv2.Options)) (*dynamodbv2.DescribeContinuousBackupsOutput, error) {
+	return &dynamodbv2.DescribeContinuousBackupsOutput{ContinuousBackupsDescription: &types.ContinuousBackupsDescription{
+		PointInTimeRecoveryDescription: &types.PointInTimeRecoveryDescription{
+			PointInTimeRecoveryStatus: types.PointInTimeRecoveryStatus(d.table.pitrStatus()),
+		},
+	}}, nil
+}
+
+func (d *tableV2Mock) UpdateContinuousBackups(ctx context.Context, input *dynamodbv2.UpdateContinuousBackupsInput, optFns ...func(*dynamodbv2.Options)) (*dynamodbv2.UpdateContinuousBackupsOutput, error) {
+	d.table.updatePointInTimeRecovery(aws.BoolValue(input.PointInTimeRecoverySpecification.PointInTimeRecoveryEnabled))
+	return &dynamodbv2.UpdateContinuousBackupsOutput{}, nil
+}
+
+func (d *tableV2Mock) ListTagsOfResource(ctx context.Context, input *dynamodbv2.ListTagsOfResourceInput, optFns ...func(*dynamodbv2.Options)) (*dynamodbv2.ListTagsOfResourceOutput, error) {
+	output := dynamodbv2.ListTagsOfResourceOutput{}
+	for key, value := range d.table.tags {
+		output.Tags = append(output.Tags, types.Tag{Key: aws.String(key), Value: aws.String(value)})
+	}
+	return &output, nil
+}
+
+func (d *tableV2Mock) TagResource(ctx context.Context, input *dynamodbv2.TagResourceInput, optFns ...func(*dynamodbv2.Options)) (*dynamodbv2.TagResourceOutput, error) {
+	tags := make(map[string]string)
+	for _, tag := range input.Tags {
+		tags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+	}
+	d.table.tag(tags)
+	return &dynamodbv2.TagResourceOutput{}, nil
+}
+
+func throughputFromV2(throughput *types.ProvisionedThroughput) *awsdynamodb.ProvisionedThroughput {
+	if throughput == nil {
+		return nil
+	}
+	return &awsdynamodb.ProvisionedThroughput{
+		ReadCapacityUnits:  throughput.ReadCapacityUnits,
+		WriteCapacityUnits: throughput.WriteCapacityUnits,
+	}
+}
+
+func sseFromV2(specification *types.SSESpecification) *awsdynamodb.SSESpecification {
+	if specification == nil {
+		return nil
+	}
+	return &awsdynamodb.SSESpecification{
+		Enabled:        specification.Enabled,
+		KMSMasterKeyId: specification.KMSMasterKeyId,
+	}
+}
@@ -0,0 +1,61 @@
+package kinesis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// BatchHandler defines behavior to process all the records of a kinesis batch at once.
+// It is useful for sinks that are more efficient with bulk operations.
+type BatchHandler interface {
+	// HandleBatch processes the given records. If only a part of them could be
+	// processed it must return a *BatchError with the index of the first record that failed.
+	HandleBatch(ctx context.Context, records []Record) error
+}
+
+// BatchHandlerCreator defines behavior to create instances of BatchHandler
+type BatchHandlerCreator interface {
+	Create() BatchHandler
+}
+
+// BatchError reports that a batch was processed partially. Records before Index were
+// processed successfully, the record at Index and the following ones were not.
+type BatchError struct {
+	Index int
+	Err   error
+}
+
+// NewBatchError creates a new batch error that fails at the given record index.
+func NewBatchError(index int, err error) *BatchError {
+	return &BatchError{
+		Index: index,
+		Err:   err,
+	}
+}
+
+// Error returns the description of the batch error.
+func (b *BatchError) Error() string {
+	return fmt.Sprintf("batch failed at record %d: %s", b.Index, b.Err)
+}
+
+// Unwrap returns the error that caused the batch failure.
+func (b *BatchError) Unwrap() error {
+	return b.Err
+}
+
+// failedIndex returns the index of the first record that failed within a batch of the given size.
+// Errors that are not a *BatchError mean that the whole batch failed.
+func failedIndex(err error, size int) int {
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) {
+		return 0
+	}
+	if batchErr.Index < 0 {
+		return 0
+	}
+	if batchErr.Index > size {
+		return size
+	}
+	return batchErr.Index
+}
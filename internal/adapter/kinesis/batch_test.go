@@ -0,0 +1,137 @@
+package kinesis_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	awskinesis "github.com/aws/aws-sdk-go/service/kinesis"
+	"github.com/fernandoocampo/pubsub-kinesis/internal/adapter/kinesis"
+	"github.com/stretchr/testify/assert"
+	"github.com/vmware/vmware-go-kcl/clientlibrary/interfaces"
+)
+
+func TestProcessBatchSuccesfully(t *testing.T) {
+	batchHandlerCreator := &batchHandlerCreatorMock{}
+	recordProcessorFactory := kinesis.NewBatchRecordProcessorFactory(batchHandlerCreator)
+	checkpointer := recordProcessorCheckPointer{}
+	input := newProcessRecordsInput(&checkpointer, "1", "2", "3")
+
+	recordProcessor := recordProcessorFactory.CreateProcessor()
+	recordProcessor.ProcessRecords(input)
+
+	assert.Len(t, batchHandlerCreator.handler.batches, 1)
+	assert.Equal(t, []string{"1", "2", "3"}, sequenceNumbers(batchHandlerCreator.handler.batches[0]))
+	assert.Equal(t, []string{"3"}, checkpointer.checkpoints)
+}
+
+func TestProcessBatchRetriesAfterPartialFailure(t *testing.T) {
+	batchHandlerCreator := &batchHandlerCreatorMock{
+		errors: []error{kinesis.NewBatchError(1, errors.New("db timeout"))},
+	}
+	recordProcessorFactory := kinesis.NewBatchRecordProcessorFactory(batchHandlerCreator)
+	checkpointer := recordProcessorCheckPointer{}
+	input := newProcessRecordsInput(&checkpointer, "1", "2", "3")
+
+	recordProcessor := recordProcessorFactory.CreateProcessor()
+	recordProcessor.ProcessRecords(input)
+
+	assert.Len(t, batchHandlerCreator.handler.batches, 2)
+	assert.Equal(t, []string{"1", "2", "3"}, sequenceNumbers(batchHandlerCreator.handler.batches[0]))
+	assert.Equal(t, []string{"2", "3"}, sequenceNumbers(batchHandlerCreator.handler.batches[1]))
+	assert.Equal(t, []string{"1", "3"}, checkpointer.checkpoints)
+}
+
+func TestProcessBatchGivesUpAfterMaxRetries(t *testing.T) {
+	batchHandlerCreator := &batchHandlerCreatorMock{
+		errors: []error{
+			kinesis.NewBatchError(2, errors.New("db timeout")),
+			errors.New("db down"),
+			errors.New("db down"),
+		},
+	}
+	recordProcessorFactory := kinesis.NewBatchRecordProcessorFactory(batchHandlerCreator).WithMaxBatchRetries(2)
+	checkpointer := recordProcessorCheckPointer{}
+	input := newProcessRecordsInput(&checkpointer, "1", "2", "3")
+
+	recordProcessor := recordProcessorFactory.CreateProcessor()
+	recordProcessor.ProcessRecords(input)
+
+	assert.Len(t, batchHandlerCreator.handler.batches, 3)
+	assert.Equal(t, []string{"2"}, checkpointer.checkpoints)
+}
+
+func TestProcessBatchDoesNotCheckpointPastFailedBatch(t *testing.T) {
+	batchHandlerCreator := &batchHandlerCreatorMock{
+		errors: []error{
+			errors.New("db down"),
+			errors.New("db down"),
+		},
+	}
+	recordProcessorFactory := kinesis.NewBatchRecordProcessorFactory(batchHandlerCreator).WithMaxBatchRetries(1)
+	checkpointer := recordProcessorCheckPointer{}
+
+	recordProcessor := recordProcessorFactory.CreateProcessor()
+	recordProcessor.ProcessRecords(newProcessRecordsInput(&checkpointer, "1", "2"))
+	recordProcessor.ProcessRecords(newProcessRecordsInput(&checkpointer, "3", "4"))
+
+	assert.Len(t, batchHandlerCreator.handler.batches, 2)
+	assert.Empty(t, checkpointer.checkpoints)
+}
+
+type batchHandlerCreatorMock struct {
+	handler *batchHandlerMock
+	errors  []error
+}
+
+// Create create a batchHandlerMock
+func (b *batchHandlerCreatorMock) Create() kinesis.BatchHandler {
+	b.handler = &batchHandlerMock{
+		errors: b.errors,
+	}
+	return b.handler
+}
+
+type batchHandlerMock struct {
+	batches [][]kinesis.Record
+	errors  []error
+}
+
+func (b *batchHandlerMock) HandleBatch(ctx context.Context, records []kinesis.Record) error {
+	b.batches = append(b.batches, records)
+	if len(b.errors) == 0 {
+		return nil
+	}
+	err := b.errors[0]
+	b.errors = b.errors[1:]
+	return err
+}
+
+func newProcessRecordsInput(checkpointer interfaces.IRecordProcessorCheckpointer, sequenceNumbers ...string) *interfaces.ProcessRecordsInput {
+	now := time.Now()
+	input := interfaces.ProcessRecordsInput{
+		CacheEntryTime: &now,
+		CacheExitTime:  &now,
+		Records:        make([]*awskinesis.Record, 0),
+		Checkpointer:   checkpointer,
+	}
+	for _, v := range sequenceNumbers {
+		newrecord := awskinesis.Record{
+			Data:           []byte(`{"key": "` + v + `"}`),
+			PartitionKey:   aws.String("partition-" + v),
+			SequenceNumber: aws.String(v),
+		}
+		input.Records = append(input.Records, &newrecord)
+	}
+	return &input
+}
+
+func sequenceNumbers(records []kinesis.Record) []string {
+	result := make([]string, 0, len(records))
+	for _, v := range records {
+		result = append(result, v.SequenceNumber)
+	}
+	return result
+}
@@ -0,0 +1,190 @@
+package kinesis
+
+import (
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/vmware/vmware-go-kcl/clientlibrary/interfaces"
+)
+
+// Position is the exact position of a user record within a shard. Records de-aggregated
+// from the same KPL record share the sequence number and differ in the sub sequence number.
+type Position struct {
+	SequenceNumber    string
+	SubSequenceNumber int64
+}
+
+// PositionStore defines behavior to keep the position of shards that stopped in the middle
+// of a KPL aggregated record. KCL checkpoints only hold sequence numbers, so the processor
+// checkpoints before the aggregated record and keeps the exact position here.
+type PositionStore interface {
+	// SavePosition stores the position of the last processed user record of the shard.
+	SavePosition(shardID string, position Position) error
+	// FetchPosition returns the stored position of the shard, false if there is none.
+	FetchPosition(shardID string) (Position, bool, error)
+	// DeletePosition removes the position of the shard once the aggregated record is completed.
+	DeletePosition(shardID string) error
+}
+
+// MemoryPositionStore keeps positions in memory, so they survive processors of the same worker
+// being recreated but not the restart of the worker.
+type MemoryPositionStore struct {
+	mu        sync.RWMutex
+	positions map[string]Position
+}
+
+// NewMemoryPositionStore creates a new in memory position store.
+func NewMemoryPositionStore() *MemoryPositionStore {
+	newStore := MemoryPositionStore{
+		positions: make(map[string]Position),
+	}
+	return &newStore
+}
+
+// SavePosition stores the position of the shard.
+func (m *MemoryPositionStore) SavePosition(shardID string, position Position) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.positions[shardID] = position
+	return nil
+}
+
+// FetchPosition returns the position of the shard.
+func (m *MemoryPositionStore) FetchPosition(shardID string) (Position, bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	position, ok := m.positions[shardID]
+	return position, ok, nil
+}
+
+// DeletePosition removes the position of the shard.
+func (m *MemoryPositionStore) DeletePosition(shardID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.positions, shardID)
+	return nil
+}
+
+// loadPosition restores the position within an aggregated record left by a previous processor
+// of the shard. It is ignored if the kcl checkpoint is already beyond it.
+func (r *RecordProcessor) loadPosition(checkpoint string) {
+	position, ok, err := r.positionStore.FetchPosition(r.shardID)
+	if err != nil {
+		log.Println("level", "ERROR", "msg", "position could not be fetched", "shard", r.shardID, "error", err)
+		return
+	}
+	if !ok {
+		return
+	}
+	if checkpoint != "" && compareSequenceNumbers(checkpoint, position.SequenceNumber) >= 0 {
+		return
+	}
+	log.Println("level", "INFO", "msg", "resuming within aggregated record", "shard", r.shardID, "sequence", position.SequenceNumber, "subsequence", position.SubSequenceNumber)
+	r.position = &position
+}
+
+// skipProcessed removes the user records that were already processed from an aggregated record
+// that was partially processed.
+func (r *RecordProcessor) skipProcessed(records []Record) []Record {
+	if r.position == nil {
+		return records
+	}
+	pending := make([]Record, 0, len(records))
+	for _, v := range records {
+		if v.SequenceNumber == r.position.SequenceNumber && v.SubSequenceNumber <= r.position.SubSequenceNumber {
+			continue
+		}
+		pending = append(pending, v)
+	}
+	return pending
+}
+
+// checkpoint stores the progress of the shard once the first processed records were handled.
+// De-aggregated KPL records share the same sequence number, so when the progress stops in the middle of
+// an aggregated record the kcl checkpoint is set before it and the exact position is kept in the position store.
+func (r *RecordProcessor) checkpoint(input *interfaces.ProcessRecordsInput, records []Record, processed int) {
+	if processed <= 0 {
+		return
+	}
+	last := records[processed-1]
+	r.lagTracker.processed(last)
+	completed := processed == len(records) || records[processed].SequenceNumber != last.SequenceNumber
+	if completed {
+		r.checkpointSequence(input, last.SequenceNumber)
+		if r.position != nil {
+			r.position = nil
+			if err := r.positionStore.DeletePosition(r.shardID); err != nil {
+				log.Println("level", "ERROR", "msg", "position could not be deleted", "shard", r.shardID, "error", err)
+			}
+		}
+		return
+	}
+
+	position := Position{
+		SequenceNumber:    last.SequenceNumber,
+		SubSequenceNumber: last.SubSequenceNumber,
+	}
+	r.position = &position
+	if err := r.positionStore.SavePosition(r.shardID, position); err != nil {
+		log.Println("level", "ERROR", "msg", "position could not be saved", "shard", r.shardID, "error", err)
+	}
+	for i := processed - 1; i >= 0; i-- {
+		if records[i].SequenceNumber != last.SequenceNumber {
+			r.checkpointSequence(input, records[i].SequenceNumber)
+			return
+		}
+	}
+}
+
+// checkpointSequence stores the progress of the shard at the given sequence number.
+func (r *RecordProcessor) checkpointSequence(input *interfaces.ProcessRecordsInput, sequenceNumber string) {
+	diff := input.CacheExitTime.Sub(*input.CacheEntryTime)
+	log.Println("level", "debug", "checkpoint progress at", sequenceNumber, "millisBehindLatest", input.MillisBehindLatest, "kclProcessTime", diff)
+	err := input.Checkpointer.Checkpoint(aws.String(sequenceNumber))
+	if err != nil {
+		// the next checkpoint or the shutdown of the processor writes it again.
+		log.Println("level", "error", "msg", "error checkpointing progress", "error", err)
+		r.uncheckpointed = sequenceNumber
+		return
+	}
+	r.uncheckpointed = ""
+}
+
+// writeUncheckpointed writes again the last checkpoint of the shard if it failed, before leaving
+// the shard. It returns false if it fails again.
+func (r *RecordProcessor) writeUncheckpointed(checkpointer interfaces.IRecordProcessorCheckpointer) bool {
+	if r.uncheckpointed == "" {
+		return true
+	}
+	if err := checkpointer.Checkpoint(aws.String(r.uncheckpointed)); err != nil {
+		log.Println("level", "ERROR", "msg", "final checkpoint could not be written", "shard", r.shardID, "sequence", r.uncheckpointed, "error", err)
+		return false
+	}
+	r.uncheckpointed = ""
+	return true
+}
+
+// checkpointBeforeRelease writes the failed checkpoint of the shard once the processors are
+// stopped, because draining workers release their leases without shutting the processors down.
+func (r *RecordProcessor) checkpointBeforeRelease(checkpointer interfaces.IRecordProcessorCheckpointer) {
+	if !r.flowControl.isStopped() {
+		return
+	}
+	r.writeUncheckpointed(checkpointer)
+}
+
+// compareSequenceNumbers compares two kinesis sequence numbers, which are decimal numbers
+// too big for int64. It returns -1, 0 or 1.
+func compareSequenceNumbers(a, b string) int {
+	a = strings.TrimLeft(a, "0")
+	b = strings.TrimLeft(b, "0")
+	if len(a) != len(b) {
+		if len(a) < len(b) {
+			return -1
+		}
+		return 1
+	}
+	return strings.Compare(a, b)
+}
@@ -0,0 +1,152 @@
+package kinesis_test
+
+import (
+	"context"
+	"crypto/md5"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	awskinesis "github.com/aws/aws-sdk-go/service/kinesis"
+	"github.com/awslabs/kinesis-aggregation/go/deaggregator"
+	"github.com/awslabs/kinesis-aggregation/go/records"
+	"github.com/fernandoocampo/pubsub-kinesis/internal/adapter/kinesis"
+	"github.com/golang/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/vmware/vmware-go-kcl/clientlibrary/interfaces"
+)
+
+func TestAggregatedRecordsAreCheckpointedAtUserRecordPosition(t *testing.T) {
+	positionStore := kinesis.NewMemoryPositionStore()
+	recordHandlerCreator := &poisonHandlerCreatorMock{poisonSequenceNumber: "2/1"}
+	recordProcessorFactory := kinesis.NewRecordHandlerProcessorFactory(&subSequenceHandlerCreator{recordHandlerCreator}).
+		WithPositionStore(positionStore).
+		WithQuarantinePolicy(kinesis.QuarantinePolicy{Action: kinesis.QuarantineHalt})
+	checkpointer := recordProcessorCheckPointer{}
+	kinesisRecords := []*awskinesis.Record{
+		plainRecord("1", "one"),
+		aggregatedRecord(t, "2", "two-a", "two-b", "two-c"),
+		plainRecord("3", "three"),
+	}
+
+	recordProcessor := recordProcessorFactory.CreateProcessor()
+	initializeRecordProcessor(recordProcessor, "")
+	recordProcessor.ProcessRecords(deaggregatedInput(t, &checkpointer, kinesisRecords))
+
+	assert.Equal(t, []string{"1/0", "2/0", "2/1"}, recordHandlerCreator.handler.attempts)
+	assert.Equal(t, []string{"1"}, checkpointer.checkpoints)
+	position, ok, err := positionStore.FetchPosition("shardId-000000000001")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, kinesis.Position{SequenceNumber: "2", SubSequenceNumber: 0}, position)
+
+	// the shard is processed again from the kcl checkpoint by a new processor once the poison pill is fixed.
+	recordHandlerCreator.poisonSequenceNumber = ""
+	checkpointer = recordProcessorCheckPointer{}
+	recordProcessor = recordProcessorFactory.CreateProcessor()
+	initializeRecordProcessor(recordProcessor, "1")
+	recordProcessor.ProcessRecords(deaggregatedInput(t, &checkpointer, kinesisRecords[1:]))
+
+	assert.Equal(t, []string{"2/1", "2/2", "3/0"}, recordHandlerCreator.handler.attempts)
+	assert.Equal(t, []string{"3"}, checkpointer.checkpoints)
+	_, ok, err = positionStore.FetchPosition("shardId-000000000001")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestBatchPartialFailureWithinAggregatedRecord(t *testing.T) {
+	batchHandlerCreator := &batchHandlerCreatorMock{
+		errors: []error{kinesis.NewBatchError(3, errors.New("db timeout"))},
+	}
+	recordProcessorFactory := kinesis.NewBatchRecordProcessorFactory(batchHandlerCreator)
+	checkpointer := recordProcessorCheckPointer{}
+	kinesisRecords := []*awskinesis.Record{
+		plainRecord("1", "one"),
+		aggregatedRecord(t, "2", "two-a", "two-b", "two-c"),
+	}
+
+	recordProcessor := recordProcessorFactory.CreateProcessor()
+	initializeRecordProcessor(recordProcessor, "")
+	recordProcessor.ProcessRecords(deaggregatedInput(t, &checkpointer, kinesisRecords))
+
+	assert.Len(t, batchHandlerCreator.handler.batches, 2)
+	retried := batchHandlerCreator.handler.batches[1]
+	assert.Len(t, retried, 1)
+	assert.Equal(t, "2", retried[0].SequenceNumber)
+	assert.Equal(t, int64(2), retried[0].SubSequenceNumber)
+	assert.Equal(t, "two-c", string(retried[0].Data))
+	assert.Equal(t, []string{"1", "2"}, checkpointer.checkpoints)
+}
+
+// subSequenceHandlerCreator wraps the poison handler so it sees records as sequence/subsequence.
+type subSequenceHandlerCreator struct {
+	creator *poisonHandlerCreatorMock
+}
+
+// Create create a handler that identifies records by sequence and sub sequence numbers
+func (s *subSequenceHandlerCreator) Create() kinesis.RecordHandler {
+	handler := s.creator.Create()
+	return kinesis.RecordHandlerFunc(func(ctx context.Context, record kinesis.Record) error {
+		record.SequenceNumber = record.SequenceNumber + "/" + strconv.FormatInt(record.SubSequenceNumber, 10)
+		return handler.HandleRecord(ctx, record)
+	})
+}
+
+func initializeRecordProcessor(recordProcessor interfaces.IRecordProcessor, checkpoint string) {
+	recordProcessor.Initialize(&interfaces.InitializationInput{
+		ShardId:                "shardId-000000000001",
+		ExtendedSequenceNumber: &interfaces.ExtendedSequenceNumber{SequenceNumber: aws.String(checkpoint)},
+	})
+}
+
+// deaggregatedInput de-aggregates the records the same way kcl does before delivering them.
+func deaggregatedInput(t *testing.T, checkpointer interfaces.IRecordProcessorCheckpointer, kinesisRecords []*awskinesis.Record) *interfaces.ProcessRecordsInput {
+	t.Helper()
+	userRecords, err := deaggregator.DeaggregateRecords(kinesisRecords)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	now := time.Now()
+	return &interfaces.ProcessRecordsInput{
+		CacheEntryTime: &now,
+		CacheExitTime:  &now,
+		Records:        userRecords,
+		Checkpointer:   checkpointer,
+	}
+}
+
+func plainRecord(sequenceNumber, data string) *awskinesis.Record {
+	return &awskinesis.Record{
+		Data:           []byte(data),
+		PartitionKey:   aws.String("partition-" + sequenceNumber),
+		SequenceNumber: aws.String(sequenceNumber),
+	}
+}
+
+// aggregatedRecord builds a KPL aggregated record containing the given user records.
+func aggregatedRecord(t *testing.T, sequenceNumber string, data ...string) *awskinesis.Record {
+	t.Helper()
+	aggregated := records.AggregatedRecord{
+		PartitionKeyTable: []string{"partition-" + sequenceNumber},
+	}
+	for _, v := range data {
+		aggregated.Records = append(aggregated.Records, &records.Record{
+			PartitionKeyIndex: proto.Uint64(0),
+			Data:              []byte(v),
+		})
+	}
+	message, err := proto.Marshal(&aggregated)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	digest := md5.Sum(message)
+	payload := append([]byte("\xf3\x89\x9a\xc2"), message...)
+	payload = append(payload, digest[:]...)
+	return &awskinesis.Record{
+		Data:           payload,
+		PartitionKey:   aws.String("partition-" + sequenceNumber),
+		SequenceNumber: aws.String(sequenceNumber),
+	}
+}
@@ -0,0 +1,220 @@
+package kinesis_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fernandoocampo/pubsub-kinesis/internal/adapter/kinesis"
+	"github.com/stretchr/testify/assert"
+	"github.com/vmware/vmware-go-kcl/clientlibrary/checkpoint"
+	partition "github.com/vmware/vmware-go-kcl/clientlibrary/partition"
+)
+
+func TestDrainLeasesCheckpointsBeforeReleasing(t *testing.T) {
+	leaseDrainer := newLeaseDrainerMock()
+	checkpointer := failingCheckpointerMock{failures: 1}
+	var processor *kinesis.Processor
+	drained := make(chan error, 1)
+	recordHandlerCreator := drainingRecordHandlerCreator{
+		drain: func() {
+			go func() {
+				drained <- processor.DrainLeases(context.Background())
+			}()
+			<-leaseDrainer.draining
+		},
+	}
+	recordProcessorFactory := kinesis.NewRecordHandlerProcessorFactory(recordHandlerCreator).
+		WithLeaseRenewer(leaseDrainer, time.Millisecond)
+	processor = kinesis.NewProcessor(&kclWorkerMock{}).WithRecordProcessorFactory(recordProcessorFactory)
+
+	recordProcessor := recordProcessorFactory.CreateProcessor()
+	initializeRecordProcessor(recordProcessor, "")
+	recordProcessor.ProcessRecords(newProcessRecordsInput(&checkpointer, "1"))
+
+	assert.Equal(t, []string{"1"}, checkpointer.checkpoints)
+	leaseDrainer.release()
+	select {
+	case err := <-drained:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("leases were not drained")
+	}
+}
+
+func TestDrainLeasesReleasesPausedShards(t *testing.T) {
+	leaseDrainer := newLeaseDrainerMock()
+	recordHandlerCreator := &recordHandlerCreatorMock{}
+	recordProcessorFactory := kinesis.NewRecordHandlerProcessorFactory(recordHandlerCreator).
+		WithLeaseRenewer(leaseDrainer, time.Millisecond)
+	processor := kinesis.NewProcessor(&kclWorkerMock{}).WithRecordProcessorFactory(recordProcessorFactory)
+	checkpointer := recordProcessorCheckPointer{}
+	recordProcessor := recordProcessorFactory.CreateProcessor()
+	initializeRecordProcessor(recordProcessor, "")
+	err := processor.Pause()
+	assert.NoError(t, err)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		recordProcessor.ProcessRecords(newProcessRecordsInput(&checkpointer, "1"))
+	}()
+	leaseDrainer.release()
+
+	err = processor.DrainLeases(context.Background())
+
+	assert.NoError(t, err)
+	waitOrFail(t, done)
+	assert.Empty(t, recordHandlerCreator.handler.records)
+	assert.Empty(t, checkpointer.checkpoints)
+}
+
+func TestDrainLeasesWaitsForRelease(t *testing.T) {
+	recordProcessorFactory := kinesis.NewRecordHandlerProcessorFactory(&recordHandlerCreatorMock{}).
+		WithLeaseRenewer(newLeaseDrainerMock(), time.Millisecond)
+	processor := kinesis.NewProcessor(&kclWorkerMock{}).WithRecordProcessorFactory(recordProcessorFactory)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	err := processor.DrainLeases(ctx)
+
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestDrainLeasesWithoutLeaseDrainer(t *testing.T) {
+	recordProcessorFactory := kinesis.NewRecordHandlerProcessorFactory(&recordHandlerCreatorMock{}).
+		WithLeaseRenewer(&leaseRenewerMock{}, time.Millisecond)
+	processor := kinesis.NewProcessor(&kclWorkerMock{}).WithRecordProcessorFactory(recordProcessorFactory)
+
+	err := processor.DrainLeases(context.Background())
+
+	assert.Equal(t, kinesis.ErrNoLeaseDrainer, err)
+}
+
+func TestLeaseKeeperRefusesLeasesWhileDraining(t *testing.T) {
+	checkpointer := newLeaseCheckpointerMock()
+	leaseKeeper := kinesis.NewLeaseKeeper(checkpointer, "worker-1")
+	assert.NoError(t, leaseKeeper.GetLease(newShardStatus("shardId-000000000000"), "worker-1"))
+
+	leaseKeeper.DrainLeases()
+
+	assert.Equal(t, checkpoint.ErrLeaseNotAcquired{}, leaseKeeper.GetLease(newShardStatus("shardId-000000000001"), "worker-1"))
+	assert.Error(t, leaseKeeper.ClaimShard(newShardStatus("shardId-000000000002"), "worker-1"))
+	assert.NoError(t, leaseKeeper.GetLease(newShardStatus("shardId-000000000003"), "worker-2"))
+	assert.NoError(t, leaseKeeper.ClaimShard(newShardStatus("shardId-000000000004"), "worker-2"))
+	assert.Equal(t, []string{"shardId-000000000000/worker-1", "shardId-000000000003/worker-2"}, checkpointer.leases)
+	assert.Equal(t, []string{"shardId-000000000004/worker-2"}, checkpointer.claims)
+}
+
+func TestLeaseKeeperDrainsHeldLeases(t *testing.T) {
+	leaseKeeper := kinesis.NewLeaseKeeper(newLeaseCheckpointerMock(), "worker-1")
+	first := newShardStatus("shardId-000000000000")
+	second := newShardStatus("shardId-000000000001")
+	assert.NoError(t, leaseKeeper.GetLease(first, "worker-1"))
+	assert.NoError(t, leaseKeeper.GetLease(second, "worker-1"))
+	assert.False(t, first.GetLeaseTimeout().IsZero())
+
+	drained := leaseKeeper.DrainLeases()
+
+	assert.True(t, first.GetLeaseTimeout().IsZero())
+	assert.True(t, second.GetLeaseTimeout().IsZero())
+	assert.False(t, isClosed(drained))
+	assert.NoError(t, leaseKeeper.RemoveLeaseOwner(first.ID))
+	assert.False(t, isClosed(drained))
+	assert.NoError(t, leaseKeeper.RemoveLeaseOwner(second.ID))
+	assert.True(t, isClosed(drained))
+	assert.Equal(t, drained, leaseKeeper.DrainLeases())
+}
+
+func TestLeaseKeeperWithoutLeasesIsDrainedRightAway(t *testing.T) {
+	leaseKeeper := kinesis.NewLeaseKeeper(newLeaseCheckpointerMock(), "worker-1")
+
+	drained := leaseKeeper.DrainLeases()
+
+	assert.True(t, isClosed(drained))
+	assert.True(t, isClosed(leaseKeeper.DrainLeases()))
+}
+
+// leaseDrainerMock drains its leases once release is called.
+type leaseDrainerMock struct {
+	leaseRenewerMock
+	once     sync.Once
+	draining chan struct{}
+	drained  chan struct{}
+}
+
+func newLeaseDrainerMock() *leaseDrainerMock {
+	return &leaseDrainerMock{
+		draining: make(chan struct{}),
+		drained:  make(chan struct{}),
+	}
+}
+
+func (l *leaseDrainerMock) DrainLeases() <-chan struct{} {
+	l.once.Do(func() {
+		close(l.draining)
+	})
+	return l.drained
+}
+
+func (l *leaseDrainerMock) release() {
+	close(l.drained)
+}
+
+// drainingRecordHandlerCreator creates handlers that drain the leases while they handle a record.
+type drainingRecordHandlerCreator struct {
+	drain func()
+}
+
+func (d drainingRecordHandlerCreator) Create() kinesis.RecordHandler {
+	return kinesis.RecordHandlerFunc(func(ctx context.Context, record kinesis.Record) error {
+		d.drain()
+		return nil
+	})
+}
+
+// leaseCheckpointerMock grants every lease and claim, it keeps them as shard/worker.
+type leaseCheckpointerMock struct {
+	checkpoint.Checkpointer
+	leases []string
+	claims []string
+}
+
+func newLeaseCheckpointerMock() *leaseCheckpointerMock {
+	return &leaseCheckpointerMock{}
+}
+
+func (l *leaseCheckpointerMock) GetLease(shard *partition.ShardStatus, newAssignTo string) error {
+	l.leases = append(l.leases, shard.ID+"/"+newAssignTo)
+	shard.SetLeaseOwner(newAssignTo)
+	shard.Mux.Lock()
+	shard.LeaseTimeout = time.Now().Add(time.Minute)
+	shard.Mux.Unlock()
+	return nil
+}
+
+func (l *leaseCheckpointerMock) RemoveLeaseOwner(shardID string) error {
+	return nil
+}
+
+func (l *leaseCheckpointerMock) ClaimShard(shard *partition.ShardStatus, claimID string) error {
+	l.claims = append(l.claims, shard.ID+"/"+claimID)
+	return nil
+}
+
+func newShardStatus(shardID string) *partition.ShardStatus {
+	return &partition.ShardStatus{
+		ID:  shardID,
+		Mux: &sync.RWMutex{},
+	}
+}
+
+// isClosed tells if the channel is closed.
+func isClosed(c <-chan struct{}) bool {
+	select {
+	case <-c:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,116 @@
+package kinesis
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Envelope is a message format that carries headers along with the payload of a record.
+//
+//	{"headers": {"type": "order.created"}, "payload": {...}}
+type Envelope struct {
+	Headers map[string]string `json:"headers"`
+	Payload json.RawMessage   `json:"payload"`
+}
+
+// errNotEnvelope is returned when the data of a record is not an envelope.
+var errNotEnvelope = errors.New("record data is not an envelope")
+
+// DecodeEnvelope decodes the envelope contained in the given data.
+func DecodeEnvelope(data []byte) (Envelope, error) {
+	var envelope Envelope
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return envelope, err
+	}
+	if envelope.Headers == nil && envelope.Payload == nil {
+		return envelope, errNotEnvelope
+	}
+	return envelope, nil
+}
+
+// Envelope decodes the data of the record as an envelope. The records delivered by record processors
+// decode it once, their filters, router and handler share it, so its headers must not be modified.
+func (r Record) Envelope() (Envelope, error) {
+	if r.envelope == nil {
+		return DecodeEnvelope(r.Data)
+	}
+	return r.envelope.decode(r.Data)
+}
+
+// envelopeCache keeps the envelope decoded from the data of a record, it is shared by the copies of the record.
+type envelopeCache struct {
+	mutex    sync.Mutex
+	data     []byte
+	envelope Envelope
+	err      error
+}
+
+// decode returns the envelope of the data, it is decoded again only if the data is not the cached one,
+// e.g. because a middleware replaced it.
+func (e *envelopeCache) decode(data []byte) (Envelope, error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.data == nil || !sameBytes(e.data, data) {
+		e.envelope, e.err = DecodeEnvelope(data)
+		e.data = data
+	}
+	return e.envelope, e.err
+}
+
+// sameBytes tells if both slices are the same slice, not only equal.
+func sameBytes(a, b []byte) bool {
+	return len(a) == len(b) && (len(a) == 0 || &a[0] == &b[0])
+}
+
+// Header returns the value of an envelope header of the record.
+// The second value is false if the record is not an envelope or the header is missing.
+func (r Record) Header(name string) (string, bool) {
+	envelope, err := r.Envelope()
+	if err != nil {
+		return "", false
+	}
+	value, ok := envelope.Headers[name]
+	return value, ok
+}
+
+// Payload returns the payload of the record, that is the envelope payload for envelopes
+// and the whole data otherwise.
+func (r Record) Payload() []byte {
+	envelope, err := r.Envelope()
+	if err != nil || envelope.Payload == nil {
+		return r.Data
+	}
+	return envelope.Payload
+}
+
+// lookupJSONField returns the value at the given dotted path of a JSON document, e.g. "order.items.0.sku".
+// The second value is false if the path does not exist.
+func lookupJSONField(data []byte, path string) (interface{}, bool, error) {
+	var document interface{}
+	if err := json.Unmarshal(data, &document); err != nil {
+		return nil, false, err
+	}
+	current := document
+	for _, key := range strings.Split(path, ".") {
+		switch node := current.(type) {
+		case map[string]interface{}:
+			value, ok := node[key]
+			if !ok {
+				return nil, false, nil
+			}
+			current = value
+		case []interface{}:
+			index, err := strconv.Atoi(key)
+			if err != nil || index < 0 || index >= len(node) {
+				return nil, false, nil
+			}
+			current = node[index]
+		default:
+			return nil, false, nil
+		}
+	}
+	return current, true, nil
+}
@@ -0,0 +1,11 @@
+package kinesis
+
+import "github.com/vmware/vmware-go-kcl/clientlibrary/checkpoint"
+
+// LeaseKeeper exposes the lease keeper of the workers to the tests.
+type LeaseKeeper = leaseKeeper
+
+// NewLeaseKeeper exposes newLeaseKeeper to the tests.
+func NewLeaseKeeper(checkpointer checkpoint.Checkpointer, workerID string) *LeaseKeeper {
+	return newLeaseKeeper(checkpointer, workerID)
+}
@@ -0,0 +1,31 @@
+package kinesis
+
+import (
+	"log"
+
+	"github.com/vmware/vmware-go-kcl/clientlibrary/config"
+)
+
+// applyEnhancedFanOut makes the worker receive records through enhanced fan-out when it is enabled.
+// The worker registers the stream consumer if no consumer ARN is given, subscribes to its shards
+// with SubscribeToShard and subscribes again after the last delivered record when a subscription
+// expires, so checkpoints work the same way as in polling mode.
+func (k KCLConfiguration) applyEnhancedFanOut(kclLibConf *config.KinesisClientLibConfiguration) {
+	switch {
+	case k.EnhancedFanOutConsumerARN != "":
+		kclLibConf.WithEnhancedFanOutConsumerARN(k.EnhancedFanOutConsumerARN)
+	case k.EnhancedFanOutConsumerName != "":
+		kclLibConf.WithEnhancedFanOutConsumerName(k.EnhancedFanOutConsumerName)
+	case k.EnhancedFanOut:
+		// the consumer is named after the application, which is the default of kcl.
+		kclLibConf.WithEnhancedFanOutConsumerName(kclLibConf.ApplicationName)
+	default:
+		return
+	}
+	log.Println(
+		"level", "INFO",
+		"msg", "enhanced fan-out enabled",
+		"consumer", kclLibConf.EnhancedFanOutConsumerName,
+		"consumer_arn", kclLibConf.EnhancedFanOutConsumerARN,
+	)
+}
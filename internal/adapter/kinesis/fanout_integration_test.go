@@ -0,0 +1,103 @@
+//go:build integration
+// +build integration
+
+package kinesis_test
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	awskinesis "github.com/aws/aws-sdk-go/service/kinesis"
+	"github.com/fernandoocampo/pubsub-kinesis/internal/adapter/kinesis"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestEnhancedFanOutWithEmulator runs an enhanced fan-out worker against a local emulator
+// that supports SubscribeToShard, e.g. localstack:
+//
+//	KINESIS_EMULATOR_ENDPOINT=http://localhost:4566 go test -tags integration ./internal/adapter/kinesis/...
+func TestEnhancedFanOutWithEmulator(t *testing.T) {
+	endpoint := os.Getenv("KINESIS_EMULATOR_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("KINESIS_EMULATOR_ENDPOINT is not set")
+	}
+	streamName := "fanout-" + time.Now().Format("20060102150405")
+	awsCredentials := credentials.NewStaticCredentials("test", "test", "")
+	kinesisClient := awskinesis.New(session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String("us-east-1"),
+		Endpoint:    aws.String(endpoint),
+		Credentials: awsCredentials,
+	})))
+	_, err := kinesisClient.CreateStream(&awskinesis.CreateStreamInput{
+		StreamName: aws.String(streamName),
+		ShardCount: aws.Int64(1),
+	})
+	if err != nil {
+		t.Fatal("unexpected error creating stream", err)
+	}
+	defer kinesisClient.DeleteStream(&awskinesis.DeleteStreamInput{StreamName: aws.String(streamName)})
+	err = kinesisClient.WaitUntilStreamExists(&awskinesis.DescribeStreamInput{StreamName: aws.String(streamName)})
+	if err != nil {
+		t.Fatal("unexpected error waiting for stream", err)
+	}
+
+	received := make(chan kinesis.Record, 1)
+	var once sync.Once
+	recordProcessorFactory := kinesis.NewRecordHandlerProcessorFactory(recordHandlerCreatorFunc(func(ctx context.Context, record kinesis.Record) error {
+		once.Do(func() { received <- record })
+		return nil
+	}))
+	workerFactory, err := kinesis.NewKCLWorkerFactory(kinesis.KCLConfiguration{
+		KinesisCredentials:  awsCredentials,
+		DynamoDBCredentials: awsCredentials,
+		ApplicationName:     streamName + "-consumer",
+		StreamName:          streamName,
+		RegionName:          "us-east-1",
+		WorkerID:            "worker-1",
+		KinesisEndpoint:     endpoint,
+		DynamoDBEndpoint:    endpoint,
+		InitialPosition:     kinesis.InitialPositionTrimHorizon,
+		EnhancedFanOut:      true,
+	})
+	if err != nil {
+		t.Fatal("unexpected error creating worker factory", err)
+	}
+	processor := kinesis.NewProcessor(workerFactory.NewWorker(recordProcessorFactory)).
+		WithRecordProcessorFactory(recordProcessorFactory)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errs := make(chan error, 1)
+	go func() {
+		errs <- processor.Run(ctx)
+	}()
+
+	_, err = kinesisClient.PutRecord(&awskinesis.PutRecordInput{
+		StreamName:   aws.String(streamName),
+		PartitionKey: aws.String("one"),
+		Data:         []byte(`{"key": "one"}`),
+	})
+	if err != nil {
+		t.Fatal("unexpected error publishing record", err)
+	}
+
+	select {
+	case record := <-received:
+		assert.Equal(t, `{"key": "one"}`, string(record.Data))
+	case <-time.After(2 * time.Minute):
+		t.Fatal("record was not received through enhanced fan-out")
+	}
+	cancel()
+	assert.NoError(t, <-errs)
+}
+
+type recordHandlerCreatorFunc kinesis.RecordHandlerFunc
+
+func (f recordHandlerCreatorFunc) Create() kinesis.RecordHandler {
+	return kinesis.RecordHandlerFunc(f)
+}
@@ -0,0 +1,275 @@
+package kinesis
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"reflect"
+	"strings"
+)
+
+// Prefixes of the selectors used in filter expressions.
+const (
+	headerSelectorPrefix   = "header."
+	jsonPathSelectorPrefix = "$."
+)
+
+// RecordFilter defines behavior to decide if a record must reach the handler.
+type RecordFilter interface {
+	Match(record Record) bool
+}
+
+// RecordFilterFunc is an adapter to allow the use of ordinary functions as record filters.
+type RecordFilterFunc func(record Record) bool
+
+// Match calls f(record).
+func (f RecordFilterFunc) Match(record Record) bool {
+	return f(record)
+}
+
+// HeaderExists matches records whose envelope has the given header.
+func HeaderExists(name string) RecordFilter {
+	return RecordFilterFunc(func(record Record) bool {
+		_, ok := record.Header(name)
+		return ok
+	})
+}
+
+// HeaderEquals matches records whose envelope header has the given value.
+func HeaderEquals(name, value string) RecordFilter {
+	return RecordFilterFunc(func(record Record) bool {
+		headerValue, ok := record.Header(name)
+		return ok && headerValue == value
+	})
+}
+
+// HeaderMatches matches records whose envelope header matches the given pattern,
+// using the syntax of path.Match, e.g. "order.*".
+func HeaderMatches(name, pattern string) RecordFilter {
+	return RecordFilterFunc(func(record Record) bool {
+		headerValue, ok := record.Header(name)
+		if !ok {
+			return false
+		}
+		matched, err := path.Match(pattern, headerValue)
+		return err == nil && matched
+	})
+}
+
+// JSONFieldExists matches records whose payload has a value at the given dotted path.
+func JSONFieldExists(fieldPath string) RecordFilter {
+	return RecordFilterFunc(func(record Record) bool {
+		_, ok, err := lookupJSONField(record.Payload(), fieldPath)
+		return err == nil && ok
+	})
+}
+
+// JSONFieldEquals matches records whose payload value at the given dotted path is equal
+// to the given value once both are decoded as JSON, so 3 and 3.0 are equal.
+func JSONFieldEquals(fieldPath string, value interface{}) RecordFilter {
+	expected, err := normalizeJSONValue(value)
+	return RecordFilterFunc(func(record Record) bool {
+		if err != nil {
+			return false
+		}
+		fieldValue, ok, lookupErr := lookupJSONField(record.Payload(), fieldPath)
+		return lookupErr == nil && ok && reflect.DeepEqual(fieldValue, expected)
+	})
+}
+
+// JSONFieldMatches matches records whose payload value at the given dotted path matches
+// the given pattern, using the syntax of path.Match. Non string values are matched on
+// their default format.
+func JSONFieldMatches(fieldPath, pattern string) RecordFilter {
+	return RecordFilterFunc(func(record Record) bool {
+		fieldValue, ok, err := lookupJSONField(record.Payload(), fieldPath)
+		if err != nil || !ok {
+			return false
+		}
+		matched, err := path.Match(pattern, fmt.Sprint(fieldValue))
+		return err == nil && matched
+	})
+}
+
+// AllOf matches records that match every given filter.
+func AllOf(filters ...RecordFilter) RecordFilter {
+	return RecordFilterFunc(func(record Record) bool {
+		for _, filter := range filters {
+			if !filter.Match(record) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// AnyOf matches records that match at least one of the given filters.
+func AnyOf(filters ...RecordFilter) RecordFilter {
+	return RecordFilterFunc(func(record Record) bool {
+		for _, filter := range filters {
+			if filter.Match(record) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// Not matches records that don't match the given filter.
+func Not(filter RecordFilter) RecordFilter {
+	return RecordFilterFunc(func(record Record) bool {
+		return !filter.Match(record)
+	})
+}
+
+// ParseFilter creates a filter from an expression, so filters can be declared in configuration.
+// An expression is a selector, optionally followed by an operator and a value:
+//
+//	header.event-type == "order.created"
+//	header.event-type ~= "order.*"
+//	$.order.country != "CO"
+//	$.order.total == 100
+//	$.order.priority
+//
+// Selectors start with "header." for envelope headers or "$." for a dotted path in the payload.
+// Operators are "==", "!=" and "~=" (pattern match). Values are JSON literals; values that are
+// not valid JSON are taken as plain strings. A selector alone matches records where it exists.
+func ParseFilter(expression string) (RecordFilter, error) {
+	selector, operator, value := splitFilterExpression(expression)
+	if selector == "" {
+		return nil, fmt.Errorf("invalid filter expression %q: missing selector", expression)
+	}
+
+	var header, fieldPath string
+	switch {
+	case strings.HasPrefix(selector, headerSelectorPrefix):
+		header = strings.TrimPrefix(selector, headerSelectorPrefix)
+	case strings.HasPrefix(selector, jsonPathSelectorPrefix):
+		fieldPath = strings.TrimPrefix(selector, jsonPathSelectorPrefix)
+	default:
+		return nil, fmt.Errorf("invalid filter expression %q: unknown selector %q", expression, selector)
+	}
+	if header == "" && fieldPath == "" {
+		return nil, fmt.Errorf("invalid filter expression %q: empty selector %q", expression, selector)
+	}
+
+	if operator == "" {
+		if header != "" {
+			return HeaderExists(header), nil
+		}
+		return JSONFieldExists(fieldPath), nil
+	}
+	if value == "" {
+		return nil, fmt.Errorf("invalid filter expression %q: missing value", expression)
+	}
+
+	var literal interface{}
+	if err := json.Unmarshal([]byte(value), &literal); err != nil {
+		literal = value
+	}
+
+	switch operator {
+	case "==", "!=":
+		var filter RecordFilter
+		if header != "" {
+			headerValue, ok := literal.(string)
+			if !ok {
+				headerValue = value
+			}
+			filter = HeaderEquals(header, headerValue)
+		} else {
+			filter = JSONFieldEquals(fieldPath, literal)
+		}
+		if operator == "!=" {
+			filter = Not(filter)
+		}
+		return filter, nil
+	default:
+		pattern, ok := literal.(string)
+		if !ok {
+			pattern = value
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid filter expression %q: %w", expression, err)
+		}
+		if header != "" {
+			return HeaderMatches(header, pattern), nil
+		}
+		return JSONFieldMatches(fieldPath, pattern), nil
+	}
+}
+
+// ParseFilters creates a filter that matches records matching all the given expressions.
+func ParseFilters(expressions ...string) (RecordFilter, error) {
+	filters := make([]RecordFilter, 0, len(expressions))
+	for _, expression := range expressions {
+		filter, err := ParseFilter(expression)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, filter)
+	}
+	return AllOf(filters...), nil
+}
+
+// splitFilterExpression splits an expression at its first operator.
+func splitFilterExpression(expression string) (string, string, string) {
+	operatorIndex := -1
+	var operator string
+	for _, candidate := range []string{"==", "!=", "~="} {
+		index := strings.Index(expression, candidate)
+		if index >= 0 && (operatorIndex < 0 || index < operatorIndex) {
+			operatorIndex = index
+			operator = candidate
+		}
+	}
+	if operatorIndex < 0 {
+		return strings.TrimSpace(expression), "", ""
+	}
+	selector := strings.TrimSpace(expression[:operatorIndex])
+	value := strings.TrimSpace(expression[operatorIndex+len(operator):])
+	return selector, operator, value
+}
+
+// normalizeJSONValue converts a value to the types produced by decoding JSON.
+func normalizeJSONValue(value interface{}) (interface{}, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, errors.New("filter value cannot be encoded as json")
+	}
+	var normalized interface{}
+	if err := json.Unmarshal(data, &normalized); err != nil {
+		return nil, errors.New("filter value cannot be decoded as json")
+	}
+	return normalized, nil
+}
+
+// matches tells if the record must reach the handler, recording the filter hit or miss.
+func (r *RecordProcessor) matches(record Record) bool {
+	if r.filter == nil {
+		return true
+	}
+	matched := r.filter.Match(record)
+	if r.metricsRecorder != nil {
+		metric := MetricFilterMisses
+		if matched {
+			metric = MetricFilterHits
+		}
+		r.metricsRecorder.IncrementCounter(metric, map[string]string{"shard": r.shardID})
+	}
+	return matched
+}
+
+// selectRecords returns the records that match the filter and their indexes within the given records.
+func (r *RecordProcessor) selectRecords(records []Record) ([]Record, []int) {
+	selected := make([]Record, 0, len(records))
+	indexes := make([]int, 0, len(records))
+	for i, record := range records {
+		if r.matches(record) {
+			selected = append(selected, record)
+			indexes = append(indexes, i)
+		}
+	}
+	return selected, indexes
+}
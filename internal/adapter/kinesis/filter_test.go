@@ -0,0 +1,120 @@
+package kinesis_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/fernandoocampo/pubsub-kinesis/internal/adapter/kinesis"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseFilter(t *testing.T) {
+	order := kinesis.Record{
+		Data: []byte(`{"headers":{"event-type":"order.created","version":"2"},"payload":{"order":{"country":"CO","total":100,"items":[{"sku":"A-1"}]}}}`),
+	}
+	cases := map[string]struct {
+		expression string
+		want       bool
+	}{
+		"header_equals":        {expression: `header.event-type == "order.created"`, want: true},
+		"header_unquoted":      {expression: `header.event-type == order.created`, want: true},
+		"header_number":        {expression: `header.version == 2`, want: true},
+		"header_not_equals":    {expression: `header.event-type != "order.created"`, want: false},
+		"header_pattern":       {expression: `header.event-type ~= "order.*"`, want: true},
+		"header_exists":        {expression: `header.version`, want: true},
+		"missing_header":       {expression: `header.tenant == "acme"`, want: false},
+		"field_equals":         {expression: `$.order.country == "CO"`, want: true},
+		"field_number":         {expression: `$.order.total == 100.0`, want: true},
+		"field_not_equals":     {expression: `$.order.country != "CO"`, want: false},
+		"field_array_pattern":  {expression: `$.order.items.0.sku ~= "A-*"`, want: true},
+		"field_exists":         {expression: `$.order.items`, want: true},
+		"missing_field":        {expression: `$.order.priority`, want: false},
+		"missing_field_differ": {expression: `$.order.priority != "high"`, want: true},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(st *testing.T) {
+			filter, err := kinesis.ParseFilter(c.expression)
+
+			assert.NoError(st, err)
+			assert.Equal(st, c.want, filter.Match(order))
+		})
+	}
+}
+
+func TestParseFilterRejectsInvalidExpressions(t *testing.T) {
+	expressions := []string{
+		``,
+		`== "order.created"`,
+		`event-type == "order.created"`,
+		`header. == "order.created"`,
+		`$.order.country ==`,
+		`header.event-type ~= "[order"`,
+	}
+
+	for _, expression := range expressions {
+		_, err := kinesis.ParseFilter(expression)
+
+		assert.Error(t, err, expression)
+	}
+}
+
+func TestFilteredRecordsAreSkippedButCheckpointed(t *testing.T) {
+	recordHandlerCreator := &recordHandlerCreatorMock{}
+	metricsRecorder := newMetricsRecorderMock()
+	filter, err := kinesis.ParseFilters(`$.key != "2"`, `$.key != "4"`)
+	assert.NoError(t, err)
+	recordProcessorFactory := kinesis.NewRecordHandlerProcessorFactory(recordHandlerCreator).
+		WithFilters(filter).
+		WithMetricsRecorder(metricsRecorder)
+	checkpointer := recordProcessorCheckPointer{}
+
+	recordProcessor := recordProcessorFactory.CreateProcessor()
+	initializeRecordProcessor(recordProcessor, "")
+	recordProcessor.ProcessRecords(newProcessRecordsInput(&checkpointer, "1", "2", "3", "4"))
+
+	assert.Equal(t, []string{"1", "3"}, sequenceNumbers(recordHandlerCreator.handler.records))
+	assert.Equal(t, []string{"4"}, checkpointer.checkpoints)
+	assert.Equal(t, 2, metricsRecorder.counters[kinesis.MetricFilterHits])
+	assert.Equal(t, 2, metricsRecorder.counters[kinesis.MetricFilterMisses])
+}
+
+func TestFilteredBatchIsCheckpointedUpToFailedRecord(t *testing.T) {
+	batchHandlerCreator := &batchHandlerCreatorMock{
+		errors: []error{kinesis.NewBatchError(1, errors.New("record 3 failed"))},
+	}
+	recordProcessorFactory := kinesis.NewBatchRecordProcessorFactory(batchHandlerCreator).
+		WithMaxBatchRetries(0).
+		WithQuarantinePolicy(kinesis.QuarantinePolicy{Action: kinesis.QuarantineHalt}).
+		WithFilters(kinesis.Not(kinesis.JSONFieldEquals("key", "2")))
+	checkpointer := recordProcessorCheckPointer{}
+
+	recordProcessor := recordProcessorFactory.CreateProcessor()
+	initializeRecordProcessor(recordProcessor, "")
+	recordProcessor.ProcessRecords(newProcessRecordsInput(&checkpointer, "1", "2", "3"))
+
+	assert.Equal(t, [][]string{{"1", "3"}}, batchSequenceNumbers(batchHandlerCreator.handler.batches))
+	assert.Equal(t, []string{"2"}, checkpointer.checkpoints)
+}
+
+func TestBatchWithoutMatchingRecordsIsCheckpointed(t *testing.T) {
+	batchHandlerCreator := &batchHandlerCreatorMock{}
+	recordProcessorFactory := kinesis.NewBatchRecordProcessorFactory(batchHandlerCreator).
+		WithFilters(kinesis.HeaderExists("event-type"))
+	checkpointer := recordProcessorCheckPointer{}
+
+	recordProcessor := recordProcessorFactory.CreateProcessor()
+	initializeRecordProcessor(recordProcessor, "")
+	recordProcessor.ProcessRecords(newProcessRecordsInput(&checkpointer, "1", "2"))
+
+	assert.Empty(t, batchHandlerCreator.handler.batches)
+	assert.Equal(t, []string{"2"}, checkpointer.checkpoints)
+}
+
+func batchSequenceNumbers(batches [][]kinesis.Record) [][]string {
+	result := make([][]string, 0, len(batches))
+	for _, v := range batches {
+		result = append(result, sequenceNumbers(v))
+	}
+	return result
+}
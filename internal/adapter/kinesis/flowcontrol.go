@@ -0,0 +1,195 @@
+package kinesis
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// DefaultHealthCheckInterval is the default time between health checks while the processors are paused by the health gate.
+const DefaultHealthCheckInterval = 5 * time.Second
+
+// DefaultLeaseRenewInterval is the default time between lease renewals of paused shards.
+const DefaultLeaseRenewInterval = 5 * time.Second
+
+// ErrNoRecordProcessorFactory is returned when an operation needs the record processor factory of a processor
+// but it was not set.
+var ErrNoRecordProcessorFactory = errors.New("record processor factory was not set in the processor")
+
+// HealthCheck defines behavior to check if the downstream dependencies of handlers are healthy.
+type HealthCheck interface {
+	Check(ctx context.Context) error
+}
+
+// HealthCheckFunc is an adapter to use ordinary functions as health checks.
+type HealthCheckFunc func(ctx context.Context) error
+
+// Check calls f(ctx).
+func (f HealthCheckFunc) Check(ctx context.Context) error {
+	return f(ctx)
+}
+
+// LeaseRenewer defines behavior to renew the lease of a shard, so it is kept while its processor is paused.
+type LeaseRenewer interface {
+	RenewLease(shardID string) error
+}
+
+// LeaseDrainer defines behavior to drain the leases of a worker, so other workers take its shards
+// right away instead of waiting for the leases to expire, e.g. before a deploy.
+type LeaseDrainer interface {
+	// DrainLeases stops taking leases and releases the held ones as their shards finish their
+	// current batch. The returned channel is closed once the worker holds no lease.
+	DrainLeases() <-chan struct{}
+}
+
+// FlowControl pauses and resumes the record processors of a factory, globally or per shard.
+// Processors check it before each batch and wait while they are paused or the health gate fails,
+// renewing their leases so other workers don't take their shards.
+type FlowControl struct {
+	mu                  sync.Mutex
+	paused              bool
+	pausedShards        map[string]bool
+	changed             chan struct{}
+	stopped             chan struct{}
+	stopOnce            sync.Once
+	healthCheck         HealthCheck
+	healthCheckInterval time.Duration
+	leaseRenewer        LeaseRenewer
+	leaseRenewInterval  time.Duration
+}
+
+// newFlowControl creates a flow control that lets every processor run.
+func newFlowControl() *FlowControl {
+	newFlowControl := FlowControl{
+		pausedShards:        make(map[string]bool),
+		changed:             make(chan struct{}),
+		stopped:             make(chan struct{}),
+		healthCheckInterval: DefaultHealthCheckInterval,
+		leaseRenewInterval:  DefaultLeaseRenewInterval,
+	}
+	return &newFlowControl
+}
+
+// Pause pauses all the shards.
+func (f *FlowControl) Pause() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	log.Println("level", "INFO", "msg", "pausing all shards")
+	f.paused = true
+	f.notify()
+}
+
+// Resume resumes all the shards that were not paused individually.
+func (f *FlowControl) Resume() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	log.Println("level", "INFO", "msg", "resuming all shards")
+	f.paused = false
+	f.notify()
+}
+
+// PauseShard pauses the given shard.
+func (f *FlowControl) PauseShard(shardID string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	log.Println("level", "INFO", "msg", "pausing shard", "shard", shardID)
+	f.pausedShards[shardID] = true
+	f.notify()
+}
+
+// ResumeShard resumes the given shard, it keeps waiting if all the shards are paused.
+func (f *FlowControl) ResumeShard(shardID string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	log.Println("level", "INFO", "msg", "resuming shard", "shard", shardID)
+	delete(f.pausedShards, shardID)
+	f.notify()
+}
+
+// IsPaused tells if the given shard is paused, either individually or globally.
+func (f *FlowControl) IsPaused(shardID string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.paused || f.pausedShards[shardID]
+}
+
+// notify wakes up the processors waiting for a change. It must be called holding the lock.
+func (f *FlowControl) notify() {
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
+
+// stop releases every waiting processor, it is used when the worker shuts down.
+func (f *FlowControl) stop() {
+	f.stopOnce.Do(func() {
+		close(f.stopped)
+	})
+}
+
+// isStopped tells if the processors were released to shut down or drain.
+func (f *FlowControl) isStopped() bool {
+	select {
+	case <-f.stopped:
+		return true
+	default:
+		return false
+	}
+}
+
+// state returns whether the shard is paused and the channel that is closed on the next change.
+func (f *FlowControl) state(shardID string) (bool, <-chan struct{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.paused || f.pausedShards[shardID], f.changed
+}
+
+// wait blocks until the shard is allowed to process its next batch. It returns false if
+// the processor must not process it because it is shutting down.
+func (f *FlowControl) wait(ctx context.Context, shardID string) bool {
+	lastRenew := time.Now()
+	for {
+		paused, changed := f.state(shardID)
+		var wake <-chan time.Time
+		if !paused {
+			err := f.checkHealth(ctx)
+			if err == nil {
+				return true
+			}
+			log.Println("level", "WARN", "msg", "health gate failed, pausing shard", "shard", shardID, "error", err)
+			wake = time.After(f.healthCheckInterval)
+		}
+
+		renew := time.After(f.leaseRenewInterval - time.Since(lastRenew))
+		select {
+		case <-ctx.Done():
+			return false
+		case <-f.stopped:
+			return false
+		case <-changed:
+		case <-wake:
+		case <-renew:
+			lastRenew = time.Now()
+			f.renewLease(shardID)
+		}
+	}
+}
+
+// checkHealth runs the health gate, if any.
+func (f *FlowControl) checkHealth(ctx context.Context) error {
+	if f.healthCheck == nil {
+		return nil
+	}
+	return f.healthCheck.Check(ctx)
+}
+
+// renewLease keeps the lease of a waiting shard.
+func (f *FlowControl) renewLease(shardID string) {
+	if f.leaseRenewer == nil {
+		return
+	}
+	if err := f.leaseRenewer.RenewLease(shardID); err != nil {
+		log.Println("level", "ERROR", "msg", "lease of paused shard could not be renewed", "shard", shardID, "error", err)
+	}
+}
@@ -0,0 +1,125 @@
+package kinesis_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fernandoocampo/pubsub-kinesis/internal/adapter/kinesis"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPausedShardKeepsLeaseUntilResumed(t *testing.T) {
+	leaseRenewer := &leaseRenewerMock{}
+	recordHandlerCreator := &recordHandlerCreatorMock{}
+	recordProcessorFactory := kinesis.NewRecordHandlerProcessorFactory(recordHandlerCreator).
+		WithLeaseRenewer(leaseRenewer, 5*time.Millisecond)
+	processor := kinesis.NewProcessor(&kclWorkerMock{}).WithRecordProcessorFactory(recordProcessorFactory)
+	checkpointer := recordProcessorCheckPointer{}
+	recordProcessor := recordProcessorFactory.CreateProcessor()
+	initializeRecordProcessor(recordProcessor, "")
+
+	err := processor.PauseShard("shardId-000000000001")
+	assert.NoError(t, err)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		recordProcessor.ProcessRecords(newProcessRecordsInput(&checkpointer, "1"))
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	assert.Empty(t, recordHandlerCreator.handler.records)
+	assert.True(t, recordProcessorFactory.FlowControl().IsPaused("shardId-000000000001"))
+	assert.False(t, recordProcessorFactory.FlowControl().IsPaused("shardId-000000000002"))
+	assert.NotZero(t, leaseRenewer.renewals("shardId-000000000001"))
+
+	err = processor.ResumeShard("shardId-000000000001")
+	assert.NoError(t, err)
+	waitOrFail(t, done)
+	assert.Len(t, recordHandlerCreator.handler.records, 1)
+	assert.Equal(t, []string{"1"}, checkpointer.checkpoints)
+}
+
+func TestGlobalPauseStopsAllShards(t *testing.T) {
+	recordHandlerCreator := &recordHandlerCreatorMock{}
+	recordProcessorFactory := kinesis.NewRecordHandlerProcessorFactory(recordHandlerCreator)
+	processor := kinesis.NewProcessor(&kclWorkerMock{}).WithRecordProcessorFactory(recordProcessorFactory)
+	checkpointer := recordProcessorCheckPointer{}
+	recordProcessor := recordProcessorFactory.CreateProcessor()
+	initializeRecordProcessor(recordProcessor, "")
+
+	assert.NoError(t, processor.Pause())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		recordProcessor.ProcessRecords(newProcessRecordsInput(&checkpointer, "1"))
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	assert.Empty(t, recordHandlerCreator.handler.records)
+
+	assert.NoError(t, processor.Resume())
+	waitOrFail(t, done)
+	assert.Len(t, recordHandlerCreator.handler.records, 1)
+}
+
+func TestHealthGatePausesWhileUnhealthy(t *testing.T) {
+	checks := 0
+	healthCheck := kinesis.HealthCheckFunc(func(ctx context.Context) error {
+		checks++
+		if checks < 3 {
+			return errors.New("database is degraded")
+		}
+		return nil
+	})
+	recordHandlerCreator := &recordHandlerCreatorMock{}
+	recordProcessorFactory := kinesis.NewRecordHandlerProcessorFactory(recordHandlerCreator).
+		WithHealthGate(healthCheck, time.Millisecond)
+	checkpointer := recordProcessorCheckPointer{}
+
+	recordProcessor := recordProcessorFactory.CreateProcessor()
+	recordProcessor.ProcessRecords(newProcessRecordsInput(&checkpointer, "1"))
+
+	assert.Equal(t, 3, checks)
+	assert.Len(t, recordHandlerCreator.handler.records, 1)
+}
+
+func TestPauseWithoutRecordProcessorFactory(t *testing.T) {
+	processor := kinesis.NewProcessor(&kclWorkerMock{})
+
+	err := processor.Pause()
+
+	assert.Equal(t, kinesis.ErrNoRecordProcessorFactory, err)
+}
+
+type leaseRenewerMock struct {
+	mu     sync.Mutex
+	shards map[string]int
+}
+
+func (l *leaseRenewerMock) RenewLease(shardID string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.shards == nil {
+		l.shards = make(map[string]int)
+	}
+	l.shards[shardID]++
+	return nil
+}
+
+func (l *leaseRenewerMock) renewals(shardID string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.shards[shardID]
+}
+
+func waitOrFail(t *testing.T, done <-chan struct{}) {
+	t.Helper()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for the record processor")
+	}
+}
@@ -0,0 +1,173 @@
+package kinesis
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/vmware/vmware-go-kcl/clientlibrary/config"
+)
+
+// MaxRecordsLimit is the maximum number of records kinesis returns in a GetRecords call.
+const MaxRecordsLimit = 10000
+
+// Validate checks the configuration can be used to run a kcl worker. Zero values are valid,
+// they mean the kcl default is used. All the problems found are reported in the error.
+func (k KCLConfiguration) Validate() error {
+	var problems []string
+	addProblem := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if k.ApplicationName == "" {
+		addProblem("application name is required")
+	}
+	if k.StreamName == "" {
+		addProblem("stream name is required")
+	}
+	if k.RegionName == "" {
+		addProblem("region name is required")
+	}
+
+	for _, field := range []struct {
+		name  string
+		value int
+	}{
+		{"FailoverTimeMillis", k.FailoverTimeMillis},
+		{"LeaseRefreshPeriodMillis", k.LeaseRefreshPeriodMillis},
+		{"MaxRecords", k.MaxRecords},
+		{"IdleTimeBetweenReadsInMillis", k.IdleTimeBetweenReadsInMillis},
+		{"ParentShardPollIntervalMillis", k.ParentShardPollIntervalMillis},
+		{"ShardSyncIntervalMillis", k.ShardSyncIntervalMillis},
+		{"TaskBackoffTimeMillis", k.TaskBackoffTimeMillis},
+		{"ShutdownGraceMillis", k.ShutdownGraceMillis},
+		{"MaxLeasesForWorker", k.MaxLeasesForWorker},
+		{"MaxLeasesToStealAtOneTime", k.MaxLeasesToStealAtOneTime},
+		{"InitialLeaseTableReadCapacity", k.InitialLeaseTableReadCapacity},
+		{"InitialLeaseTableWriteCapacity", k.InitialLeaseTableWriteCapacity},
+		{"LeaseStealingIntervalMillis", k.LeaseStealingIntervalMillis},
+		{"LeaseStealingClaimTimeoutMillis", k.LeaseStealingClaimTimeoutMillis},
+		{"LeaseSyncingTimeIntervalMillis", k.LeaseSyncingTimeIntervalMillis},
+	} {
+		if field.value < 0 {
+			addProblem("%s must not be negative, got %d", field.name, field.value)
+		}
+	}
+
+	if k.MaxRecords > MaxRecordsLimit {
+		addProblem("MaxRecords must not be greater than %d, got %d", MaxRecordsLimit, k.MaxRecords)
+	}
+	failoverTimeMillis := intOrDefault(k.FailoverTimeMillis, config.DefaultFailoverTimeMillis)
+	leaseRefreshPeriodMillis := intOrDefault(k.LeaseRefreshPeriodMillis, config.DefaultLeaseRefreshPeriodMillis)
+	if leaseRefreshPeriodMillis >= failoverTimeMillis {
+		addProblem("LeaseRefreshPeriodMillis (%d) must be lower than FailoverTimeMillis (%d), otherwise leases expire before they are refreshed", leaseRefreshPeriodMillis, failoverTimeMillis)
+	}
+	maxLeasesForWorker := intOrDefault(k.MaxLeasesForWorker, config.DefaultMaxLeasesForWorker)
+	maxLeasesToStealAtOneTime := intOrDefault(k.MaxLeasesToStealAtOneTime, config.DefaultMaxLeasesToStealAtOneTime)
+	if maxLeasesToStealAtOneTime > maxLeasesForWorker {
+		addProblem("MaxLeasesToStealAtOneTime (%d) must not be greater than MaxLeasesForWorker (%d)", maxLeasesToStealAtOneTime, maxLeasesForWorker)
+	}
+	if k.EnableLeaseStealing {
+		claimTimeoutMillis := intOrDefault(k.LeaseStealingClaimTimeoutMillis, config.DefaultLeaseStealingClaimTimeoutMillis)
+		if claimTimeoutMillis <= failoverTimeMillis {
+			addProblem("LeaseStealingClaimTimeoutMillis (%d) must be greater than FailoverTimeMillis (%d), otherwise claimed shards are taken back before the lease can be stolen", claimTimeoutMillis, failoverTimeMillis)
+		}
+	}
+
+	if k.EnhancedFanOutConsumerName != "" && k.EnhancedFanOutConsumerARN != "" {
+		addProblem("only one of EnhancedFanOutConsumerName and EnhancedFanOutConsumerARN can be set")
+	}
+
+	switch k.InitialPosition {
+	case "", InitialPositionLatest, InitialPositionTrimHorizon:
+		if k.InitialTimestamp != nil {
+			addProblem("InitialTimestamp can only be set with the %s initial position", InitialPositionAtTimestamp)
+		}
+	case InitialPositionAtTimestamp:
+		if k.InitialTimestamp == nil {
+			addProblem("InitialTimestamp is required with the %s initial position", InitialPositionAtTimestamp)
+		}
+	default:
+		addProblem("unknown initial position %q, use %s, %s or %s", k.InitialPosition, InitialPositionLatest, InitialPositionTrimHorizon, InitialPositionAtTimestamp)
+	}
+
+	if k.Replay != nil {
+		if k.Replay.From.IsZero() {
+			addProblem("replay start time is required")
+		}
+		if !k.Replay.To.IsZero() && !k.Replay.To.After(k.Replay.From) {
+			addProblem("replay end time must be after its start time")
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid kcl configuration: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// applyTuning sets the tuning fields of the configuration that are not zero or nil, so the rest keep
+// the kcl defaults. It must be called with a valid configuration, kcl panics on invalid values.
+func (k KCLConfiguration) applyTuning(kclLibConf *config.KinesisClientLibConfiguration) {
+	if k.FailoverTimeMillis > 0 {
+		kclLibConf.WithFailoverTimeMillis(k.FailoverTimeMillis)
+	}
+	if k.LeaseRefreshPeriodMillis > 0 {
+		kclLibConf.WithLeaseRefreshPeriodMillis(k.LeaseRefreshPeriodMillis)
+	}
+	if k.MaxRecords > 0 {
+		kclLibConf.WithMaxRecords(k.MaxRecords)
+	}
+	if k.IdleTimeBetweenReadsInMillis > 0 {
+		kclLibConf.WithIdleTimeBetweenReadsInMillis(k.IdleTimeBetweenReadsInMillis)
+	}
+	kclLibConf.WithCallProcessRecordsEvenForEmptyRecordList(k.CallProcessRecordsEvenForEmptyRecordList)
+	if k.ParentShardPollIntervalMillis > 0 {
+		kclLibConf.ParentShardPollIntervalMillis = k.ParentShardPollIntervalMillis
+	}
+	if k.ShardSyncIntervalMillis > 0 {
+		kclLibConf.WithShardSyncIntervalMillis(k.ShardSyncIntervalMillis)
+	}
+	if k.CleanupTerminatedShardsBeforeExpiry != nil {
+		kclLibConf.CleanupTerminatedShardsBeforeExpiry = *k.CleanupTerminatedShardsBeforeExpiry
+	}
+	if k.TaskBackoffTimeMillis > 0 {
+		kclLibConf.WithTaskBackoffTimeMillis(k.TaskBackoffTimeMillis)
+	}
+	if k.ValidateSequenceNumberBeforeCheckpointing != nil {
+		kclLibConf.ValidateSequenceNumberBeforeCheckpointing = *k.ValidateSequenceNumberBeforeCheckpointing
+	}
+	if k.ShutdownGraceMillis > 0 {
+		kclLibConf.ShutdownGraceMillis = k.ShutdownGraceMillis
+	}
+	if k.MaxLeasesForWorker > 0 {
+		kclLibConf.WithMaxLeasesForWorker(k.MaxLeasesForWorker)
+	}
+	if k.MaxLeasesToStealAtOneTime > 0 {
+		kclLibConf.MaxLeasesToStealAtOneTime = k.MaxLeasesToStealAtOneTime
+	}
+	if k.InitialLeaseTableReadCapacity > 0 {
+		kclLibConf.InitialLeaseTableReadCapacity = k.InitialLeaseTableReadCapacity
+	}
+	if k.InitialLeaseTableWriteCapacity > 0 {
+		kclLibConf.InitialLeaseTableWriteCapacity = k.InitialLeaseTableWriteCapacity
+	}
+	kclLibConf.SkipShardSyncAtWorkerInitializationIfLeasesExist = k.SkipShardSyncAtWorkerInitializationIfLeasesExist
+	kclLibConf.WithLeaseStealing(k.EnableLeaseStealing)
+	if k.LeaseStealingIntervalMillis > 0 {
+		kclLibConf.WithLeaseStealingIntervalMillis(k.LeaseStealingIntervalMillis)
+	}
+	if k.LeaseStealingClaimTimeoutMillis > 0 {
+		kclLibConf.LeaseStealingClaimTimeoutMillis = k.LeaseStealingClaimTimeoutMillis
+	}
+	if k.LeaseSyncingTimeIntervalMillis > 0 {
+		kclLibConf.WithLeaseSyncingIntervalMillis(k.LeaseSyncingTimeIntervalMillis)
+	}
+}
+
+// intOrDefault returns the value if it is set, otherwise the default value.
+func intOrDefault(value, defaultValue int) int {
+	if value > 0 {
+		return value
+	}
+	return defaultValue
+}
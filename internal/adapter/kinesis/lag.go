@@ -0,0 +1,134 @@
+package kinesis
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// lagMovingAverageWeight is the weight of the latest sample in the moving average of MillisBehindLatest.
+const lagMovingAverageWeight = 0.2
+
+// ShardLag is a snapshot of how far behind the tip of the stream a shard is.
+type ShardLag struct {
+	ShardID string
+	// MillisBehindLatest is the latest value reported by kinesis for the shard.
+	MillisBehindLatest int64
+	// AverageMillisBehindLatest is an exponential moving average of MillisBehindLatest.
+	AverageMillisBehindLatest float64
+	// LastRecordAge is the time between the arrival of the last processed record and its processing.
+	LastRecordAge time.Duration
+	// LastProcessedAt is when the last record of the shard was processed.
+	LastProcessedAt time.Time
+	// UpdatedAt is when the lag of the shard was last reported.
+	UpdatedAt time.Time
+}
+
+// LagThresholds defines the lag values that raise alerts, zero values are not checked.
+type LagThresholds struct {
+	MillisBehindLatest int64
+	LastRecordAge      time.Duration
+}
+
+// LagAlert is raised when a shard crosses a lag threshold, and again when it gets back under it.
+type LagAlert struct {
+	Lag ShardLag
+	// Exceeded is true when the shard went over a threshold and false when it recovered.
+	Exceeded bool
+}
+
+// LagTracker keeps the lag of every shard processed by the record processors of a factory.
+type LagTracker struct {
+	mu         sync.Mutex
+	shards     map[string]*ShardLag
+	exceeded   map[string]bool
+	thresholds LagThresholds
+	alert      func(alert LagAlert)
+}
+
+// newLagTracker creates a lag tracker without thresholds.
+func newLagTracker() *LagTracker {
+	newLagTracker := LagTracker{
+		shards:   make(map[string]*ShardLag),
+		exceeded: make(map[string]bool),
+	}
+	return &newLagTracker
+}
+
+// Snapshot returns the lag of every shard currently owned by this worker.
+func (l *LagTracker) Snapshot() map[string]ShardLag {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	snapshot := make(map[string]ShardLag, len(l.shards))
+	for k, v := range l.shards {
+		snapshot[k] = *v
+	}
+	return snapshot
+}
+
+// observe records the MillisBehindLatest reported for a batch of the shard.
+func (l *LagTracker) observe(shardID string, millisBehindLatest int64) {
+	l.mu.Lock()
+	lag := l.shard(shardID)
+	if lag.UpdatedAt.IsZero() {
+		lag.AverageMillisBehindLatest = float64(millisBehindLatest)
+	} else {
+		lag.AverageMillisBehindLatest += lagMovingAverageWeight * (float64(millisBehindLatest) - lag.AverageMillisBehindLatest)
+	}
+	lag.MillisBehindLatest = millisBehindLatest
+	lag.UpdatedAt = time.Now()
+	alert := l.checkThresholds(lag)
+	l.mu.Unlock()
+	l.raise(alert)
+}
+
+// processed records the last processed record of the shard.
+func (l *LagTracker) processed(record Record) {
+	l.mu.Lock()
+	lag := l.shard(record.ShardID)
+	lag.LastProcessedAt = time.Now()
+	if !record.ApproximateArrivalTimestamp.IsZero() {
+		lag.LastRecordAge = lag.LastProcessedAt.Sub(record.ApproximateArrivalTimestamp)
+	}
+	alert := l.checkThresholds(lag)
+	l.mu.Unlock()
+	l.raise(alert)
+}
+
+// remove stops tracking a shard once this worker does not own it anymore.
+func (l *LagTracker) remove(shardID string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.shards, shardID)
+	delete(l.exceeded, shardID)
+}
+
+// shard returns the lag of the shard, creating it if needed. It must be called holding the lock.
+func (l *LagTracker) shard(shardID string) *ShardLag {
+	lag, ok := l.shards[shardID]
+	if !ok {
+		lag = &ShardLag{ShardID: shardID}
+		l.shards[shardID] = lag
+	}
+	return lag
+}
+
+// checkThresholds returns an alert when the shard crosses the thresholds. It must be called holding the lock.
+func (l *LagTracker) checkThresholds(lag *ShardLag) *LagAlert {
+	exceeded := (l.thresholds.MillisBehindLatest > 0 && lag.MillisBehindLatest > l.thresholds.MillisBehindLatest) ||
+		(l.thresholds.LastRecordAge > 0 && lag.LastRecordAge > l.thresholds.LastRecordAge)
+	if exceeded == l.exceeded[lag.ShardID] {
+		return nil
+	}
+	l.exceeded[lag.ShardID] = exceeded
+	log.Println("level", "WARN", "msg", "shard lag threshold crossed", "shard", lag.ShardID, "exceeded", exceeded, "millisBehindLatest", lag.MillisBehindLatest, "lastRecordAge", lag.LastRecordAge)
+	return &LagAlert{Lag: *lag, Exceeded: exceeded}
+}
+
+// raise calls the alert function, outside of the lock so it can use the tracker.
+func (l *LagTracker) raise(alert *LagAlert) {
+	if alert == nil || l.alert == nil {
+		return
+	}
+	l.alert(*alert)
+}
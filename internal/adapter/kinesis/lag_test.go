@@ -0,0 +1,82 @@
+package kinesis_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/fernandoocampo/pubsub-kinesis/internal/adapter/kinesis"
+	"github.com/stretchr/testify/assert"
+	"github.com/vmware/vmware-go-kcl/clientlibrary/interfaces"
+)
+
+func TestLagIsTrackedPerShard(t *testing.T) {
+	recordProcessorFactory := kinesis.NewRecordHandlerProcessorFactory(&recordHandlerCreatorMock{})
+	processor := kinesis.NewProcessor(&kclWorkerMock{}).WithRecordProcessorFactory(recordProcessorFactory)
+	checkpointer := recordProcessorCheckPointer{}
+	recordProcessor := recordProcessorFactory.CreateProcessor()
+	initializeRecordProcessor(recordProcessor, "")
+
+	input := newProcessRecordsInput(&checkpointer, "1")
+	input.MillisBehindLatest = 1000
+	input.Records[0].ApproximateArrivalTimestamp = aws.Time(time.Now().Add(-time.Minute))
+	recordProcessor.ProcessRecords(input)
+	input = newProcessRecordsInput(&checkpointer)
+	input.MillisBehindLatest = 2000
+	recordProcessor.ProcessRecords(input)
+
+	lag, err := processor.Lag()
+	assert.NoError(t, err)
+	assert.Len(t, lag, 1)
+	shardLag := lag["shardId-000000000001"]
+	assert.Equal(t, int64(2000), shardLag.MillisBehindLatest)
+	assert.InDelta(t, 1200, shardLag.AverageMillisBehindLatest, 0.001)
+	assert.True(t, shardLag.LastRecordAge >= time.Minute)
+	assert.False(t, shardLag.LastProcessedAt.IsZero())
+
+	recordProcessor.Shutdown(&interfaces.ShutdownInput{ShutdownReason: interfaces.ZOMBIE, Checkpointer: &checkpointer})
+
+	lag, err = processor.Lag()
+	assert.NoError(t, err)
+	assert.Empty(t, lag)
+}
+
+func TestLagThresholdsRaiseAlerts(t *testing.T) {
+	var alerts []kinesis.LagAlert
+	recordProcessorFactory := kinesis.NewRecordHandlerProcessorFactory(&recordHandlerCreatorMock{}).
+		WithLagAlerts(kinesis.LagThresholds{MillisBehindLatest: 5000}, func(alert kinesis.LagAlert) {
+			alerts = append(alerts, alert)
+		})
+	checkpointer := recordProcessorCheckPointer{}
+	recordProcessor := recordProcessorFactory.CreateProcessor()
+	initializeRecordProcessor(recordProcessor, "")
+
+	for _, millisBehindLatest := range []int64{1000, 6000, 7000, 3000} {
+		input := newProcessRecordsInput(&checkpointer, "1")
+		input.MillisBehindLatest = millisBehindLatest
+		recordProcessor.ProcessRecords(input)
+	}
+
+	assert.Len(t, alerts, 2)
+	assert.True(t, alerts[0].Exceeded)
+	assert.Equal(t, int64(6000), alerts[0].Lag.MillisBehindLatest)
+	assert.False(t, alerts[1].Exceeded)
+	assert.Equal(t, int64(3000), alerts[1].Lag.MillisBehindLatest)
+}
+
+func TestStreamLagOfSingleStream(t *testing.T) {
+	recordProcessorFactory := kinesis.NewRecordHandlerProcessorFactory(&recordHandlerCreatorMock{})
+	processor := kinesis.NewProcessor(&kclWorkerMock{}).WithRecordProcessorFactory(recordProcessorFactory)
+	checkpointer := recordProcessorCheckPointer{}
+	recordProcessor := recordProcessorFactory.CreateProcessor()
+	initializeRecordProcessor(recordProcessor, "")
+	input := newProcessRecordsInput(&checkpointer, "1")
+	input.MillisBehindLatest = 1000
+	recordProcessor.ProcessRecords(input)
+
+	lag, err := processor.StreamLag()
+
+	assert.NoError(t, err)
+	assert.Len(t, lag, 1)
+	assert.Equal(t, int64(1000), lag[""]["shardId-000000000001"].MillisBehindLatest)
+}
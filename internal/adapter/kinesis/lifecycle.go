@@ -0,0 +1,219 @@
+package kinesis
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+)
+
+// DefaultGracePeriod is the default time a processor waits for in-flight handlers when it stops.
+const DefaultGracePeriod = 30 * time.Second
+
+// WorkerState is the state of the kcl worker run by a processor.
+type WorkerState int
+
+// Supported worker states.
+const (
+	// WorkerStopped the worker is not running.
+	WorkerStopped WorkerState = iota
+	// WorkerStarting the worker is being started.
+	WorkerStarting
+	// WorkerRunning the worker is processing records.
+	WorkerRunning
+	// WorkerDraining the worker is waiting for in-flight handlers to finish before stopping.
+	WorkerDraining
+)
+
+// String returns the name of the worker state.
+func (s WorkerState) String() string {
+	switch s {
+	case WorkerStopped:
+		return "stopped"
+	case WorkerStarting:
+		return "starting"
+	case WorkerRunning:
+		return "running"
+	case WorkerDraining:
+		return "draining"
+	default:
+		return "unknown"
+	}
+}
+
+// ErrProcessorRunning is returned when Run is called on a processor that is already running.
+var ErrProcessorRunning = errors.New("kinesis processor is already running")
+
+// ErrProcessorStopped is returned when Run is called on a processor that already ran. Its kcl workers
+// and record processor factories were shut down, so a new processor has to be created.
+var ErrProcessorStopped = errors.New("kinesis processor already ran and can't run again")
+
+// ErrNoLeaseDrainer is returned when leases are drained but the lease renewer of a record processor
+// factory can't drain them. Workers created by the kcl worker factory can.
+var ErrNoLeaseDrainer = errors.New("lease renewer of the record processor factory can't drain leases")
+
+// ErrGracePeriodExceeded is returned by Run when in-flight handlers didn't finish within the grace
+// period and had to be cancelled.
+var ErrGracePeriodExceeded = errors.New("in-flight handlers didn't finish within the grace period")
+
+// Run starts the kcl worker and blocks until the given context is cancelled or Stop is called.
+// A processor runs once, later calls return ErrProcessorStopped.
+// Then it drains the worker: it stops fetching records, waits for in-flight handlers to finish
+// and lets every shard write its final checkpoint. Handlers still running after the grace period
+// get their context cancelled and Run returns ErrGracePeriodExceeded once the worker stops.
+func (p *Processor) Run(ctx context.Context) error {
+	ctx, stop := context.WithCancel(ctx)
+	defer stop()
+	done := make(chan struct{})
+	defer close(done)
+
+	p.mu.Lock()
+	if p.state != WorkerStopped {
+		p.mu.Unlock()
+		return ErrProcessorRunning
+	}
+	if p.ran {
+		p.mu.Unlock()
+		return ErrProcessorStopped
+	}
+	p.ran = true
+	p.state = WorkerStarting
+	p.stopRun = stop
+	p.done = done
+	p.mu.Unlock()
+
+	p.reportState(WorkerStarting)
+	err := p.startWorkers()
+	if err != nil {
+		p.setState(WorkerStopped)
+		return err
+	}
+	p.setState(WorkerRunning)
+
+	<-ctx.Done()
+
+	p.setState(WorkerDraining)
+	err = p.drain()
+	p.setState(WorkerStopped)
+	return err
+}
+
+// Stop makes a running processor drain and stop, waiting until it is stopped or the given
+// context is done.
+func (p *Processor) Stop(ctx context.Context) error {
+	p.mu.Lock()
+	stop, done := p.stopRun, p.done
+	p.mu.Unlock()
+	if stop == nil {
+		return nil
+	}
+	stop()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// DrainLeases marks the worker as draining, e.g. before it is stopped by a rolling deploy. It stops
+// processing new batches and releases every lease once the batch of its shard is checkpointed, so
+// other workers take the shards right away instead of waiting for the leases to expire. It blocks
+// until the worker holds no lease or the given context is done, then the processor can be stopped.
+// Draining can't be undone, the worker doesn't take leases until it is recreated.
+func (p *Processor) DrainLeases(ctx context.Context) error {
+	factories, err := p.recordProcessorFactories()
+	if err != nil {
+		return err
+	}
+	drainers := make([]LeaseDrainer, 0, len(factories))
+	for _, factory := range factories {
+		drainer, ok := factory.flowControl.leaseRenewer.(LeaseDrainer)
+		if !ok {
+			return ErrNoLeaseDrainer
+		}
+		drainers = append(drainers, drainer)
+	}
+	drains := make([]<-chan struct{}, 0, len(drainers))
+	for i, factory := range factories {
+		factory.flowControl.stop()
+		drains = append(drains, drainers[i].DrainLeases())
+	}
+	for _, drained := range drains {
+		select {
+		case <-drained:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	log.Println("level", "INFO", "msg", "kinesis processor leases drained")
+	return nil
+}
+
+// State returns the current state of the worker run by the processor.
+func (p *Processor) State() WorkerState {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.state
+}
+
+// WithGracePeriod sets how long the processor waits for in-flight handlers when it stops.
+func (p *Processor) WithGracePeriod(gracePeriod time.Duration) *Processor {
+	p.gracePeriod = gracePeriod
+	return p
+}
+
+// WithStateListener sets a function that is called every time the worker changes its state.
+func (p *Processor) WithStateListener(listener func(state WorkerState)) *Processor {
+	p.stateListener = listener
+	return p
+}
+
+// setState changes the state of the worker and reports it.
+func (p *Processor) setState(state WorkerState) {
+	p.mu.Lock()
+	p.state = state
+	if state == WorkerStopped {
+		p.stopRun = nil
+	}
+	p.mu.Unlock()
+	p.reportState(state)
+}
+
+// reportState logs the state of the worker and tells the state listener.
+func (p *Processor) reportState(state WorkerState) {
+	log.Println("level", "INFO", "msg", "kinesis processor state changed", "state", state)
+	if p.stateListener != nil {
+		p.stateListener(state)
+	}
+}
+
+// drain shuts the kcl workers down, which waits for the shard consumers to finish their current
+// batch and call the processors shutdown, cancelling the handlers if the grace period expires.
+func (p *Processor) drain() error {
+	factories, _ := p.recordProcessorFactories()
+	for _, factory := range factories {
+		factory.flowControl.stop()
+	}
+
+	shutdown := make(chan struct{})
+	go func() {
+		defer close(shutdown)
+		p.shutdownWorkers()
+	}()
+
+	timer := time.NewTimer(p.gracePeriod)
+	defer timer.Stop()
+	select {
+	case <-shutdown:
+		return nil
+	case <-timer.C:
+	}
+
+	log.Println("level", "WARN", "msg", "grace period exceeded, cancelling in-flight handlers", "grace_period", p.gracePeriod)
+	for _, factory := range factories {
+		factory.cancelProcessors()
+	}
+	<-shutdown
+	return ErrGracePeriodExceeded
+}
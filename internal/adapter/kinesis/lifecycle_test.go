@@ -0,0 +1,255 @@
+package kinesis_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/fernandoocampo/pubsub-kinesis/internal/adapter/kinesis"
+	"github.com/stretchr/testify/assert"
+	"github.com/vmware/vmware-go-kcl/clientlibrary/interfaces"
+)
+
+func TestRunDrainsInFlightHandlersBeforeStopping(t *testing.T) {
+	recordHandlerCreator := &slowHandlerCreatorMock{delay: 50 * time.Millisecond}
+	recordProcessorFactory := kinesis.NewRecordHandlerProcessorFactory(recordHandlerCreator)
+	checkpointer := &recordProcessorCheckPointer{}
+	kclWorker := newRunningKCLWorkerMock(recordProcessorFactory, checkpointer)
+	states := newStateRecorder()
+	processor := kinesis.NewProcessor(kclWorker).
+		WithRecordProcessorFactory(recordProcessorFactory).
+		WithStateListener(states.record)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	errs := make(chan error)
+	go func() {
+		errs <- processor.Run(ctx)
+	}()
+	<-kclWorker.processing
+	cancel()
+	err := <-errs
+
+	assert.NoError(t, err)
+	assert.Equal(t, kinesis.WorkerStopped, processor.State())
+	assert.Equal(t, []kinesis.WorkerState{kinesis.WorkerStarting, kinesis.WorkerRunning, kinesis.WorkerDraining, kinesis.WorkerStopped}, states.all())
+	assert.Equal(t, 1, recordHandlerCreator.completed())
+	assert.Equal(t, []string{"1"}, checkpointer.checkpoints)
+}
+
+func TestRunCancelsHandlersAfterGracePeriod(t *testing.T) {
+	recordHandlerCreator := &slowHandlerCreatorMock{delay: time.Hour}
+	recordProcessorFactory := kinesis.NewRecordHandlerProcessorFactory(recordHandlerCreator).
+		WithQuarantinePolicy(kinesis.QuarantinePolicy{Action: kinesis.QuarantineHalt})
+	checkpointer := &recordProcessorCheckPointer{}
+	kclWorker := newRunningKCLWorkerMock(recordProcessorFactory, checkpointer)
+	processor := kinesis.NewProcessor(kclWorker).
+		WithRecordProcessorFactory(recordProcessorFactory).
+		WithGracePeriod(20 * time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	errs := make(chan error)
+	go func() {
+		errs <- processor.Run(ctx)
+	}()
+	<-kclWorker.processing
+	cancel()
+	err := <-errs
+
+	assert.Equal(t, kinesis.ErrGracePeriodExceeded, err)
+	assert.Equal(t, 0, recordHandlerCreator.completed())
+	assert.Empty(t, checkpointer.checkpoints)
+}
+
+func TestStopDrainsRunningProcessor(t *testing.T) {
+	recordProcessorFactory := kinesis.NewRecordHandlerProcessorFactory(&slowHandlerCreatorMock{})
+	kclWorker := newRunningKCLWorkerMock(recordProcessorFactory, &recordProcessorCheckPointer{})
+	processor := kinesis.NewProcessor(kclWorker).WithRecordProcessorFactory(recordProcessorFactory)
+
+	errs := make(chan error)
+	go func() {
+		errs <- processor.Run(context.Background())
+	}()
+	<-kclWorker.processing
+	err := processor.Stop(context.Background())
+
+	assert.NoError(t, err)
+	assert.NoError(t, <-errs)
+	assert.Equal(t, kinesis.WorkerStopped, processor.State())
+}
+
+func TestRunStartsOnce(t *testing.T) {
+	recordProcessorFactory := kinesis.NewRecordHandlerProcessorFactory(&slowHandlerCreatorMock{})
+	kclWorker := newRunningKCLWorkerMock(recordProcessorFactory, &recordProcessorCheckPointer{})
+	states := newStateRecorder()
+	processor := kinesis.NewProcessor(kclWorker).
+		WithRecordProcessorFactory(recordProcessorFactory).
+		WithStateListener(states.record)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	errs := make(chan error, 4)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- processor.Run(ctx)
+		}()
+	}
+	<-kclWorker.processing
+	cancel()
+	wg.Wait()
+	close(errs)
+
+	var running, succeeded int
+	for err := range errs {
+		switch err {
+		case nil:
+			succeeded++
+		case kinesis.ErrProcessorRunning, kinesis.ErrProcessorStopped:
+			running++
+		}
+	}
+	assert.Equal(t, 1, succeeded)
+	assert.Equal(t, 3, running)
+	assert.Equal(t, []kinesis.WorkerState{kinesis.WorkerStarting, kinesis.WorkerRunning, kinesis.WorkerDraining, kinesis.WorkerStopped}, states.all())
+	assert.Equal(t, kinesis.ErrProcessorStopped, processor.Run(context.Background()))
+}
+
+func TestRunFailsWhenWorkerCannotStart(t *testing.T) {
+	kclWorker := &failingKCLWorkerMock{}
+	processor := kinesis.NewProcessor(kclWorker)
+
+	err := processor.Run(context.Background())
+
+	assert.Error(t, err)
+	assert.Equal(t, kinesis.WorkerStopped, processor.State())
+}
+
+func TestShutdownCheckpointsEndOfShard(t *testing.T) {
+	recordProcessorFactory := kinesis.NewRecordHandlerProcessorFactory(&recordHandlerCreatorMock{})
+	checkpointer := recordProcessorCheckPointer{}
+
+	recordProcessor := recordProcessorFactory.CreateProcessor()
+	initializeRecordProcessor(recordProcessor, "")
+	recordProcessor.ProcessRecords(newProcessRecordsInput(&checkpointer, "1"))
+	recordProcessor.Shutdown(&interfaces.ShutdownInput{ShutdownReason: interfaces.TERMINATE, Checkpointer: &checkpointer})
+
+	assert.Equal(t, []string{"1", ""}, checkpointer.checkpoints)
+}
+
+func TestShutdownWritesFailedCheckpoint(t *testing.T) {
+	recordProcessorFactory := kinesis.NewRecordHandlerProcessorFactory(&recordHandlerCreatorMock{})
+	checkpointer := failingCheckpointerMock{failures: 1}
+
+	recordProcessor := recordProcessorFactory.CreateProcessor()
+	initializeRecordProcessor(recordProcessor, "")
+	recordProcessor.ProcessRecords(newProcessRecordsInput(&checkpointer, "1"))
+	recordProcessor.Shutdown(&interfaces.ShutdownInput{ShutdownReason: interfaces.REQUESTED, Checkpointer: &checkpointer})
+
+	assert.Equal(t, []string{"1"}, checkpointer.checkpoints)
+}
+
+// runningKCLWorkerMock delivers one batch from a shard consumer goroutine and, like kcl,
+// waits for it when it is shut down.
+type runningKCLWorkerMock struct {
+	recordProcessorFactory interfaces.IRecordProcessorFactory
+	checkpointer           *recordProcessorCheckPointer
+	processing             chan struct{}
+	wg                     sync.WaitGroup
+}
+
+func newRunningKCLWorkerMock(recordProcessorFactory interfaces.IRecordProcessorFactory, checkpointer *recordProcessorCheckPointer) *runningKCLWorkerMock {
+	return &runningKCLWorkerMock{
+		recordProcessorFactory: recordProcessorFactory,
+		checkpointer:           checkpointer,
+		processing:             make(chan struct{}),
+	}
+}
+
+func (k *runningKCLWorkerMock) Start() error {
+	processor := k.recordProcessorFactory.CreateProcessor()
+	initializeRecordProcessor(processor, "")
+	k.wg.Add(1)
+	go func() {
+		defer k.wg.Done()
+		close(k.processing)
+		processor.ProcessRecords(newProcessRecordsInput(k.checkpointer, "1"))
+		processor.Shutdown(&interfaces.ShutdownInput{ShutdownReason: interfaces.REQUESTED, Checkpointer: k.checkpointer})
+	}()
+	return nil
+}
+
+func (k *runningKCLWorkerMock) Shutdown() {
+	k.wg.Wait()
+}
+
+type failingKCLWorkerMock struct{}
+
+func (f *failingKCLWorkerMock) Start() error {
+	return errors.New("kinesis is not available")
+}
+
+func (f *failingKCLWorkerMock) Shutdown() {}
+
+type slowHandlerCreatorMock struct {
+	delay time.Duration
+	mu    sync.Mutex
+	count int
+}
+
+func (s *slowHandlerCreatorMock) Create() kinesis.RecordHandler {
+	return kinesis.RecordHandlerFunc(func(ctx context.Context, record kinesis.Record) error {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(s.delay):
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.count++
+		return nil
+	})
+}
+
+func (s *slowHandlerCreatorMock) completed() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.count
+}
+
+type failingCheckpointerMock struct {
+	recordProcessorCheckPointer
+	failures int
+}
+
+func (f *failingCheckpointerMock) Checkpoint(sequenceNumber *string) error {
+	if f.failures > 0 {
+		f.failures--
+		return errors.New("checkpoint failed")
+	}
+	return f.recordProcessorCheckPointer.Checkpoint(aws.String(aws.StringValue(sequenceNumber)))
+}
+
+type stateRecorder struct {
+	mu     sync.Mutex
+	states []kinesis.WorkerState
+}
+
+func newStateRecorder() *stateRecorder {
+	return &stateRecorder{}
+}
+
+func (s *stateRecorder) record(state kinesis.WorkerState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.states = append(s.states, state)
+}
+
+func (s *stateRecorder) all() []kinesis.WorkerState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]kinesis.WorkerState(nil), s.states...)
+}
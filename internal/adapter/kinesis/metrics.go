@@ -0,0 +1,21 @@
+package kinesis
+
+import "time"
+
+// Metric names recorded by this package.
+const (
+	MetricRecordsHandled        = "kinesis_records_handled"
+	MetricRecordsFailed         = "kinesis_records_failed"
+	MetricRecordHandlerDuration = "kinesis_record_handler_duration"
+	MetricFilterHits            = "kinesis_filter_hits"
+	MetricFilterMisses          = "kinesis_filter_misses"
+)
+
+// MetricsRecorder defines behavior to record metrics about record processing.
+// Implementations are expected to be safe for concurrent use.
+type MetricsRecorder interface {
+	// IncrementCounter adds one to the counter with the given name and tags.
+	IncrementCounter(name string, tags map[string]string)
+	// ObserveDuration records a duration sample for the given name and tags.
+	ObserveDuration(name string, duration time.Duration, tags map[string]string)
+}
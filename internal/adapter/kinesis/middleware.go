@@ -0,0 +1,205 @@
+package kinesis
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Middleware wraps a RecordHandler to add behavior before and after it handles a record.
+type Middleware func(next RecordHandler) RecordHandler
+
+// Chain composes the given middlewares into one. The first middleware is the outermost one,
+// so it is the first to see the record and the last to see the result.
+func Chain(middlewares ...Middleware) Middleware {
+	return func(next RecordHandler) RecordHandler {
+		for i := len(middlewares) - 1; i >= 0; i-- {
+			next = middlewares[i](next)
+		}
+		return next
+	}
+}
+
+// PanicError is returned when a handler panics while handling a record.
+type PanicError struct {
+	// Value is the value the handler panicked with.
+	Value interface{}
+	// Stack is the stack trace of the goroutine at the moment of the panic.
+	Stack []byte
+}
+
+// Error returns the description of the panic.
+func (p *PanicError) Error() string {
+	return fmt.Sprintf("handler panicked: %v", p.Value)
+}
+
+// Recovery returns a middleware that turns handler panics into *PanicError errors.
+func Recovery() Middleware {
+	return func(next RecordHandler) RecordHandler {
+		return RecordHandlerFunc(func(ctx context.Context, record Record) (err error) {
+			defer recoverPanic(&err)
+			return next.HandleRecord(ctx, record)
+		})
+	}
+}
+
+// Timeout returns a middleware that limits the time a handler can spend on a record.
+// The handler context is cancelled once the timeout expires and context.DeadlineExceeded
+// is returned even if the handler ignores the cancellation.
+//
+// A handler that ignores the cancellation keeps running, so the next record waits for it within
+// its own timeout and fails with context.DeadlineExceeded if it is still running. The handler is
+// never called while a timed out call is running, and the late result of that call is logged and
+// discarded, so at most one call outlives its timeout and handlers don't need to be safe for
+// concurrent use.
+func Timeout(timeout time.Duration) Middleware {
+	return func(next RecordHandler) RecordHandler {
+		// running holds a token while a call of the handler is running, timed out or not.
+		running := make(chan struct{}, 1)
+		return RecordHandlerFunc(func(ctx context.Context, record Record) error {
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			select {
+			case running <- struct{}{}:
+			case <-ctx.Done():
+				log.Println("level", "WARN", "msg", "record not handled, the handler of a previous record is still running after its timeout", "shard", record.ShardID, "sequence", record.SequenceNumber)
+				return ctx.Err()
+			}
+			start := time.Now()
+			result := make(chan error, 1)
+			go func() {
+				err := next.HandleRecord(ctx, record)
+				<-running
+				result <- err
+			}()
+
+			select {
+			case err := <-result:
+				return err
+			case <-ctx.Done():
+				go discardLateResult(record, start, result)
+				return ctx.Err()
+			}
+		})
+	}
+}
+
+// discardLateResult waits for a handler that outlived its timeout and logs its discarded result.
+func discardLateResult(record Record, start time.Time, result <-chan error) {
+	err := <-result
+	log.Println("level", "WARN", "msg", "handler returned after its timeout, its result is discarded", "shard", record.ShardID, "sequence", record.SequenceNumber, "duration", time.Since(start), "error", err)
+}
+
+// Logging returns a middleware that logs the outcome of every handled record.
+func Logging() Middleware {
+	return func(next RecordHandler) RecordHandler {
+		return RecordHandlerFunc(func(ctx context.Context, record Record) error {
+			start := time.Now()
+			err := next.HandleRecord(ctx, record)
+			if err != nil {
+				log.Println(
+					"level", "ERROR",
+					"msg", "record handling failed",
+					"shard", record.ShardID,
+					"sequence", record.SequenceNumber,
+					"subsequence", record.SubSequenceNumber,
+					"partitionKey", record.PartitionKey,
+					"duration", time.Since(start),
+					"error", err,
+				)
+				return err
+			}
+			log.Println(
+				"level", "DEBUG",
+				"msg", "record handled",
+				"shard", record.ShardID,
+				"sequence", record.SequenceNumber,
+				"subsequence", record.SubSequenceNumber,
+				"partitionKey", record.PartitionKey,
+				"duration", time.Since(start),
+			)
+			return nil
+		})
+	}
+}
+
+// Metrics returns a middleware that records how many records were handled or failed
+// and how long the handler took for each of them.
+func Metrics(recorder MetricsRecorder) Middleware {
+	return func(next RecordHandler) RecordHandler {
+		return RecordHandlerFunc(func(ctx context.Context, record Record) error {
+			tags := map[string]string{"shard": record.ShardID}
+			start := time.Now()
+			err := next.HandleRecord(ctx, record)
+			recorder.ObserveDuration(MetricRecordHandlerDuration, time.Since(start), tags)
+			if err != nil {
+				recorder.IncrementCounter(MetricRecordsFailed, tags)
+				return err
+			}
+			recorder.IncrementCounter(MetricRecordsHandled, tags)
+			return nil
+		})
+	}
+}
+
+// Span defines behavior of a tracing span started for a record.
+type Span interface {
+	// SetAttribute adds metadata to the span.
+	SetAttribute(key string, value interface{})
+	// End finishes the span, err is the result of the handler.
+	End(err error)
+}
+
+// Tracer defines behavior to start tracing spans, it allows to plug any tracing library.
+type Tracer interface {
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Tracing returns a middleware that wraps the handling of every record in a span.
+func Tracing(tracer Tracer) Middleware {
+	return func(next RecordHandler) RecordHandler {
+		return RecordHandlerFunc(func(ctx context.Context, record Record) error {
+			ctx, span := tracer.Start(ctx, "kinesis.HandleRecord")
+			span.SetAttribute("kinesis.shard_id", record.ShardID)
+			span.SetAttribute("kinesis.partition_key", record.PartitionKey)
+			span.SetAttribute("kinesis.sequence_number", record.SequenceNumber)
+			span.SetAttribute("kinesis.sub_sequence_number", record.SubSequenceNumber)
+			err := next.HandleRecord(ctx, record)
+			span.End(err)
+			return err
+		})
+	}
+}
+
+// Retry returns a middleware that retries failed records up to maxAttempts times in total,
+// waiting an exponential backoff that starts at the given backoff between attempts.
+func Retry(maxAttempts int, backoff time.Duration) Middleware {
+	return func(next RecordHandler) RecordHandler {
+		return RecordHandlerFunc(func(ctx context.Context, record Record) error {
+			var err error
+			wait := backoff
+			for attempt := 1; ; attempt++ {
+				err = next.HandleRecord(ctx, record)
+				if err == nil || attempt >= maxAttempts {
+					return err
+				}
+				log.Println(
+					"level", "WARN",
+					"msg", "retrying record",
+					"shard", record.ShardID,
+					"sequence", record.SequenceNumber,
+					"attempt", attempt,
+					"error", err,
+				)
+				select {
+				case <-ctx.Done():
+					return err
+				case <-time.After(wait):
+				}
+				wait *= 2
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package kinesis_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fernandoocampo/pubsub-kinesis/internal/adapter/kinesis"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChainAppliesMiddlewaresInOrder(t *testing.T) {
+	calls := make([]string, 0)
+	tracking := func(name string) kinesis.Middleware {
+		return func(next kinesis.RecordHandler) kinesis.RecordHandler {
+			return kinesis.RecordHandlerFunc(func(ctx context.Context, record kinesis.Record) error {
+				calls = append(calls, name)
+				return next.HandleRecord(ctx, record)
+			})
+		}
+	}
+	handler := kinesis.RecordHandlerFunc(func(ctx context.Context, record kinesis.Record) error {
+		calls = append(calls, "handler")
+		return nil
+	})
+
+	err := kinesis.Chain(tracking("first"), tracking("second"))(handler).HandleRecord(context.TODO(), kinesis.Record{})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"first", "second", "handler"}, calls)
+}
+
+func TestRecoveryTurnsPanicIntoError(t *testing.T) {
+	handler := kinesis.RecordHandlerFunc(func(ctx context.Context, record kinesis.Record) error {
+		panic("boom")
+	})
+
+	err := kinesis.Recovery()(handler).HandleRecord(context.TODO(), kinesis.Record{})
+
+	var panicErr *kinesis.PanicError
+	assert.True(t, errors.As(err, &panicErr))
+	assert.Equal(t, "boom", panicErr.Value)
+	assert.NotEmpty(t, panicErr.Stack)
+}
+
+func TestTimeoutCancelsSlowHandler(t *testing.T) {
+	handler := kinesis.RecordHandlerFunc(func(ctx context.Context, record kinesis.Record) error {
+		time.Sleep(time.Second)
+		return nil
+	})
+
+	err := kinesis.Timeout(10*time.Millisecond)(handler).HandleRecord(context.TODO(), kinesis.Record{})
+
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestTimeoutDoesNotOverlapTimedOutHandler(t *testing.T) {
+	var running, overlaps int32
+	release := make(chan struct{})
+	handler := kinesis.RecordHandlerFunc(func(ctx context.Context, record kinesis.Record) error {
+		if atomic.AddInt32(&running, 1) > 1 {
+			atomic.AddInt32(&overlaps, 1)
+		}
+		defer atomic.AddInt32(&running, -1)
+		if record.SequenceNumber == "1" {
+			<-release
+		}
+		return nil
+	})
+	timeoutHandler := kinesis.Timeout(10 * time.Millisecond)(handler)
+
+	err := timeoutHandler.HandleRecord(context.TODO(), kinesis.Record{SequenceNumber: "1"})
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	err = timeoutHandler.HandleRecord(context.TODO(), kinesis.Record{SequenceNumber: "2"})
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	close(release)
+	assert.Eventually(t, func() bool {
+		return timeoutHandler.HandleRecord(context.TODO(), kinesis.Record{SequenceNumber: "3"}) == nil
+	}, time.Second, time.Millisecond)
+	assert.Zero(t, atomic.LoadInt32(&overlaps))
+}
+
+func TestRetryUntilHandlerSucceeds(t *testing.T) {
+	attempts := 0
+	handler := kinesis.RecordHandlerFunc(func(ctx context.Context, record kinesis.Record) error {
+		attempts++
+		if attempts < 3 {
+			return errors.New("temporary error")
+		}
+		return nil
+	})
+
+	err := kinesis.Retry(5, time.Millisecond)(handler).HandleRecord(context.TODO(), kinesis.Record{})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 3, attempts)
+}
+
+func TestRetryGivesUpAfterMaxAttempts(t *testing.T) {
+	attempts := 0
+	handler := kinesis.RecordHandlerFunc(func(ctx context.Context, record kinesis.Record) error {
+		attempts++
+		return errors.New("permanent error")
+	})
+
+	err := kinesis.Retry(2, time.Millisecond)(handler).HandleRecord(context.TODO(), kinesis.Record{})
+
+	assert.Error(t, err)
+	assert.Equal(t, 2, attempts)
+}
+
+func TestMetricsCountsHandledAndFailedRecords(t *testing.T) {
+	recorder := newMetricsRecorderMock()
+	handler := kinesis.RecordHandlerFunc(func(ctx context.Context, record kinesis.Record) error {
+		if record.SequenceNumber == "2" {
+			return errors.New("invalid record")
+		}
+		return nil
+	})
+	recordHandler := kinesis.Metrics(recorder)(handler)
+
+	_ = recordHandler.HandleRecord(context.TODO(), kinesis.Record{SequenceNumber: "1"})
+	_ = recordHandler.HandleRecord(context.TODO(), kinesis.Record{SequenceNumber: "2"})
+
+	assert.Equal(t, 1, recorder.counters[kinesis.MetricRecordsHandled])
+	assert.Equal(t, 1, recorder.counters[kinesis.MetricRecordsFailed])
+	assert.Equal(t, 2, recorder.durations[kinesis.MetricRecordHandlerDuration])
+}
+
+func TestMiddlewaresAreAppliedByFactory(t *testing.T) {
+	recorder := newMetricsRecorderMock()
+	customHandlerCreator := &handlerCreatorMock{}
+	recordProcessorFactory := kinesis.NewRecordProcessorFactory(customHandlerCreator).
+		WithMiddlewares(kinesis.Recovery(), kinesis.Metrics(recorder))
+	checkpointer := recordProcessorCheckPointer{}
+
+	recordProcessor := recordProcessorFactory.CreateProcessor()
+	recordProcessor.ProcessRecords(newProcessRecordsInput(&checkpointer, "1", "2"))
+
+	assert.Len(t, customHandlerCreator.handler.events, 2)
+	assert.Equal(t, 2, recorder.counters[kinesis.MetricRecordsHandled])
+}
+
+type metricsRecorderMock struct {
+	mu        sync.Mutex
+	counters  map[string]int
+	durations map[string]int
+}
+
+func newMetricsRecorderMock() *metricsRecorderMock {
+	return &metricsRecorderMock{
+		counters:  make(map[string]int),
+		durations: make(map[string]int),
+	}
+}
+
+func (m *metricsRecorderMock) IncrementCounter(name string, tags map[string]string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.counters[name]++
+}
+
+func (m *metricsRecorderMock) ObserveDuration(name string, duration time.Duration, tags map[string]string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.durations[name]++
+}
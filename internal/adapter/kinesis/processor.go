@@ -3,7 +3,11 @@ package kinesis
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log"
+	"math"
+	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
@@ -13,7 +17,8 @@ import (
 // Consumer defines behavior for kinesis consumers
 type Consumer interface{}
 
-// KCLConfiguration contains data required for the Kinesis Client Library
+// KCLConfiguration contains data required for the Kinesis Client Library.
+// Zero values of the tuning fields mean the kcl defaults are used.
 type KCLConfiguration struct {
 	KinesisCredentials  *credentials.Credentials
 	DynamoDBCredentials *credentials.Credentials
@@ -22,6 +27,27 @@ type KCLConfiguration struct {
 	StreamName          string
 	RegionName          string
 	WorkerID            string
+	// KinesisEndpoint overrides the kinesis endpoint, e.g. to use a local emulator.
+	KinesisEndpoint string
+	// DynamoDBEndpoint overrides the dynamodb endpoint used for the lease table.
+	DynamoDBEndpoint string
+	// EnhancedFanOut makes the worker receive records through a dedicated enhanced fan-out
+	// consumer instead of polling the shards, so it doesn't share their read throughput.
+	EnhancedFanOut bool
+	// EnhancedFanOutConsumerName is the name of the stream consumer to register, by default the application name.
+	// Setting it enables enhanced fan-out.
+	EnhancedFanOutConsumerName string
+	// EnhancedFanOutConsumerARN is the ARN of an already registered stream consumer, no consumer is registered when it is set.
+	// Setting it enables enhanced fan-out.
+	EnhancedFanOutConsumerARN string
+	// InitialPosition is where the worker starts reading shards without checkpoint:
+	// LATEST (default), TRIM_HORIZON or AT_TIMESTAMP.
+	InitialPosition InitialPosition
+	// InitialTimestamp is the arrival time to start reading from when InitialPosition is AT_TIMESTAMP.
+	InitialTimestamp *time.Time
+	// Replay reprocesses a time range under a temporary application name and lease table.
+	// When it is set, the initial position is the start of the replay.
+	Replay *ReplayConfiguration
 	// failoverTimeMillis leases not renewed within this period will be claimed by others
 	FailoverTimeMillis int
 	// leaseRefreshPeriodMillis is the period before the end of lease during which a lease is refreshed by the owner.
@@ -45,11 +71,13 @@ type KCLConfiguration struct {
 	// cleanupTerminatedShardsBeforeExpiry Clean up shards we've finished processing (don't wait until they expire in Kinesis).
 	// Keeping leases takes some tracking/resources (e.g. they need to be renewed, assigned), so by
 	// default we try to delete the ones we don't need any longer.
-	CleanupTerminatedShardsBeforeExpiry bool
+	// It is true when it is not set.
+	CleanupTerminatedShardsBeforeExpiry *bool
 	// TaskBackoffTimeMillis Backoff period when tasks encounter an exception
 	TaskBackoffTimeMillis int
 	// ValidateSequenceNumberBeforeCheckpointing whether KCL should validate client provided sequence numbers
-	ValidateSequenceNumberBeforeCheckpointing bool
+	// It is true when it is not set.
+	ValidateSequenceNumberBeforeCheckpointing *bool
 	// ShutdownGraceMillis The number of milliseconds before graceful shutdown terminates forcefully
 	ShutdownGraceMillis int
 	// Max leases this Worker can handle at a time
@@ -94,6 +122,9 @@ type KCLConfiguration struct {
 	LeaseSyncingTimeIntervalMillis int
 }
 
+// DefaultMaxBatchRetries is the default number of times the failed records of a batch are retried.
+const DefaultMaxBatchRetries = 3
+
 // Handler defines behavior to process the message that was sent within the event.
 type Handler interface {
 	Handle(data []byte)
@@ -101,46 +132,232 @@ type Handler interface {
 
 // RecordProcessor defines a record processor for records provided by kinesis.
 type RecordProcessor struct {
-	handler Handler
+	shardID          string
+	handler          RecordHandler
+	batchHandler     BatchHandler
+	maxBatchRetries  int
+	quarantinePolicy QuarantinePolicy
+	positionStore    PositionStore
+	position         *Position
+	flowControl      *FlowControl
+	lagTracker       *LagTracker
+	replayUntil      time.Time
+	replayTable      string
+	replayFinished   bool
+	settings         *liveSettings
+	batchSize        int
+	filter           RecordFilter
+	metricsRecorder  MetricsRecorder
+	uncheckpointed   string
+	halted           bool
+	ctx              context.Context
+	cancel           context.CancelFunc
 }
 
 // Initialize Invoked by the Amazon Kinesis Client Library before data records are delivered to the RecordProcessor instance
 func (r *RecordProcessor) Initialize(input *interfaces.InitializationInput) {
+	r.shardID = input.ShardId
 	log.Println(
 		"level", "DEBUG",
 		"msg", "initializing record processor",
 		"shard", input.ShardId,
 		"checkpoint", aws.StringValue(input.ExtendedSequenceNumber.SequenceNumber),
 	)
+	r.loadPosition(aws.StringValue(input.ExtendedSequenceNumber.SequenceNumber))
 }
 
 // ProcessRecords Process data records. The Amazon Kinesis Client Library will invoke this method to deliver data records to the
 func (r *RecordProcessor) ProcessRecords(input *interfaces.ProcessRecordsInput) {
+	r.lagTracker.observe(r.shardID, input.MillisBehindLatest)
+
 	// don't process empty record
 	if len(input.Records) == 0 {
 		return
 	}
 
-	for _, v := range input.Records {
-		r.handler.Handle(v.Data)
+	if r.halted {
+		log.Println("level", "WARN", "msg", "shard is halted, records are not processed", "shard", r.shardID, "records", len(input.Records))
+		return
+	}
+
+	// a draining worker releases the lease after this batch, so its progress must be checkpointed.
+	defer r.checkpointBeforeRelease(input.Checkpointer)
+
+	if !r.flowControl.wait(r.ctx, r.shardID) {
+		log.Println("level", "WARN", "msg", "record processor stopped while waiting to process records", "shard", r.shardID)
+		return
+	}
+	r.refreshSettings()
+
+	records := r.skipAfterReplayWindow(r.skipProcessed(newRecords(r.shardID, input)))
+	if len(records) == 0 {
+		return
+	}
+	if r.batchHandler != nil {
+		r.processBatch(input, records)
+		return
+	}
+
+	for i, v := range records {
+		if !r.matches(v) {
+			continue
+		}
+		if err := r.settings.rateLimiter.Wait(r.ctx, 1); err != nil {
+			log.Println("level", "WARN", "msg", "record processor stopped while waiting for the rate limit", "shard", r.shardID)
+			r.checkpoint(input, records, i)
+			return
+		}
+		if !r.handleRecord(v) {
+			r.checkpoint(input, records, i)
+			return
+		}
 	}
 
 	// checkpoint it after processing this batch.
-	// Especially, for processing de-aggregated KPL records, checkpointing has to happen at the end of batch
-	// because de-aggregated records share the same sequence number.
-	lastRecordSequenceNumber := input.Records[len(input.Records)-1].SequenceNumber
-	diff := input.CacheExitTime.Sub(*input.CacheEntryTime)
-	log.Println("level", "debug", "checkpoint progress at", lastRecordSequenceNumber, "millisBehindLatest", input.MillisBehindLatest, "kclProcessTime", diff)
-	err := input.Checkpointer.Checkpoint(lastRecordSequenceNumber)
-	if err != nil {
-		// TODO check if we need to retry this
-		log.Println("level", "error", "msg", "error checkpointing progress", "error", err)
+	r.checkpoint(input, records, len(records))
+}
+
+// handleRecord delivers a record to the handler, retrying it according to the quarantine policy.
+// It returns false when the processing of the shard must stop.
+func (r *RecordProcessor) handleRecord(record Record) bool {
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = r.safeHandleRecord(record)
+		if err == nil {
+			return true
+		}
+		log.Println(
+			"level", "ERROR",
+			"msg", "record could not be handled",
+			"shard", record.ShardID,
+			"sequence", record.SequenceNumber,
+			"subsequence", record.SubSequenceNumber,
+			"attempt", attempt,
+			"error", err,
+		)
+		if attempt >= r.quarantinePolicy.maxAttempts() {
+			break
+		}
+		select {
+		case <-r.ctx.Done():
+			return false
+		case <-time.After(retryBackoff(attempt - 1)):
+		}
+	}
+	if !r.quarantinePolicy.enabled() {
+		return r.halt(record, err)
 	}
+	return r.quarantine(record, err)
+}
+
+// safeHandleRecord calls the handler turning panics into errors, so they don't take down the shard consumer.
+func (r *RecordProcessor) safeHandleRecord(record Record) (err error) {
+	defer recoverPanic(&err)
+	return r.handler.HandleRecord(r.ctx, record)
+}
+
+// safeHandleBatch calls the batch handler turning panics into errors, so they don't take down the shard consumer.
+func (r *RecordProcessor) safeHandleBatch(records []Record) (err error) {
+	defer recoverPanic(&err)
+	return r.batchHandler.HandleBatch(r.ctx, records)
+}
+
+// processBatch delivers the batch to the batch handler, split in batches of the configured size.
+// When the handler reports a partial failure, the progress is checkpointed up to the first failed
+// record and the rest is retried.
+// A record that keeps failing after all the retries is quarantined, or the shard is halted when
+// the policy has no action. Records that don't match
+// the filter are not delivered but they are checkpointed along with the records around them.
+func (r *RecordProcessor) processBatch(input *interfaces.ProcessRecordsInput, all []Record) {
+	records, indexes := r.selectRecords(all)
+	checkpoint := func(processed int) {
+		if processed == len(records) {
+			r.checkpoint(input, all, len(all))
+			return
+		}
+		r.checkpoint(input, all, indexes[processed])
+	}
+	if len(records) == 0 {
+		checkpoint(0)
+		return
+	}
+
+	processed := 0
+	for attempt := 0; processed < len(records); attempt++ {
+		pending := records[processed:r.batchEnd(processed, len(records))]
+		if err := r.settings.rateLimiter.Wait(r.ctx, len(pending)); err != nil {
+			log.Println("level", "WARN", "msg", "record processor stopped while waiting for the rate limit", "shard", r.shardID)
+			return
+		}
+		err := r.safeHandleBatch(pending)
+		failed := len(pending)
+		if err != nil {
+			failed = failedIndex(err, len(pending))
+		}
+		if failed == len(pending) {
+			processed += failed
+			checkpoint(processed)
+			attempt = -1
+			continue
+		}
+		if failed > 0 {
+			processed += failed
+			checkpoint(processed)
+		}
+
+		if attempt >= r.maxBatchRetries {
+			log.Println(
+				"level", "ERROR",
+				"msg", "giving up processing batch",
+				"pending", len(records)-processed,
+				"attempts", attempt+1,
+				"error", err,
+			)
+			if !r.quarantinePolicy.enabled() {
+				r.halt(records[processed], err)
+				return
+			}
+			if !r.quarantine(records[processed], err) {
+				return
+			}
+			processed++
+			checkpoint(processed)
+			// the records after the quarantined one get their own retries.
+			attempt = -1
+			continue
+		}
+
+		log.Println("level", "WARN", "msg", "retrying failed records of batch", "pending", len(records)-processed, "attempt", attempt+1, "error", err)
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-time.After(retryBackoff(attempt)):
+		}
+	}
+}
+
+// retryBackoff returns how long to wait before retrying a batch or a record using exponential backoff.
+func retryBackoff(attempt int) time.Duration {
+	return time.Duration(math.Exp2(float64(attempt))*100) * time.Millisecond
 }
 
 // Shutdown Invoked by the Amazon Kinesis Client Library to indicate it will no longer send data records to this
 // RecordProcessor instance.
-func (r *RecordProcessor) Shutdown(shutdownInput *interfaces.ShutdownInput) {}
+// When the shard ends, it checkpoints the end of the shard so its children can be processed.
+func (r *RecordProcessor) Shutdown(shutdownInput *interfaces.ShutdownInput) {
+	defer r.cancel()
+	r.lagTracker.remove(r.shardID)
+	log.Println("level", "INFO", "msg", "shutting down record processor", "shard", r.shardID, "reason", aws.StringValue(interfaces.ShutdownReasonMessage(shutdownInput.ShutdownReason)))
+
+	if !r.writeUncheckpointed(shutdownInput.Checkpointer) {
+		return
+	}
+	if shutdownInput.ShutdownReason == interfaces.TERMINATE && !r.halted && r.ctx.Err() == nil {
+		if err := shutdownInput.Checkpointer.Checkpoint(nil); err != nil {
+			log.Println("level", "ERROR", "msg", "end of shard could not be checkpointed", "shard", r.shardID, "error", err)
+		}
+	}
+}
 
 // HandlerCreator defines behavior to create instances of Handler
 type HandlerCreator interface {
@@ -149,30 +366,214 @@ type HandlerCreator interface {
 
 // RecordProcessorFactory defines a factor to create record processors.
 type RecordProcessorFactory struct {
-	handlerCreator HandlerCreator
+	handlerCreator       HandlerCreator
+	recordHandlerCreator RecordHandlerCreator
+	batchHandlerCreator  BatchHandlerCreator
+	middlewares          []Middleware
+	maxBatchRetries      int
+	quarantinePolicy     QuarantinePolicy
+	positionStore        PositionStore
+	flowControl          *FlowControl
+	lagTracker           *LagTracker
+	replayUntil          time.Time
+	replayTable          string
+	ctx                  context.Context
+	cancel               context.CancelFunc
+	settings             *liveSettings
+	metricsRecorder      MetricsRecorder
 }
 
 // NewRecordProcessorFactory creates a new record processor factory
 func NewRecordProcessorFactory(handlerCreator HandlerCreator) *RecordProcessorFactory {
 	log.Println("level", "INFO", "msg", "creating kinesis record processor factory")
+	newRecordProcessorFactory := newDefaultRecordProcessorFactory()
+	newRecordProcessorFactory.handlerCreator = handlerCreator
+	return newRecordProcessorFactory
+}
+
+// NewRecordHandlerProcessorFactory creates a new record processor factory whose processors
+// deliver every record along with its metadata to record handlers.
+func NewRecordHandlerProcessorFactory(recordHandlerCreator RecordHandlerCreator) *RecordProcessorFactory {
+	log.Println("level", "INFO", "msg", "creating kinesis record handler processor factory")
+	newRecordProcessorFactory := newDefaultRecordProcessorFactory()
+	newRecordProcessorFactory.recordHandlerCreator = recordHandlerCreator
+	return newRecordProcessorFactory
+}
+
+// NewBatchRecordProcessorFactory creates a new record processor factory whose processors
+// deliver whole batches to batch handlers.
+func NewBatchRecordProcessorFactory(batchHandlerCreator BatchHandlerCreator) *RecordProcessorFactory {
+	log.Println("level", "INFO", "msg", "creating kinesis batch record processor factory")
+	newRecordProcessorFactory := newDefaultRecordProcessorFactory()
+	newRecordProcessorFactory.batchHandlerCreator = batchHandlerCreator
+	return newRecordProcessorFactory
+}
+
+// newDefaultRecordProcessorFactory creates a record processor factory with default settings and no handlers.
+func newDefaultRecordProcessorFactory() *RecordProcessorFactory {
+	ctx, cancel := context.WithCancel(context.Background())
 	newRecordProcessorFactory := RecordProcessorFactory{
-		handlerCreator: handlerCreator,
+		ctx:              ctx,
+		cancel:           cancel,
+		maxBatchRetries:  DefaultMaxBatchRetries,
+		quarantinePolicy: DefaultQuarantinePolicy(),
+		positionStore:    NewMemoryPositionStore(),
+		flowControl:      newFlowControl(),
+		lagTracker:       newLagTracker(),
+		settings:         newLiveSettings(),
 	}
 	return &newRecordProcessorFactory
 }
 
+// cancelProcessors cancels the context of the handlers of every processor created by the factory.
+func (r *RecordProcessorFactory) cancelProcessors() {
+	r.cancel()
+}
+
+// WithMaxBatchRetries sets how many times the failed records of a batch are retried before giving up.
+func (r *RecordProcessorFactory) WithMaxBatchRetries(maxBatchRetries int) *RecordProcessorFactory {
+	r.maxBatchRetries = maxBatchRetries
+	return r
+}
+
+// WithQuarantinePolicy sets how record processors deal with records that keep failing.
+func (r *RecordProcessorFactory) WithQuarantinePolicy(policy QuarantinePolicy) *RecordProcessorFactory {
+	r.quarantinePolicy = policy
+	return r
+}
+
+// WithPositionStore sets where processors keep their position within KPL aggregated records.
+// Positions are kept in memory by default, so they are lost when the worker restarts or the lease
+// moves to another worker, and the user records of the aggregated record that were already processed
+// are processed again. Use a shared, durable store to avoid it.
+func (r *RecordProcessorFactory) WithPositionStore(positionStore PositionStore) *RecordProcessorFactory {
+	r.positionStore = positionStore
+	return r
+}
+
+// WithHealthGate sets a health check that processors run before each batch. While it fails
+// the processors are paused, and it is checked again after the given interval.
+func (r *RecordProcessorFactory) WithHealthGate(healthCheck HealthCheck, interval time.Duration) *RecordProcessorFactory {
+	r.flowControl.healthCheck = healthCheck
+	if interval > 0 {
+		r.flowControl.healthCheckInterval = interval
+	}
+	return r
+}
+
+// WithLeaseRenewer sets how paused processors keep the leases of their shards. The kcl worker factory
+// sets it when it creates the worker, so it is only needed for custom workers.
+func (r *RecordProcessorFactory) WithLeaseRenewer(leaseRenewer LeaseRenewer, interval time.Duration) *RecordProcessorFactory {
+	r.flowControl.leaseRenewer = leaseRenewer
+	if interval > 0 {
+		r.flowControl.leaseRenewInterval = interval
+	}
+	return r
+}
+
+// WithLagAlerts sets the lag thresholds of the shards and the function that is called when
+// a shard crosses them.
+func (r *RecordProcessorFactory) WithLagAlerts(thresholds LagThresholds, alert func(alert LagAlert)) *RecordProcessorFactory {
+	r.lagTracker.thresholds = thresholds
+	r.lagTracker.alert = alert
+	return r
+}
+
+// WithReplayWindow makes processors skip the records that arrived after the given time.
+// The kcl worker factory sets it when it runs a replay.
+func (r *RecordProcessorFactory) WithReplayWindow(until time.Time) *RecordProcessorFactory {
+	r.replayUntil = until
+	return r
+}
+
+// WithFilters sets the filters a record must match to reach the handler. Records that don't
+// match all the filters are skipped, but they are still checkpointed. They are kept when the
+// settings are updated, whose filters apply on top of them.
+func (r *RecordProcessorFactory) WithFilters(filters ...RecordFilter) *RecordProcessorFactory {
+	r.settings.setFixedFilters(filters)
+	return r
+}
+
+// WithMetricsRecorder sets where processors record their own metrics, like filter hits and misses.
+func (r *RecordProcessorFactory) WithMetricsRecorder(recorder MetricsRecorder) *RecordProcessorFactory {
+	r.metricsRecorder = recorder
+	return r
+}
+
+// LagTracker returns the lag tracker shared by the processors of this factory.
+func (r *RecordProcessorFactory) LagTracker() *LagTracker {
+	return r.lagTracker
+}
+
+// FlowControl returns the flow control shared by the processors of this factory.
+func (r *RecordProcessorFactory) FlowControl() *FlowControl {
+	return r.flowControl
+}
+
+// WithMiddlewares appends middlewares that wrap the handler of every record processor created by
+// this factory. They are applied in the given order, the first one is the outermost.
+// Middlewares apply to Handler and RecordHandler but not to BatchHandler.
+func (r *RecordProcessorFactory) WithMiddlewares(middlewares ...Middleware) *RecordProcessorFactory {
+	r.middlewares = append(r.middlewares, middlewares...)
+	return r
+}
+
 // CreateProcessor Returns a record processor to be used for processing data records for a (assigned) shard.
 func (r *RecordProcessorFactory) CreateProcessor() interfaces.IRecordProcessor {
 	log.Println("level", "INFO", "method", "RecordProcessorFactory.CreateProcessor", "msg", "creating kinesis record processor")
+	ctx, cancel := context.WithCancel(r.ctx)
 	newRecordProcessor := RecordProcessor{
-		handler: r.handlerCreator.Create(),
+		maxBatchRetries:  r.maxBatchRetries,
+		quarantinePolicy: r.quarantinePolicy,
+		positionStore:    r.positionStore,
+		flowControl:      r.flowControl,
+		lagTracker:       r.lagTracker,
+		replayUntil:      r.replayUntil,
+		replayTable:      r.replayTable,
+		settings:         r.settings,
+		metricsRecorder:  r.metricsRecorder,
+		ctx:              ctx,
+		cancel:           cancel,
+	}
+	switch {
+	case r.batchHandlerCreator != nil:
+		newRecordProcessor.batchHandler = r.batchHandlerCreator.Create()
+	case r.recordHandlerCreator != nil:
+		newRecordProcessor.handler = r.recordHandlerCreator.Create()
+	default:
+		handler := r.handlerCreator.Create()
+		// handlers that are also record handlers, like the router ones, receive the whole record.
+		if recordHandler, ok := handler.(RecordHandler); ok {
+			newRecordProcessor.handler = recordHandler
+		} else {
+			newRecordProcessor.handler = &handlerAdapter{handler: handler}
+		}
+	}
+	if newRecordProcessor.handler != nil && len(r.middlewares) > 0 {
+		newRecordProcessor.handler = Chain(r.middlewares...)(newRecordProcessor.handler)
 	}
 	return &newRecordProcessor
 }
 
-// Processor defines a worker to process events that comes from kinesis
+// Processor defines a worker to process events that comes from kinesis.
+// It can run the kcl workers of several streams, which are started and stopped together.
 type Processor struct {
-	kclWorker KCLWorker
+	streams       []*streamWorker
+	gracePeriod   time.Duration
+	stateListener func(state WorkerState)
+	mu            sync.Mutex
+	state         WorkerState
+	ran           bool
+	stopRun       context.CancelFunc
+	done          chan struct{}
+}
+
+// streamWorker is the kcl worker of a stream run by a processor.
+type streamWorker struct {
+	streamName             string
+	kclWorker              KCLWorker
+	recordProcessorFactory *RecordProcessorFactory
+	started                bool
 }
 
 // NewProcessor creates a new kinesis processor using kcl.
@@ -180,26 +581,207 @@ func NewProcessor(kclWorker KCLWorker) *Processor {
 	log.Println("level", "INFO", "method", "kinesis.NewProcessor", "msg", "creating kinesis procesor")
 
 	newProcessor := Processor{
-		kclWorker: kclWorker,
+		streams: []*streamWorker{
+			{kclWorker: kclWorker},
+		},
+		gracePeriod: DefaultGracePeriod,
 	}
 
 	return &newProcessor
 }
 
-// Start starts the kinesis processor which starts the kcl worker.
+// WithRecordProcessorFactory sets the factory of the record processors run by the kcl worker,
+// it allows to control them from the processor.
+func (p *Processor) WithRecordProcessorFactory(recordProcessorFactory *RecordProcessorFactory) *Processor {
+	p.streams[0].recordProcessorFactory = recordProcessorFactory
+	return p
+}
+
+// Start starts the kinesis processor which starts the kcl workers and returns right away.
+// Use Run to keep the workers running until a context is cancelled.
 func (p *Processor) Start(ctx context.Context) error {
 	log.Println("level", "INFO", "msg", "starting kinesis procesor")
 	select {
 	case <-ctx.Done():
-		p.kclWorker.Shutdown()
+		for _, stream := range p.streams {
+			if stream.recordProcessorFactory != nil {
+				stream.recordProcessorFactory.flowControl.stop()
+			}
+			stream.kclWorker.Shutdown()
+		}
 		return nil
 	default:
-		err := p.kclWorker.Start()
+		err := p.startWorkers()
 		if err != nil {
-			log.Println("level", "ERROR", "msg", "something went wrong when trying to start the KCLWorker", "error", err)
-			return errors.New("something went wrong when trying to start the KCLWorker")
+			return err
 		}
 		log.Println("level", "INFO", "msg", "kinesis procesor started")
 	}
 	return nil
 }
+
+// startWorkers starts the kcl worker of every stream. If one of them fails, the ones
+// already started are shut down.
+func (p *Processor) startWorkers() error {
+	for _, stream := range p.streams {
+		err := stream.kclWorker.Start()
+		if err != nil {
+			log.Println("level", "ERROR", "msg", "something went wrong when trying to start the KCLWorker", "stream", stream.streamName, "error", err)
+			p.shutdownWorkers()
+			return errors.New("something went wrong when trying to start the KCLWorker")
+		}
+		p.mu.Lock()
+		stream.started = true
+		p.mu.Unlock()
+	}
+	return nil
+}
+
+// shutdownWorkers shuts down the started kcl workers at the same time and waits for them.
+func (p *Processor) shutdownWorkers() {
+	var wg sync.WaitGroup
+	for _, stream := range p.streams {
+		p.mu.Lock()
+		started := stream.started
+		stream.started = false
+		p.mu.Unlock()
+		if !started {
+			continue
+		}
+		wg.Add(1)
+		go func(kclWorker KCLWorker) {
+			defer wg.Done()
+			kclWorker.Shutdown()
+		}(stream.kclWorker)
+	}
+	wg.Wait()
+}
+
+// recordProcessorFactories returns the record processor factories of the streams of the processor.
+func (p *Processor) recordProcessorFactories() ([]*RecordProcessorFactory, error) {
+	factories := make([]*RecordProcessorFactory, 0, len(p.streams))
+	for _, stream := range p.streams {
+		if stream.recordProcessorFactory != nil {
+			factories = append(factories, stream.recordProcessorFactory)
+		}
+	}
+	if len(factories) == 0 {
+		return nil, ErrNoRecordProcessorFactory
+	}
+	return factories, nil
+}
+
+// Pause stops processing records in all the shards of this worker, keeping their leases.
+func (p *Processor) Pause() error {
+	factories, err := p.recordProcessorFactories()
+	if err != nil {
+		return err
+	}
+	for _, factory := range factories {
+		factory.flowControl.Pause()
+	}
+	return nil
+}
+
+// Resume resumes processing records in all the shards of this worker that were not paused individually.
+func (p *Processor) Resume() error {
+	factories, err := p.recordProcessorFactories()
+	if err != nil {
+		return err
+	}
+	for _, factory := range factories {
+		factory.flowControl.Resume()
+	}
+	return nil
+}
+
+// PauseShard stops processing records in the given shard, keeping its lease.
+// When the processor reads several streams, the shard is paused in all of them, use PauseStreamShard
+// to pause it in one stream.
+func (p *Processor) PauseShard(shardID string) error {
+	factories, err := p.recordProcessorFactories()
+	if err != nil {
+		return err
+	}
+	for _, factory := range factories {
+		factory.flowControl.PauseShard(shardID)
+	}
+	return nil
+}
+
+// PauseStreamShard stops processing records in the given shard of the given stream, keeping its lease.
+func (p *Processor) PauseStreamShard(streamName, shardID string) error {
+	factory, err := p.streamRecordProcessorFactory(streamName)
+	if err != nil {
+		return err
+	}
+	factory.flowControl.PauseShard(shardID)
+	return nil
+}
+
+// ResumeStreamShard resumes processing records in the given shard of the given stream.
+func (p *Processor) ResumeStreamShard(streamName, shardID string) error {
+	factory, err := p.streamRecordProcessorFactory(streamName)
+	if err != nil {
+		return err
+	}
+	factory.flowControl.ResumeShard(shardID)
+	return nil
+}
+
+// streamRecordProcessorFactory returns the record processor factory of the given stream.
+func (p *Processor) streamRecordProcessorFactory(streamName string) (*RecordProcessorFactory, error) {
+	for _, stream := range p.streams {
+		if stream.streamName != streamName {
+			continue
+		}
+		if stream.recordProcessorFactory == nil {
+			return nil, ErrNoRecordProcessorFactory
+		}
+		return stream.recordProcessorFactory, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnknownStream, streamName)
+}
+
+// ResumeShard resumes processing records in the given shard.
+// When the processor reads several streams, the shard is resumed in all of them, use ResumeStreamShard
+// to resume it in one stream.
+func (p *Processor) ResumeShard(shardID string) error {
+	factories, err := p.recordProcessorFactories()
+	if err != nil {
+		return err
+	}
+	for _, factory := range factories {
+		factory.flowControl.ResumeShard(shardID)
+	}
+	return nil
+}
+
+// Lag returns a snapshot of the lag of every shard owned by this worker, keyed by shard id.
+// Shard ids repeat across streams, so processors that read several streams return ErrSeveralStreams,
+// use StreamLag instead.
+func (p *Processor) Lag() (map[string]ShardLag, error) {
+	if _, err := p.recordProcessorFactories(); err != nil {
+		return nil, err
+	}
+	if len(p.streams) > 1 {
+		return nil, ErrSeveralStreams
+	}
+	return p.streams[0].recordProcessorFactory.lagTracker.Snapshot(), nil
+}
+
+// StreamLag returns a snapshot of the lag of every shard owned by this worker, keyed by stream name
+// and shard id. The stream of processors created with NewProcessor has no name.
+func (p *Processor) StreamLag() (map[string]map[string]ShardLag, error) {
+	if _, err := p.recordProcessorFactories(); err != nil {
+		return nil, err
+	}
+	lag := make(map[string]map[string]ShardLag, len(p.streams))
+	for _, stream := range p.streams {
+		if stream.recordProcessorFactory == nil {
+			continue
+		}
+		lag[stream.streamName] = stream.recordProcessorFactory.lagTracker.Snapshot()
+	}
+	return lag, nil
+}
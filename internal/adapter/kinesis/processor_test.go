@@ -7,6 +7,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/aws/aws-sdk-go/aws"
 	awskinesis "github.com/aws/aws-sdk-go/service/kinesis"
 	"github.com/fernandoocampo/pubsub-kinesis/internal/adapter/kinesis"
 	"github.com/stretchr/testify/assert"
@@ -133,9 +134,12 @@ func (h *handlerMock) Handle(data []byte) {
 	h.events = append(h.events, newTestMessage)
 }
 
-type recordProcessorCheckPointer struct{}
+type recordProcessorCheckPointer struct {
+	checkpoints []string
+}
 
 func (r *recordProcessorCheckPointer) Checkpoint(sequenceNumber *string) error {
+	r.checkpoints = append(r.checkpoints, aws.StringValue(sequenceNumber))
 	return nil
 }
 func (r *recordProcessorCheckPointer) PrepareCheckpoint(sequenceNumber *string) (interfaces.IPreparedCheckpointer, error) {
@@ -1,31 +1,71 @@
 package kinesis
 
 import (
+	"context"
 	"errors"
 	"log"
 
+	kinesisv2 "github.com/aws/aws-sdk-go-v2/service/kinesis"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/kinesis"
 	vmwarekcl "github.com/vmware/vmware-go-kcl/clientlibrary/utils"
 )
 
-// RecordPublisher defines kinesis publisher client behavior
+// RecordPublisher defines kinesis publisher client behavior of aws-sdk-go clients.
 type RecordPublisher interface {
 	PutRecord(*kinesis.PutRecordInput) (*kinesis.PutRecordOutput, error)
 }
 
+// RecordPublisherV2 defines kinesis publisher client behavior of aws-sdk-go-v2 clients.
+type RecordPublisherV2 interface {
+	PutRecord(ctx context.Context, input *kinesisv2.PutRecordInput, optFns ...func(*kinesisv2.Options)) (*kinesisv2.PutRecordOutput, error)
+}
+
+// recordSender sends a record to a stream with the client of a sdk generation.
+type recordSender interface {
+	putRecord(ctx context.Context, input putRecordInput) (putRecordOutput, error)
+}
+
+// putRecordInput is a record to send, independent of the sdk generation.
+type putRecordInput struct {
+	streamName      string
+	data            []byte
+	partitionKey    string
+	explicitHashKey string
+}
+
+// putRecordOutput is where a record was stored, independent of the sdk generation.
+type putRecordOutput struct {
+	sequenceNumber string
+	shardID        string
+}
+
 // PublisherClient contains data to connect to kinesis streaming service
 type PublisherClient struct {
 	streamName    string
-	kinesisClient RecordPublisher
+	kinesisClient recordSender
+	rateLimiter   *RateLimiter
 }
 
-// NewClient creates a new kinesis client.
+// NewClient creates a new kinesis client on an aws-sdk-go kinesis client.
 func NewClient(streamName string, kinesisClient RecordPublisher) *PublisherClient {
 	log.Println("level", "INFO", "msg", "creating new kinesis client")
+	return newPublisherClient(streamName, &senderV1{client: kinesisClient})
+}
+
+// NewClientV2 creates a new kinesis client on an aws-sdk-go-v2 kinesis client. It behaves like
+// the clients created with NewClient.
+func NewClientV2(streamName string, kinesisClient RecordPublisherV2) *PublisherClient {
+	log.Println("level", "INFO", "msg", "creating new kinesis client", "sdk", "v2")
+	return newPublisherClient(streamName, &senderV2{client: kinesisClient})
+}
 
+// newPublisherClient creates a new kinesis client that sends records with the given sender.
+func newPublisherClient(streamName string, sender recordSender) *PublisherClient {
 	newClient := PublisherClient{
-		kinesisClient: kinesisClient,
+		streamName:    streamName,
+		kinesisClient: sender,
+		rateLimiter:   NewRateLimiter(0),
 	}
 
 	return &newClient
@@ -34,34 +74,81 @@ func NewClient(streamName string, kinesisClient RecordPublisher) *PublisherClien
 // Publish sends a new message into the stream.
 func (c *PublisherClient) Publish(message []byte, partitionKey string) error {
 	log.Println("publishing a new message")
+	// there is no deadline to publish, so the rate limiter waits as long as needed.
+	_ = c.rateLimiter.Wait(context.Background(), 1)
 	input := c.buildPutRecordInput(message, partitionKey)
 
 	log.Println(
 		"msg", "publishing new message",
 		"stream", c.streamName,
-		"generated partition key", input.PartitionKey,
+		"generated partition key", input.partitionKey,
 		"explicit hash key", partitionKey,
 	)
 
-	output, err := c.kinesisClient.PutRecord(input)
+	output, err := c.kinesisClient.putRecord(context.Background(), input)
 	if err != nil {
 		log.Println("msg", "error in publishing a message", "error", err)
 		return errors.New("error in publishing a message into kinesis stream")
 	}
 
-	log.Println("msg", "message was published into kinesis", "sequence", output.SequenceNumber, "shardid", output.ShardId)
+	log.Println("msg", "message was published into kinesis", "sequence", output.sequenceNumber, "shardid", output.shardID)
 	return nil
 }
 
 // buildPutRecordInput
-func (c *PublisherClient) buildPutRecordInput(message []byte, partitionKey string) *kinesis.PutRecordInput {
-	input := kinesis.PutRecordInput{
-		Data:         message,
-		StreamName:   aws.String(c.streamName),
-		PartitionKey: aws.String(vmwarekcl.RandStringBytesMaskImpr(10)),
+func (c *PublisherClient) buildPutRecordInput(message []byte, partitionKey string) putRecordInput {
+	return putRecordInput{
+		streamName:      c.streamName,
+		data:            message,
+		partitionKey:    vmwarekcl.RandStringBytesMaskImpr(10),
+		explicitHashKey: partitionKey,
+	}
+}
+
+// senderV1 sends records with an aws-sdk-go client.
+type senderV1 struct {
+	client RecordPublisher
+}
+
+func (s *senderV1) putRecord(ctx context.Context, input putRecordInput) (putRecordOutput, error) {
+	request := kinesis.PutRecordInput{
+		Data:         input.data,
+		StreamName:   aws.String(input.streamName),
+		PartitionKey: aws.String(input.partitionKey),
+	}
+	if input.explicitHashKey != "" {
+		request.ExplicitHashKey = aws.String(input.explicitHashKey)
 	}
-	if partitionKey != "" {
-		input.ExplicitHashKey = &partitionKey
+	output, err := s.client.PutRecord(&request)
+	if err != nil {
+		return putRecordOutput{}, err
+	}
+	return putRecordOutput{
+		sequenceNumber: aws.StringValue(output.SequenceNumber),
+		shardID:        aws.StringValue(output.ShardId),
+	}, nil
+}
+
+// senderV2 sends records with an aws-sdk-go-v2 client.
+type senderV2 struct {
+	client RecordPublisherV2
+}
+
+func (s *senderV2) putRecord(ctx context.Context, input putRecordInput) (putRecordOutput, error) {
+	request := kinesisv2.PutRecordInput{
+		Data:         input.data,
+		StreamName:   aws.String(input.streamName),
+		PartitionKey: aws.String(input.partitionKey),
+	}
+	if input.explicitHashKey != "" {
+		request.ExplicitHashKey = aws.String(input.explicitHashKey)
+	}
+	output, err := s.client.PutRecord(ctx, &request)
+	if err != nil {
+		return putRecordOutput{}, err
 	}
-	return &input
+	return putRecordOutput{
+		sequenceNumber: aws.StringValue(output.SequenceNumber),
+		shardID:        aws.StringValue(output.ShardId),
+	}, nil
 }
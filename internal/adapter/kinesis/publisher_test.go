@@ -1,96 +1,136 @@
 package kinesis_test
 
 import (
+	"context"
 	"errors"
 	"testing"
 
+	kinesisv2 "github.com/aws/aws-sdk-go-v2/service/kinesis"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/kinesis"
 	pubsubkinesis "github.com/fernandoocampo/pubsub-kinesis/internal/adapter/kinesis"
 	"github.com/stretchr/testify/assert"
 )
 
-func TestPublishWithPartitionKeySuccess(t *testing.T) {
-	expectedReceivedRecords := 1
-	rawMessage := `{"name":"fernando"}`
-	streamName := "orders"
-	kinesisRecordOutput := kinesis.PutRecordOutput{
-		ShardId:        aws.String("123"),
-		SequenceNumber: aws.String("321"),
-		EncryptionType: aws.String("asdf23"),
+// publisherSDK creates publishers on the mocked client of a sdk generation, so every publisher
+// test runs against both of them.
+type publisherSDK struct {
+	name         string
+	newPublisher func(streamName string, err error) (*pubsubkinesis.PublisherClient, func() []receivedRecord)
+}
+
+// receivedRecord is a record received by the mocked client of any sdk generation.
+type receivedRecord struct {
+	streamName      string
+	data            []byte
+	partitionKey    string
+	explicitHashKey *string
+}
+
+func publisherSDKs() []publisherSDK {
+	return []publisherSDK{
+		{
+			name: "aws-sdk-go",
+			newPublisher: func(streamName string, err error) (*pubsubkinesis.PublisherClient, func() []receivedRecord) {
+				awsKinesisClientMocked := awsKinesisMock{
+					response: &kinesis.PutRecordOutput{
+						ShardId:        aws.String("123"),
+						SequenceNumber: aws.String("321"),
+						EncryptionType: aws.String("asdf23"),
+					},
+					err: err,
+				}
+				return pubsubkinesis.NewClient(streamName, &awsKinesisClientMocked), awsKinesisClientMocked.received
+			},
+		},
+		{
+			name: "aws-sdk-go-v2",
+			newPublisher: func(streamName string, err error) (*pubsubkinesis.PublisherClient, func() []receivedRecord) {
+				awsKinesisClientMocked := awsKinesisV2Mock{
+					response: &kinesisv2.PutRecordOutput{
+						ShardId:        aws.String("123"),
+						SequenceNumber: aws.String("321"),
+					},
+					err: err,
+				}
+				return pubsubkinesis.NewClientV2(streamName, &awsKinesisClientMocked), awsKinesisClientMocked.received
+			},
+		},
 	}
-	awsKinesisClientMocked := awsKinesisMock{
-		response:        &kinesisRecordOutput,
-		receivedRecords: make([]*kinesis.PutRecordInput, 0),
+}
+
+func TestPublishWithPartitionKeySuccess(t *testing.T) {
+	for _, sdk := range publisherSDKs() {
+		t.Run(sdk.name, func(st *testing.T) {
+			rawMessage := `{"name":"fernando"}`
+			partitionKey := "ddfasdf2343sfsd434sfs"
+			kinesisClient, received := sdk.newPublisher("orders", nil)
+
+			err := kinesisClient.Publish([]byte(rawMessage), partitionKey)
+
+			assert.NoError(st, err)
+			assert.Len(st, received(), 1)
+			receivedRecord := received()[0]
+			assert.Equal(st, "orders", receivedRecord.streamName)
+			assert.Equal(st, rawMessage, string(receivedRecord.data))
+			assert.NotEmpty(st, receivedRecord.partitionKey)
+			assert.Equal(st, partitionKey, aws.StringValue(receivedRecord.explicitHashKey))
+		})
 	}
-	partitionKey := "ddfasdf2343sfsd434sfs"
-	message := []byte(rawMessage)
-	kinesisClient := pubsubkinesis.NewClient(streamName, &awsKinesisClientMocked)
-
-	err := kinesisClient.Publish(message, partitionKey)
-
-	assert.NoError(t, err)
-	assert.NotEmpty(t, awsKinesisClientMocked.receivedRecords)
-	assert.Equal(t, expectedReceivedRecords, len(awsKinesisClientMocked.receivedRecords))
-	receivedRecord := awsKinesisClientMocked.receivedRecords[0]
-	assert.Equal(t, rawMessage, string(receivedRecord.Data))
-	assert.NotEmpty(t, receivedRecord.PartitionKey)
-	assert.Equal(t, partitionKey, *receivedRecord.ExplicitHashKey)
 }
 
 func TestPublishWithOutPartitionKeySuccess(t *testing.T) {
-	expectedReceivedRecords := 1
-	rawMessage := `{"name":"fernando"}`
-	streamName := "orders"
-	kinesisRecordOutput := kinesis.PutRecordOutput{
-		ShardId:        aws.String("123"),
-		SequenceNumber: aws.String("321"),
-		EncryptionType: aws.String("asdf23"),
-	}
-	awsKinesisClientMocked := awsKinesisMock{
-		response: &kinesisRecordOutput,
+	for _, sdk := range publisherSDKs() {
+		t.Run(sdk.name, func(st *testing.T) {
+			rawMessage := `{"name":"fernando"}`
+			kinesisClient, received := sdk.newPublisher("orders", nil)
+
+			err := kinesisClient.Publish([]byte(rawMessage), "")
+
+			assert.NoError(st, err)
+			assert.Len(st, received(), 1)
+			receivedRecord := received()[0]
+			assert.Equal(st, "orders", receivedRecord.streamName)
+			assert.Equal(st, rawMessage, string(receivedRecord.data))
+			assert.NotEmpty(st, receivedRecord.partitionKey)
+			assert.Nil(st, receivedRecord.explicitHashKey)
+		})
 	}
-	partitionKey := ""
-	message := []byte(rawMessage)
-	kinesisClient := pubsubkinesis.NewClient(streamName, &awsKinesisClientMocked)
-
-	err := kinesisClient.Publish(message, partitionKey)
-
-	assert.NoError(t, err)
-	assert.NotEmpty(t, awsKinesisClientMocked.receivedRecords)
-	assert.Equal(t, expectedReceivedRecords, len(awsKinesisClientMocked.receivedRecords))
-	receivedRecord := awsKinesisClientMocked.receivedRecords[0]
-	assert.Equal(t, rawMessage, string(receivedRecord.Data))
-	assert.NotEmpty(t, receivedRecord.PartitionKey)
-	assert.Empty(t, receivedRecord.ExplicitHashKey)
 }
 
 func TestPublishWithOutPartitionKeyFailed(t *testing.T) {
-	expectedReceivedRecords := 1
-	rawMessage := `{"name":"fernando"}`
-	streamName := "orders"
-	kinesisRecordOutput := kinesis.PutRecordOutput{
-		ShardId:        aws.String("123"),
-		SequenceNumber: aws.String("321"),
-		EncryptionType: aws.String("asdf23"),
+	for _, sdk := range publisherSDKs() {
+		t.Run(sdk.name, func(st *testing.T) {
+			rawMessage := `{"name":"fernando"}`
+			kinesisClient, received := sdk.newPublisher("orders", errors.New("unexpected error"))
+
+			err := kinesisClient.Publish([]byte(rawMessage), "")
+
+			assert.Error(st, err)
+			assert.Len(st, received(), 1)
+			receivedRecord := received()[0]
+			assert.Equal(st, rawMessage, string(receivedRecord.data))
+			assert.NotEmpty(st, receivedRecord.partitionKey)
+			assert.Nil(st, receivedRecord.explicitHashKey)
+		})
 	}
-	awsKinesisClientMocked := awsKinesisMock{
-		response: &kinesisRecordOutput,
-		err:      errors.New("unexpected error"),
+}
+
+// TestPublishSendsStreamName covers NewClient, which used to drop the stream name so records
+// were put without one.
+func TestPublishSendsStreamName(t *testing.T) {
+	for _, sdk := range publisherSDKs() {
+		t.Run(sdk.name, func(st *testing.T) {
+			kinesisClient, received := sdk.newPublisher("payments-events", nil)
+
+			err := kinesisClient.Publish([]byte(`{"id":"7"}`), "")
+
+			assert.NoError(st, err)
+			if assert.Len(st, received(), 1) {
+				assert.Equal(st, "payments-events", received()[0].streamName)
+			}
+		})
 	}
-	partitionKey := ""
-	message := []byte(rawMessage)
-	kinesisClient := pubsubkinesis.NewClient(streamName, &awsKinesisClientMocked)
-
-	err := kinesisClient.Publish(message, partitionKey)
-
-	assert.Error(t, err)
-	assert.NotEmpty(t, awsKinesisClientMocked.receivedRecords)
-	assert.Equal(t, expectedReceivedRecords, len(awsKinesisClientMocked.receivedRecords))
-	receivedRecord := awsKinesisClientMocked.receivedRecords[0]
-	assert.Equal(t, rawMessage, string(receivedRecord.Data))
-	assert.NotEmpty(t, receivedRecord.PartitionKey)
-	assert.Empty(t, receivedRecord.ExplicitHashKey)
 }
 
 type awsKinesisMock struct {
@@ -106,3 +146,43 @@ func (a *awsKinesisMock) PutRecord(record *kinesis.PutRecordInput) (*kinesis.Put
 	}
 	return a.response, nil
 }
+
+func (a *awsKinesisMock) received() []receivedRecord {
+	records := make([]receivedRecord, 0, len(a.receivedRecords))
+	for _, v := range a.receivedRecords {
+		records = append(records, receivedRecord{
+			streamName:      aws.StringValue(v.StreamName),
+			data:            v.Data,
+			partitionKey:    aws.StringValue(v.PartitionKey),
+			explicitHashKey: v.ExplicitHashKey,
+		})
+	}
+	return records
+}
+
+type awsKinesisV2Mock struct {
+	receivedRecords []*kinesisv2.PutRecordInput
+	response        *kinesisv2.PutRecordOutput
+	err             error
+}
+
+func (a *awsKinesisV2Mock) PutRecord(ctx context.Context, record *kinesisv2.PutRecordInput, optFns ...func(*kinesisv2.Options)) (*kinesisv2.PutRecordOutput, error) {
+	a.receivedRecords = append(a.receivedRecords, record)
+	if a.err != nil {
+		return nil, a.err
+	}
+	return a.response, nil
+}
+
+func (a *awsKinesisV2Mock) received() []receivedRecord {
+	records := make([]receivedRecord, 0, len(a.receivedRecords))
+	for _, v := range a.receivedRecords {
+		records = append(records, receivedRecord{
+			streamName:      aws.StringValue(v.StreamName),
+			data:            v.Data,
+			partitionKey:    aws.StringValue(v.PartitionKey),
+			explicitHashKey: v.ExplicitHashKey,
+		})
+	}
+	return records
+}
@@ -0,0 +1,162 @@
+package kinesis
+
+import (
+	"context"
+	"errors"
+	"log"
+	"runtime/debug"
+)
+
+// QuarantineAction defines what to do with a record that keeps failing.
+type QuarantineAction int
+
+const (
+	// QuarantineSkip logs the record and continues with the next one.
+	QuarantineSkip QuarantineAction = iota + 1
+	// QuarantineDeadLetter sends the record to a dead letter queue and continues with the next one.
+	QuarantineDeadLetter
+	// QuarantineHalt stops processing the shard. Its checkpoint stays before the failing record
+	// until the worker is restarted or the lease moves to another worker.
+	QuarantineHalt
+)
+
+// DefaultQuarantineMaxAttempts is the default number of times a record is handled before it is quarantined.
+const DefaultQuarantineMaxAttempts = 1
+
+// DeadLetterQueue defines behavior to store records that could not be processed.
+type DeadLetterQueue interface {
+	SendToDeadLetter(ctx context.Context, record Record, cause error) error
+}
+
+// QuarantineAlert contains the details of a record that was quarantined.
+type QuarantineAlert struct {
+	Record Record
+	Action QuarantineAction
+	Err    error
+}
+
+// QuarantinePolicy defines how the record processor deals with poison pills,
+// records that keep failing or crashing the handler.
+type QuarantinePolicy struct {
+	// MaxAttempts is how many times a record is handled before it is quarantined,
+	// waiting an exponential backoff between attempts.
+	// It applies to Handler and RecordHandler, batch handlers are retried according to MaxBatchRetries.
+	MaxAttempts int
+	// Action is what to do with a record once it is quarantined. Without action nothing is quarantined
+	// and the shard is halted, see DefaultQuarantinePolicy.
+	Action QuarantineAction
+	// DeadLetterQueue receives the records when Action is QuarantineDeadLetter.
+	DeadLetterQueue DeadLetterQueue
+	// Alert is invoked every time a record is quarantined, if it is set.
+	Alert func(alert QuarantineAlert)
+}
+
+// DefaultQuarantinePolicy returns the policy used when none is set. It has no action, so nothing is
+// quarantined: a record or batch that keeps failing halts the shard like QuarantineHalt, because the
+// kcl keeps reading after it and the next checkpoint would skip the failed records.
+func DefaultQuarantinePolicy() QuarantinePolicy {
+	return QuarantinePolicy{
+		MaxAttempts: DefaultQuarantineMaxAttempts,
+	}
+}
+
+// enabled tells if records that keep failing are quarantined, that is if the policy has an action.
+func (q QuarantinePolicy) enabled() bool {
+	return q.Action != 0
+}
+
+// maxAttempts returns the attempts to handle a record, it is at least one.
+func (q QuarantinePolicy) maxAttempts() int {
+	if q.MaxAttempts < 1 {
+		return 1
+	}
+	return q.MaxAttempts
+}
+
+// errNoDeadLetterQueue is returned when the dead letter action is used without a dead letter queue.
+var errNoDeadLetterQueue = errors.New("dead letter queue is not configured")
+
+// quarantine applies the quarantine policy to a record that could not be processed.
+// It returns false when the processing of the shard must stop.
+func (r *RecordProcessor) quarantine(record Record, cause error) bool {
+	action := r.quarantinePolicy.Action
+	if action == QuarantineDeadLetter {
+		err := errNoDeadLetterQueue
+		if r.quarantinePolicy.DeadLetterQueue != nil {
+			err = r.quarantinePolicy.DeadLetterQueue.SendToDeadLetter(r.ctx, record, cause)
+		}
+		if err != nil {
+			// the record can't be lost, so the shard is halted instead.
+			log.Println("level", "ERROR", "msg", "record could not be sent to dead letter queue", "shard", record.ShardID, "sequence", record.SequenceNumber, "error", err)
+			action = QuarantineHalt
+		}
+	}
+
+	logArgs := []interface{}{
+		"level", "ERROR",
+		"msg", "quarantining record",
+		"action", action,
+		"shard", record.ShardID,
+		"sequence", record.SequenceNumber,
+		"subsequence", record.SubSequenceNumber,
+		"error", cause,
+	}
+	var panicErr *PanicError
+	if errors.As(cause, &panicErr) {
+		logArgs = append(logArgs, "stack", string(panicErr.Stack))
+	}
+	log.Println(logArgs...)
+
+	if r.quarantinePolicy.Alert != nil {
+		r.quarantinePolicy.Alert(QuarantineAlert{
+			Record: record,
+			Action: action,
+			Err:    cause,
+		})
+	}
+
+	if action == QuarantineHalt {
+		r.halted = true
+		return false
+	}
+	return true
+}
+
+// halt stops processing the shard because a record keeps failing and the policy has no action.
+// It always returns false.
+func (r *RecordProcessor) halt(record Record, cause error) bool {
+	log.Println(
+		"level", "ERROR",
+		"msg", "halting shard, record keeps failing and there is no quarantine action",
+		"shard", record.ShardID,
+		"sequence", record.SequenceNumber,
+		"subsequence", record.SubSequenceNumber,
+		"error", cause,
+	)
+	r.halted = true
+	return false
+}
+
+// String returns the name of the quarantine action.
+func (q QuarantineAction) String() string {
+	switch q {
+	case QuarantineSkip:
+		return "skip"
+	case QuarantineDeadLetter:
+		return "dead-letter"
+	case QuarantineHalt:
+		return "halt"
+	default:
+		return "unknown"
+	}
+}
+
+// recoverPanic turns a recovered panic value into a *PanicError stored in err.
+func recoverPanic(err *error) {
+	if value := recover(); value != nil {
+		*err = &PanicError{
+			Value: value,
+			Stack: debug.Stack(),
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package kinesis_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fernandoocampo/pubsub-kinesis/internal/adapter/kinesis"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandlerPanicIsIsolated(t *testing.T) {
+	var alerts []kinesis.QuarantineAlert
+	recordHandlerCreator := &poisonHandlerCreatorMock{poisonSequenceNumber: "2", panics: true}
+	recordProcessorFactory := kinesis.NewRecordHandlerProcessorFactory(recordHandlerCreator).
+		WithQuarantinePolicy(kinesis.QuarantinePolicy{
+			MaxAttempts: 2,
+			Action:      kinesis.QuarantineSkip,
+			Alert: func(alert kinesis.QuarantineAlert) {
+				alerts = append(alerts, alert)
+			},
+		})
+	checkpointer := recordProcessorCheckPointer{}
+
+	recordProcessor := recordProcessorFactory.CreateProcessor()
+	recordProcessor.ProcessRecords(newProcessRecordsInput(&checkpointer, "1", "2", "3"))
+
+	assert.Equal(t, []string{"1", "2", "2", "3"}, recordHandlerCreator.handler.attempts)
+	assert.Equal(t, []string{"3"}, checkpointer.checkpoints)
+	assert.Len(t, alerts, 1)
+	assert.Equal(t, "2", alerts[0].Record.SequenceNumber)
+	var panicErr *kinesis.PanicError
+	assert.True(t, errors.As(alerts[0].Err, &panicErr))
+	assert.NotEmpty(t, panicErr.Stack)
+}
+
+func TestPoisonPillIsSentToDeadLetterQueue(t *testing.T) {
+	deadLetterQueue := &deadLetterQueueMock{}
+	recordHandlerCreator := &poisonHandlerCreatorMock{poisonSequenceNumber: "2"}
+	recordProcessorFactory := kinesis.NewRecordHandlerProcessorFactory(recordHandlerCreator).
+		WithQuarantinePolicy(kinesis.QuarantinePolicy{
+			Action:          kinesis.QuarantineDeadLetter,
+			DeadLetterQueue: deadLetterQueue,
+		})
+	checkpointer := recordProcessorCheckPointer{}
+
+	recordProcessor := recordProcessorFactory.CreateProcessor()
+	recordProcessor.ProcessRecords(newProcessRecordsInput(&checkpointer, "1", "2", "3"))
+
+	assert.Equal(t, []string{"2"}, sequenceNumbers(deadLetterQueue.records))
+	assert.Equal(t, []string{"3"}, checkpointer.checkpoints)
+}
+
+func TestPoisonPillHaltsShard(t *testing.T) {
+	var alerts []kinesis.QuarantineAlert
+	recordHandlerCreator := &poisonHandlerCreatorMock{poisonSequenceNumber: "2", panics: true}
+	recordProcessorFactory := kinesis.NewRecordHandlerProcessorFactory(recordHandlerCreator).
+		WithQuarantinePolicy(kinesis.QuarantinePolicy{
+			Action: kinesis.QuarantineHalt,
+			Alert: func(alert kinesis.QuarantineAlert) {
+				alerts = append(alerts, alert)
+			},
+		})
+	checkpointer := recordProcessorCheckPointer{}
+
+	recordProcessor := recordProcessorFactory.CreateProcessor()
+	recordProcessor.ProcessRecords(newProcessRecordsInput(&checkpointer, "1", "2", "3"))
+	recordProcessor.ProcessRecords(newProcessRecordsInput(&checkpointer, "4"))
+
+	assert.Equal(t, []string{"1", "2"}, recordHandlerCreator.handler.attempts)
+	assert.Equal(t, []string{"1"}, checkpointer.checkpoints)
+	assert.Len(t, alerts, 1)
+	assert.Equal(t, kinesis.QuarantineHalt, alerts[0].Action)
+}
+
+func TestBatchHandlerPanicIsIsolated(t *testing.T) {
+	recordProcessorFactory := kinesis.NewBatchRecordProcessorFactory(&panicBatchHandlerCreator{}).
+		WithMaxBatchRetries(0).
+		WithQuarantinePolicy(kinesis.QuarantinePolicy{Action: kinesis.QuarantineSkip})
+	checkpointer := recordProcessorCheckPointer{}
+
+	recordProcessor := recordProcessorFactory.CreateProcessor()
+	recordProcessor.ProcessRecords(newProcessRecordsInput(&checkpointer, "1", "2"))
+
+	assert.Equal(t, []string{"1", "2"}, checkpointer.checkpoints)
+}
+
+func TestBatchPoisonPillIsSkipped(t *testing.T) {
+	var alerts []kinesis.QuarantineAlert
+	batchHandlerCreator := &batchHandlerCreatorMock{
+		errors: []error{
+			kinesis.NewBatchError(2, errors.New("db timeout")),
+			errors.New("db down"),
+			errors.New("db down"),
+		},
+	}
+	recordProcessorFactory := kinesis.NewBatchRecordProcessorFactory(batchHandlerCreator).
+		WithMaxBatchRetries(2).
+		WithQuarantinePolicy(kinesis.QuarantinePolicy{
+			Action: kinesis.QuarantineSkip,
+			Alert: func(alert kinesis.QuarantineAlert) {
+				alerts = append(alerts, alert)
+			},
+		})
+	checkpointer := recordProcessorCheckPointer{}
+
+	recordProcessor := recordProcessorFactory.CreateProcessor()
+	recordProcessor.ProcessRecords(newProcessRecordsInput(&checkpointer, "1", "2", "3"))
+
+	assert.Len(t, batchHandlerCreator.handler.batches, 3)
+	assert.Equal(t, []string{"2", "3"}, checkpointer.checkpoints)
+	assert.Len(t, alerts, 1)
+	assert.Equal(t, "3", alerts[0].Record.SequenceNumber)
+}
+
+func TestFailedRecordHaltsShardWithoutQuarantine(t *testing.T) {
+	recordHandlerCreator := &poisonHandlerCreatorMock{poisonSequenceNumber: "2"}
+	recordProcessorFactory := kinesis.NewRecordHandlerProcessorFactory(recordHandlerCreator)
+	checkpointer := recordProcessorCheckPointer{}
+
+	recordProcessor := recordProcessorFactory.CreateProcessor()
+	recordProcessor.ProcessRecords(newProcessRecordsInput(&checkpointer, "1", "2", "3"))
+	recordProcessor.ProcessRecords(newProcessRecordsInput(&checkpointer, "4"))
+
+	assert.Equal(t, []string{"1", "2"}, recordHandlerCreator.handler.attempts)
+	assert.Equal(t, []string{"1"}, checkpointer.checkpoints)
+}
+
+func TestRecordRetriesWaitBackoff(t *testing.T) {
+	recordHandlerCreator := &poisonHandlerCreatorMock{poisonSequenceNumber: "1"}
+	recordProcessorFactory := kinesis.NewRecordHandlerProcessorFactory(recordHandlerCreator).
+		WithQuarantinePolicy(kinesis.QuarantinePolicy{MaxAttempts: 3, Action: kinesis.QuarantineSkip})
+	checkpointer := recordProcessorCheckPointer{}
+	start := time.Now()
+
+	recordProcessor := recordProcessorFactory.CreateProcessor()
+	recordProcessor.ProcessRecords(newProcessRecordsInput(&checkpointer, "1"))
+
+	assert.Equal(t, []string{"1", "1", "1"}, recordHandlerCreator.handler.attempts)
+	assert.GreaterOrEqual(t, int64(time.Since(start)), int64(300*time.Millisecond))
+	assert.Equal(t, []string{"1"}, checkpointer.checkpoints)
+}
+
+type poisonHandlerCreatorMock struct {
+	handler              *poisonHandlerMock
+	poisonSequenceNumber string
+	panics               bool
+}
+
+// Create create a poisonHandlerMock
+func (p *poisonHandlerCreatorMock) Create() kinesis.RecordHandler {
+	p.handler = &poisonHandlerMock{
+		poisonSequenceNumber: p.poisonSequenceNumber,
+		panics:               p.panics,
+	}
+	return p.handler
+}
+
+type poisonHandlerMock struct {
+	attempts             []string
+	poisonSequenceNumber string
+	panics               bool
+}
+
+func (p *poisonHandlerMock) HandleRecord(ctx context.Context, record kinesis.Record) error {
+	p.attempts = append(p.attempts, record.SequenceNumber)
+	if record.SequenceNumber != p.poisonSequenceNumber {
+		return nil
+	}
+	if p.panics {
+		panic("poison pill")
+	}
+	return errors.New("poison pill")
+}
+
+type panicBatchHandlerCreator struct{}
+
+// Create create a batch handler that always panics
+func (p *panicBatchHandlerCreator) Create() kinesis.BatchHandler {
+	return &panicBatchHandler{}
+}
+
+type panicBatchHandler struct{}
+
+func (p *panicBatchHandler) HandleBatch(ctx context.Context, records []kinesis.Record) error {
+	panic("unexpected batch")
+}
+
+type deadLetterQueueMock struct {
+	records []kinesis.Record
+}
+
+func (d *deadLetterQueueMock) SendToDeadLetter(ctx context.Context, record kinesis.Record, cause error) error {
+	d.records = append(d.records, record)
+	return nil
+}
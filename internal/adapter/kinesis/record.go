@@ -0,0 +1,91 @@
+package kinesis
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/vmware/vmware-go-kcl/clientlibrary/interfaces"
+)
+
+// Record contains the data and metadata of a kinesis record delivered to handlers.
+type Record struct {
+	// Data is the payload of the record.
+	Data []byte
+	// PartitionKey identifies the shard the record was sent to.
+	PartitionKey string
+	// SequenceNumber is the unique identifier of the record within its shard.
+	// Records de-aggregated from the same KPL record share the same sequence number.
+	SequenceNumber string
+	// SubSequenceNumber is the position of the record within its KPL aggregated record.
+	// It is zero for records that were not aggregated.
+	SubSequenceNumber int64
+	// ShardID is the shard the record was read from.
+	ShardID string
+	// ApproximateArrivalTimestamp is the time kinesis accepted the record.
+	ApproximateArrivalTimestamp time.Time
+	// EncryptionType is the encryption applied to the record, if any.
+	EncryptionType string
+	// MillisBehindLatest is how far behind the tip of the stream the batch of this record was when read.
+	MillisBehindLatest int64
+	// envelope is the envelope decoded from Data, nil when records are not created by record processors.
+	envelope *envelopeCache
+}
+
+// RecordHandler defines behavior to process kinesis records along with their metadata.
+type RecordHandler interface {
+	HandleRecord(ctx context.Context, record Record) error
+}
+
+// RecordHandlerFunc is an adapter to use ordinary functions as record handlers.
+type RecordHandlerFunc func(ctx context.Context, record Record) error
+
+// HandleRecord calls f(ctx, record).
+func (f RecordHandlerFunc) HandleRecord(ctx context.Context, record Record) error {
+	return f(ctx, record)
+}
+
+// RecordHandlerCreator defines behavior to create instances of RecordHandler
+type RecordHandlerCreator interface {
+	Create() RecordHandler
+}
+
+// handlerAdapter allows to use a Handler where a RecordHandler is expected.
+type handlerAdapter struct {
+	handler Handler
+}
+
+// HandleRecord delivers only the data of the record to the adapted handler.
+func (h *handlerAdapter) HandleRecord(ctx context.Context, record Record) error {
+	h.handler.Handle(record.Data)
+	return nil
+}
+
+// newRecords builds the records that will be delivered to handlers from the kcl input.
+func newRecords(shardID string, input *interfaces.ProcessRecordsInput) []Record {
+	records := make([]Record, 0, len(input.Records))
+	var subSequenceNumber int64
+	for i, v := range input.Records {
+		// de-aggregated records share the sequence number of the KPL record they came from,
+		// so their position within it is used as sub sequence number.
+		sequenceNumber := aws.StringValue(v.SequenceNumber)
+		if i > 0 && sequenceNumber != "" && sequenceNumber == records[i-1].SequenceNumber {
+			subSequenceNumber++
+		} else {
+			subSequenceNumber = 0
+		}
+		newRecord := Record{
+			Data:                        v.Data,
+			PartitionKey:                aws.StringValue(v.PartitionKey),
+			SequenceNumber:              sequenceNumber,
+			SubSequenceNumber:           subSequenceNumber,
+			ShardID:                     shardID,
+			ApproximateArrivalTimestamp: aws.TimeValue(v.ApproximateArrivalTimestamp),
+			EncryptionType:              aws.StringValue(v.EncryptionType),
+			MillisBehindLatest:          input.MillisBehindLatest,
+			envelope:                    &envelopeCache{},
+		}
+		records = append(records, newRecord)
+	}
+	return records
+}
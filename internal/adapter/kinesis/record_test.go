@@ -0,0 +1,96 @@
+package kinesis_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/fernandoocampo/pubsub-kinesis/internal/adapter/kinesis"
+	"github.com/stretchr/testify/assert"
+	"github.com/vmware/vmware-go-kcl/clientlibrary/interfaces"
+)
+
+func TestProcessRecordsDeliversMetadata(t *testing.T) {
+	arrival := time.Date(2021, 3, 4, 10, 0, 0, 0, time.UTC)
+	expectedRecords := []kinesis.Record{
+		{
+			Data:                        []byte(`{"key": "1"}`),
+			PartitionKey:                "partition-1",
+			SequenceNumber:              "1",
+			SubSequenceNumber:           0,
+			ShardID:                     "shardId-000000000001",
+			ApproximateArrivalTimestamp: arrival,
+			MillisBehindLatest:          250,
+		},
+		{
+			Data:                        []byte(`{"key": "2"}`),
+			PartitionKey:                "partition-2",
+			SequenceNumber:              "2",
+			SubSequenceNumber:           0,
+			ShardID:                     "shardId-000000000001",
+			ApproximateArrivalTimestamp: arrival,
+			MillisBehindLatest:          250,
+		},
+		{
+			Data:                        []byte(`{"key": "2"}`),
+			PartitionKey:                "partition-2",
+			SequenceNumber:              "2",
+			SubSequenceNumber:           1,
+			ShardID:                     "shardId-000000000001",
+			ApproximateArrivalTimestamp: arrival,
+			MillisBehindLatest:          250,
+		},
+	}
+	recordHandlerCreator := &recordHandlerCreatorMock{}
+	recordProcessorFactory := kinesis.NewRecordHandlerProcessorFactory(recordHandlerCreator)
+	checkpointer := recordProcessorCheckPointer{}
+	input := newProcessRecordsInput(&checkpointer, "1", "2", "2")
+	input.MillisBehindLatest = 250
+	for _, v := range input.Records {
+		v.ApproximateArrivalTimestamp = aws.Time(arrival)
+	}
+
+	recordProcessor := recordProcessorFactory.CreateProcessor()
+	recordProcessor.Initialize(&interfaces.InitializationInput{
+		ShardId:                "shardId-000000000001",
+		ExtendedSequenceNumber: &interfaces.ExtendedSequenceNumber{},
+	})
+	recordProcessor.ProcessRecords(input)
+
+	assert.Equal(t, expectedRecords, recordHandlerCreator.handler.records)
+	assert.Equal(t, []string{"2"}, checkpointer.checkpoints)
+}
+
+type recordHandlerCreatorMock struct {
+	handler *recordHandlerMock
+}
+
+// Create create a recordHandlerMock
+func (r *recordHandlerCreatorMock) Create() kinesis.RecordHandler {
+	r.handler = &recordHandlerMock{}
+	return r.handler
+}
+
+type recordHandlerMock struct {
+	records []kinesis.Record
+}
+
+func (r *recordHandlerMock) HandleRecord(ctx context.Context, record kinesis.Record) error {
+	r.records = append(r.records, exportedFields(record))
+	return nil
+}
+
+// exportedFields returns a copy of the record without its decoded envelope, so it can be compared with literals.
+func exportedFields(record kinesis.Record) kinesis.Record {
+	return kinesis.Record{
+		Data:                        record.Data,
+		PartitionKey:                record.PartitionKey,
+		SequenceNumber:              record.SequenceNumber,
+		SubSequenceNumber:           record.SubSequenceNumber,
+		ShardID:                     record.ShardID,
+		ApproximateArrivalTimestamp: record.ApproximateArrivalTimestamp,
+		EncryptionType:              record.EncryptionType,
+		MillisBehindLatest:          record.MillisBehindLatest,
+	}
+}
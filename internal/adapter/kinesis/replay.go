@@ -0,0 +1,106 @@
+package kinesis
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/vmware/vmware-go-kcl/clientlibrary/config"
+)
+
+// InitialPosition is where a worker starts reading a shard that has no checkpoint yet.
+type InitialPosition string
+
+// Supported initial positions.
+const (
+	// InitialPositionLatest starts after the most recent record of the shard.
+	InitialPositionLatest InitialPosition = "LATEST"
+	// InitialPositionTrimHorizon starts at the oldest record available in the shard.
+	InitialPositionTrimHorizon InitialPosition = "TRIM_HORIZON"
+	// InitialPositionAtTimestamp starts at the first record that arrived at or after a timestamp.
+	InitialPositionAtTimestamp InitialPosition = "AT_TIMESTAMP"
+)
+
+// replayTimeLayout is the layout of the start time within the replay application name.
+const replayTimeLayout = "20060102T150405Z"
+
+// ReplayConfiguration contains data to reprocess a time range of the stream. The worker runs
+// under its own application name and lease table, so production checkpoints are not touched.
+//
+// The worker doesn't stop at the end of the window: it keeps reading and skipping the later
+// records until it is shut down, and every shard logs when it reaches the end. The lease table
+// is not deleted either, delete it once the worker is shut down, e.g. with
+// dynamodb.Client.DeleteLeaseTable, or a later replay from the same time resumes from its checkpoints.
+type ReplayConfiguration struct {
+	// From is the arrival time of the first record to reprocess.
+	From time.Time
+	// To is the arrival time of the last record to reprocess, records after it are skipped.
+	// Zero means reprocessing up to the tip of the stream.
+	To time.Time
+	// ApplicationName is the temporary application name. It defaults to the application
+	// name followed by "-replay-" and the From time.
+	ApplicationName string
+	// TableName is the temporary lease table, it defaults to the replay application name.
+	TableName string
+}
+
+// ReplayApplicationName returns the temporary application name used to replay from the given time.
+func ReplayApplicationName(applicationName string, from time.Time) string {
+	return fmt.Sprintf("%s-replay-%s", applicationName, from.UTC().Format(replayTimeLayout))
+}
+
+// applicationNames returns the application name and lease table the worker runs with.
+func (k KCLConfiguration) applicationNames() (string, string) {
+	if k.Replay == nil {
+		return k.ApplicationName, k.TableName
+	}
+	applicationName := k.Replay.ApplicationName
+	if applicationName == "" {
+		applicationName = ReplayApplicationName(k.ApplicationName, k.Replay.From)
+	}
+	tableName := k.Replay.TableName
+	if tableName == "" {
+		tableName = applicationName
+	}
+	return applicationName, tableName
+}
+
+// applyInitialPosition sets where the worker starts reading shards without checkpoint.
+// Replays always start at their From time. The configuration must be valid.
+func (k KCLConfiguration) applyInitialPosition(kclLibConf *config.KinesisClientLibConfiguration) {
+	if k.Replay != nil {
+		from := k.Replay.From
+		kclLibConf.WithTimestampAtInitialPositionInStream(&from)
+		return
+	}
+	switch k.InitialPosition {
+	case "", InitialPositionLatest:
+		kclLibConf.WithInitialPositionInStream(config.LATEST)
+	case InitialPositionTrimHorizon:
+		kclLibConf.WithInitialPositionInStream(config.TRIM_HORIZON)
+	case InitialPositionAtTimestamp:
+		timestamp := *k.InitialTimestamp
+		kclLibConf.WithTimestampAtInitialPositionInStream(&timestamp)
+	}
+}
+
+// skipAfterReplayWindow removes the records that arrived after the end of the replay window.
+// The shard keeps being read, so the lease table named in the log can only be deleted once the
+// worker is shut down.
+func (r *RecordProcessor) skipAfterReplayWindow(records []Record) []Record {
+	if r.replayUntil.IsZero() {
+		return records
+	}
+	pending := make([]Record, 0, len(records))
+	for _, v := range records {
+		if v.ApproximateArrivalTimestamp.After(r.replayUntil) {
+			continue
+		}
+		pending = append(pending, v)
+	}
+	if len(pending) < len(records) && !r.replayFinished {
+		r.replayFinished = true
+		log.Println("level", "INFO", "msg", "shard reached the end of the replay window, the worker keeps running until it is shut down", "shard", r.shardID, "until", r.replayUntil, "table", r.replayTable)
+	}
+	return pending
+}
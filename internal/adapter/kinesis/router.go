@@ -0,0 +1,212 @@
+package kinesis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"path"
+)
+
+// EventTypeResolver defines behavior to extract the event type of a record.
+type EventTypeResolver func(record Record) (string, error)
+
+// HeaderEventType resolves the event type from the given envelope header.
+func HeaderEventType(header string) EventTypeResolver {
+	return func(record Record) (string, error) {
+		envelope, err := record.Envelope()
+		if err != nil {
+			return "", err
+		}
+		eventType, ok := envelope.Headers[header]
+		if !ok {
+			return "", fmt.Errorf("header %q not found", header)
+		}
+		return eventType, nil
+	}
+}
+
+// JSONFieldEventType resolves the event type from the value at the given dotted path
+// of the record payload, e.g. "metadata.type".
+func JSONFieldEventType(fieldPath string) EventTypeResolver {
+	return func(record Record) (string, error) {
+		value, ok, err := lookupJSONField(record.Payload(), fieldPath)
+		if err != nil {
+			return "", err
+		}
+		if !ok {
+			return "", fmt.Errorf("field %q not found", fieldPath)
+		}
+		eventType, ok := value.(string)
+		if !ok {
+			return "", fmt.Errorf("field %q is not a string", fieldPath)
+		}
+		return eventType, nil
+	}
+}
+
+// ErrNoRoute is reported when there is no handler registered for the event type of a record.
+var ErrNoRoute = errors.New("no handler registered for event type")
+
+// UnroutableHandler is called with the records that could not be routed and the reason.
+type UnroutableHandler func(ctx context.Context, record Record, err error)
+
+// route links an event type pattern with the creator of its handler.
+type route struct {
+	pattern string
+	creator RecordHandlerCreator
+}
+
+// Router is a handler creator that routes every record to the handler registered for its event type.
+// It can be used with NewRecordProcessorFactory.
+type Router struct {
+	resolver   EventTypeResolver
+	routes     map[string]route
+	wildcards  []route
+	fallback   *route
+	unroutable UnroutableHandler
+}
+
+// NewRouter creates a new router that gets the event type of records with the given resolver.
+func NewRouter(resolver EventTypeResolver) *Router {
+	newRouter := Router{
+		resolver:   resolver,
+		routes:     make(map[string]route),
+		unroutable: logUnroutable,
+	}
+	return &newRouter
+}
+
+// Handle registers the handler creator for the given event type. The event type can be a
+// wildcard pattern such as "order.*", exact event types take precedence over patterns and
+// patterns are matched in the order they were registered.
+func (r *Router) Handle(eventType string, creator RecordHandlerCreator) *Router {
+	if isWildcard(eventType) {
+		r.wildcards = append(r.wildcards, route{pattern: eventType, creator: creator})
+		return r
+	}
+	r.routes[eventType] = route{pattern: eventType, creator: creator}
+	return r
+}
+
+// HandleFunc registers a handler function for the given event type.
+func (r *Router) HandleFunc(eventType string, handler RecordHandlerFunc) *Router {
+	return r.Handle(eventType, &singleRecordHandlerCreator{handler: handler})
+}
+
+// HandleJSON registers a typed handler for the given event type. The payload of every record
+// is decoded into the value returned by newEvent before calling handle with it.
+func (r *Router) HandleJSON(eventType string, newEvent func() interface{}, handle func(ctx context.Context, record Record, event interface{}) error) *Router {
+	return r.HandleFunc(eventType, func(ctx context.Context, record Record) error {
+		event := newEvent()
+		if err := json.Unmarshal(record.Payload(), event); err != nil {
+			return fmt.Errorf("decoding %s event: %w", eventType, err)
+		}
+		return handle(ctx, record, event)
+	})
+}
+
+// Fallback registers the handler creator used for records whose event type has no handler.
+func (r *Router) Fallback(creator RecordHandlerCreator) *Router {
+	r.fallback = &route{creator: creator}
+	return r
+}
+
+// OnUnroutable sets the function that is told about records that could not be routed.
+// Unroutable records are logged by default.
+func (r *Router) OnUnroutable(unroutable UnroutableHandler) *Router {
+	r.unroutable = unroutable
+	return r
+}
+
+// Create creates the router handler of a record processor.
+func (r *Router) Create() Handler {
+	newRouterHandler := routerHandler{
+		router:   r,
+		handlers: make(map[string]RecordHandler),
+	}
+	return &newRouterHandler
+}
+
+// routeFor returns the route registered for the given event type, if any.
+// The fallback route has an empty pattern.
+func (r *Router) routeFor(eventType string) (route, bool) {
+	if v, ok := r.routes[eventType]; ok {
+		return v, true
+	}
+	for _, v := range r.wildcards {
+		if matched, _ := path.Match(v.pattern, eventType); matched {
+			return v, true
+		}
+	}
+	if r.fallback != nil {
+		return *r.fallback, true
+	}
+	return route{}, false
+}
+
+// routerHandler is the handler created by the router for every record processor.
+// It creates the handler of each route once, the first time a record is routed to it.
+type routerHandler struct {
+	router   *Router
+	handlers map[string]RecordHandler
+}
+
+// Handle routes the given data.
+func (r *routerHandler) Handle(data []byte) {
+	_ = r.HandleRecord(context.Background(), Record{Data: data})
+}
+
+// HandleRecord delivers the record to the handler of its event type.
+// Unroutable records are reported and considered handled.
+func (r *routerHandler) HandleRecord(ctx context.Context, record Record) error {
+	eventType, err := r.router.resolver(record)
+	if err != nil {
+		r.router.unroutable(ctx, record, err)
+		return nil
+	}
+	route, ok := r.router.routeFor(eventType)
+	if !ok {
+		r.router.unroutable(ctx, record, fmt.Errorf("%w: %s", ErrNoRoute, eventType))
+		return nil
+	}
+	handler, ok := r.handlers[route.pattern]
+	if !ok {
+		handler = route.creator.Create()
+		r.handlers[route.pattern] = handler
+	}
+	return handler.HandleRecord(ctx, record)
+}
+
+// singleRecordHandlerCreator always returns the same handler.
+type singleRecordHandlerCreator struct {
+	handler RecordHandler
+}
+
+// Create returns the handler of the creator.
+func (s *singleRecordHandlerCreator) Create() RecordHandler {
+	return s.handler
+}
+
+// isWildcard tells if the event type is a pattern.
+func isWildcard(eventType string) bool {
+	for _, v := range eventType {
+		if v == '*' || v == '?' || v == '[' {
+			return true
+		}
+	}
+	return false
+}
+
+// logUnroutable is the default unroutable handler, it logs the record.
+func logUnroutable(ctx context.Context, record Record, err error) {
+	log.Println(
+		"level", "WARN",
+		"msg", "record could not be routed",
+		"shard", record.ShardID,
+		"sequence", record.SequenceNumber,
+		"subsequence", record.SubSequenceNumber,
+		"error", err,
+	)
+}
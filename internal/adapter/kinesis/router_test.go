@@ -0,0 +1,153 @@
+package kinesis_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fernandoocampo/pubsub-kinesis/internal/adapter/kinesis"
+	"github.com/stretchr/testify/assert"
+)
+
+type orderCreated struct {
+	ID string `json:"id"`
+}
+
+func TestRouterRoutesByHeader(t *testing.T) {
+	var created []orderCreated
+	var wildcard []string
+	var fallback []string
+	router := kinesis.NewRouter(kinesis.HeaderEventType("type")).
+		HandleJSON("order.created",
+			func() interface{} { return &orderCreated{} },
+			func(ctx context.Context, record kinesis.Record, event interface{}) error {
+				created = append(created, *event.(*orderCreated))
+				return nil
+			}).
+		HandleFunc("order.*", func(ctx context.Context, record kinesis.Record) error {
+			wildcard = append(wildcard, record.SequenceNumber)
+			return nil
+		}).
+		Fallback(&singleHandlerCreator{handler: func(ctx context.Context, record kinesis.Record) error {
+			fallback = append(fallback, record.SequenceNumber)
+			return nil
+		}})
+	checkpointer := recordProcessorCheckPointer{}
+	input := newProcessRecordsInput(&checkpointer, "1", "2", "3")
+	input.Records[0].Data = []byte(`{"headers": {"type": "order.created"}, "payload": {"id": "o-1"}}`)
+	input.Records[1].Data = []byte(`{"headers": {"type": "order.cancelled"}, "payload": {"id": "o-2"}}`)
+	input.Records[2].Data = []byte(`{"headers": {"type": "user.created"}, "payload": {"id": "u-1"}}`)
+
+	recordProcessor := kinesis.NewRecordProcessorFactory(router).CreateProcessor()
+	recordProcessor.ProcessRecords(input)
+
+	assert.Equal(t, []orderCreated{{ID: "o-1"}}, created)
+	assert.Equal(t, []string{"2"}, wildcard)
+	assert.Equal(t, []string{"3"}, fallback)
+	assert.Equal(t, []string{"3"}, checkpointer.checkpoints)
+}
+
+func TestRouterDecodesEnvelopeOnce(t *testing.T) {
+	var first, second, replaced kinesis.Envelope
+	router := kinesis.NewRouter(kinesis.HeaderEventType("type")).
+		HandleFunc("order.created", func(ctx context.Context, record kinesis.Record) error {
+			first, _ = record.Envelope()
+			second, _ = record.Envelope()
+			record.Data = []byte(`{"headers": {"type": "order.updated"}}`)
+			replaced, _ = record.Envelope()
+			return nil
+		})
+	checkpointer := recordProcessorCheckPointer{}
+	input := newProcessRecordsInput(&checkpointer, "1")
+	input.Records[0].Data = []byte(`{"headers": {"type": "order.created"}, "payload": {"id": "o-1"}}`)
+
+	recordProcessor := kinesis.NewRecordProcessorFactory(router).CreateProcessor()
+	recordProcessor.ProcessRecords(input)
+
+	assert.Equal(t, "order.created", first.Headers["type"])
+	assert.Equal(t, reflect.ValueOf(first.Headers).Pointer(), reflect.ValueOf(second.Headers).Pointer())
+	assert.Equal(t, "order.updated", replaced.Headers["type"])
+}
+
+func TestRouterRoutesByJSONField(t *testing.T) {
+	var routed []string
+	router := kinesis.NewRouter(kinesis.JSONFieldEventType("meta.type")).
+		HandleFunc("payment.settled", func(ctx context.Context, record kinesis.Record) error {
+			routed = append(routed, record.SequenceNumber)
+			return nil
+		})
+	checkpointer := recordProcessorCheckPointer{}
+	input := newProcessRecordsInput(&checkpointer, "1", "2")
+	input.Records[0].Data = []byte(`{"meta": {"type": "payment.settled"}, "amount": 10}`)
+	input.Records[1].Data = []byte(`{"meta": {"type": "payment.refunded"}, "amount": 10}`)
+
+	recordProcessor := kinesis.NewRecordProcessorFactory(router).CreateProcessor()
+	recordProcessor.ProcessRecords(input)
+
+	assert.Equal(t, []string{"1"}, routed)
+}
+
+func TestRouterReportsUnroutableRecords(t *testing.T) {
+	unroutable := make(map[string]error)
+	router := kinesis.NewRouter(kinesis.HeaderEventType("type")).
+		HandleFunc("order.created", func(ctx context.Context, record kinesis.Record) error {
+			return nil
+		}).
+		OnUnroutable(func(ctx context.Context, record kinesis.Record, err error) {
+			unroutable[record.SequenceNumber] = err
+		})
+	checkpointer := recordProcessorCheckPointer{}
+	input := newProcessRecordsInput(&checkpointer, "1", "2")
+	input.Records[0].Data = []byte(`{"headers": {"type": "order.deleted"}, "payload": {}}`)
+	input.Records[1].Data = []byte(`not json`)
+
+	recordProcessor := kinesis.NewRecordProcessorFactory(router).CreateProcessor()
+	recordProcessor.ProcessRecords(input)
+
+	assert.Len(t, unroutable, 2)
+	assert.True(t, errors.Is(unroutable["1"], kinesis.ErrNoRoute))
+	assert.Error(t, unroutable["2"])
+	assert.Equal(t, []string{"2"}, checkpointer.checkpoints)
+}
+
+func TestRouterHandlerOutlivesTimeout(t *testing.T) {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	slow := func(ctx context.Context, record kinesis.Record) error {
+		defer wg.Done()
+		time.Sleep(150 * time.Millisecond)
+		return nil
+	}
+	fast := func(ctx context.Context, record kinesis.Record) error {
+		defer wg.Done()
+		return nil
+	}
+	router := kinesis.NewRouter(kinesis.HeaderEventType("type")).
+		Handle("order.created", &singleHandlerCreator{handler: slow}).
+		Handle("order.cancelled", &singleHandlerCreator{handler: fast})
+	checkpointer := recordProcessorCheckPointer{}
+	input := newProcessRecordsInput(&checkpointer, "1", "2")
+	input.Records[0].Data = []byte(`{"headers": {"type": "order.created"}, "payload": {}}`)
+	input.Records[1].Data = []byte(`{"headers": {"type": "order.cancelled"}, "payload": {}}`)
+
+	recordProcessor := kinesis.NewRecordProcessorFactory(router).
+		WithMiddlewares(kinesis.Timeout(100 * time.Millisecond)).
+		WithQuarantinePolicy(kinesis.QuarantinePolicy{Action: kinesis.QuarantineSkip}).
+		CreateProcessor()
+	recordProcessor.ProcessRecords(input)
+	wg.Wait()
+
+	assert.Equal(t, []string{"2"}, checkpointer.checkpoints)
+}
+
+type singleHandlerCreator struct {
+	handler kinesis.RecordHandlerFunc
+}
+
+// Create returns the handler function of the creator
+func (s *singleHandlerCreator) Create() kinesis.RecordHandler {
+	return s.handler
+}
@@ -0,0 +1,232 @@
+package kinesis
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// ProcessorSettings are the settings of record processors that can change while they run.
+// Processors pick them up before their next batch.
+type ProcessorSettings struct {
+	// BatchSize is the maximum number of records delivered to a batch handler at once,
+	// zero delivers the whole kcl batch.
+	BatchSize int
+	// RecordsPerSecond limits the records delivered to the handlers of all the shards of the factory,
+	// zero means no limit.
+	RecordsPerSecond int
+	// Filters are the filters a record must match to reach the handler, besides the ones set
+	// with RecordProcessorFactory.WithFilters.
+	Filters []RecordFilter
+}
+
+// Validate checks the settings can be applied.
+func (p ProcessorSettings) Validate() error {
+	if p.BatchSize < 0 {
+		return fmt.Errorf("batch size must not be negative, got %d", p.BatchSize)
+	}
+	if p.RecordsPerSecond < 0 {
+		return fmt.Errorf("records per second must not be negative, got %d", p.RecordsPerSecond)
+	}
+	return nil
+}
+
+// PublisherSettings are the settings of a publisher that can change while it runs.
+type PublisherSettings struct {
+	// RecordsPerSecond limits the records published, zero means no limit.
+	RecordsPerSecond int
+}
+
+// liveSettings holds the processor settings shared by the processors of a factory.
+type liveSettings struct {
+	mu       sync.RWMutex
+	settings ProcessorSettings
+	// fixedFilters are the filters set in code, they are kept when the settings change.
+	fixedFilters []RecordFilter
+	filter       RecordFilter
+	rateLimiter  *RateLimiter
+}
+
+// newLiveSettings creates live settings with no batch size, rate limit or filters.
+func newLiveSettings() *liveSettings {
+	newLiveSettings := liveSettings{
+		rateLimiter: NewRateLimiter(0),
+	}
+	return &newLiveSettings
+}
+
+// set replaces the settings.
+func (l *liveSettings) set(settings ProcessorSettings) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.settings = settings
+	l.updateFilter()
+	l.rateLimiter.SetRate(settings.RecordsPerSecond)
+}
+
+// setFixedFilters replaces the filters set in code.
+func (l *liveSettings) setFixedFilters(filters []RecordFilter) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.fixedFilters = filters
+	l.updateFilter()
+}
+
+// updateFilter combines the filters set in code with the ones of the settings.
+func (l *liveSettings) updateFilter() {
+	filters := make([]RecordFilter, 0, len(l.fixedFilters)+len(l.settings.Filters))
+	filters = append(filters, l.fixedFilters...)
+	filters = append(filters, l.settings.Filters...)
+	l.filter = nil
+	if len(filters) > 0 {
+		l.filter = AllOf(filters...)
+	}
+}
+
+// get returns the settings.
+func (l *liveSettings) get() ProcessorSettings {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	settings := l.settings
+	settings.Filters = append([]RecordFilter(nil), l.settings.Filters...)
+	return settings
+}
+
+// batch returns the batch size and the filter of the next batch.
+func (l *liveSettings) batch() (int, RecordFilter) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.settings.BatchSize, l.filter
+}
+
+// UpdateSettings changes the settings of the processors created by the factory, including
+// the ones already running.
+func (r *RecordProcessorFactory) UpdateSettings(settings ProcessorSettings) error {
+	if err := settings.Validate(); err != nil {
+		return err
+	}
+	log.Println("level", "INFO", "msg", "updating record processor settings", "batch_size", settings.BatchSize, "records_per_second", settings.RecordsPerSecond, "filters", len(settings.Filters))
+	r.settings.set(settings)
+	return nil
+}
+
+// Settings returns the current settings of the processors created by the factory, without the
+// filters set with WithFilters.
+func (r *RecordProcessorFactory) Settings() ProcessorSettings {
+	return r.settings.get()
+}
+
+// UpdateSettings changes the settings of the running record processors of every stream.
+func (p *Processor) UpdateSettings(settings ProcessorSettings) error {
+	if err := settings.Validate(); err != nil {
+		return err
+	}
+	factories, err := p.recordProcessorFactories()
+	if err != nil {
+		return err
+	}
+	for _, factory := range factories {
+		if err := factory.UpdateSettings(settings); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// refreshSettings picks up the settings of the factory before a batch.
+func (r *RecordProcessor) refreshSettings() {
+	r.batchSize, r.filter = r.settings.batch()
+}
+
+// batchEnd returns the end of the batch delivered to the batch handler starting at the given record.
+func (r *RecordProcessor) batchEnd(start, size int) int {
+	if r.batchSize <= 0 || start+r.batchSize > size {
+		return size
+	}
+	return start + r.batchSize
+}
+
+// UpdateSettings changes the settings of the publisher while it runs.
+func (c *PublisherClient) UpdateSettings(settings PublisherSettings) error {
+	if settings.RecordsPerSecond < 0 {
+		return fmt.Errorf("records per second must not be negative, got %d", settings.RecordsPerSecond)
+	}
+	log.Println("level", "INFO", "msg", "updating publisher settings", "records_per_second", settings.RecordsPerSecond)
+	c.rateLimiter.SetRate(settings.RecordsPerSecond)
+	return nil
+}
+
+// Settings returns the current settings of the publisher.
+func (c *PublisherClient) Settings() PublisherSettings {
+	return PublisherSettings{
+		RecordsPerSecond: c.rateLimiter.Rate(),
+	}
+}
+
+// RateLimiter spaces out records so no more than the given rate go through per second.
+// Its rate can change while it is used.
+type RateLimiter struct {
+	mu   sync.Mutex
+	rate int
+	next time.Time
+}
+
+// NewRateLimiter creates a rate limiter of the given records per second, zero means no limit.
+func NewRateLimiter(rate int) *RateLimiter {
+	newRateLimiter := RateLimiter{
+		rate: rate,
+	}
+	return &newRateLimiter
+}
+
+// SetRate changes the records per second, zero removes the limit.
+func (l *RateLimiter) SetRate(rate int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if rate < 0 {
+		rate = 0
+	}
+	l.rate = rate
+	l.next = time.Time{}
+}
+
+// Rate returns the records per second, zero when there is no limit.
+func (l *RateLimiter) Rate() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rate
+}
+
+// Wait blocks until the given number of records can go through or the context is done.
+func (l *RateLimiter) Wait(ctx context.Context, records int) error {
+	delay := l.reserve(records)
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// reserve books the time of the records and returns how long to wait for it.
+func (l *RateLimiter) reserve(records int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.rate <= 0 || records <= 0 {
+		return 0
+	}
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	start := l.next
+	l.next = l.next.Add(time.Duration(records) * time.Second / time.Duration(l.rate))
+	return start.Sub(now)
+}
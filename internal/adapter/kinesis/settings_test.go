@@ -0,0 +1,103 @@
+package kinesis_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/fernandoocampo/pubsub-kinesis/internal/adapter/kinesis"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdateSettingsAppliesToRunningProcessors(t *testing.T) {
+	batchHandlerCreator := &batchHandlerCreatorMock{}
+	recordProcessorFactory := kinesis.NewBatchRecordProcessorFactory(batchHandlerCreator)
+	checkpointer := recordProcessorCheckPointer{}
+	recordProcessor := recordProcessorFactory.CreateProcessor()
+
+	recordProcessor.ProcessRecords(newProcessRecordsInput(&checkpointer, "1", "2", "3"))
+	err := recordProcessorFactory.UpdateSettings(kinesis.ProcessorSettings{BatchSize: 2})
+	assert.NoError(t, err)
+	recordProcessor.ProcessRecords(newProcessRecordsInput(&checkpointer, "4", "5", "6"))
+
+	assert.Len(t, batchHandlerCreator.handler.batches, 3)
+	assert.Equal(t, []string{"1", "2", "3"}, sequenceNumbers(batchHandlerCreator.handler.batches[0]))
+	assert.Equal(t, []string{"4", "5"}, sequenceNumbers(batchHandlerCreator.handler.batches[1]))
+	assert.Equal(t, []string{"6"}, sequenceNumbers(batchHandlerCreator.handler.batches[2]))
+	assert.Equal(t, []string{"3", "5", "6"}, checkpointer.checkpoints)
+	assert.Equal(t, 2, recordProcessorFactory.Settings().BatchSize)
+}
+
+func TestUpdateSettingsChangesFilters(t *testing.T) {
+	batchHandlerCreator := &batchHandlerCreatorMock{}
+	recordProcessorFactory := kinesis.NewBatchRecordProcessorFactory(batchHandlerCreator)
+	checkpointer := recordProcessorCheckPointer{}
+	recordProcessor := recordProcessorFactory.CreateProcessor()
+	filter, err := kinesis.ParseFilter(`$.key != "2"`)
+	assert.NoError(t, err)
+
+	err = recordProcessorFactory.UpdateSettings(kinesis.ProcessorSettings{Filters: []kinesis.RecordFilter{filter}})
+	assert.NoError(t, err)
+	recordProcessor.ProcessRecords(newProcessRecordsInput(&checkpointer, "1", "2", "3"))
+
+	assert.Len(t, batchHandlerCreator.handler.batches, 1)
+	assert.Equal(t, []string{"1", "3"}, sequenceNumbers(batchHandlerCreator.handler.batches[0]))
+	assert.Equal(t, []string{"3"}, checkpointer.checkpoints)
+}
+
+func TestUpdateSettingsKeepsFiltersSetInCode(t *testing.T) {
+	batchHandlerCreator := &batchHandlerCreatorMock{}
+	recordProcessorFactory := kinesis.NewBatchRecordProcessorFactory(batchHandlerCreator).
+		WithFilters(kinesis.Not(kinesis.JSONFieldEquals("key", "2")))
+	checkpointer := recordProcessorCheckPointer{}
+	recordProcessor := recordProcessorFactory.CreateProcessor()
+	filter, err := kinesis.ParseFilter(`$.key != "3"`)
+	assert.NoError(t, err)
+
+	err = recordProcessorFactory.UpdateSettings(kinesis.ProcessorSettings{Filters: []kinesis.RecordFilter{filter}})
+	assert.NoError(t, err)
+	recordProcessor.ProcessRecords(newProcessRecordsInput(&checkpointer, "1", "2", "3", "4"))
+	err = recordProcessorFactory.UpdateSettings(kinesis.ProcessorSettings{})
+	assert.NoError(t, err)
+	recordProcessor.ProcessRecords(newProcessRecordsInput(&checkpointer, "2", "3"))
+
+	assert.Equal(t, [][]string{{"1", "4"}, {"3"}}, batchSequenceNumbers(batchHandlerCreator.handler.batches))
+	assert.Empty(t, recordProcessorFactory.Settings().Filters)
+}
+
+func TestUpdateSettingsRejectsInvalidSettings(t *testing.T) {
+	recordProcessorFactory := kinesis.NewBatchRecordProcessorFactory(&batchHandlerCreatorMock{})
+	publisher := kinesis.NewClient("orders", &awsKinesisMock{})
+
+	assert.Error(t, recordProcessorFactory.UpdateSettings(kinesis.ProcessorSettings{BatchSize: -1}))
+	assert.Error(t, recordProcessorFactory.UpdateSettings(kinesis.ProcessorSettings{RecordsPerSecond: -1}))
+	assert.Error(t, publisher.UpdateSettings(kinesis.PublisherSettings{RecordsPerSecond: -1}))
+	assert.NoError(t, publisher.UpdateSettings(kinesis.PublisherSettings{RecordsPerSecond: 100}))
+	assert.Equal(t, 100, publisher.Settings().RecordsPerSecond)
+}
+
+func TestRateLimiterSpacesOutRecords(t *testing.T) {
+	rateLimiter := kinesis.NewRateLimiter(20)
+	ctx := context.Background()
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, rateLimiter.Wait(ctx, 1))
+	}
+
+	assert.GreaterOrEqual(t, int64(time.Since(start)), int64(90*time.Millisecond))
+
+	rateLimiter.SetRate(0)
+	start = time.Now()
+	assert.NoError(t, rateLimiter.Wait(ctx, 1000))
+	assert.Less(t, int64(time.Since(start)), int64(10*time.Millisecond))
+}
+
+func TestRateLimiterStopsWaitingWhenContextIsDone(t *testing.T) {
+	rateLimiter := kinesis.NewRateLimiter(1)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	assert.NoError(t, rateLimiter.Wait(ctx, 1))
+	assert.Error(t, rateLimiter.Wait(ctx, 1))
+}
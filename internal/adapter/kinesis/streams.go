@@ -0,0 +1,177 @@
+package kinesis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// StreamBinding binds a stream to the handlers that process its records.
+type StreamBinding struct {
+	// StreamName is the name of the stream to read.
+	StreamName string
+	// HandlerCreator creates the handlers of the records of the stream. It is ignored
+	// when RecordProcessorFactory is set.
+	HandlerCreator HandlerCreator
+	// RecordProcessorFactory creates the record processors of the stream, use it to set
+	// any option of the processors, like record or batch handlers, filters or middlewares.
+	RecordProcessorFactory *RecordProcessorFactory
+	// InitialPosition is where the stream is read from when its shards have no checkpoint.
+	// By default the one of the kcl configuration.
+	InitialPosition InitialPosition
+	// InitialTimestamp is the arrival time to start reading from when InitialPosition is AT_TIMESTAMP.
+	InitialTimestamp *time.Time
+	// ApplicationName is the kcl application of the stream, by default the application name of
+	// the kcl configuration followed by the stream name.
+	ApplicationName string
+	// TableName is the lease table of the stream, by default its application name.
+	TableName string
+}
+
+// StreamHealth is the health of the kcl worker of a stream.
+type StreamHealth struct {
+	StreamName string
+	// Running is true when the kcl worker of the stream is started.
+	Running bool
+	// Shards is the number of shards the worker is processing.
+	Shards int
+	// MillisBehindLatest is the highest lag among the shards of the stream.
+	MillisBehindLatest int64
+}
+
+// ProcessorHealth is the aggregated health of the streams of a processor.
+type ProcessorHealth struct {
+	State   WorkerState
+	Streams []StreamHealth
+	// Healthy is true when the processor is running and so are all its streams.
+	Healthy bool
+}
+
+// ErrProcessorUnhealthy is returned by Check when the processor or any of its streams is not running.
+var ErrProcessorUnhealthy = errors.New("kinesis processor is not healthy")
+
+// ErrUnknownStream is returned when an operation names a stream the processor doesn't read.
+var ErrUnknownStream = errors.New("unknown stream")
+
+// ErrSeveralStreams is returned by Lag when the processor reads several streams, see StreamLag.
+var ErrSeveralStreams = errors.New("kinesis processor reads several streams")
+
+// NewStreamsProcessor creates a processor that reads several streams, each one with its own kcl worker
+// and lease table created from the given configuration and the stream bindings. The worker factories
+// of every stream are created with the given options, e.g. to set their clients or checkpointers.
+func NewStreamsProcessor(configuration KCLConfiguration, bindings []StreamBinding, options ...WorkerFactoryOption) (*Processor, error) {
+	log.Println("level", "INFO", "method", "kinesis.NewStreamsProcessor", "msg", "creating kinesis procesor", "streams", len(bindings))
+	if len(bindings) == 0 {
+		return nil, errors.New("at least one stream binding is required")
+	}
+	if replay := configuration.Replay; replay != nil && len(bindings) > 1 && (replay.ApplicationName != "" || replay.TableName != "") {
+		return nil, errors.New("replay application and table names can't be shared by several streams, set the application names of the bindings instead")
+	}
+
+	newProcessor := Processor{
+		gracePeriod: DefaultGracePeriod,
+	}
+	streamNames := make(map[string]bool)
+	tableNames := make(map[string]string)
+	for _, binding := range bindings {
+		if binding.StreamName == "" {
+			return nil, errors.New("stream name of stream binding is required")
+		}
+		if streamNames[binding.StreamName] {
+			return nil, fmt.Errorf("stream %q is bound more than once", binding.StreamName)
+		}
+		streamNames[binding.StreamName] = true
+
+		recordProcessorFactory := binding.RecordProcessorFactory
+		if recordProcessorFactory == nil {
+			if binding.HandlerCreator == nil {
+				return nil, fmt.Errorf("stream %q has no handler creator", binding.StreamName)
+			}
+			recordProcessorFactory = NewRecordProcessorFactory(binding.HandlerCreator)
+		}
+
+		workerFactory, err := NewKCLWorkerFactory(binding.kclConfiguration(configuration), options...)
+		if err != nil {
+			return nil, fmt.Errorf("stream %q: %w", binding.StreamName, err)
+		}
+		tableName := workerFactory.kinesisClientLibConf.TableName
+		if other, ok := tableNames[tableName]; ok {
+			return nil, fmt.Errorf("streams %q and %q use the same lease table %q", other, binding.StreamName, tableName)
+		}
+		tableNames[tableName] = binding.StreamName
+
+		newProcessor.WithStream(binding.StreamName, workerFactory.NewWorker(recordProcessorFactory), recordProcessorFactory)
+	}
+
+	return &newProcessor, nil
+}
+
+// kclConfiguration returns the kcl configuration of the stream based on the given one.
+func (s StreamBinding) kclConfiguration(configuration KCLConfiguration) KCLConfiguration {
+	configuration.StreamName = s.StreamName
+	if s.ApplicationName != "" {
+		configuration.ApplicationName = s.ApplicationName
+	} else {
+		configuration.ApplicationName = configuration.ApplicationName + "-" + s.StreamName
+	}
+	configuration.TableName = s.TableName
+	if s.InitialPosition != "" {
+		configuration.InitialPosition = s.InitialPosition
+		configuration.InitialTimestamp = s.InitialTimestamp
+	}
+	return configuration
+}
+
+// WithStream adds the kcl worker of a stream to the processor, so it is started and stopped
+// with the other streams of the processor.
+func (p *Processor) WithStream(streamName string, kclWorker KCLWorker, recordProcessorFactory *RecordProcessorFactory) *Processor {
+	p.streams = append(p.streams, &streamWorker{
+		streamName:             streamName,
+		kclWorker:              kclWorker,
+		recordProcessorFactory: recordProcessorFactory,
+	})
+	return p
+}
+
+// Health returns the aggregated health of the streams of the processor.
+func (p *Processor) Health() ProcessorHealth {
+	p.mu.Lock()
+	health := ProcessorHealth{
+		State:   p.state,
+		Streams: make([]StreamHealth, 0, len(p.streams)),
+		Healthy: p.state == WorkerRunning,
+	}
+	for _, stream := range p.streams {
+		health.Streams = append(health.Streams, StreamHealth{
+			StreamName: stream.streamName,
+			Running:    stream.started,
+		})
+		health.Healthy = health.Healthy && stream.started
+	}
+	p.mu.Unlock()
+
+	for i, stream := range p.streams {
+		if stream.recordProcessorFactory == nil {
+			continue
+		}
+		lag := stream.recordProcessorFactory.lagTracker.Snapshot()
+		health.Streams[i].Shards = len(lag)
+		for _, shardLag := range lag {
+			if shardLag.MillisBehindLatest > health.Streams[i].MillisBehindLatest {
+				health.Streams[i].MillisBehindLatest = shardLag.MillisBehindLatest
+			}
+		}
+	}
+	return health
+}
+
+// Check returns ErrProcessorUnhealthy if the processor or any of its streams is not running,
+// so the processor can be used as a health check.
+func (p *Processor) Check(ctx context.Context) error {
+	if !p.Health().Healthy {
+		return ErrProcessorUnhealthy
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+package kinesis_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fernandoocampo/pubsub-kinesis/internal/adapter/kinesis"
+	"github.com/stretchr/testify/assert"
+	"github.com/vmware/vmware-go-kcl/clientlibrary/checkpoint"
+	"github.com/vmware/vmware-go-kcl/clientlibrary/config"
+)
+
+func TestStreamsAreStartedAndStoppedTogether(t *testing.T) {
+	ordersCheckpointer := &recordProcessorCheckPointer{}
+	ordersFactory := kinesis.NewRecordHandlerProcessorFactory(&slowHandlerCreatorMock{})
+	ordersWorker := newRunningKCLWorkerMock(ordersFactory, ordersCheckpointer)
+	paymentsCheckpointer := &recordProcessorCheckPointer{}
+	paymentsFactory := kinesis.NewRecordHandlerProcessorFactory(&slowHandlerCreatorMock{})
+	paymentsWorker := newRunningKCLWorkerMock(paymentsFactory, paymentsCheckpointer)
+	processor := kinesis.NewProcessor(ordersWorker).
+		WithRecordProcessorFactory(ordersFactory).
+		WithStream("payments", paymentsWorker, paymentsFactory)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	errs := make(chan error)
+	go func() {
+		errs <- processor.Run(ctx)
+	}()
+	<-ordersWorker.processing
+	<-paymentsWorker.processing
+	health := processor.Health()
+	cancel()
+	err := <-errs
+
+	assert.NoError(t, err)
+	assert.True(t, health.Healthy)
+	assert.Equal(t, kinesis.WorkerRunning, health.State)
+	assert.Len(t, health.Streams, 2)
+	assert.Equal(t, "payments", health.Streams[1].StreamName)
+	assert.True(t, health.Streams[1].Running)
+	assert.Equal(t, []string{"1"}, ordersCheckpointer.checkpoints)
+	assert.Equal(t, []string{"1"}, paymentsCheckpointer.checkpoints)
+	assert.False(t, processor.Health().Healthy)
+	assert.Equal(t, kinesis.ErrProcessorUnhealthy, processor.Check(context.Background()))
+}
+
+func TestStartedStreamsAreStoppedWhenOneFails(t *testing.T) {
+	ordersFactory := kinesis.NewRecordHandlerProcessorFactory(&slowHandlerCreatorMock{})
+	ordersWorker := newRunningKCLWorkerMock(ordersFactory, &recordProcessorCheckPointer{})
+	processor := kinesis.NewProcessor(ordersWorker).
+		WithRecordProcessorFactory(ordersFactory).
+		WithStream("payments", &failingKCLWorkerMock{}, nil)
+
+	err := processor.Run(context.Background())
+
+	assert.Error(t, err)
+	assert.Equal(t, kinesis.WorkerStopped, processor.State())
+	assert.False(t, processor.Health().Streams[0].Running)
+}
+
+func TestPauseAppliesToAllStreams(t *testing.T) {
+	ordersFactory := kinesis.NewRecordHandlerProcessorFactory(&recordHandlerCreatorMock{})
+	paymentsFactory := kinesis.NewRecordHandlerProcessorFactory(&recordHandlerCreatorMock{})
+	processor := kinesis.NewProcessor(&kclWorkerMock{}).
+		WithRecordProcessorFactory(ordersFactory).
+		WithStream("payments", &kclWorkerMock{}, paymentsFactory)
+
+	err := processor.Pause()
+
+	assert.NoError(t, err)
+	assert.True(t, ordersFactory.FlowControl().IsPaused("shardId-000000000001"))
+	assert.True(t, paymentsFactory.FlowControl().IsPaused("shardId-000000000001"))
+}
+
+func TestNewStreamsProcessorValidatesBindings(t *testing.T) {
+	configuration := newKCLConfiguration()
+	cases := map[string][]kinesis.StreamBinding{
+		"no_bindings": nil,
+		"no_stream_name": {
+			{HandlerCreator: &handlerCreatorMock{}},
+		},
+		"no_handler": {
+			{StreamName: "orders"},
+		},
+		"duplicated_stream": {
+			{StreamName: "orders", HandlerCreator: &handlerCreatorMock{}},
+			{StreamName: "orders", HandlerCreator: &handlerCreatorMock{}},
+		},
+		"shared_lease_table": {
+			{StreamName: "orders", HandlerCreator: &handlerCreatorMock{}, TableName: "leases"},
+			{StreamName: "payments", HandlerCreator: &handlerCreatorMock{}, TableName: "leases"},
+		},
+	}
+
+	for name, bindings := range cases {
+		t.Run(name, func(st *testing.T) {
+			processor, err := kinesis.NewStreamsProcessor(configuration, bindings)
+
+			assert.Error(st, err)
+			assert.Nil(st, processor)
+		})
+	}
+}
+
+func TestNewStreamsProcessor(t *testing.T) {
+	processor, err := kinesis.NewStreamsProcessor(
+		newKCLConfiguration(),
+		[]kinesis.StreamBinding{
+			{StreamName: "orders", HandlerCreator: &handlerCreatorMock{}},
+			{StreamName: "payments", HandlerCreator: &handlerCreatorMock{}, InitialPosition: kinesis.InitialPositionTrimHorizon},
+		},
+	)
+
+	assert.NoError(t, err)
+	health := processor.Health()
+	assert.Equal(t, kinesis.WorkerStopped, health.State)
+	assert.Equal(t, "orders", health.Streams[0].StreamName)
+	assert.Equal(t, "payments", health.Streams[1].StreamName)
+}
+
+func TestNewStreamsProcessorAppliesWorkerFactoryOptions(t *testing.T) {
+	var tableNames []string
+	checkpointers := func(kclConfig *config.KinesisClientLibConfiguration) checkpoint.Checkpointer {
+		tableNames = append(tableNames, kclConfig.TableName)
+		return newLeaseCheckpointerMock()
+	}
+
+	_, err := kinesis.NewStreamsProcessor(
+		newKCLConfiguration(),
+		[]kinesis.StreamBinding{
+			{StreamName: "orders", HandlerCreator: &handlerCreatorMock{}},
+			{StreamName: "payments", HandlerCreator: &handlerCreatorMock{}},
+		},
+		kinesis.WithCheckpointerFactory(checkpointers),
+	)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"orders-consumer-orders", "orders-consumer-payments"}, tableNames)
+}
+
+func TestNewStreamsProcessorRejectsSharedReplayNames(t *testing.T) {
+	bindings := []kinesis.StreamBinding{
+		{StreamName: "orders", HandlerCreator: &handlerCreatorMock{}},
+		{StreamName: "payments", HandlerCreator: &handlerCreatorMock{}},
+	}
+	configuration := newKCLConfiguration()
+	configuration.Replay = &kinesis.ReplayConfiguration{
+		From:            time.Date(2021, 5, 1, 12, 0, 0, 0, time.UTC),
+		ApplicationName: "orders-consumer-replay",
+	}
+
+	processor, err := kinesis.NewStreamsProcessor(configuration, bindings)
+
+	assert.EqualError(t, err, "replay application and table names can't be shared by several streams, set the application names of the bindings instead")
+	assert.Nil(t, processor)
+
+	configuration.Replay.ApplicationName = ""
+	processor, err = kinesis.NewStreamsProcessor(configuration, bindings)
+
+	assert.NoError(t, err)
+	assert.NotNil(t, processor)
+}
+
+func TestPauseStreamShardAppliesToOneStream(t *testing.T) {
+	ordersFactory := kinesis.NewRecordHandlerProcessorFactory(&recordHandlerCreatorMock{})
+	paymentsFactory := kinesis.NewRecordHandlerProcessorFactory(&recordHandlerCreatorMock{})
+	processor := kinesis.NewProcessor(&kclWorkerMock{}).
+		WithRecordProcessorFactory(ordersFactory).
+		WithStream("payments", &kclWorkerMock{}, paymentsFactory)
+
+	err := processor.PauseStreamShard("payments", "shardId-000000000001")
+
+	assert.NoError(t, err)
+	assert.False(t, ordersFactory.FlowControl().IsPaused("shardId-000000000001"))
+	assert.True(t, paymentsFactory.FlowControl().IsPaused("shardId-000000000001"))
+
+	err = processor.ResumeStreamShard("payments", "shardId-000000000001")
+
+	assert.NoError(t, err)
+	assert.False(t, paymentsFactory.FlowControl().IsPaused("shardId-000000000001"))
+
+	err = processor.PauseStreamShard("invoices", "shardId-000000000001")
+
+	assert.True(t, errors.Is(err, kinesis.ErrUnknownStream))
+}
+
+func TestStreamLagIsKeyedByStream(t *testing.T) {
+	ordersFactory := kinesis.NewRecordHandlerProcessorFactory(&recordHandlerCreatorMock{})
+	paymentsFactory := kinesis.NewRecordHandlerProcessorFactory(&recordHandlerCreatorMock{})
+	processor := kinesis.NewProcessor(&kclWorkerMock{}).
+		WithRecordProcessorFactory(ordersFactory).
+		WithStream("payments", &kclWorkerMock{}, paymentsFactory)
+	checkpointer := recordProcessorCheckPointer{}
+	recordProcessor := paymentsFactory.CreateProcessor()
+	initializeRecordProcessor(recordProcessor, "")
+	input := newProcessRecordsInput(&checkpointer, "1")
+	input.MillisBehindLatest = 1000
+	recordProcessor.ProcessRecords(input)
+
+	lag, err := processor.StreamLag()
+
+	assert.NoError(t, err)
+	assert.Empty(t, lag[""])
+	assert.Equal(t, int64(1000), lag["payments"]["shardId-000000000001"].MillisBehindLatest)
+
+	_, err = processor.Lag()
+
+	assert.Equal(t, kinesis.ErrSeveralStreams, err)
+}
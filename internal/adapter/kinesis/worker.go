@@ -1,8 +1,18 @@
 package kinesis
 
 import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/aws/aws-sdk-go/service/kinesis/kinesisiface"
+	"github.com/vmware/vmware-go-kcl/clientlibrary/checkpoint"
 	"github.com/vmware/vmware-go-kcl/clientlibrary/config"
 	"github.com/vmware/vmware-go-kcl/clientlibrary/interfaces"
+	partition "github.com/vmware/vmware-go-kcl/clientlibrary/partition"
 	kclworker "github.com/vmware/vmware-go-kcl/clientlibrary/worker"
 )
 
@@ -12,31 +22,294 @@ type KCLWorker interface {
 	Shutdown()
 }
 
+// LeaseTableProvisioner creates or reconciles the lease table of a worker before it starts,
+// e.g. the one of dynamodb.Client.LeaseTableProvisioner.
+type LeaseTableProvisioner func(ctx context.Context, tableName string) error
+
+// CheckpointerFactory creates the checkpointer that keeps the leases and checkpoints of a worker,
+// e.g. the one of checkpointstore.CheckpointerFactory.
+type CheckpointerFactory func(kclConfig *config.KinesisClientLibConfiguration) checkpoint.Checkpointer
+
 // StandardKCLWorkerFactory it is the standard procedure to create a KCL workers/
 type StandardKCLWorkerFactory struct {
 	kinesisClientLibConf *config.KinesisClientLibConfiguration
+	replay               *ReplayConfiguration
+	provisioner          LeaseTableProvisioner
+	checkpointers        CheckpointerFactory
+	kinesisClient        kinesisiface.KinesisAPI
+	dynamoDBClient       dynamodbiface.DynamoDBAPI
+}
+
+// WorkerFactoryOption sets an option of a kcl worker factory, like the With methods of StandardKCLWorkerFactory.
+type WorkerFactoryOption func(workerFactory *StandardKCLWorkerFactory)
+
+// WithLeaseTableProvisioner is the option of StandardKCLWorkerFactory.WithLeaseTableProvisioner.
+func WithLeaseTableProvisioner(provisioner LeaseTableProvisioner) WorkerFactoryOption {
+	return func(workerFactory *StandardKCLWorkerFactory) {
+		workerFactory.WithLeaseTableProvisioner(provisioner)
+	}
+}
+
+// WithCheckpointerFactory is the option of StandardKCLWorkerFactory.WithCheckpointerFactory.
+func WithCheckpointerFactory(checkpointers CheckpointerFactory) WorkerFactoryOption {
+	return func(workerFactory *StandardKCLWorkerFactory) {
+		workerFactory.WithCheckpointerFactory(checkpointers)
+	}
 }
 
-// NewKCLWorkerFactory create a new KCL worker factory
-func NewKCLWorkerFactory(configuration KCLConfiguration) *StandardKCLWorkerFactory {
+// WithKinesisClient is the option of StandardKCLWorkerFactory.WithKinesisClient.
+func WithKinesisClient(kinesisClient kinesisiface.KinesisAPI) WorkerFactoryOption {
+	return func(workerFactory *StandardKCLWorkerFactory) {
+		workerFactory.WithKinesisClient(kinesisClient)
+	}
+}
+
+// WithDynamoDBClient is the option of StandardKCLWorkerFactory.WithDynamoDBClient.
+func WithDynamoDBClient(dynamoDBClient dynamodbiface.DynamoDBAPI) WorkerFactoryOption {
+	return func(workerFactory *StandardKCLWorkerFactory) {
+		workerFactory.WithDynamoDBClient(dynamoDBClient)
+	}
+}
+
+// NewKCLWorkerFactory create a new KCL worker factory with the given options, it fails if the configuration is not valid.
+func NewKCLWorkerFactory(configuration KCLConfiguration, options ...WorkerFactoryOption) (*StandardKCLWorkerFactory, error) {
+	if err := configuration.Validate(); err != nil {
+		log.Println("level", "ERROR", "msg", "invalid kcl configuration", "error", err)
+		return nil, err
+	}
+	applicationName, tableName := configuration.applicationNames()
 	kclLibConf := config.NewKinesisClientLibConfigWithCredentials(
-		configuration.ApplicationName,
+		applicationName,
 		configuration.StreamName,
 		configuration.RegionName,
 		configuration.WorkerID,
 		configuration.KinesisCredentials,
 		configuration.DynamoDBCredentials,
 	)
-	if configuration.TableName != "" {
-		kclLibConf.WithTableName(configuration.TableName)
+	if tableName != "" {
+		kclLibConf.WithTableName(tableName)
+	}
+	if configuration.KinesisEndpoint != "" {
+		kclLibConf.WithKinesisEndpoint(configuration.KinesisEndpoint)
+	}
+	if configuration.DynamoDBEndpoint != "" {
+		kclLibConf.WithDynamoDBEndpoint(configuration.DynamoDBEndpoint)
+	}
+	configuration.applyTuning(kclLibConf)
+	configuration.applyInitialPosition(kclLibConf)
+	configuration.applyEnhancedFanOut(kclLibConf)
+	if configuration.Replay != nil {
+		log.Println("level", "INFO", "msg", "creating replay KCL worker factory", "application", applicationName, "table", kclLibConf.TableName, "from", configuration.Replay.From, "to", configuration.Replay.To)
 	}
 	kclworkerFactory := StandardKCLWorkerFactory{
 		kinesisClientLibConf: kclLibConf,
+		replay:               configuration.Replay,
+	}
+	for _, option := range options {
+		option(&kclworkerFactory)
 	}
-	return &kclworkerFactory
+	return &kclworkerFactory, nil
+}
+
+// KinesisClientLibConfiguration returns a copy of the kcl configuration used to create workers.
+func (s *StandardKCLWorkerFactory) KinesisClientLibConfiguration() config.KinesisClientLibConfiguration {
+	return *s.kinesisClientLibConf
+}
+
+// WithLeaseTableProvisioner sets how the lease table is provisioned when workers start, otherwise
+// kcl creates it with the initial lease table capacities if it doesn't exist.
+func (s *StandardKCLWorkerFactory) WithLeaseTableProvisioner(provisioner LeaseTableProvisioner) *StandardKCLWorkerFactory {
+	s.provisioner = provisioner
+	return s
+}
+
+// WithCheckpointerFactory sets how the checkpointers of workers are created, otherwise they keep
+// the leases and checkpoints in the dynamodb lease table.
+func (s *StandardKCLWorkerFactory) WithCheckpointerFactory(checkpointers CheckpointerFactory) *StandardKCLWorkerFactory {
+	s.checkpointers = checkpointers
+	return s
+}
+
+// WithKinesisClient sets the kinesis client of the workers, e.g. one created with aws.NewKinesisSession
+// to use its http and retry settings. Otherwise kcl creates a client with the sdk defaults.
+func (s *StandardKCLWorkerFactory) WithKinesisClient(kinesisClient kinesisiface.KinesisAPI) *StandardKCLWorkerFactory {
+	s.kinesisClient = kinesisClient
+	return s
+}
+
+// WithDynamoDBClient sets the dynamodb client of the lease tables of the workers, e.g. one created with
+// aws.NewDynamoDBSession to use its http and retry settings. Otherwise kcl creates a client with the sdk
+// defaults. It is not used by the checkpointers of WithCheckpointerFactory.
+func (s *StandardKCLWorkerFactory) WithDynamoDBClient(dynamoDBClient dynamodbiface.DynamoDBAPI) *StandardKCLWorkerFactory {
+	s.dynamoDBClient = dynamoDBClient
+	return s
 }
 
 // NewWorker create a new worker based on kcl worker factory.
+// When the factory is a *RecordProcessorFactory its paused processors are able to keep their leases.
 func (s *StandardKCLWorkerFactory) NewWorker(factory interfaces.IRecordProcessorFactory) *kclworker.Worker {
-	return kclworker.NewWorker(factory, s.kinesisClientLibConf)
+	var checkpointer checkpoint.Checkpointer
+	if s.checkpointers != nil {
+		checkpointer = s.checkpointers(s.kinesisClientLibConf)
+	} else {
+		dynamoCheckpoint := checkpoint.NewDynamoCheckpoint(s.kinesisClientLibConf)
+		if s.dynamoDBClient != nil {
+			dynamoCheckpoint.WithDynamoDB(s.dynamoDBClient)
+		}
+		checkpointer = dynamoCheckpoint
+	}
+	leases := newLeaseKeeper(checkpointer, s.kinesisClientLibConf.WorkerID)
+	if s.provisioner != nil {
+		leases.provisioner = s.provisioner
+		leases.tableName = s.kinesisClientLibConf.TableName
+	}
+	if recordProcessorFactory, ok := factory.(*RecordProcessorFactory); ok {
+		renewInterval := time.Duration(s.kinesisClientLibConf.LeaseRefreshPeriodMillis) * time.Millisecond
+		recordProcessorFactory.WithLeaseRenewer(leases, renewInterval)
+		if s.replay != nil && !s.replay.To.IsZero() {
+			recordProcessorFactory.WithReplayWindow(s.replay.To)
+			recordProcessorFactory.replayTable = s.kinesisClientLibConf.TableName
+		}
+	}
+	worker := kclworker.NewWorker(factory, s.kinesisClientLibConf).WithCheckpointer(leases)
+	if s.kinesisClient != nil {
+		worker.WithKinesis(s.kinesisClient)
+	}
+	return worker
+}
+
+// leaseTableProvisionTimeout bounds the provisioning of the lease table when a worker starts,
+// e.g. while waiting for a new table to be active.
+const leaseTableProvisionTimeout = 5 * time.Minute
+
+// errUnknownShard is returned when a lease is renewed for a shard the worker never leased.
+var errUnknownShard = errors.New("shard was not leased by this worker")
+
+// errWorkerDraining is returned when a draining worker is asked to claim a shard.
+var errWorkerDraining = errors.New("worker is draining its leases")
+
+// leaseKeeper is a kcl checkpointer that keeps track of the shards leased by the worker,
+// so their leases can be renewed while their record processors are paused, and drained.
+type leaseKeeper struct {
+	checkpoint.Checkpointer
+	workerID string
+	mu       sync.Mutex
+	shards   map[string]*partition.ShardStatus
+	draining bool
+	drained  chan struct{}
+	// provisioner provisions the lease table named tableName when the worker starts.
+	provisioner LeaseTableProvisioner
+	tableName   string
+}
+
+// newLeaseKeeper wraps the given checkpointer.
+func newLeaseKeeper(checkpointer checkpoint.Checkpointer, workerID string) *leaseKeeper {
+	newLeaseKeeper := leaseKeeper{
+		Checkpointer: checkpointer,
+		workerID:     workerID,
+		shards:       make(map[string]*partition.ShardStatus),
+		drained:      make(chan struct{}),
+	}
+	return &newLeaseKeeper
+}
+
+// Init provisions the lease table, if there is a provisioner, and initializes the checkpointer.
+// The table exists by then, so kcl doesn't create it.
+func (l *leaseKeeper) Init() error {
+	if l.provisioner != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), leaseTableProvisionTimeout)
+		defer cancel()
+		if err := l.provisioner(ctx, l.tableName); err != nil {
+			log.Println("level", "ERROR", "msg", "lease table could not be provisioned", "table", l.tableName, "error", err)
+			return err
+		}
+	}
+	return l.Checkpointer.Init()
+}
+
+// GetLease attempts to gain a lock on the given shard and remembers it if it succeeds.
+// A draining worker doesn't take new leases nor renews the ones it holds, so their shard
+// consumers stop after their current batch and release them.
+func (l *leaseKeeper) GetLease(shard *partition.ShardStatus, newAssignTo string) error {
+	if newAssignTo == l.workerID && l.isDraining() {
+		return checkpoint.ErrLeaseNotAcquired{}
+	}
+	err := l.Checkpointer.GetLease(shard, newAssignTo)
+	if err != nil {
+		return err
+	}
+	if newAssignTo == l.workerID {
+		l.mu.Lock()
+		l.shards[shard.ID] = shard
+		l.mu.Unlock()
+	}
+	return nil
+}
+
+// RemoveLeaseOwner releases the lease of the shard and forgets it.
+func (l *leaseKeeper) RemoveLeaseOwner(shardID string) error {
+	err := l.Checkpointer.RemoveLeaseOwner(shardID)
+	l.mu.Lock()
+	delete(l.shards, shardID)
+	l.checkDrained()
+	l.mu.Unlock()
+	return err
+}
+
+// ClaimShard claims a shard to steal it, unless the worker is draining.
+func (l *leaseKeeper) ClaimShard(shard *partition.ShardStatus, claimID string) error {
+	if claimID == l.workerID && l.isDraining() {
+		return errWorkerDraining
+	}
+	return l.Checkpointer.ClaimShard(shard, claimID)
+}
+
+// DrainLeases marks the worker as draining. The leases it holds are due for renewal right away,
+// so every shard consumer releases its lease once its current batch is checkpointed.
+func (l *leaseKeeper) DrainLeases() <-chan struct{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.draining {
+		return l.drained
+	}
+	log.Println("level", "INFO", "msg", "draining leases", "worker", l.workerID, "leases", len(l.shards))
+	l.draining = true
+	for _, shard := range l.shards {
+		shard.Mux.Lock()
+		shard.LeaseTimeout = time.Time{}
+		shard.Mux.Unlock()
+	}
+	l.checkDrained()
+	return l.drained
+}
+
+// isDraining tells if the worker is draining its leases.
+func (l *leaseKeeper) isDraining() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.draining
+}
+
+// checkDrained reports the end of the drain once the worker holds no lease. It must be called holding the lock.
+func (l *leaseKeeper) checkDrained() {
+	if !l.draining || len(l.shards) > 0 {
+		return
+	}
+	select {
+	case <-l.drained:
+	default:
+		log.Println("level", "INFO", "msg", "leases drained", "worker", l.workerID)
+		close(l.drained)
+	}
+}
+
+// RenewLease renews the lease of a shard held by this worker.
+func (l *leaseKeeper) RenewLease(shardID string) error {
+	l.mu.Lock()
+	shard, ok := l.shards[shardID]
+	l.mu.Unlock()
+	if !ok {
+		return errUnknownShard
+	}
+	return l.Checkpointer.GetLease(shard, l.workerID)
 }
@@ -0,0 +1,368 @@
+package kinesis_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	awsdynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	awskinesis "github.com/aws/aws-sdk-go/service/kinesis"
+	"github.com/aws/aws-sdk-go/service/kinesis/kinesisiface"
+	"github.com/fernandoocampo/pubsub-kinesis/internal/adapter/checkpointstore"
+	"github.com/fernandoocampo/pubsub-kinesis/internal/adapter/kinesis"
+	"github.com/stretchr/testify/assert"
+	"github.com/vmware/vmware-go-kcl/clientlibrary/checkpoint"
+	"github.com/vmware/vmware-go-kcl/clientlibrary/config"
+)
+
+func TestWorkerFactoryUsesLatestByDefault(t *testing.T) {
+	kclConfiguration := newKinesisClientLibConfiguration(t, newKCLConfiguration())
+
+	assert.Equal(t, config.LATEST, kclConfiguration.InitialPositionInStream)
+	assert.Equal(t, "orders-consumer", kclConfiguration.ApplicationName)
+	assert.Equal(t, "orders-leases", kclConfiguration.TableName)
+}
+
+func TestWorkerFactoryStartsAtTimestamp(t *testing.T) {
+	timestamp := time.Date(2021, 5, 1, 12, 0, 0, 0, time.UTC)
+	configuration := newKCLConfiguration()
+	configuration.InitialPosition = kinesis.InitialPositionAtTimestamp
+	configuration.InitialTimestamp = &timestamp
+	kclConfiguration := newKinesisClientLibConfiguration(t, configuration)
+
+	assert.Equal(t, config.AT_TIMESTAMP, kclConfiguration.InitialPositionInStream)
+	assert.Equal(t, timestamp, *kclConfiguration.InitialPositionInStreamExtended.Timestamp)
+}
+
+func TestWorkerFactoryStartsAtTrimHorizon(t *testing.T) {
+	configuration := newKCLConfiguration()
+	configuration.InitialPosition = kinesis.InitialPositionTrimHorizon
+	kclConfiguration := newKinesisClientLibConfiguration(t, configuration)
+
+	assert.Equal(t, config.TRIM_HORIZON, kclConfiguration.InitialPositionInStream)
+}
+
+func TestReplayUsesTemporaryApplicationAndLeaseTable(t *testing.T) {
+	from := time.Date(2021, 5, 1, 12, 0, 0, 0, time.UTC)
+	configuration := newKCLConfiguration()
+	configuration.Replay = &kinesis.ReplayConfiguration{
+		From: from,
+		To:   from.Add(time.Hour),
+	}
+	kclConfiguration := newKinesisClientLibConfiguration(t, configuration)
+
+	assert.Equal(t, "orders-consumer-replay-20210501T120000Z", kclConfiguration.ApplicationName)
+	assert.Equal(t, "orders-consumer-replay-20210501T120000Z", kclConfiguration.TableName)
+	assert.Equal(t, config.AT_TIMESTAMP, kclConfiguration.InitialPositionInStream)
+	assert.Equal(t, from, *kclConfiguration.InitialPositionInStreamExtended.Timestamp)
+}
+
+func TestReplayWindowSkipsLaterRecords(t *testing.T) {
+	until := time.Date(2021, 5, 1, 13, 0, 0, 0, time.UTC)
+	recordHandlerCreator := &recordHandlerCreatorMock{}
+	recordProcessorFactory := kinesis.NewRecordHandlerProcessorFactory(recordHandlerCreator).WithReplayWindow(until)
+	checkpointer := recordProcessorCheckPointer{}
+	input := newProcessRecordsInput(&checkpointer, "1", "2")
+	input.Records[0].ApproximateArrivalTimestamp = aws.Time(until.Add(-time.Minute))
+	input.Records[1].ApproximateArrivalTimestamp = aws.Time(until.Add(time.Minute))
+
+	recordProcessor := recordProcessorFactory.CreateProcessor()
+	initializeRecordProcessor(recordProcessor, "")
+	recordProcessor.ProcessRecords(input)
+
+	assert.Equal(t, []string{"1"}, sequenceNumbers(recordHandlerCreator.handler.records))
+}
+
+func newKCLConfiguration() kinesis.KCLConfiguration {
+	return kinesis.KCLConfiguration{
+		ApplicationName: "orders-consumer",
+		TableName:       "orders-leases",
+		StreamName:      "orders",
+		RegionName:      "us-east-1",
+		WorkerID:        "worker-1",
+	}
+}
+
+func TestWorkerFactoryEnablesEnhancedFanOut(t *testing.T) {
+	cases := map[string]struct {
+		configure  func(configuration *kinesis.KCLConfiguration)
+		wantName   string
+		wantARN    string
+		wantFanOut bool
+	}{
+		"polling": {
+			configure:  func(configuration *kinesis.KCLConfiguration) {},
+			wantName:   "orders-consumer",
+			wantFanOut: false,
+		},
+		"application_consumer": {
+			configure:  func(configuration *kinesis.KCLConfiguration) { configuration.EnhancedFanOut = true },
+			wantName:   "orders-consumer",
+			wantFanOut: true,
+		},
+		"named_consumer": {
+			configure: func(configuration *kinesis.KCLConfiguration) {
+				configuration.EnhancedFanOutConsumerName = "orders-analytics"
+			},
+			wantName:   "orders-analytics",
+			wantFanOut: true,
+		},
+		"registered_consumer": {
+			configure: func(configuration *kinesis.KCLConfiguration) {
+				configuration.EnhancedFanOutConsumerARN = "arn:aws:kinesis:us-east-1:000000000000:stream/orders/consumer/orders-analytics:1"
+			},
+			wantName:   "orders-consumer",
+			wantARN:    "arn:aws:kinesis:us-east-1:000000000000:stream/orders/consumer/orders-analytics:1",
+			wantFanOut: true,
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(st *testing.T) {
+			configuration := newKCLConfiguration()
+			configuration.KinesisEndpoint = "http://localhost:4566"
+			configuration.DynamoDBEndpoint = "http://localhost:4567"
+			c.configure(&configuration)
+
+			kclConfiguration := newKinesisClientLibConfiguration(st, configuration)
+
+			assert.Equal(st, c.wantFanOut, kclConfiguration.EnableEnhancedFanOutConsumer)
+			assert.Equal(st, c.wantName, kclConfiguration.EnhancedFanOutConsumerName)
+			assert.Equal(st, c.wantARN, kclConfiguration.EnhancedFanOutConsumerARN)
+			assert.Equal(st, "http://localhost:4566", kclConfiguration.KinesisEndpoint)
+			assert.Equal(st, "http://localhost:4567", kclConfiguration.DynamoDBEndpoint)
+		})
+	}
+}
+
+func newKinesisClientLibConfiguration(t *testing.T, configuration kinesis.KCLConfiguration) config.KinesisClientLibConfiguration {
+	t.Helper()
+	workerFactory, err := kinesis.NewKCLWorkerFactory(configuration)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	return workerFactory.KinesisClientLibConfiguration()
+}
+
+func TestWorkerFactoryAppliesTuning(t *testing.T) {
+	configuration := newKCLConfiguration()
+	configuration.FailoverTimeMillis = 20000
+	configuration.LeaseRefreshPeriodMillis = 4000
+	configuration.MaxRecords = 500
+	configuration.IdleTimeBetweenReadsInMillis = 250
+	configuration.CallProcessRecordsEvenForEmptyRecordList = true
+	configuration.ParentShardPollIntervalMillis = 3000
+	configuration.ShardSyncIntervalMillis = 30000
+	configuration.CleanupTerminatedShardsBeforeExpiry = aws.Bool(false)
+	configuration.TaskBackoffTimeMillis = 700
+	configuration.ValidateSequenceNumberBeforeCheckpointing = aws.Bool(false)
+	configuration.ShutdownGraceMillis = 9000
+	configuration.MaxLeasesForWorker = 8
+	configuration.MaxLeasesToStealAtOneTime = 2
+	configuration.InitialLeaseTableReadCapacity = 5
+	configuration.InitialLeaseTableWriteCapacity = 6
+	configuration.SkipShardSyncAtWorkerInitializationIfLeasesExist = true
+	configuration.EnableLeaseStealing = true
+	configuration.LeaseStealingIntervalMillis = 7000
+	configuration.LeaseStealingClaimTimeoutMillis = 60000
+	configuration.LeaseSyncingTimeIntervalMillis = 15000
+
+	kclConfiguration := newKinesisClientLibConfiguration(t, configuration)
+
+	assert.Equal(t, 20000, kclConfiguration.FailoverTimeMillis)
+	assert.Equal(t, 4000, kclConfiguration.LeaseRefreshPeriodMillis)
+	assert.Equal(t, 500, kclConfiguration.MaxRecords)
+	assert.Equal(t, 250, kclConfiguration.IdleTimeBetweenReadsInMillis)
+	assert.True(t, kclConfiguration.CallProcessRecordsEvenForEmptyRecordList)
+	assert.Equal(t, 3000, kclConfiguration.ParentShardPollIntervalMillis)
+	assert.Equal(t, 30000, kclConfiguration.ShardSyncIntervalMillis)
+	assert.False(t, kclConfiguration.CleanupTerminatedShardsBeforeExpiry)
+	assert.Equal(t, 700, kclConfiguration.TaskBackoffTimeMillis)
+	assert.False(t, kclConfiguration.ValidateSequenceNumberBeforeCheckpointing)
+	assert.Equal(t, 9000, kclConfiguration.ShutdownGraceMillis)
+	assert.Equal(t, 8, kclConfiguration.MaxLeasesForWorker)
+	assert.Equal(t, 2, kclConfiguration.MaxLeasesToStealAtOneTime)
+	assert.Equal(t, 5, kclConfiguration.InitialLeaseTableReadCapacity)
+	assert.Equal(t, 6, kclConfiguration.InitialLeaseTableWriteCapacity)
+	assert.True(t, kclConfiguration.SkipShardSyncAtWorkerInitializationIfLeasesExist)
+	assert.True(t, kclConfiguration.EnableLeaseStealing)
+	assert.Equal(t, 7000, kclConfiguration.LeaseStealingIntervalMillis)
+	assert.Equal(t, 60000, kclConfiguration.LeaseStealingClaimTimeoutMillis)
+	assert.Equal(t, 15000, kclConfiguration.LeaseSyncingTimeIntervalMillis)
+}
+
+func TestWorkerFactoryKeepsDefaults(t *testing.T) {
+	kclConfiguration := newKinesisClientLibConfiguration(t, newKCLConfiguration())
+
+	assert.Equal(t, config.DefaultFailoverTimeMillis, kclConfiguration.FailoverTimeMillis)
+	assert.Equal(t, config.DefaultMaxRecords, kclConfiguration.MaxRecords)
+	assert.Equal(t, config.DefaultShardSyncIntervalMillis, kclConfiguration.ShardSyncIntervalMillis)
+	assert.Equal(t, config.DefaultMaxLeasesForWorker, kclConfiguration.MaxLeasesForWorker)
+	assert.Equal(t, config.DefaultInitialLeaseTableReadCapacity, kclConfiguration.InitialLeaseTableReadCapacity)
+	assert.True(t, kclConfiguration.CleanupTerminatedShardsBeforeExpiry)
+	assert.True(t, kclConfiguration.ValidateSequenceNumberBeforeCheckpointing)
+}
+
+func TestWorkerFactoryRejectsInvalidConfiguration(t *testing.T) {
+	timestamp := time.Date(2021, 5, 1, 12, 0, 0, 0, time.UTC)
+	cases := map[string]struct {
+		configure func(configuration *kinesis.KCLConfiguration)
+		want      string
+	}{
+		"missing_stream": {
+			configure: func(configuration *kinesis.KCLConfiguration) { configuration.StreamName = "" },
+			want:      "stream name is required",
+		},
+		"negative_value": {
+			configure: func(configuration *kinesis.KCLConfiguration) { configuration.MaxLeasesForWorker = -1 },
+			want:      "MaxLeasesForWorker must not be negative",
+		},
+		"negative_values_in_field_order": {
+			configure: func(configuration *kinesis.KCLConfiguration) {
+				configuration.MaxLeasesForWorker = -1
+				configuration.FailoverTimeMillis = -1
+				configuration.MaxRecords = -1
+			},
+			want: "FailoverTimeMillis must not be negative, got -1; MaxRecords must not be negative, got -1; MaxLeasesForWorker must not be negative, got -1",
+		},
+		"too_many_records": {
+			configure: func(configuration *kinesis.KCLConfiguration) { configuration.MaxRecords = 20000 },
+			want:      "MaxRecords must not be greater than 10000",
+		},
+		"lease_refresh_after_failover": {
+			configure: func(configuration *kinesis.KCLConfiguration) {
+				configuration.FailoverTimeMillis = 5000
+				configuration.LeaseRefreshPeriodMillis = 6000
+			},
+			want: "LeaseRefreshPeriodMillis (6000) must be lower than FailoverTimeMillis (5000)",
+		},
+		"steal_more_than_allowed": {
+			configure: func(configuration *kinesis.KCLConfiguration) {
+				configuration.MaxLeasesForWorker = 2
+				configuration.MaxLeasesToStealAtOneTime = 3
+			},
+			want: "MaxLeasesToStealAtOneTime (3) must not be greater than MaxLeasesForWorker (2)",
+		},
+		"claim_timeout_before_failover": {
+			configure: func(configuration *kinesis.KCLConfiguration) {
+				configuration.EnableLeaseStealing = true
+				configuration.LeaseStealingClaimTimeoutMillis = 1000
+			},
+			want: "LeaseStealingClaimTimeoutMillis (1000) must be greater than FailoverTimeMillis (10000)",
+		},
+		"consumer_name_and_arn": {
+			configure: func(configuration *kinesis.KCLConfiguration) {
+				configuration.EnhancedFanOutConsumerName = "analytics"
+				configuration.EnhancedFanOutConsumerARN = "arn:aws:kinesis:us-east-1:000000000000:stream/orders/consumer/analytics:1"
+			},
+			want: "only one of EnhancedFanOutConsumerName and EnhancedFanOutConsumerARN can be set",
+		},
+		"timestamp_missing": {
+			configure: func(configuration *kinesis.KCLConfiguration) {
+				configuration.InitialPosition = kinesis.InitialPositionAtTimestamp
+			},
+			want: "InitialTimestamp is required",
+		},
+		"timestamp_without_at_timestamp": {
+			configure: func(configuration *kinesis.KCLConfiguration) {
+				configuration.InitialTimestamp = &timestamp
+			},
+			want: "InitialTimestamp can only be set with the AT_TIMESTAMP initial position",
+		},
+		"unknown_position": {
+			configure: func(configuration *kinesis.KCLConfiguration) {
+				configuration.InitialPosition = "EARLIEST"
+			},
+			want: `unknown initial position "EARLIEST"`,
+		},
+		"replay_ends_before_start": {
+			configure: func(configuration *kinesis.KCLConfiguration) {
+				configuration.Replay = &kinesis.ReplayConfiguration{From: timestamp, To: timestamp.Add(-time.Hour)}
+			},
+			want: "replay end time must be after its start time",
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(st *testing.T) {
+			configuration := newKCLConfiguration()
+			c.configure(&configuration)
+
+			workerFactory, err := kinesis.NewKCLWorkerFactory(configuration)
+
+			assert.Nil(st, workerFactory)
+			if assert.Error(st, err) {
+				assert.Contains(st, err.Error(), c.want)
+			}
+		})
+	}
+}
+
+func TestWorkerFactoryUsesCheckpointerFactory(t *testing.T) {
+	workerFactory, err := kinesis.NewKCLWorkerFactory(newKCLConfiguration())
+	assert.NoError(t, err)
+	var tableNames []string
+	workerFactory.WithCheckpointerFactory(func(kclConfig *config.KinesisClientLibConfiguration) checkpoint.Checkpointer {
+		tableNames = append(tableNames, kclConfig.TableName)
+		return checkpointstore.NewCheckpointer(checkpointstore.NewMemoryStore(), kclConfig)
+	})
+
+	worker := workerFactory.NewWorker(kinesis.NewRecordProcessorFactory(&handlerCreatorMock{}))
+
+	assert.NotNil(t, worker)
+	assert.Equal(t, []string{"orders-leases"}, tableNames)
+}
+
+func TestWorkerFactoryUsesGivenClients(t *testing.T) {
+	configuration := newKCLConfiguration()
+	configuration.ShardSyncIntervalMillis = 100
+	workerFactory, err := kinesis.NewKCLWorkerFactory(configuration)
+	assert.NoError(t, err)
+	kinesisClient := kinesisClientMock{}
+	dynamoDBClient := dynamoDBClientMock{}
+	workerFactory.WithKinesisClient(&kinesisClient).WithDynamoDBClient(&dynamoDBClient)
+
+	worker := workerFactory.NewWorker(kinesis.NewRecordProcessorFactory(&handlerCreatorMock{}))
+	err = worker.Start()
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool { return kinesisClient.listShardsCalls() > 0 }, time.Second, 10*time.Millisecond)
+	worker.Shutdown()
+
+	assert.Equal(t, []string{"orders-leases"}, dynamoDBClient.describedTables)
+	assert.Equal(t, "orders", kinesisClient.streamName)
+}
+
+// kinesisClientMock is a kinesis client whose stream has no shards.
+type kinesisClientMock struct {
+	kinesisiface.KinesisAPI
+	mutex      sync.Mutex
+	calls      int
+	streamName string
+}
+
+func (k *kinesisClientMock) ListShards(input *awskinesis.ListShardsInput) (*awskinesis.ListShardsOutput, error) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	k.calls++
+	k.streamName = aws.StringValue(input.StreamName)
+	return &awskinesis.ListShardsOutput{}, nil
+}
+
+func (k *kinesisClientMock) listShardsCalls() int {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	return k.calls
+}
+
+// dynamoDBClientMock is a dynamodb client where every lease table exists.
+type dynamoDBClientMock struct {
+	dynamodbiface.DynamoDBAPI
+	describedTables []string
+}
+
+func (d *dynamoDBClientMock) DescribeTable(input *awsdynamodb.DescribeTableInput) (*awsdynamodb.DescribeTableOutput, error) {
+	d.describedTables = append(d.describedTables, aws.StringValue(input.TableName))
+	return &awsdynamodb.DescribeTableOutput{}, nil
+}
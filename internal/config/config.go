@@ -0,0 +1,112 @@
+// Package config loads the configuration of the services built on this project, merging
+// built-in defaults, a YAML or JSON file, environment variables and command-line flags.
+package config
+
+import (
+	awsadapter "github.com/fernandoocampo/pubsub-kinesis/internal/adapter/aws"
+	"github.com/fernandoocampo/pubsub-kinesis/internal/adapter/checkpointstore"
+	"github.com/fernandoocampo/pubsub-kinesis/internal/adapter/dynamodb"
+	"github.com/fernandoocampo/pubsub-kinesis/internal/adapter/kinesis"
+	kclconfig "github.com/vmware/vmware-go-kcl/clientlibrary/config"
+)
+
+// Default region used when none is configured.
+const DefaultRegion = "us-east-1"
+
+// Configuration contains the settings of a service that publishes or consumes kinesis records.
+type Configuration struct {
+	AWS        awsadapter.Configuration
+	Checkpoint checkpointstore.Configuration
+	KCL        kinesis.KCLConfiguration
+	LeaseTable LeaseTable
+	Publisher  Publisher
+	Runtime    Runtime
+}
+
+// Publisher contains the settings of a kinesis publisher.
+type Publisher struct {
+	StreamName string
+}
+
+// Runtime contains the settings that can change while the service runs, see RuntimeStore.
+// Every other setting needs a restart.
+type Runtime struct {
+	// LogLevel is the lowest level of the log lines that are written: DEBUG, INFO, WARN or ERROR.
+	LogLevel string
+	// BatchSize is the maximum number of records delivered to batch handlers at once, zero delivers whole kcl batches.
+	BatchSize int
+	// RecordsPerSecond limits the records delivered to the handlers of each stream, zero means no limit.
+	RecordsPerSecond int
+	// PublisherRecordsPerSecond limits the records sent by the publisher, zero means no limit.
+	PublisherRecordsPerSecond int
+	// Filters are the expressions records must match to reach the handlers, see kinesis.ParseFilter.
+	// Expressions can't contain commas.
+	Filters []string
+}
+
+// Default returns the built-in configuration, the first layer of every load.
+func Default() Configuration {
+	return Configuration{
+		AWS: awsadapter.Configuration{
+			Region: DefaultRegion,
+		},
+		Checkpoint: checkpointstore.Configuration{
+			Kind: checkpointstore.KindDynamoDB,
+		},
+		KCL: kinesis.KCLConfiguration{
+			RegionName:                                DefaultRegion,
+			InitialPosition:                           kinesis.InitialPositionLatest,
+			FailoverTimeMillis:                        kclconfig.DefaultFailoverTimeMillis,
+			LeaseRefreshPeriodMillis:                  kclconfig.DefaultLeaseRefreshPeriodMillis,
+			MaxRecords:                                kclconfig.DefaultMaxRecords,
+			IdleTimeBetweenReadsInMillis:              kclconfig.DefaultIdletimeBetweenReadsMillis,
+			ParentShardPollIntervalMillis:             kclconfig.DefaultParentShardPollIntervalMillis,
+			CleanupTerminatedShardsBeforeExpiry:       boolPointer(kclconfig.DefaultCleanupLeasesUponShardsCompletion),
+			ShardSyncIntervalMillis:                   kclconfig.DefaultShardSyncIntervalMillis,
+			ValidateSequenceNumberBeforeCheckpointing: boolPointer(kclconfig.DefaultValidateSequenceNumberBeforeCheckpointing),
+			TaskBackoffTimeMillis:                     kclconfig.DefaultTaskBackoffTimeMillis,
+			ShutdownGraceMillis:                       kclconfig.DefaultShutdownGraceMillis,
+			MaxLeasesForWorker:                        kclconfig.DefaultMaxLeasesForWorker,
+			MaxLeasesToStealAtOneTime:                 kclconfig.DefaultMaxLeasesToStealAtOneTime,
+			InitialLeaseTableReadCapacity:             kclconfig.DefaultInitialLeaseTableReadCapacity,
+			InitialLeaseTableWriteCapacity:            kclconfig.DefaultInitialLeaseTableWriteCapacity,
+			LeaseStealingIntervalMillis:               kclconfig.DefaultLeaseStealingIntervalMillis,
+			LeaseStealingClaimTimeoutMillis:           kclconfig.DefaultLeaseStealingClaimTimeoutMillis,
+			LeaseSyncingTimeIntervalMillis:            kclconfig.DefaultLeaseSyncingIntervalMillis,
+		},
+		LeaseTable: LeaseTable{
+			BillingMode: "PROVISIONED",
+			Encryption:  dynamodb.EncryptionDefault,
+		},
+		Runtime: Runtime{
+			LogLevel: LogLevelDebug,
+		},
+	}
+}
+
+// applyCredentials creates the credentials declared in the aws configuration and sets them
+// to the kcl clients, each one with the role of its service.
+func (c *Configuration) applyCredentials() error {
+	awsCredentials, err := awsadapter.NewCredentials(c.AWS)
+	if err != nil {
+		return err
+	}
+	c.AWS.Credentials = awsCredentials
+	if c.KCL.KinesisCredentials == nil {
+		c.KCL.KinesisCredentials, err = awsadapter.NewKinesisCredentials(c.AWS)
+		if err != nil {
+			return err
+		}
+	}
+	if c.KCL.DynamoDBCredentials == nil {
+		c.KCL.DynamoDBCredentials, err = awsadapter.NewDynamoDBCredentials(c.AWS)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func boolPointer(value bool) *bool {
+	return &value
+}
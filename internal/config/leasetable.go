@@ -0,0 +1,71 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/fernandoocampo/pubsub-kinesis/internal/adapter/dynamodb"
+)
+
+// LeaseTable contains the settings of the kcl lease table when the service provisions it
+// instead of kcl, see LeaseTableSettings.
+type LeaseTable struct {
+	// Provision makes the service create or reconcile the lease table before the worker starts.
+	Provision bool
+	// BillingMode is PROVISIONED, with the initial lease table capacities of the kcl section, or PAY_PER_REQUEST.
+	BillingMode string
+	// Tags are key=value pairs added to the table.
+	Tags                []string
+	PointInTimeRecovery bool
+	// Encryption is DEFAULT, with a key owned by dynamodb, or KMS.
+	Encryption string
+	// KMSKeyID is the arn of the kms key of KMS encryption, the aws managed key when it is empty.
+	KMSKeyID string
+}
+
+// LeaseTableSettings returns the validated settings to provision the lease table of the kcl section.
+func (c Configuration) LeaseTableSettings() (dynamodb.TableSettings, error) {
+	tags, err := c.LeaseTable.tags()
+	if err != nil {
+		return dynamodb.TableSettings{}, err
+	}
+	tableName := c.KCL.TableName
+	if tableName == "" {
+		tableName = c.KCL.ApplicationName
+	}
+	settings := dynamodb.TableSettings{
+		TableName:           tableName,
+		BillingMode:         c.LeaseTable.BillingMode,
+		ReadCapacity:        int64(c.KCL.InitialLeaseTableReadCapacity),
+		WriteCapacity:       int64(c.KCL.InitialLeaseTableWriteCapacity),
+		Tags:                tags,
+		PointInTimeRecovery: c.LeaseTable.PointInTimeRecovery,
+		Encryption:          c.LeaseTable.Encryption,
+		KMSKeyID:            c.LeaseTable.KMSKeyID,
+	}
+	if err := settings.Validate(); err != nil {
+		return dynamodb.TableSettings{}, err
+	}
+	return settings, nil
+}
+
+// tags parses the key=value tags.
+func (l LeaseTable) tags() (map[string]string, error) {
+	tags := make(map[string]string, len(l.Tags))
+	for _, tag := range l.Tags {
+		key, value, ok := cut(tag, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid tag %q, use key=value", tag)
+		}
+		tags[key] = value
+	}
+	return tags, nil
+}
+
+// cut slices s around the first instance of sep.
+func cut(s, sep string) (string, string, bool) {
+	if i := strings.Index(s, sep); i >= 0 {
+		return strings.TrimSpace(s[:i]), strings.TrimSpace(s[i+len(sep):]), true
+	}
+	return s, "", false
+}
@@ -0,0 +1,567 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultEnvPrefix is the default prefix of the environment variables read by the loader.
+const DefaultEnvPrefix = "PUBSUB"
+
+// fileFlag is the command-line flag that sets the configuration file.
+const fileFlag = "config"
+
+// redacted replaces the value of secrets in the configuration dump.
+const redacted = "******"
+
+// Source tells which layer set a configuration value.
+type Source string
+
+// Configuration layers, from lowest to highest precedence.
+const (
+	SourceDefault Source = "default"
+	SourceFile    Source = "file"
+	SourceEnv     Source = "env"
+	SourceFlag    Source = "flag"
+	SourceAdmin   Source = "admin"
+)
+
+// Loaded is a configuration along with the layer each of its values came from.
+type Loaded struct {
+	Configuration
+	sources  map[string]Source
+	filePath string
+}
+
+// Loader loads a configuration merging its layers: built-in defaults, a YAML or JSON file,
+// environment variables and command-line flags, each one overriding the previous ones.
+//
+// Every value has a key made of its section and field names in snake case, e.g. "kcl.max_records".
+// Files use nested keys, environment variables the upper-cased key with underscores and the
+// prefix, e.g. PUBSUB_KCL_MAX_RECORDS, and flags the key with dashes, e.g. -kcl.max-records.
+// The "-config" flag sets the file when none was given to the loader. The flags of the
+// application can be mixed with them through WithFlagSet.
+type Loader struct {
+	filePath  string
+	envPrefix string
+	args      []string
+	flagSet   *flag.FlagSet
+	lookupEnv func(key string) (string, bool)
+}
+
+// NewLoader creates a loader that reads the environment with the default prefix.
+func NewLoader() *Loader {
+	newLoader := Loader{
+		envPrefix: DefaultEnvPrefix,
+		lookupEnv: os.LookupEnv,
+	}
+	return &newLoader
+}
+
+// WithFile sets the YAML or JSON file to load, its format is chosen by extension.
+func (l *Loader) WithFile(filePath string) *Loader {
+	l.filePath = filePath
+	return l
+}
+
+// WithEnvPrefix sets the prefix of the environment variables to read.
+func (l *Loader) WithEnvPrefix(envPrefix string) *Loader {
+	l.envPrefix = envPrefix
+	return l
+}
+
+// WithArgs sets the command-line arguments to read flags from, e.g. os.Args[1:].
+func (l *Loader) WithArgs(args []string) *Loader {
+	l.args = args
+	return l
+}
+
+// WithFlagSet sets the flag set the loader registers its flags on, so they can be mixed with the
+// flags of the application. The arguments are parsed with it, so the application reads its own
+// flags from it after loading. Without it, the loader parses its flags alone and fails on others.
+func (l *Loader) WithFlagSet(flagSet *flag.FlagSet) *Loader {
+	l.flagSet = flagSet
+	return l
+}
+
+// WithLookupEnv sets the function used to read environment variables.
+func (l *Loader) WithLookupEnv(lookupEnv func(key string) (string, bool)) *Loader {
+	l.lookupEnv = lookupEnv
+	return l
+}
+
+// Load merges the configuration layers.
+func (l *Loader) Load() (*Loaded, error) {
+	loaded := Loaded{
+		Configuration: Default(),
+		sources:       make(map[string]Source),
+	}
+	fields := configurationFields()
+	for _, field := range fields {
+		loaded.sources[field.key] = SourceDefault
+	}
+
+	flagValues, filePath, err := l.parseFlags(fields)
+	if err != nil {
+		return nil, err
+	}
+
+	loaded.filePath = filePath
+	if filePath != "" {
+		fileValues, err := readFile(filePath)
+		if err != nil {
+			return nil, err
+		}
+		if err := loaded.apply(fields, fileValues, SourceFile); err != nil {
+			return nil, fmt.Errorf("file %s: %w", filePath, err)
+		}
+	}
+
+	envValues := make(map[string]string)
+	for _, field := range fields {
+		if value, ok := l.lookupEnv(l.envName(field.key)); ok {
+			envValues[field.key] = value
+		}
+	}
+	if err := loaded.apply(fields, envValues, SourceEnv); err != nil {
+		return nil, fmt.Errorf("environment: %w", err)
+	}
+
+	if err := loaded.apply(fields, flagValues, SourceFlag); err != nil {
+		return nil, fmt.Errorf("flags: %w", err)
+	}
+
+	if err := loaded.AWS.HTTP.Validate(); err != nil {
+		return nil, fmt.Errorf("http: %w", err)
+	}
+	if err := loaded.AWS.Retry.Validate(); err != nil {
+		return nil, fmt.Errorf("retry: %w", err)
+	}
+	if err := loaded.applyCredentials(); err != nil {
+		return nil, fmt.Errorf("credentials: %w", err)
+	}
+	loaded.applyEndpoints()
+	if err := loaded.Runtime.validate(); err != nil {
+		return nil, fmt.Errorf("runtime: %w", err)
+	}
+	if err := loaded.Checkpoint.Validate(); err != nil {
+		return nil, fmt.Errorf("checkpoint: %w", err)
+	}
+	if loaded.LeaseTable.Provision {
+		if _, err := loaded.LeaseTableSettings(); err != nil {
+			return nil, fmt.Errorf("lease_table: %w", err)
+		}
+	}
+	log.Println("level", "INFO", "msg", "configuration loaded", "file", filePath)
+	return &loaded, nil
+}
+
+// envName returns the environment variable of the given key.
+func (l *Loader) envName(key string) string {
+	name := strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+	if l.envPrefix == "" {
+		return name
+	}
+	return l.envPrefix + "_" + name
+}
+
+// parseFlags returns the values of the flags that were set and the configuration file.
+func (l *Loader) parseFlags(fields []field) (map[string]string, string, error) {
+	flagSet := l.flagSet
+	if flagSet == nil {
+		flagSet = flag.NewFlagSet("config", flag.ContinueOnError)
+		flagSet.SetOutput(ioutil.Discard)
+	}
+	defineFlag(flagSet, fileFlag, "YAML or JSON configuration file")
+	keys := make(map[string]string)
+	for _, field := range fields {
+		name := flagName(field.key)
+		keys[name] = field.key
+		defineFlag(flagSet, name, "sets "+field.key)
+	}
+	if err := flagSet.Parse(l.args); err != nil {
+		return nil, "", fmt.Errorf("flags: %w", err)
+	}
+
+	filePath := l.filePath
+	values := make(map[string]string)
+	flagSet.Visit(func(f *flag.Flag) {
+		if f.Name == fileFlag {
+			filePath = f.Value.String()
+		}
+		if key, ok := keys[f.Name]; ok {
+			values[key] = f.Value.String()
+		}
+	})
+	return values, filePath, nil
+}
+
+// defineFlag defines a string flag unless the flag set already has it, e.g. when the same set
+// is loaded twice.
+func defineFlag(flagSet *flag.FlagSet, name, usage string) {
+	if flagSet.Lookup(name) == nil {
+		flagSet.String(name, "", usage)
+	}
+}
+
+// flagName returns the command-line flag of the given key.
+func flagName(key string) string {
+	return strings.ReplaceAll(key, "_", "-")
+}
+
+// readFile reads the values of a YAML or JSON file as flat keys.
+func readFile(filePath string) (map[string]string, error) {
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("configuration file could not be read: %w", err)
+	}
+	var document map[string]interface{}
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &document)
+	case ".json":
+		err = json.Unmarshal(data, &document)
+	default:
+		return nil, fmt.Errorf("unsupported configuration file %s, use .yaml, .yml or .json", filePath)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("configuration file %s could not be decoded: %w", filePath, err)
+	}
+	values := make(map[string]string)
+	if err := flatten("", document, values); err != nil {
+		return nil, fmt.Errorf("file %s: %w", filePath, err)
+	}
+	return values, nil
+}
+
+// flatten turns nested maps into values keyed by dotted paths.
+func flatten(prefix string, node interface{}, values map[string]string) error {
+	switch value := node.(type) {
+	case map[string]interface{}:
+		for key, child := range value {
+			if err := flatten(joinKey(prefix, key), child, values); err != nil {
+				return err
+			}
+		}
+	case nil:
+	case []interface{}:
+		items := make([]string, 0, len(value))
+		for _, item := range value {
+			switch item.(type) {
+			case map[string]interface{}, []interface{}:
+				return fmt.Errorf("%s: only lists of values are supported", prefix)
+			}
+			items = append(items, fmt.Sprint(item))
+		}
+		values[prefix] = strings.Join(items, ",")
+	case time.Time:
+		values[prefix] = value.Format(time.RFC3339Nano)
+	case float64:
+		values[prefix] = strconv.FormatFloat(value, 'f', -1, 64)
+	default:
+		values[prefix] = fmt.Sprint(value)
+	}
+	return nil
+}
+
+func joinKey(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+// apply sets the given values, recording their source.
+func (l *Loaded) apply(fields []field, values map[string]string, source Source) error {
+	byKey := make(map[string]field, len(fields))
+	for _, field := range fields {
+		byKey[field.key] = field
+	}
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		field, ok := byKey[key]
+		if !ok {
+			return fmt.Errorf("unknown configuration key %q", key)
+		}
+		if err := field.set(reflect.ValueOf(&l.Configuration).Elem(), values[key]); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		l.sources[key] = source
+	}
+	return nil
+}
+
+// applyEndpoints makes the kcl clients use the endpoints of the aws configuration unless
+// the kcl configuration overrides them. The kcl endpoints keep the source of the aws ones.
+func (l *Loaded) applyEndpoints() {
+	if l.KCL.KinesisEndpoint == "" && l.AWS.KinesisEndpointURL() != "" {
+		l.KCL.KinesisEndpoint = l.AWS.KinesisEndpointURL()
+		l.sources["kcl.kinesis_endpoint"] = l.endpointSource("aws.kinesis_endpoint")
+	}
+	if l.KCL.DynamoDBEndpoint == "" && l.AWS.DynamoDBEndpointURL() != "" {
+		l.KCL.DynamoDBEndpoint = l.AWS.DynamoDBEndpointURL()
+		l.sources["kcl.dynamo_db_endpoint"] = l.endpointSource("aws.dynamo_db_endpoint")
+	}
+}
+
+// endpointSource returns the source of the given aws endpoint, or the one of the shared aws
+// endpoint when it is not set.
+func (l *Loaded) endpointSource(key string) Source {
+	if l.sources[key] != SourceDefault {
+		return l.sources[key]
+	}
+	return l.sources["aws.endpoint"]
+}
+
+// Source returns the layer the value of the given key came from.
+func (l *Loaded) Source(key string) Source {
+	return l.sources[key]
+}
+
+// FilePath returns the configuration file that was loaded, empty if there was none.
+func (l *Loaded) FilePath() string {
+	return l.filePath
+}
+
+// Sources returns the layer every value came from, keyed by configuration key.
+func (l *Loaded) Sources() map[string]Source {
+	sources := make(map[string]Source, len(l.sources))
+	for key, source := range l.sources {
+		sources[key] = source
+	}
+	return sources
+}
+
+// Dump writes the effective configuration, one "key = value (source)" line per value
+// sorted by key. Secrets are redacted.
+func (l *Loaded) Dump(w io.Writer) error {
+	configuration := reflect.ValueOf(&l.Configuration).Elem()
+	for _, field := range configurationFields() {
+		value := field.get(configuration)
+		if value != "" && isSecret(field.key) {
+			value = redacted
+		}
+		_, err := fmt.Fprintf(w, "%s = %s (%s)\n", field.key, value, l.sources[field.key])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isSecret tells if the value of the key must not be shown.
+func isSecret(key string) bool {
+	for _, word := range []string{"secret", "token", "password", "data_source"} {
+		if strings.Contains(key, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// field is a value of the configuration that can be loaded.
+type field struct {
+	key   string
+	index []int
+	typ   reflect.Type
+}
+
+var (
+	timeType        = reflect.TypeOf(time.Time{})
+	durationType    = reflect.TypeOf(time.Duration(0))
+	credentialsType = reflect.TypeOf(&credentials.Credentials{})
+	errUnsupported  = errors.New("unsupported value type")
+)
+
+// configurationFields returns the loadable fields of the configuration, sorted by key.
+func configurationFields() []field {
+	var fields []field
+	collectFields(reflect.TypeOf(Configuration{}), "", nil, &fields)
+	sort.Slice(fields, func(i, j int) bool {
+		return fields[i].key < fields[j].key
+	})
+	return fields
+}
+
+// collectFields walks the struct type adding its loadable fields. Credential providers are
+// skipped, they are built from the credentials section.
+func collectFields(structType reflect.Type, prefix string, index []int, fields *[]field) {
+	for i := 0; i < structType.NumField(); i++ {
+		structField := structType.Field(i)
+		if structField.PkgPath != "" {
+			continue
+		}
+		fieldType := structField.Type
+		if fieldType == credentialsType {
+			continue
+		}
+		fieldIndex := append(append([]int(nil), index...), i)
+		key := joinKey(prefix, snakeCase(structField.Name))
+		elemType := fieldType
+		if elemType.Kind() == reflect.Ptr {
+			elemType = elemType.Elem()
+		}
+		if elemType.Kind() == reflect.Struct && elemType != timeType {
+			collectFields(elemType, key, fieldIndex, fields)
+			continue
+		}
+		*fields = append(*fields, field{key: key, index: fieldIndex, typ: fieldType})
+	}
+}
+
+// snakeCase converts a Go field name to snake case, e.g. MaxRecords to max_records
+// and WorkerID to worker_id.
+func snakeCase(name string) string {
+	runes := []rune(name)
+	var builder strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			previousLower := i > 0 && unicode.IsLower(runes[i-1])
+			nextLower := i > 0 && i+1 < len(runes) && unicode.IsUpper(runes[i-1]) && unicode.IsLower(runes[i+1])
+			if previousLower || nextLower {
+				builder.WriteByte('_')
+			}
+		}
+		builder.WriteRune(unicode.ToLower(r))
+	}
+	return builder.String()
+}
+
+// target returns the value of the field within the configuration, allocating the
+// pointers to structs on the way when allocate is true.
+func (f field) target(configuration reflect.Value, allocate bool) (reflect.Value, bool) {
+	value := configuration
+	for _, i := range f.index {
+		if value.Kind() == reflect.Ptr {
+			if value.IsNil() {
+				if !allocate {
+					return reflect.Value{}, false
+				}
+				value.Set(reflect.New(value.Type().Elem()))
+			}
+			value = value.Elem()
+		}
+		value = value.Field(i)
+	}
+	return value, true
+}
+
+// set parses the text and sets it to the field.
+func (f field) set(configuration reflect.Value, text string) error {
+	value, _ := f.target(configuration, true)
+	if value.Kind() == reflect.Ptr {
+		if text == "" {
+			value.Set(reflect.Zero(value.Type()))
+			return nil
+		}
+		pointer := reflect.New(value.Type().Elem())
+		if err := parseValue(pointer.Elem(), text); err != nil {
+			return err
+		}
+		value.Set(pointer)
+		return nil
+	}
+	return parseValue(value, text)
+}
+
+// get returns the field as text, empty when it is not set.
+func (f field) get(configuration reflect.Value) string {
+	value, ok := f.target(configuration, false)
+	if !ok {
+		return ""
+	}
+	if value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return ""
+		}
+		value = value.Elem()
+	}
+	switch {
+	case value.Type() == timeType:
+		timestamp := value.Interface().(time.Time)
+		if timestamp.IsZero() {
+			return ""
+		}
+		return timestamp.Format(time.RFC3339Nano)
+	case value.Kind() == reflect.Slice:
+		items := make([]string, 0, value.Len())
+		for i := 0; i < value.Len(); i++ {
+			items = append(items, fmt.Sprint(value.Index(i).Interface()))
+		}
+		return strings.Join(items, ",")
+	}
+	return fmt.Sprint(value.Interface())
+}
+
+// parseValue parses the text into the value according to its kind.
+func parseValue(value reflect.Value, text string) error {
+	if value.Type() == timeType {
+		timestamp, err := time.Parse(time.RFC3339Nano, text)
+		if err != nil {
+			return fmt.Errorf("invalid time %q, use RFC 3339", text)
+		}
+		value.Set(reflect.ValueOf(timestamp))
+		return nil
+	}
+	if value.Type() == durationType {
+		duration, err := time.ParseDuration(text)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q, e.g. 1h30m", text)
+		}
+		value.SetInt(int64(duration))
+		return nil
+	}
+	switch value.Kind() {
+	case reflect.Slice:
+		items := reflect.MakeSlice(value.Type(), 0, 0)
+		for _, item := range strings.Split(text, ",") {
+			item = strings.TrimSpace(item)
+			if item == "" {
+				continue
+			}
+			itemValue := reflect.New(value.Type().Elem()).Elem()
+			if err := parseValue(itemValue, item); err != nil {
+				return err
+			}
+			items = reflect.Append(items, itemValue)
+		}
+		value.Set(items)
+	case reflect.String:
+		value.SetString(text)
+	case reflect.Bool:
+		parsed, err := strconv.ParseBool(text)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", text)
+		}
+		value.SetBool(parsed)
+	case reflect.Int, reflect.Int64:
+		parsed, err := strconv.ParseInt(text, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", text)
+		}
+		value.SetInt(parsed)
+	default:
+		return errUnsupported
+	}
+	return nil
+}
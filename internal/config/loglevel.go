@@ -0,0 +1,92 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// Log levels of the log lines written by this project.
+const (
+	LogLevelDebug = "DEBUG"
+	LogLevelInfo  = "INFO"
+	LogLevelWarn  = "WARN"
+	LogLevelError = "ERROR"
+)
+
+var logLevels = map[string]int{
+	LogLevelDebug: 0,
+	LogLevelInfo:  1,
+	LogLevelWarn:  2,
+	LogLevelError: 3,
+}
+
+// LogLevelFilter is a writer for the standard logger that drops the lines below a level.
+// Lines carry their level as a "level" key and value, e.g. log.Println("level", "INFO", "msg", "started"),
+// lines without it are always written. The level can change while it is used, e.g.
+//
+//	filter, _ := config.NewLogLevelFilter(os.Stderr, config.LogLevelInfo)
+//	log.SetOutput(filter)
+type LogLevelFilter struct {
+	mu    sync.RWMutex
+	level int
+	out   io.Writer
+}
+
+// NewLogLevelFilter creates a filter that writes the lines of the given level or above to out.
+func NewLogLevelFilter(out io.Writer, level string) (*LogLevelFilter, error) {
+	newFilter := LogLevelFilter{
+		out: out,
+	}
+	if err := newFilter.SetLevel(level); err != nil {
+		return nil, err
+	}
+	return &newFilter, nil
+}
+
+// SetLevel changes the lowest level of the lines that are written.
+func (f *LogLevelFilter) SetLevel(level string) error {
+	value, err := parseLogLevel(level)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.level = value
+	return nil
+}
+
+// Write writes the line unless its level is below the level of the filter.
+func (f *LogLevelFilter) Write(line []byte) (int, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if level, ok := lineLevel(string(line)); ok && level < f.level {
+		return len(line), nil
+	}
+	return f.out.Write(line)
+}
+
+// parseLogLevel returns the value of a level name, an empty name is the lowest level.
+func parseLogLevel(level string) (int, error) {
+	if level == "" {
+		return logLevels[LogLevelDebug], nil
+	}
+	value, ok := logLevels[strings.ToUpper(level)]
+	if !ok {
+		return 0, fmt.Errorf("unknown log level %q, use DEBUG, INFO, WARN or ERROR", level)
+	}
+	return value, nil
+}
+
+// lineLevel returns the level of a log line, false if it has none.
+func lineLevel(line string) (int, bool) {
+	fields := strings.Fields(line)
+	for i := 0; i+1 < len(fields); i++ {
+		if fields[i] == "level" {
+			level, ok := logLevels[strings.ToUpper(fields[i+1])]
+			return level, ok
+		}
+	}
+	return 0, false
+}
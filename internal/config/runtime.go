@@ -0,0 +1,377 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fernandoocampo/pubsub-kinesis/internal/adapter/kinesis"
+)
+
+// runtimeSection is the section of the settings that can change while the service runs.
+const runtimeSection = "runtime"
+
+// DefaultWatchInterval is the default time between checks of the configuration file.
+const DefaultWatchInterval = 10 * time.Second
+
+// ErrNoConfigurationFile is returned when the configuration file is watched but none was loaded.
+var ErrNoConfigurationFile = errors.New("no configuration file was loaded")
+
+// RestartRequiredError is returned when a change includes settings that can't change while the service runs.
+// None of the changes are applied.
+type RestartRequiredError struct {
+	Keys []string
+}
+
+// Error returns the description of the error.
+func (r *RestartRequiredError) Error() string {
+	return fmt.Sprintf(
+		"%s can't change while the service runs, restart it to apply the change; only the %s settings are applied at runtime",
+		strings.Join(r.Keys, ", "), runtimeSection,
+	)
+}
+
+// RuntimeStore keeps the runtime settings of a running service and applies their changes to the
+// publishers, processors and loggers bound to it. Settings change through the configuration file,
+// which is watched, or an admin call, see Update and ServeHTTP.
+type RuntimeStore struct {
+	mu        sync.Mutex
+	loader    *Loader
+	filePath  string
+	base      *Loaded
+	current   Loaded
+	listeners []func(settings Runtime)
+	modTime   time.Time
+	size      int64
+}
+
+// NewRuntimeStore creates a runtime store of the configuration the service started with.
+// The loader is used to reload the configuration when its file changes.
+func NewRuntimeStore(loader *Loader, loaded *Loaded) *RuntimeStore {
+	newStore := RuntimeStore{
+		loader:   loader,
+		filePath: loaded.filePath,
+		base:     loaded,
+		current:  loaded.copy(),
+	}
+	if info, err := os.Stat(loaded.filePath); err == nil {
+		newStore.modTime = info.ModTime()
+		newStore.size = info.Size()
+	}
+	return &newStore
+}
+
+// Settings returns the current runtime settings.
+func (s *RuntimeStore) Settings() Runtime {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.current.Runtime
+}
+
+// Subscribe registers a function that is called with the runtime settings every time they change.
+func (s *RuntimeStore) Subscribe(listener func(settings Runtime)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.listeners = append(s.listeners, listener)
+}
+
+// Update changes the given runtime settings, keyed like the configuration, e.g. "runtime.batch_size".
+// Settings outside the runtime section are rejected with a *RestartRequiredError.
+func (s *RuntimeStore) Update(values map[string]string) error {
+	fields := configurationFields()
+	known := make(map[string]bool, len(fields))
+	for _, field := range fields {
+		known[field.key] = true
+	}
+	var restart []string
+	for key := range values {
+		if !known[key] {
+			return fmt.Errorf("unknown configuration key %q", key)
+		}
+		if !isRuntimeKey(key) {
+			restart = append(restart, key)
+		}
+	}
+	if len(restart) > 0 {
+		sort.Strings(restart)
+		return &RestartRequiredError{Keys: restart}
+	}
+	return s.change(values, SourceAdmin)
+}
+
+// Reload loads the configuration again and applies the runtime settings that changed since
+// the last load. If a setting outside the runtime section changed, nothing is applied and
+// a *RestartRequiredError is returned.
+func (s *RuntimeStore) Reload() error {
+	reloaded, err := s.loader.Load()
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	base := s.base
+	s.mu.Unlock()
+
+	var restart []string
+	values := make(map[string]string)
+	baseConfiguration := reflect.ValueOf(&base.Configuration).Elem()
+	reloadedConfiguration := reflect.ValueOf(&reloaded.Configuration).Elem()
+	for _, field := range configurationFields() {
+		value := field.get(reloadedConfiguration)
+		if value == field.get(baseConfiguration) {
+			continue
+		}
+		if !isRuntimeKey(field.key) {
+			restart = append(restart, field.key)
+			continue
+		}
+		values[field.key] = value
+	}
+	if len(restart) > 0 {
+		return &RestartRequiredError{Keys: restart}
+	}
+
+	if err := s.change(values, SourceFile); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.base = reloaded
+	s.mu.Unlock()
+	return nil
+}
+
+// Watch checks the configuration file every interval and reloads it when it changes,
+// until the context is done. Changes that can't be applied are logged and ignored.
+func (s *RuntimeStore) Watch(ctx context.Context, interval time.Duration) error {
+	if s.filePath == "" {
+		return ErrNoConfigurationFile
+	}
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if !s.fileChanged() {
+				continue
+			}
+			log.Println("level", "INFO", "msg", "configuration file changed, reloading it", "file", s.filePath)
+			if err := s.Reload(); err != nil {
+				log.Println("level", "ERROR", "msg", "configuration change was rejected", "file", s.filePath, "error", err)
+			}
+		}
+	}
+}
+
+// fileChanged tells if the configuration file changed since the last check.
+func (s *RuntimeStore) fileChanged() bool {
+	info, err := os.Stat(s.filePath)
+	if err != nil {
+		log.Println("level", "ERROR", "msg", "configuration file could not be checked", "file", s.filePath, "error", err)
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if info.ModTime().Equal(s.modTime) && info.Size() == s.size {
+		return false
+	}
+	s.modTime = info.ModTime()
+	s.size = info.Size()
+	return true
+}
+
+// change applies the values to the current settings and notifies the listeners.
+func (s *RuntimeStore) change(values map[string]string, source Source) error {
+	if len(values) == 0 {
+		return nil
+	}
+	s.mu.Lock()
+	updated := s.current.copy()
+	if err := updated.apply(configurationFields(), values, source); err != nil {
+		s.mu.Unlock()
+		return err
+	}
+	if err := updated.Runtime.validate(); err != nil {
+		s.mu.Unlock()
+		return err
+	}
+	s.current = updated
+	settings := updated.Runtime
+	listeners := make([]func(settings Runtime), len(s.listeners))
+	copy(listeners, s.listeners)
+	s.mu.Unlock()
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	log.Println("level", "INFO", "msg", "runtime settings changed", "keys", strings.Join(keys, ","), "source", source)
+	for _, listener := range listeners {
+		listener(settings)
+	}
+	return nil
+}
+
+// ServeHTTP is the admin endpoint of the runtime settings. GET returns them and PUT or PATCH
+// change the ones in the JSON body, either with flat keys, e.g. {"runtime.batch_size": 100},
+// or nested ones, e.g. {"runtime": {"batch_size": 100}}. Changes of settings that need a restart
+// are answered with 409 Conflict.
+func (s *RuntimeStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut, http.MethodPatch:
+		var document map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&document); err != nil {
+			http.Error(w, "body must be a json object", http.StatusBadRequest)
+			return
+		}
+		values := make(map[string]string)
+		if err := flatten("", document, values); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		err := s.Update(values)
+		var restartErr *RestartRequiredError
+		switch {
+		case errors.As(err, &restartErr):
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, PUT, PATCH")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s.runtimeValues()); err != nil {
+		log.Println("level", "ERROR", "msg", "runtime settings could not be written", "error", err)
+	}
+}
+
+// runtimeValues returns the runtime settings keyed like the configuration.
+func (s *RuntimeStore) runtimeValues() map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	configuration := reflect.ValueOf(&s.current.Configuration).Elem()
+	values := make(map[string]string)
+	for _, field := range configurationFields() {
+		if isRuntimeKey(field.key) {
+			values[field.key] = field.get(configuration)
+		}
+	}
+	return values
+}
+
+// BindRecordProcessorFactory applies the runtime settings to the processors of the factory,
+// now and every time they change.
+func (s *RuntimeStore) BindRecordProcessorFactory(factory *kinesis.RecordProcessorFactory) {
+	s.bind("record processor factory", func(settings Runtime) error {
+		processorSettings, err := settings.processorSettings()
+		if err != nil {
+			return err
+		}
+		return factory.UpdateSettings(processorSettings)
+	})
+}
+
+// BindProcessor applies the runtime settings to the processors of every stream of the processor,
+// now and every time they change.
+func (s *RuntimeStore) BindProcessor(processor *kinesis.Processor) {
+	s.bind("processor", func(settings Runtime) error {
+		processorSettings, err := settings.processorSettings()
+		if err != nil {
+			return err
+		}
+		return processor.UpdateSettings(processorSettings)
+	})
+}
+
+// BindPublisher applies the runtime settings to the publisher, now and every time they change.
+func (s *RuntimeStore) BindPublisher(publisher *kinesis.PublisherClient) {
+	s.bind("publisher", func(settings Runtime) error {
+		return publisher.UpdateSettings(kinesis.PublisherSettings{
+			RecordsPerSecond: settings.PublisherRecordsPerSecond,
+		})
+	})
+}
+
+// BindLogLevelFilter applies the runtime log level to the filter, now and every time it changes.
+func (s *RuntimeStore) BindLogLevelFilter(filter *LogLevelFilter) {
+	s.bind("log level filter", func(settings Runtime) error {
+		return filter.SetLevel(settings.LogLevel)
+	})
+}
+
+// bind applies the current settings with the given function and subscribes it to their changes.
+func (s *RuntimeStore) bind(target string, apply func(settings Runtime) error) {
+	listener := func(settings Runtime) {
+		if err := apply(settings); err != nil {
+			log.Println("level", "ERROR", "msg", "runtime settings could not be applied", "target", target, "error", err)
+		}
+	}
+	listener(s.Settings())
+	s.Subscribe(listener)
+}
+
+// validate checks the runtime settings can be applied.
+func (r Runtime) validate() error {
+	if _, err := parseLogLevel(r.LogLevel); err != nil {
+		return err
+	}
+	if r.PublisherRecordsPerSecond < 0 {
+		return fmt.Errorf("publisher records per second must not be negative, got %d", r.PublisherRecordsPerSecond)
+	}
+	processorSettings, err := r.processorSettings()
+	if err != nil {
+		return err
+	}
+	return processorSettings.Validate()
+}
+
+// processorSettings returns the settings of the record processors.
+func (r Runtime) processorSettings() (kinesis.ProcessorSettings, error) {
+	filters := make([]kinesis.RecordFilter, 0, len(r.Filters))
+	for _, expression := range r.Filters {
+		filter, err := kinesis.ParseFilter(expression)
+		if err != nil {
+			return kinesis.ProcessorSettings{}, err
+		}
+		filters = append(filters, filter)
+	}
+	processorSettings := kinesis.ProcessorSettings{
+		BatchSize:        r.BatchSize,
+		RecordsPerSecond: r.RecordsPerSecond,
+		Filters:          filters,
+	}
+	return processorSettings, nil
+}
+
+// isRuntimeKey tells if the setting of the key can change while the service runs.
+func isRuntimeKey(key string) bool {
+	return strings.HasPrefix(key, runtimeSection+".")
+}
+
+// copy returns a copy of the loaded configuration that can be changed on its own.
+func (l *Loaded) copy() Loaded {
+	copied := *l
+	copied.sources = l.Sources()
+	copied.Runtime.Filters = append([]string(nil), l.Runtime.Filters...)
+	return copied
+}
@@ -0,0 +1,241 @@
+package config_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	awskinesis "github.com/aws/aws-sdk-go/service/kinesis"
+	"github.com/fernandoocampo/pubsub-kinesis/internal/adapter/kinesis"
+	"github.com/fernandoocampo/pubsub-kinesis/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/vmware/vmware-go-kcl/clientlibrary/interfaces"
+)
+
+func TestRuntimeStoreUpdateAppliesToBoundTargets(t *testing.T) {
+	loader := config.NewLoader().WithLookupEnv(lookupEnv(map[string]string{"PUBSUB_RUNTIME_BATCH_SIZE": "100"}))
+	loaded, err := loader.Load()
+	assert.NoError(t, err)
+	store := config.NewRuntimeStore(loader, loaded)
+	factory := kinesis.NewBatchRecordProcessorFactory(nil)
+	publisher := kinesis.NewClient("orders", nil)
+	store.BindRecordProcessorFactory(factory)
+	store.BindPublisher(publisher)
+	assert.Equal(t, 100, factory.Settings().BatchSize)
+
+	err = store.Update(map[string]string{
+		"runtime.batch_size":                   "50",
+		"runtime.records_per_second":           "200",
+		"runtime.publisher_records_per_second": "10",
+		"runtime.filters":                      `header.event-type == "order.created"`,
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 50, factory.Settings().BatchSize)
+	assert.Equal(t, 200, factory.Settings().RecordsPerSecond)
+	assert.Len(t, factory.Settings().Filters, 1)
+	assert.Equal(t, 10, publisher.Settings().RecordsPerSecond)
+	assert.Equal(t, 50, store.Settings().BatchSize)
+}
+
+func TestRuntimeStoreKeepsFiltersSetInCode(t *testing.T) {
+	loader := config.NewLoader().WithLookupEnv(lookupEnv(nil))
+	loaded, err := loader.Load()
+	assert.NoError(t, err)
+	store := config.NewRuntimeStore(loader, loaded)
+	batchHandlerCreator := &batchHandlerCreatorMock{}
+	factory := kinesis.NewBatchRecordProcessorFactory(batchHandlerCreator).
+		WithFilters(kinesis.Not(kinesis.JSONFieldEquals("key", "2")))
+	store.BindRecordProcessorFactory(factory)
+	recordProcessor := factory.CreateProcessor()
+
+	err = store.Update(map[string]string{"runtime.filters": `$.key != "3"`})
+	assert.NoError(t, err)
+	recordProcessor.ProcessRecords(newProcessRecordsInput("1", "2", "3", "4"))
+	err = store.Update(map[string]string{"runtime.filters": ""})
+	assert.NoError(t, err)
+	recordProcessor.ProcessRecords(newProcessRecordsInput("2", "3"))
+
+	assert.Equal(t, [][]string{{"1", "4"}, {"3"}}, batchHandlerCreator.handler.batches)
+	assert.Empty(t, factory.Settings().Filters)
+}
+
+func TestRuntimeStoreUpdateRejectsInvalidChanges(t *testing.T) {
+	loader := config.NewLoader().WithLookupEnv(lookupEnv(nil))
+	loaded, err := loader.Load()
+	assert.NoError(t, err)
+	store := config.NewRuntimeStore(loader, loaded)
+
+	err = store.Update(map[string]string{"runtime.batch_size": "50", "kcl.max_records": "500"})
+	var restartErr *config.RestartRequiredError
+	assert.True(t, errors.As(err, &restartErr))
+	assert.Equal(t, []string{"kcl.max_records"}, restartErr.Keys)
+	assert.Contains(t, err.Error(), "restart")
+
+	assert.Error(t, store.Update(map[string]string{"runtime.log_level": "verbose"}))
+	assert.Error(t, store.Update(map[string]string{"runtime.filters": "event-type == created"}))
+	assert.Error(t, store.Update(map[string]string{"runtime.batch_size": "-1"}))
+	assert.Error(t, store.Update(map[string]string{"runtime.unknown": "1"}))
+	assert.Equal(t, 0, store.Settings().BatchSize)
+	assert.Equal(t, config.LogLevelDebug, store.Settings().LogLevel)
+}
+
+func TestRuntimeStoreReloadsFile(t *testing.T) {
+	filePath := writeFile(t, "service.yaml", `
+kcl:
+  max_records: 500
+runtime:
+  log_level: info
+  batch_size: 100
+`)
+	loader := config.NewLoader().WithFile(filePath).WithLookupEnv(lookupEnv(nil))
+	loaded, err := loader.Load()
+	assert.NoError(t, err)
+	store := config.NewRuntimeStore(loader, loaded)
+	var levels bytes.Buffer
+	filter, err := config.NewLogLevelFilter(&levels, config.LogLevelDebug)
+	assert.NoError(t, err)
+	store.BindLogLevelFilter(filter)
+
+	writeTo(t, filePath, `
+kcl:
+  max_records: 500
+runtime:
+  log_level: warn
+  batch_size: 200
+`)
+	err = store.Reload()
+
+	assert.NoError(t, err)
+	assert.Equal(t, 200, store.Settings().BatchSize)
+	assert.Equal(t, "warn", store.Settings().LogLevel)
+	_, _ = filter.Write([]byte("level INFO msg dropped\n"))
+	assert.Empty(t, levels.String())
+
+	writeTo(t, filePath, `
+kcl:
+  max_records: 1000
+runtime:
+  log_level: warn
+  batch_size: 300
+`)
+	err = store.Reload()
+
+	var restartErr *config.RestartRequiredError
+	assert.True(t, errors.As(err, &restartErr))
+	assert.Equal(t, []string{"kcl.max_records"}, restartErr.Keys)
+	assert.Equal(t, 200, store.Settings().BatchSize)
+}
+
+func TestRuntimeStoreAdminEndpoint(t *testing.T) {
+	loader := config.NewLoader().WithLookupEnv(lookupEnv(nil))
+	loaded, err := loader.Load()
+	assert.NoError(t, err)
+	store := config.NewRuntimeStore(loader, loaded)
+
+	response := httptest.NewRecorder()
+	store.ServeHTTP(response, httptest.NewRequest(http.MethodPatch, "/settings", strings.NewReader(`{"runtime":{"batch_size":25}}`)))
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Contains(t, response.Body.String(), `"runtime.batch_size":"25"`)
+	assert.Equal(t, 25, store.Settings().BatchSize)
+
+	response = httptest.NewRecorder()
+	store.ServeHTTP(response, httptest.NewRequest(http.MethodPut, "/settings", strings.NewReader(`{"kcl.stream_name":"payments"}`)))
+	assert.Equal(t, http.StatusConflict, response.Code)
+	assert.Contains(t, response.Body.String(), "kcl.stream_name can't change while the service runs")
+
+	response = httptest.NewRecorder()
+	store.ServeHTTP(response, httptest.NewRequest(http.MethodPut, "/settings", strings.NewReader(`{"runtime.batch_size":"many"}`)))
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+
+	response = httptest.NewRecorder()
+	store.ServeHTTP(response, httptest.NewRequest(http.MethodDelete, "/settings", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, response.Code)
+}
+
+func TestLogLevelFilter(t *testing.T) {
+	var output bytes.Buffer
+	filter, err := config.NewLogLevelFilter(&output, config.LogLevelWarn)
+	assert.NoError(t, err)
+
+	lines := []string{
+		"2021/05/01 12:00:00 level DEBUG msg checkpoint\n",
+		"2021/05/01 12:00:00 level INFO msg started\n",
+		"2021/05/01 12:00:00 level error msg failed\n",
+		"2021/05/01 12:00:00 publishing a new message\n",
+	}
+	for _, line := range lines {
+		_, err := filter.Write([]byte(line))
+		assert.NoError(t, err)
+	}
+
+	assert.Equal(t, lines[2]+lines[3], output.String())
+	assert.Error(t, filter.SetLevel("verbose"))
+}
+
+func writeTo(t *testing.T, filePath, content string) {
+	t.Helper()
+	if err := ioutil.WriteFile(filePath, []byte(content), 0600); err != nil {
+		t.Fatal("unexpected error writing file", err)
+	}
+}
+
+// batchHandlerCreatorMock creates a batchHandlerMock.
+type batchHandlerCreatorMock struct {
+	handler *batchHandlerMock
+}
+
+func (b *batchHandlerCreatorMock) Create() kinesis.BatchHandler {
+	b.handler = &batchHandlerMock{}
+	return b.handler
+}
+
+// batchHandlerMock records the sequence numbers of the batches it receives.
+type batchHandlerMock struct {
+	batches [][]string
+}
+
+func (b *batchHandlerMock) HandleBatch(ctx context.Context, records []kinesis.Record) error {
+	sequenceNumbers := make([]string, 0, len(records))
+	for _, v := range records {
+		sequenceNumbers = append(sequenceNumbers, v.SequenceNumber)
+	}
+	b.batches = append(b.batches, sequenceNumbers)
+	return nil
+}
+
+// checkpointerMock accepts every checkpoint.
+type checkpointerMock struct{}
+
+func (c checkpointerMock) Checkpoint(sequenceNumber *string) error {
+	return nil
+}
+
+func (c checkpointerMock) PrepareCheckpoint(sequenceNumber *string) (interfaces.IPreparedCheckpointer, error) {
+	return nil, nil
+}
+
+// newProcessRecordsInput returns records whose data is a json document with the sequence number as key.
+func newProcessRecordsInput(sequenceNumbers ...string) *interfaces.ProcessRecordsInput {
+	now := time.Now()
+	input := interfaces.ProcessRecordsInput{
+		CacheEntryTime: &now,
+		CacheExitTime:  &now,
+		Checkpointer:   checkpointerMock{},
+	}
+	for _, v := range sequenceNumbers {
+		input.Records = append(input.Records, &awskinesis.Record{
+			Data:           []byte(`{"key": "` + v + `"}`),
+			PartitionKey:   aws.String("partition-" + v),
+			SequenceNumber: aws.String(v),
+		})
+	}
+	return &input
+}
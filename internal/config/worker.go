@@ -0,0 +1,68 @@
+package config
+
+import (
+	awsadapter "github.com/fernandoocampo/pubsub-kinesis/internal/adapter/aws"
+	"github.com/fernandoocampo/pubsub-kinesis/internal/adapter/checkpointstore"
+	"github.com/fernandoocampo/pubsub-kinesis/internal/adapter/dynamodb"
+	"github.com/fernandoocampo/pubsub-kinesis/internal/adapter/kinesis"
+)
+
+// NewKCLWorkerFactory creates the kcl worker factory of the kcl section. Its workers use kinesis and
+// dynamodb clients with the http and retry settings of the aws section, and the kcl endpoints and credentials.
+// They keep their leases and checkpoints in the store of the checkpoint section, and with the dynamodb
+// store they provision the lease table of the lease_table section before they start when it is enabled.
+// The returned function closes the checkpoint store, call it once the workers are stopped.
+func (c Configuration) NewKCLWorkerFactory() (*kinesis.StandardKCLWorkerFactory, func() error, error) {
+	kinesisConfiguration := c.AWS
+	kinesisConfiguration.Region = c.KCL.RegionName
+	kinesisConfiguration.KinesisEndpoint = c.KCL.KinesisEndpoint
+	if c.KCL.KinesisCredentials != nil {
+		kinesisConfiguration.Credentials = c.KCL.KinesisCredentials
+		kinesisConfiguration.KinesisRole = awsadapter.AssumeRoleConfiguration{}
+	}
+	kinesisSession, err := awsadapter.NewKinesisSession(kinesisConfiguration)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dynamoDBConfiguration := c.AWS
+	dynamoDBConfiguration.Region = c.KCL.RegionName
+	dynamoDBConfiguration.DynamoDBEndpoint = c.KCL.DynamoDBEndpoint
+	if c.KCL.DynamoDBCredentials != nil {
+		dynamoDBConfiguration.Credentials = c.KCL.DynamoDBCredentials
+		dynamoDBConfiguration.DynamoDBRole = awsadapter.AssumeRoleConfiguration{}
+	}
+	dynamoDBSession, err := awsadapter.NewDynamoDBSession(dynamoDBConfiguration)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	options := []kinesis.WorkerFactoryOption{
+		kinesis.WithKinesisClient(awsadapter.NewKinesisClient(kinesisSession)),
+		kinesis.WithDynamoDBClient(awsadapter.NewDynamoDBClient(dynamoDBSession)),
+	}
+	store, err := checkpointstore.Open(c.Checkpoint)
+	if err != nil {
+		return nil, nil, err
+	}
+	closeStore := func() error {
+		return nil
+	}
+	if store != nil {
+		options = append(options, kinesis.WithCheckpointerFactory(checkpointstore.CheckpointerFactory(store)))
+		closeStore = store.Close
+	} else if c.LeaseTable.Provision {
+		settings, err := c.LeaseTableSettings()
+		if err != nil {
+			return nil, nil, err
+		}
+		options = append(options, kinesis.WithLeaseTableProvisioner(dynamodb.NewClient(dynamoDBSession).LeaseTableProvisioner(settings)))
+	}
+
+	workerFactory, err := kinesis.NewKCLWorkerFactory(c.KCL, options...)
+	if err != nil {
+		_ = closeStore()
+		return nil, nil, err
+	}
+	return workerFactory, closeStore, nil
+}
@@ -0,0 +1,170 @@
+package config_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fernandoocampo/pubsub-kinesis/internal/adapter/checkpointstore"
+	"github.com/fernandoocampo/pubsub-kinesis/internal/adapter/kinesis"
+	"github.com/fernandoocampo/pubsub-kinesis/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKCLWorkerFactoryUsesRetrySettings(t *testing.T) {
+	var mutex sync.Mutex
+	var operations []string
+	dynamoDB := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		operations = append(operations, strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "DynamoDB_20120810."))
+		mutex.Unlock()
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer dynamoDB.Close()
+	env := map[string]string{
+		"PUBSUB_KCL_APPLICATION_NAME":                       "orders-consumer",
+		"PUBSUB_KCL_STREAM_NAME":                            "orders",
+		"PUBSUB_KCL_DYNAMO_DB_ENDPOINT":                     dynamoDB.URL,
+		"PUBSUB_AWS_CREDENTIALS_PROVIDER_ACCESS_KEY_ID":     "AKIAEXAMPLE",
+		"PUBSUB_AWS_CREDENTIALS_PROVIDER_SECRET_ACCESS_KEY": "very-secret",
+		"PUBSUB_AWS_RETRY_MAX_RETRIES":                      "0",
+	}
+	loaded, err := config.NewLoader().WithLookupEnv(lookupEnv(env)).Load()
+	assert.NoError(t, err)
+
+	workerFactory, closeStore, err := loaded.NewKCLWorkerFactory()
+	assert.NoError(t, err)
+	defer closeStore()
+	worker := workerFactory.NewWorker(kinesis.NewBatchRecordProcessorFactory(nil))
+	err = worker.Start()
+
+	assert.Error(t, err)
+	assert.Equal(t, []string{"DescribeTable", "CreateTable"}, operations)
+}
+
+func TestKCLWorkerFactoryProvisionsLeaseTable(t *testing.T) {
+	var mutex sync.Mutex
+	var operations []string
+	var billingMode string
+	dynamoDB := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		operation := strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "DynamoDB_20120810.")
+		operations = append(operations, operation)
+		switch {
+		case len(operations) == 1:
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"__type": "com.amazonaws.dynamodb.v20120810#ResourceNotFoundException", "message": "table not found"}`)
+		case len(operations) == 2:
+			var input struct{ BillingMode string }
+			_ = json.NewDecoder(r.Body).Decode(&input)
+			billingMode = input.BillingMode
+			fmt.Fprint(w, `{}`)
+		case len(operations) == 3:
+			fmt.Fprint(w, `{"Table": {"TableName": "orders-consumer", "TableStatus": "ACTIVE"}}`)
+		default:
+			// the worker stops starting once the table is provisioned.
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer dynamoDB.Close()
+	env := map[string]string{
+		"PUBSUB_KCL_APPLICATION_NAME":                       "orders-consumer",
+		"PUBSUB_KCL_STREAM_NAME":                            "orders",
+		"PUBSUB_KCL_DYNAMO_DB_ENDPOINT":                     dynamoDB.URL,
+		"PUBSUB_AWS_CREDENTIALS_PROVIDER_ACCESS_KEY_ID":     "AKIAEXAMPLE",
+		"PUBSUB_AWS_CREDENTIALS_PROVIDER_SECRET_ACCESS_KEY": "very-secret",
+		"PUBSUB_AWS_RETRY_MAX_RETRIES":                      "0",
+		"PUBSUB_LEASE_TABLE_PROVISION":                      "true",
+		"PUBSUB_LEASE_TABLE_BILLING_MODE":                   "PAY_PER_REQUEST",
+	}
+	loaded, err := config.NewLoader().WithLookupEnv(lookupEnv(env)).Load()
+	assert.NoError(t, err)
+
+	workerFactory, closeStore, err := loaded.NewKCLWorkerFactory()
+	assert.NoError(t, err)
+	defer closeStore()
+	worker := workerFactory.NewWorker(kinesis.NewBatchRecordProcessorFactory(nil))
+	err = worker.Start()
+
+	assert.Error(t, err)
+	assert.Equal(t, []string{"DescribeTable", "CreateTable", "DescribeTable"}, operations[:3])
+	assert.Equal(t, "PAY_PER_REQUEST", billingMode)
+}
+
+func TestKCLWorkerFactoryUsesCheckpointStore(t *testing.T) {
+	var mutex sync.Mutex
+	var dynamoDBOperations []string
+	dynamoDB := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		dynamoDBOperations = append(dynamoDBOperations, r.Header.Get("X-Amz-Target"))
+		mutex.Unlock()
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer dynamoDB.Close()
+	shardConsumed := make(chan struct{})
+	var once sync.Once
+	kinesisServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Amz-Target") == "Kinesis_20131202.ListShards" {
+			fmt.Fprint(w, `{"Shards": [{"ShardId": "shardId-000000000000", "SequenceNumberRange": {"StartingSequenceNumber": "1"}}]}`)
+			return
+		}
+		// the shard consumer only reads the shard once its lease is acquired.
+		once.Do(func() { close(shardConsumed) })
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer kinesisServer.Close()
+	filePath := filepath.Join(t.TempDir(), "leases.db")
+	env := map[string]string{
+		"PUBSUB_KCL_APPLICATION_NAME":                       "orders-consumer",
+		"PUBSUB_KCL_STREAM_NAME":                            "orders",
+		"PUBSUB_KCL_WORKER_ID":                              "worker-1",
+		"PUBSUB_KCL_KINESIS_ENDPOINT":                       kinesisServer.URL,
+		"PUBSUB_KCL_DYNAMO_DB_ENDPOINT":                     dynamoDB.URL,
+		"PUBSUB_AWS_CREDENTIALS_PROVIDER_ACCESS_KEY_ID":     "AKIAEXAMPLE",
+		"PUBSUB_AWS_CREDENTIALS_PROVIDER_SECRET_ACCESS_KEY": "very-secret",
+		"PUBSUB_AWS_RETRY_MAX_RETRIES":                      "0",
+		"PUBSUB_CHECKPOINT_KIND":                            "file",
+		"PUBSUB_CHECKPOINT_FILE_PATH":                       filePath,
+		"PUBSUB_LEASE_TABLE_PROVISION":                      "true",
+	}
+	loaded, err := config.NewLoader().WithLookupEnv(lookupEnv(env)).Load()
+	assert.NoError(t, err)
+
+	workerFactory, closeStore, err := loaded.NewKCLWorkerFactory()
+	assert.NoError(t, err)
+	worker := workerFactory.NewWorker(kinesis.NewRecordProcessorFactory(kinesis.NewRouter(kinesis.HeaderEventType("type"))))
+	err = worker.Start()
+	assert.NoError(t, err)
+	select {
+	case <-shardConsumed:
+	case <-time.After(10 * time.Second):
+		t.Error("the worker didn't acquire the lease of the shard")
+	}
+	worker.Shutdown()
+	assert.NoError(t, closeStore())
+
+	store, err := checkpointstore.OpenFileStore(filePath)
+	assert.NoError(t, err)
+	defer store.Close()
+	leases, err := store.ListLeases("orders-consumer")
+	assert.NoError(t, err)
+	assert.Len(t, leases, 1)
+	assert.Equal(t, "shardId-000000000000", leases[0].ShardID)
+	assert.Empty(t, dynamoDBOperations)
+}
+
+func TestKCLWorkerFactoryRejectsInvalidConfiguration(t *testing.T) {
+	configuration := config.Default()
+
+	workerFactory, _, err := configuration.NewKCLWorkerFactory()
+
+	assert.Error(t, err)
+	assert.Nil(t, workerFactory)
+}